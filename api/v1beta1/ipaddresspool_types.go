@@ -33,6 +33,218 @@ type IPAddressPoolSpec struct {
 	// +optional
 	// +kubebuilder:default:=true
 	AutoAssign *bool `json:"autoAssign,omitempty"`
+
+	// AutodetectIPv6 adds to the pool an IPv6 range computed from the
+	// IPv6 PodCIDRs of the nodes: the prefix following the one covering
+	// them all. The range follows the changes of the PodCIDRs, and can't
+	// be combined with AutoSplit.
+	// +optional
+	AutodetectIPv6 bool `json:"autodetectIPv6,omitempty"`
+
+	// AutoSplit makes MetalLB split the address ranges of the pool into
+	// smaller sub-ranges of AutoSplitSize addresses each, which keeps the
+	// allocation scan short for large pools.
+	// +optional
+	AutoSplit bool `json:"autoSplit,omitempty"`
+
+	// AutoSplitSize is the number of addresses in each sub-range when
+	// AutoSplit is enabled. Must be a power of two. Defaults to 256.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	AutoSplitSize int `json:"autoSplitSize,omitempty"`
+
+	// MaxPendingAllocations is the maximum number of services that can
+	// wait for an IP from this pool. The services failing to get an IP
+	// when the limit is reached are rejected instead of waiting, including
+	// the services not requesting a pool if AutoAssign is set. Zero means
+	// unlimited.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	MaxPendingAllocations int `json:"maxPendingAllocations,omitempty"`
+
+	// ReservedBoundaryIPs is the number of addresses at the beginning and
+	// at the end of each CIDR of the pool that are never allocated, e.g.
+	// 2 keeps the network, gateway, secondary gateway and broadcast
+	// addresses of a /24 out of the allocation.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	ReservedBoundaryIPs int `json:"reservedBoundaryIPs,omitempty"`
+
+	// AvoidBuggyIPs prevents the addresses ending in .0 and .255 from
+	// being allocated, since some clients and routers mishandle them
+	// as network or broadcast addresses. For IPv6, the addresses with
+	// an all zeros interface identifier are avoided.
+	// +optional
+	AvoidBuggyIPs bool `json:"avoidBuggyIPs,omitempty"`
+
+	// ReservationMode splits the addresses of the pool between the
+	// services annotated with metallb.universe.tf/priority: high and the
+	// others. With reserved-first, the high priority services are
+	// allocated from the beginning of the ranges and the others from the
+	// end, reserved-last is the opposite.
+	// +optional
+	// +kubebuilder:validation:Enum=reserved-first;reserved-last
+	ReservationMode string `json:"reservationMode,omitempty"`
+
+	// AllocationStrategy is how the IP of a service is picked among the
+	// free ones of the pool: sequential (the default) takes the first,
+	// random picks one at random, round-robin takes the one following
+	// the last allocated, least-recently-used prefers the addresses
+	// never used, then the ones released the longest ago, and hashed
+	// takes the one at the offset of the hash of the service key, so a
+	// service tends to get the same IP when it is created again. It
+	// can't be combined with a ReservationMode.
+	// +optional
+	// +kubebuilder:validation:Enum=sequential;random;round-robin;least-recently-used;hashed
+	AllocationStrategy string `json:"allocationStrategy,omitempty"`
+
+	// GenerationPlugin is the name of a plugin, built into the
+	// controller, picking the IP of a service instead of the
+	// AllocationStrategy. It can't be combined with a ReservationMode or
+	// an AllocationStrategy other than sequential. The sequential plugin
+	// is always available.
+	// +optional
+	GenerationPlugin string `json:"generationPlugin,omitempty"`
+
+	// EmergencyReservePercent is the percentage of the addresses of the
+	// pool kept for the services annotated with
+	// metallb.universe.tf/priority: high or metallb.universe.tf/emergency:
+	// "true". The other services can't get an address once only the
+	// reserve is left.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=100
+	EmergencyReservePercent int `json:"emergencyReservePercent,omitempty"`
+
+	// MaxIPAgeHours raises a StaleIPAllocation warning event on the
+	// services holding an IP of the pool for longer than this many
+	// hours. Zero disables the check.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	MaxIPAgeHours int `json:"maxIPAgeHours,omitempty"`
+
+	// ForceRecycle releases the IPs older than MaxIPAgeHours and
+	// allocates the services again, instead of only warning.
+	// +optional
+	ForceRecycle bool `json:"forceRecycle,omitempty"`
+
+	// MultiPathL2 makes all the eligible nodes announce the IPs of the
+	// pool via L2, instead of the elected one only. How the traffic is
+	// spread between the nodes depends on the switches.
+	// +optional
+	MultiPathL2 bool `json:"multiPathL2,omitempty"`
+
+	// Hybrid makes the IPs of the pool announced via BGP only from the
+	// node announcing them via L2, which becomes the next hop of the
+	// routes. The pool needs both L2 and BGP advertisements.
+	// +optional
+	Hybrid bool `json:"hybrid,omitempty"`
+
+	// AnnouncementOrder is the order in which the IPs of an hybrid pool
+	// are announced: simultaneous (the default), bgp-first, which gives
+	// the routers the time to learn the route before the node answers
+	// ARP / NDP requests, or l2-first.
+	// +optional
+	// +kubebuilder:validation:Enum=simultaneous;bgp-first;l2-first
+	AnnouncementOrder string `json:"announcementOrder,omitempty"`
+
+	// BGPSettleTime is how long to wait after the first announcement
+	// before the second one, when the AnnouncementOrder is not
+	// simultaneous. Defaults to 1s.
+	// +optional
+	BGPSettleTime *metav1.Duration `json:"bgpSettleTime,omitempty"`
+
+	// AnnouncementTimeout releases the IPs of the pool assigned to a
+	// service if no speaker announces them within this delay, so that
+	// the service is allocated again. Requires the controller to watch
+	// the announcements. Zero disables it.
+	// +optional
+	AnnouncementTimeout *metav1.Duration `json:"announcementTimeout,omitempty"`
+
+	// ServiceAnnotations are added to the services getting an IP from
+	// the pool, with the metallb.universe.tf/pool- prefix, so the pool
+	// of a service can be found by inspecting it. For example, team: infra
+	// is added as metallb.universe.tf/pool-team: infra.
+	// +optional
+	ServiceAnnotations map[string]string `json:"serviceAnnotations,omitempty"`
+
+	// AllocationHook is an external HTTP service asked to approve each
+	// IP allocated from the pool before it is assigned to the service.
+	// +optional
+	AllocationHook *AllocationHook `json:"allocationHook,omitempty"`
+
+	// FailoverGroup offers the IPs of a backup pool to the services
+	// that can't get an IP from this pool when the failover condition
+	// is met.
+	// +optional
+	FailoverGroup *FailoverGroupSpec `json:"failoverGroup,omitempty"`
+
+	// ServiceAllocation restricts the services the pool gives IPs to.
+	// Any service can get an IP from the pool if not set.
+	// +optional
+	ServiceAllocation *ServiceAllocation `json:"serviceAllocation,omitempty"`
+}
+
+// ServiceAllocation defines the services a pool gives IPs to.
+type ServiceAllocation struct {
+	// Namespaces whose services can get IPs from the pool.
+	// +optional
+	Namespaces []string `json:"namespaces,omitempty"`
+
+	// NamespaceSelectors select the namespaces whose services can get
+	// IPs from the pool, in addition to Namespaces.
+	// +optional
+	NamespaceSelectors []metav1.LabelSelector `json:"namespaceSelectors,omitempty"`
+
+	// ServiceSelectors select the services that can get IPs from the
+	// pool by their labels. A service must match one of them when set.
+	// +optional
+	ServiceSelectors []metav1.LabelSelector `json:"serviceSelectors,omitempty"`
+
+	// Priority of the pool when the IPs of a service are assigned
+	// automatically. The pools with the lowest priority are tried first,
+	// and those without priority last. The pools of the same priority
+	// are tried in the order of their names.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	Priority int `json:"priority,omitempty"`
+}
+
+// AllocationHook is an external HTTP service approving the IPs
+// allocated from a pool.
+type AllocationHook struct {
+	// URL the allocations are POSTed to.
+	// +kubebuilder:validation:Pattern=`^https?://`
+	URL string `json:"url"`
+
+	// Timeout of the requests to the hook. Defaults to 5s.
+	// +optional
+	Timeout metav1.Duration `json:"timeout,omitempty"`
+
+	// FailOpen makes the allocation proceed when the hook can't be
+	// reached or fails, instead of being rejected.
+	// +optional
+	FailOpen bool `json:"failOpen,omitempty"`
+}
+
+// FailoverGroupSpec is the backup pool of a pool, and the condition
+// activating it.
+type FailoverGroupSpec struct {
+	// BackupPool is the name of the pool whose IPs are offered during
+	// the failover. Its IPs can be announced via different BGP peers or
+	// VLANs by selecting it in the advertisements.
+	BackupPool string `json:"backupPool"`
+
+	// FailoverCondition activates the failover: pool-exhausted when the
+	// pool has no IP left, pool-degraded when its IPs are not announced
+	// within its announcementTimeout, manual when Active is set.
+	// +kubebuilder:validation:Enum=pool-exhausted;pool-degraded;manual
+	FailoverCondition string `json:"failoverCondition"`
+
+	// Active activates the failover when the FailoverCondition is
+	// manual.
+	// +optional
+	Active bool `json:"active,omitempty"`
 }
 
 // IPAddressPoolStatus defines the observed state of IPAddressPool.
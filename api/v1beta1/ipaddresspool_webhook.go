@@ -17,10 +17,15 @@ limitations under the License.
 package v1beta1
 
 import (
+	"bytes"
 	"context"
+	"fmt"
+	"net"
+	"strings"
 
 	"github.com/go-kit/log/level"
 	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -78,6 +83,14 @@ func (ipAddress *IPAddressPool) ValidateUpdate(old runtime.Object) error {
 		level.Error(Logger).Log("webhook", "ipAddress", "action", "update", "name", ipAddress.Name, "namespace", ipAddress.Namespace, "error", err)
 		return err
 	}
+
+	if oldPool, ok := old.(*IPAddressPool); ok {
+		err = validateNoOrphanedIPs(oldPool, ipAddress)
+		if err != nil {
+			level.Error(Logger).Log("webhook", "ipAddress", "action", "update", "name", ipAddress.Name, "namespace", ipAddress.Namespace, "error", err)
+			return err
+		}
+	}
 	return nil
 }
 
@@ -95,6 +108,65 @@ var getExistingIPAddressPools = func() (*IPAddressPoolList, error) {
 	return existingIPAddressPoolList, nil
 }
 
+var getExistingServices = func() (*v1.ServiceList, error) {
+	existingServiceList := &v1.ServiceList{}
+	err := WebhookClient.List(context.Background(), existingServiceList)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to get existing Service objects")
+	}
+	return existingServiceList, nil
+}
+
+// validateNoOrphanedIPs rejects an update of the pool removing
+// addresses that are still assigned to services.
+func validateNoOrphanedIPs(old, updated *IPAddressPool) error {
+	services, err := getExistingServices()
+	if err != nil {
+		return err
+	}
+	var orphaned []string
+	for _, svc := range services.Items {
+		for _, ingress := range svc.Status.LoadBalancer.Ingress {
+			ip := net.ParseIP(ingress.IP)
+			if ip == nil {
+				continue
+			}
+			if addressesContain(old.Spec.Addresses, ip) && !addressesContain(updated.Spec.Addresses, ip) {
+				orphaned = append(orphaned, fmt.Sprintf("%s/%s (%s)", svc.Namespace, svc.Name, ip))
+			}
+		}
+	}
+	if len(orphaned) > 0 {
+		return fmt.Errorf("pool %s can't drop the addresses still assigned to the services %s", updated.Name, strings.Join(orphaned, ", "))
+	}
+	return nil
+}
+
+// addressesContain returns true if ip belongs to one of the CIDRs or
+// ranges of addresses.
+func addressesContain(addresses []string, ip net.IP) bool {
+	for _, a := range addresses {
+		if _, cidr, err := net.ParseCIDR(a); err == nil {
+			if cidr.Contains(ip) {
+				return true
+			}
+			continue
+		}
+		fs := strings.SplitN(a, "-", 2)
+		if len(fs) != 2 {
+			continue
+		}
+		start, end := net.ParseIP(strings.TrimSpace(fs[0])), net.ParseIP(strings.TrimSpace(fs[1]))
+		if start == nil || end == nil {
+			continue
+		}
+		if bytes.Compare(ip.To16(), start.To16()) >= 0 && bytes.Compare(ip.To16(), end.To16()) <= 0 {
+			return true
+		}
+	}
+	return false
+}
+
 func ipAddressListWithUpdate(existing *IPAddressPoolList, toAdd *IPAddressPool) *IPAddressPoolList {
 	res := existing.DeepCopy()
 	for i, item := range res.Items { // We override the element with the fresh copy
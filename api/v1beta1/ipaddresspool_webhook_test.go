@@ -7,6 +7,7 @@ import (
 
 	"github.com/go-kit/log"
 	"github.com/google/go-cmp/cmp"
+	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -132,3 +133,98 @@ func TestValidateIPAddressPool(t *testing.T) {
 		}
 	}
 }
+
+func TestValidateIPAddressPoolOrphanedIPs(t *testing.T) {
+	Logger = log.NewNopLogger()
+	Validator = &mockValidator{}
+
+	toRestoreAddresspools := getExistingAddressPools
+	getExistingAddressPools = func() (*AddressPoolList, error) {
+		return &AddressPoolList{}, nil
+	}
+	toRestoreIPAddressPools := getExistingIPAddressPools
+	getExistingIPAddressPools = func() (*IPAddressPoolList, error) {
+		return &IPAddressPoolList{}, nil
+	}
+	toRestoreServices := getExistingServices
+	getExistingServices = func() (*v1.ServiceList, error) {
+		return &v1.ServiceList{
+			Items: []v1.Service{
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "svc1", Namespace: "ns"},
+					Status: v1.ServiceStatus{
+						LoadBalancer: v1.LoadBalancerStatus{
+							Ingress: []v1.LoadBalancerIngress{{IP: "10.20.0.10"}},
+						},
+					},
+				},
+			},
+		}, nil
+	}
+
+	defer func() {
+		getExistingAddressPools = toRestoreAddresspools
+		getExistingIPAddressPools = toRestoreIPAddressPools
+		getExistingServices = toRestoreServices
+	}()
+
+	pool := func(addresses ...string) *IPAddressPool {
+		return &IPAddressPool{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "test-ippool",
+				Namespace: MetalLBTestNameSpace,
+			},
+			Spec: IPAddressPoolSpec{Addresses: addresses},
+		}
+	}
+
+	tests := []struct {
+		desc         string
+		old          *IPAddressPool
+		updated      *IPAddressPool
+		failValidate bool
+	}{
+		{
+			desc:    "Pool growing",
+			old:     pool("10.20.0.0/24"),
+			updated: pool("10.20.0.0/23"),
+		},
+		{
+			desc:    "Pool shrinking, keeping the assigned IP",
+			old:     pool("10.20.0.0/24"),
+			updated: pool("10.20.0.0/28"),
+		},
+		{
+			desc:    "Pool shrinking, keeping the assigned IP in a range",
+			old:     pool("10.20.0.0/24"),
+			updated: pool("10.20.0.5-10.20.0.10"),
+		},
+		{
+			desc:         "Pool dropping the assigned IP",
+			old:          pool("10.20.0.0/24"),
+			updated:      pool("10.20.0.0/29"),
+			failValidate: true,
+		},
+		{
+			desc:         "Pool range dropping the assigned IP",
+			old:          pool("10.20.0.1-10.20.0.20"),
+			updated:      pool("10.20.0.1-10.20.0.9"),
+			failValidate: true,
+		},
+		{
+			desc:    "Pool not containing the assigned IP",
+			old:     pool("10.30.0.0/24"),
+			updated: pool("10.30.0.0/28"),
+		},
+	}
+
+	for _, test := range tests {
+		err := test.updated.ValidateUpdate(test.old)
+		if test.failValidate && err == nil {
+			t.Fatalf("test %s failed, expecting error", test.desc)
+		}
+		if !test.failValidate && err != nil {
+			t.Fatalf("test %s failed, unexpected error %s", test.desc, err)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// NamespaceIPQuotaSpec defines the desired state of NamespaceIPQuota.
+type NamespaceIPQuotaSpec struct {
+	// Namespace is the namespace of the services the quota applies to.
+	Namespace string `json:"namespace"`
+
+	// Pool is the name of the IPAddressPool the quota applies to.
+	Pool string `json:"pool"`
+
+	// MaxIPs is the maximum number of IPs services in the namespace
+	// can take from the pool. Zero means no limit.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	MaxIPs int `json:"maxIPs,omitempty"`
+
+	// MaxIPsPerService is the maximum number of IPs a single service
+	// in the namespace can take from the pool. Zero means no limit.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	MaxIPsPerService int `json:"maxIPsPerService,omitempty"`
+}
+
+// NamespaceIPQuotaStatus defines the observed state of NamespaceIPQuota.
+type NamespaceIPQuotaStatus struct {
+	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
+	// Important: Run "make" to regenerate code after modifying this file
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+
+// NamespaceIPQuota limits how many IPs the services of a namespace
+// can be assigned from a given IPAddressPool.
+type NamespaceIPQuota struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   NamespaceIPQuotaSpec   `json:"spec,omitempty"`
+	Status NamespaceIPQuotaStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// NamespaceIPQuotaList contains a list of NamespaceIPQuota.
+type NamespaceIPQuotaList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []NamespaceIPQuota `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&NamespaceIPQuota{}, &NamespaceIPQuotaList{})
+}
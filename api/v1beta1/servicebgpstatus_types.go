@@ -0,0 +1,71 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ServiceBGPStatusSpec defines the desired state of ServiceBGPStatus.
+type ServiceBGPStatusSpec struct {
+}
+
+// MetalLBServiceBGPStatus defines the observed state of ServiceBGPStatus.
+type MetalLBServiceBGPStatus struct {
+	// Node is the node announcing the service.
+	Node string `json:"node,omitempty"`
+
+	// ServiceName is the name of the announced service.
+	ServiceName string `json:"serviceName,omitempty"`
+
+	// ServiceNamespace is the namespace of the announced service.
+	ServiceNamespace string `json:"serviceNamespace,omitempty"`
+
+	// Peers are the names of the BGPPeers the IPs of the service are
+	// advertised to.
+	// +optional
+	Peers []string `json:"peers,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Node",type=string,JSONPath=`.status.node`
+// +kubebuilder:printcolumn:name="Service Name",type=string,JSONPath=`.status.serviceName`
+// +kubebuilder:printcolumn:name="Service Namespace",type=string,JSONPath=`.status.serviceNamespace`
+
+// ServiceBGPStatus records that a node announces a service via BGP. It
+// is written by the speakers.
+type ServiceBGPStatus struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ServiceBGPStatusSpec    `json:"spec,omitempty"`
+	Status MetalLBServiceBGPStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// ServiceBGPStatusList contains a list of ServiceBGPStatus.
+type ServiceBGPStatusList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ServiceBGPStatus `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ServiceBGPStatus{}, &ServiceBGPStatusList{})
+}
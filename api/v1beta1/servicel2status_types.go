@@ -0,0 +1,77 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ServiceL2StatusSpec defines the desired state of ServiceL2Status.
+type ServiceL2StatusSpec struct {
+}
+
+// MetalLBServiceL2Status defines the observed state of ServiceL2Status.
+type MetalLBServiceL2Status struct {
+	// Node is the node announcing the service.
+	Node string `json:"node,omitempty"`
+
+	// ServiceName is the name of the announced service.
+	ServiceName string `json:"serviceName,omitempty"`
+
+	// ServiceNamespace is the namespace of the announced service.
+	ServiceNamespace string `json:"serviceNamespace,omitempty"`
+
+	// Interfaces are the interfaces of the node answering the ARP and
+	// NDP requests for the IPs of the service.
+	// +optional
+	Interfaces []InterfaceInfo `json:"interfaces,omitempty"`
+}
+
+// InterfaceInfo defines an interface of a node.
+type InterfaceInfo struct {
+	// Name of the interface.
+	Name string `json:"name,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Node",type=string,JSONPath=`.status.node`
+// +kubebuilder:printcolumn:name="Service Name",type=string,JSONPath=`.status.serviceName`
+// +kubebuilder:printcolumn:name="Service Namespace",type=string,JSONPath=`.status.serviceNamespace`
+
+// ServiceL2Status records that a node announces a service in layer 2.
+// It is written by the speakers.
+type ServiceL2Status struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ServiceL2StatusSpec    `json:"spec,omitempty"`
+	Status MetalLBServiceL2Status `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// ServiceL2StatusList contains a list of ServiceL2Status.
+type ServiceL2StatusList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ServiceL2Status `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ServiceL2Status{}, &ServiceL2StatusList{})
+}
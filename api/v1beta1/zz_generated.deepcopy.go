@@ -8,6 +8,7 @@
 package v1beta1
 
 import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 )
 
@@ -117,6 +118,22 @@ func (in *AddressPoolStatus) DeepCopy() *AddressPoolStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AllocationHook) DeepCopyInto(out *AllocationHook) {
+	*out = *in
+	out.Timeout = in.Timeout
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AllocationHook.
+func (in *AllocationHook) DeepCopy() *AllocationHook {
+	if in == nil {
+		return nil
+	}
+	out := new(AllocationHook)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *BFDProfile) DeepCopyInto(out *BFDProfile) {
 	*out = *in
@@ -453,6 +470,21 @@ func (in *BGPPeerStatus) DeepCopy() *BGPPeerStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FailoverGroupSpec) DeepCopyInto(out *FailoverGroupSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FailoverGroupSpec.
+func (in *FailoverGroupSpec) DeepCopy() *FailoverGroupSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(FailoverGroupSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *IPAddressPool) DeepCopyInto(out *IPAddressPool) {
 	*out = *in
@@ -525,6 +557,38 @@ func (in *IPAddressPoolSpec) DeepCopyInto(out *IPAddressPoolSpec) {
 		*out = new(bool)
 		**out = **in
 	}
+	if in.BGPSettleTime != nil {
+		in, out := &in.BGPSettleTime, &out.BGPSettleTime
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.AnnouncementTimeout != nil {
+		in, out := &in.AnnouncementTimeout, &out.AnnouncementTimeout
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.ServiceAnnotations != nil {
+		in, out := &in.ServiceAnnotations, &out.ServiceAnnotations
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.AllocationHook != nil {
+		in, out := &in.AllocationHook, &out.AllocationHook
+		*out = new(AllocationHook)
+		**out = **in
+	}
+	if in.FailoverGroup != nil {
+		in, out := &in.FailoverGroup, &out.FailoverGroup
+		*out = new(FailoverGroupSpec)
+		**out = **in
+	}
+	if in.ServiceAllocation != nil {
+		in, out := &in.ServiceAllocation, &out.ServiceAllocation
+		*out = new(ServiceAllocation)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IPAddressPoolSpec.
@@ -552,6 +616,21 @@ func (in *IPAddressPoolStatus) DeepCopy() *IPAddressPoolStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *InterfaceInfo) DeepCopyInto(out *InterfaceInfo) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InterfaceInfo.
+func (in *InterfaceInfo) DeepCopy() *InterfaceInfo {
+	if in == nil {
+		return nil
+	}
+	out := new(InterfaceInfo)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *L2Advertisement) DeepCopyInto(out *L2Advertisement) {
 	*out = *in
@@ -696,6 +775,135 @@ func (in *MatchExpression) DeepCopy() *MatchExpression {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MetalLBServiceBGPStatus) DeepCopyInto(out *MetalLBServiceBGPStatus) {
+	*out = *in
+	if in.Peers != nil {
+		in, out := &in.Peers, &out.Peers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MetalLBServiceBGPStatus.
+func (in *MetalLBServiceBGPStatus) DeepCopy() *MetalLBServiceBGPStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(MetalLBServiceBGPStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MetalLBServiceL2Status) DeepCopyInto(out *MetalLBServiceL2Status) {
+	*out = *in
+	if in.Interfaces != nil {
+		in, out := &in.Interfaces, &out.Interfaces
+		*out = make([]InterfaceInfo, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MetalLBServiceL2Status.
+func (in *MetalLBServiceL2Status) DeepCopy() *MetalLBServiceL2Status {
+	if in == nil {
+		return nil
+	}
+	out := new(MetalLBServiceL2Status)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NamespaceIPQuota) DeepCopyInto(out *NamespaceIPQuota) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	out.Spec = in.Spec
+	out.Status = in.Status
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NamespaceIPQuota.
+func (in *NamespaceIPQuota) DeepCopy() *NamespaceIPQuota {
+	if in == nil {
+		return nil
+	}
+	out := new(NamespaceIPQuota)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *NamespaceIPQuota) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NamespaceIPQuotaList) DeepCopyInto(out *NamespaceIPQuotaList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]NamespaceIPQuota, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NamespaceIPQuotaList.
+func (in *NamespaceIPQuotaList) DeepCopy() *NamespaceIPQuotaList {
+	if in == nil {
+		return nil
+	}
+	out := new(NamespaceIPQuotaList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *NamespaceIPQuotaList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NamespaceIPQuotaSpec) DeepCopyInto(out *NamespaceIPQuotaSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NamespaceIPQuotaSpec.
+func (in *NamespaceIPQuotaSpec) DeepCopy() *NamespaceIPQuotaSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(NamespaceIPQuotaSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NamespaceIPQuotaStatus) DeepCopyInto(out *NamespaceIPQuotaStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NamespaceIPQuotaStatus.
+func (in *NamespaceIPQuotaStatus) DeepCopy() *NamespaceIPQuotaStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(NamespaceIPQuotaStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *NodeSelector) DeepCopyInto(out *NodeSelector) {
 	*out = *in
@@ -725,6 +933,188 @@ func (in *NodeSelector) DeepCopy() *NodeSelector {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ServiceAllocation) DeepCopyInto(out *ServiceAllocation) {
+	*out = *in
+	if in.Namespaces != nil {
+		in, out := &in.Namespaces, &out.Namespaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.NamespaceSelectors != nil {
+		in, out := &in.NamespaceSelectors, &out.NamespaceSelectors
+		*out = make([]v1.LabelSelector, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.ServiceSelectors != nil {
+		in, out := &in.ServiceSelectors, &out.ServiceSelectors
+		*out = make([]v1.LabelSelector, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ServiceAllocation.
+func (in *ServiceAllocation) DeepCopy() *ServiceAllocation {
+	if in == nil {
+		return nil
+	}
+	out := new(ServiceAllocation)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ServiceBGPStatus) DeepCopyInto(out *ServiceBGPStatus) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	out.Spec = in.Spec
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ServiceBGPStatus.
+func (in *ServiceBGPStatus) DeepCopy() *ServiceBGPStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ServiceBGPStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ServiceBGPStatus) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ServiceBGPStatusList) DeepCopyInto(out *ServiceBGPStatusList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ServiceBGPStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ServiceBGPStatusList.
+func (in *ServiceBGPStatusList) DeepCopy() *ServiceBGPStatusList {
+	if in == nil {
+		return nil
+	}
+	out := new(ServiceBGPStatusList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ServiceBGPStatusList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ServiceBGPStatusSpec) DeepCopyInto(out *ServiceBGPStatusSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ServiceBGPStatusSpec.
+func (in *ServiceBGPStatusSpec) DeepCopy() *ServiceBGPStatusSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ServiceBGPStatusSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ServiceL2Status) DeepCopyInto(out *ServiceL2Status) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	out.Spec = in.Spec
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ServiceL2Status.
+func (in *ServiceL2Status) DeepCopy() *ServiceL2Status {
+	if in == nil {
+		return nil
+	}
+	out := new(ServiceL2Status)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ServiceL2Status) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ServiceL2StatusList) DeepCopyInto(out *ServiceL2StatusList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ServiceL2Status, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ServiceL2StatusList.
+func (in *ServiceL2StatusList) DeepCopy() *ServiceL2StatusList {
+	if in == nil {
+		return nil
+	}
+	out := new(ServiceL2StatusList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ServiceL2StatusList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ServiceL2StatusSpec) DeepCopyInto(out *ServiceL2StatusSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ServiceL2StatusSpec.
+func (in *ServiceL2StatusSpec) DeepCopy() *ServiceL2StatusSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ServiceL2StatusSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Community) DeepCopyInto(out *Community) {
 	*out = *in
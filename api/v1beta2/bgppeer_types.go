@@ -79,6 +79,47 @@ type BGPPeerSpec struct {
 	// To set if the BGPPeer is multi-hops away. Needed for FRR mode only.
 	// +optional
 	EBGPMultiHop bool `json:"ebgpMultiHop,omitempty"`
+
+	// If set, the graceful restart capability is negotiated with the
+	// peer, which keeps the routes while the speaker restarts instead of
+	// withdrawing them. FRR mode only.
+	// +optional
+	EnableGracefulRestart bool `json:"enableGracefulRestart,omitempty"`
+
+	// The name of the VRF device the session is established in, the
+	// routes of the services being announced into that VRF. The default
+	// VRF is used if not set. FRR mode only.
+	// +optional
+	VRFName string `json:"vrf,omitempty"`
+
+	// Time after which the session is torn down and re-established if the
+	// peer didn't send any KEEPALIVE or UPDATE message, even if the TCP
+	// connection is still up. Native mode only.
+	// +optional
+	SessionWatchdogTimeout *metav1.Duration `json:"sessionWatchdogTimeout,omitempty"`
+
+	// If set, the IPv6 /128 prefixes announced to this peer carry a BGP
+	// color extended community holding a stable per service flow label
+	// (RFC 6437), for routers to use in their ECMP hashing. FRR mode only.
+	// +optional
+	FlowLabelECMP bool `json:"flowLabelECMP,omitempty"`
+
+	// Time to wait before the first connection attempt to the peer, to
+	// spread the connections of the speakers restarting together.
+	// Native mode only.
+	// +optional
+	InitialDelay *metav1.Duration `json:"initialDelay,omitempty"`
+
+	// Upper bound of the random time added to the InitialDelay.
+	// Defaults to 5s. Native mode only.
+	// +optional
+	InitialJitter *metav1.Duration `json:"initialJitter,omitempty"`
+
+	// Expression selecting the routes announced to the peer, e.g.
+	// pool == 'prod' && community contains '64512:100'. All the routes
+	// are announced if empty.
+	// +optional
+	RoutePolicy string `json:"routePolicy,omitempty"`
 	// Add future BGP configuration here
 }
 
@@ -84,6 +84,21 @@ func (in *BGPPeerSpec) DeepCopyInto(out *BGPPeerSpec) {
 		}
 	}
 	out.PasswordSecret = in.PasswordSecret
+	if in.SessionWatchdogTimeout != nil {
+		in, out := &in.SessionWatchdogTimeout, &out.SessionWatchdogTimeout
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.InitialDelay != nil {
+		in, out := &in.InitialDelay, &out.InitialDelay
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.InitialJitter != nil {
+		in, out := &in.InitialJitter, &out.InitialJitter
+		*out = new(v1.Duration)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BGPPeerSpec.
@@ -0,0 +1,152 @@
+// SPDX-License-Identifier:Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"go.universe.tf/metallb/api/v1beta1"
+	"go.universe.tf/metallb/internal/config"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	annotationAssignedIP = "metallb.universe.tf/assigned-ip"
+	annotationSharingKey = "metallb.universe.tf/allow-shared-ip"
+
+	reasonInvalidIP   = "AssignedIPInvalid"
+	reasonNotInPool   = "AssignedIPNotInPool"
+	reasonDuplicated  = "AssignedIPDuplicated"
+	reasonUnreachable = "AssignedIPUnreachable"
+)
+
+// inconsistency is a problem found with the IPs of a service.
+type inconsistency struct {
+	service *corev1.Service
+	reason  string
+	message string
+}
+
+// poolCIDRs returns the CIDRs of each pool.
+func poolCIDRs(pools []v1beta1.IPAddressPool) (map[string][]*net.IPNet, error) {
+	ret := map[string][]*net.IPNet{}
+	for _, p := range pools {
+		for _, addr := range p.Spec.Addresses {
+			cidrs, err := config.ParseCIDR(addr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid address %q in pool %q: %s", addr, p.Name, err)
+			}
+			ret[p.Name] = append(ret[p.Name], cidrs...)
+		}
+	}
+	return ret, nil
+}
+
+// assignedIPs returns the IPs assigned to the service, from the
+// assigned-ip annotation if set, or from its status otherwise. Unparsable
+// IPs are returned as invalid.
+func assignedIPs(svc *corev1.Service) (ips []net.IP, invalid []string) {
+	var raw []string
+	if a, ok := svc.Annotations[annotationAssignedIP]; ok {
+		raw = strings.Split(a, ",")
+	} else {
+		for _, ingress := range svc.Status.LoadBalancer.Ingress {
+			raw = append(raw, ingress.IP)
+		}
+	}
+	for _, s := range raw {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		ip := net.ParseIP(s)
+		if ip == nil {
+			invalid = append(invalid, s)
+			continue
+		}
+		ips = append(ips, ip)
+	}
+	return ips, invalid
+}
+
+// check returns the inconsistencies of the IPs of the LoadBalancer
+// services: IPs out of any pool, IPs assigned to several services not
+// sharing them, and, if probe is not nil, IPs probe can't reach.
+func check(services []corev1.Service, pools map[string][]*net.IPNet, probe func(net.IP) error) []inconsistency {
+	var ret []inconsistency
+	owners := map[string][]*corev1.Service{}
+
+	for i := range services {
+		svc := &services[i]
+		if svc.Spec.Type != corev1.ServiceTypeLoadBalancer {
+			continue
+		}
+		ips, invalid := assignedIPs(svc)
+		for _, s := range invalid {
+			ret = append(ret, inconsistency{svc, reasonInvalidIP, fmt.Sprintf("%q is not a valid IP", s)})
+		}
+		for _, ip := range ips {
+			owners[ip.String()] = append(owners[ip.String()], svc)
+			if poolFor(pools, ip) == "" {
+				ret = append(ret, inconsistency{svc, reasonNotInPool, fmt.Sprintf("IP %s is not in any address pool", ip)})
+			}
+			if probe == nil {
+				continue
+			}
+			if err := probe(ip); err != nil {
+				ret = append(ret, inconsistency{svc, reasonUnreachable, fmt.Sprintf("IP %s is unreachable: %s", ip, err)})
+			}
+		}
+	}
+
+	ips := make([]string, 0, len(owners))
+	for ip := range owners {
+		ips = append(ips, ip)
+	}
+	sort.Strings(ips)
+	for _, ip := range ips {
+		svcs := owners[ip]
+		if len(svcs) < 2 || sharing(svcs) {
+			continue
+		}
+		names := make([]string, 0, len(svcs))
+		for _, svc := range svcs {
+			names = append(names, svc.Namespace+"/"+svc.Name)
+		}
+		for _, svc := range svcs {
+			ret = append(ret, inconsistency{svc, reasonDuplicated, fmt.Sprintf("IP %s is assigned to several services: %s", ip, strings.Join(names, ", "))})
+		}
+	}
+	return ret
+}
+
+// poolFor returns the name of the pool containing ip, or an empty string.
+func poolFor(pools map[string][]*net.IPNet, ip net.IP) string {
+	for name, cidrs := range pools {
+		for _, cidr := range cidrs {
+			if cidr.Contains(ip) {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// sharing returns true if all the services have the same non-empty
+// sharing key, in which case they are allowed to have the same IP.
+func sharing(svcs []*corev1.Service) bool {
+	key := svcs[0].Annotations[annotationSharingKey]
+	if key == "" {
+		return false
+	}
+	for _, svc := range svcs[1:] {
+		if svc.Annotations[annotationSharingKey] != key {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,144 @@
+// SPDX-License-Identifier:Apache-2.0
+
+package main
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"go.universe.tf/metallb/api/v1beta1"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func service(name, ip, sharingKey string) corev1.Service {
+	svc := corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   "default",
+			Annotations: map[string]string{annotationAssignedIP: ip},
+		},
+		Spec: corev1.ServiceSpec{Type: corev1.ServiceTypeLoadBalancer},
+	}
+	if sharingKey != "" {
+		svc.Annotations[annotationSharingKey] = sharingKey
+	}
+	return svc
+}
+
+func TestCheck(t *testing.T) {
+	pools, err := poolCIDRs([]v1beta1.IPAddressPool{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "pool1"},
+			Spec:       v1beta1.IPAddressPoolSpec{Addresses: []string{"1.2.3.0/24", "1000::/120"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("parsing the pools: %s", err)
+	}
+	unreachable := func(ip net.IP) error {
+		if ip.Equal(net.ParseIP("1.2.3.99")) {
+			return errors.New("timeout")
+		}
+		return nil
+	}
+
+	tests := []struct {
+		desc     string
+		services []corev1.Service
+		probe    func(net.IP) error
+		want     []string // reason of each inconsistency, in order
+	}{
+		{
+			desc: "consistent",
+			services: []corev1.Service{
+				service("s1", "1.2.3.1", ""),
+				service("s2", "1.2.3.2,1000::2", ""),
+			},
+		},
+		{
+			desc: "from the status",
+			services: []corev1.Service{
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "s1"},
+					Spec:       corev1.ServiceSpec{Type: corev1.ServiceTypeLoadBalancer},
+					Status: corev1.ServiceStatus{
+						LoadBalancer: corev1.LoadBalancerStatus{Ingress: []corev1.LoadBalancerIngress{{IP: "4.5.6.7"}}},
+					},
+				},
+			},
+			want: []string{reasonNotInPool},
+		},
+		{
+			desc:     "invalid IP",
+			services: []corev1.Service{service("s1", "1.2.3.1,foo", "")},
+			want:     []string{reasonInvalidIP},
+		},
+		{
+			desc:     "not in a pool",
+			services: []corev1.Service{service("s1", "1.2.3.1,2000::1", "")},
+			want:     []string{reasonNotInPool},
+		},
+		{
+			desc: "not a load balancer",
+			services: []corev1.Service{
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "s1", Annotations: map[string]string{annotationAssignedIP: "4.5.6.7"}},
+					Spec:       corev1.ServiceSpec{Type: corev1.ServiceTypeClusterIP},
+				},
+			},
+		},
+		{
+			desc: "duplicated",
+			services: []corev1.Service{
+				service("s1", "1.2.3.1", ""),
+				service("s2", "1.2.3.1", ""),
+			},
+			want: []string{reasonDuplicated, reasonDuplicated},
+		},
+		{
+			desc: "shared",
+			services: []corev1.Service{
+				service("s1", "1.2.3.1", "key"),
+				service("s2", "1.2.3.1", "key"),
+			},
+		},
+		{
+			desc: "different sharing keys",
+			services: []corev1.Service{
+				service("s1", "1.2.3.1", "key"),
+				service("s2", "1.2.3.1", "other"),
+			},
+			want: []string{reasonDuplicated, reasonDuplicated},
+		},
+		{
+			desc: "unreachable",
+			services: []corev1.Service{
+				service("s1", "1.2.3.1", ""),
+				service("s2", "1.2.3.99", ""),
+			},
+			probe: unreachable,
+			want:  []string{reasonUnreachable},
+		},
+		{
+			desc:     "unreachable without probe",
+			services: []corev1.Service{service("s1", "1.2.3.99", "")},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			got := check(test.services, pools, test.probe)
+			if len(got) != len(test.want) {
+				t.Fatalf("got %d inconsistencies %v, want %v", len(got), got, test.want)
+			}
+			for i := range got {
+				if got[i].reason != test.want[i] {
+					t.Fatalf("got inconsistency %d %q (%s), want %q", i, got[i].reason, got[i].message, test.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+// SPDX-License-Identifier:Apache-2.0
+
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"net"
+	"os"
+	"time"
+
+	"go.universe.tf/metallb/api/v1beta1"
+	"go.universe.tf/metallb/internal/version"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const component = "metallb-consistency-check"
+
+func main() {
+	kubeconfig := flag.String("kubeconfig", os.Getenv(clientcmd.RecommendedConfigPathEnvVar), "path to the kubeconfig file, the in-cluster configuration is used if empty")
+	namespace := flag.String("namespace", "metallb-system", "namespace of the address pools")
+	probe := flag.Bool("probe", false, "check that the assigned IPs answer to ICMP echo requests")
+	probeTimeout := flag.Duration("probe-timeout", time.Second, "maximum time to wait for an ICMP echo reply")
+	proposed := flag.String("config", "", "YAML file with a proposed set of MetalLB resources to check the services against instead of the pools of the cluster, without raising events")
+	bgpType := flag.String("bgp-type", "native", "BGP implementation the proposed configuration is validated for, native or frr")
+	flag.Parse()
+	log.Printf("MetalLB consistency check starting. commit: %s branch: %s goversion: %s",
+		version.CommitHash(), version.Branch(), version.GoString())
+
+	cfg, err := clientcmd.BuildConfigFromFlags("", *kubeconfig)
+	if err != nil {
+		log.Fatalf("failed to load kubeconfig: %s", err)
+	}
+	cs, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		log.Fatalf("failed to create the kubernetes client: %s", err)
+	}
+	scheme := runtime.NewScheme()
+	if err := v1beta1.AddToScheme(scheme); err != nil {
+		log.Fatalf("failed to register the metallb types: %s", err)
+	}
+	cl, err := client.New(cfg, client.Options{Scheme: scheme})
+	if err != nil {
+		log.Fatalf("failed to create the metallb client: %s", err)
+	}
+
+	ctx := context.Background()
+	var cidrs map[string][]*net.IPNet
+	if *proposed != "" {
+		cidrs, err = proposedPools(*proposed, *bgpType)
+		if err != nil {
+			log.Fatalf("invalid proposed configuration: %s", err)
+		}
+	} else {
+		var pools v1beta1.IPAddressPoolList
+		if err := cl.List(ctx, &pools, client.InNamespace(*namespace)); err != nil {
+			log.Fatalf("failed to list the address pools: %s", err)
+		}
+		cidrs, err = poolCIDRs(pools.Items)
+		if err != nil {
+			log.Fatalf("failed to parse the address pools: %s", err)
+		}
+	}
+	services, err := cs.CoreV1().Services(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		log.Fatalf("failed to list the services: %s", err)
+	}
+
+	var probeFunc func(net.IP) error
+	if *probe {
+		probeFunc = func(ip net.IP) error { return ping(ip, *probeTimeout) }
+	}
+	found := check(services.Items, cidrs, probeFunc)
+	for _, inc := range found {
+		log.Printf("%s/%s: %s: %s", inc.service.Namespace, inc.service.Name, inc.reason, inc.message)
+		if *proposed != "" {
+			continue
+		}
+		if err := emitEvent(ctx, cs, inc); err != nil {
+			log.Printf("failed to emit the event for %s/%s: %s", inc.service.Namespace, inc.service.Name, err)
+		}
+	}
+	if len(found) > 0 && *proposed != "" {
+		log.Fatalf("found %d inconsistencies in %d services with the proposed configuration", len(found), len(services.Items))
+	}
+	if len(found) > 0 {
+		log.Fatalf("found %d inconsistencies in %d services", len(found), len(services.Items))
+	}
+	log.Printf("checked %d services, no inconsistency found", len(services.Items))
+}
+
+// emitEvent records the inconsistency as a warning event of the service.
+func emitEvent(ctx context.Context, cs kubernetes.Interface, inc inconsistency) error {
+	now := metav1.Now()
+	svc := inc.service
+	event := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: svc.Name + ".",
+			Namespace:    svc.Namespace,
+		},
+		InvolvedObject: corev1.ObjectReference{
+			APIVersion:      "v1",
+			Kind:            "Service",
+			Namespace:       svc.Namespace,
+			Name:            svc.Name,
+			UID:             svc.UID,
+			ResourceVersion: svc.ResourceVersion,
+		},
+		Reason:         inc.reason,
+		Message:        inc.message,
+		Type:           corev1.EventTypeWarning,
+		Source:         corev1.EventSource{Component: component},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}
+	_, err := cs.CoreV1().Events(svc.Namespace).Create(ctx, event, metav1.CreateOptions{})
+	return err
+}
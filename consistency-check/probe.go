@@ -0,0 +1,65 @@
+// SPDX-License-Identifier:Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// ping sends an ICMP echo request to ip, and waits for the reply until
+// timeout. It requires the NET_RAW capability.
+func ping(ip net.IP, timeout time.Duration) error {
+	network, proto := "ip4:icmp", 1
+	var request, reply icmp.Type = ipv4.ICMPTypeEcho, ipv4.ICMPTypeEchoReply
+	if ip.To4() == nil {
+		network, proto = "ip6:ipv6-icmp", 58
+		request, reply = ipv6.ICMPTypeEchoRequest, ipv6.ICMPTypeEchoReply
+	}
+
+	c, err := icmp.ListenPacket(network, "")
+	if err != nil {
+		return fmt.Errorf("failed to open the ICMP socket: %s", err)
+	}
+	defer c.Close()
+
+	id := os.Getpid() & 0xffff
+	msg := icmp.Message{
+		Type: request,
+		Body: &icmp.Echo{ID: id, Seq: 1, Data: []byte("metallb")},
+	}
+	b, err := msg.Marshal(nil)
+	if err != nil {
+		return err
+	}
+	if _, err := c.WriteTo(b, &net.IPAddr{IP: ip}); err != nil {
+		return fmt.Errorf("failed to send the echo request: %s", err)
+	}
+
+	if err := c.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return err
+	}
+	buf := make([]byte, 1500)
+	for {
+		n, peer, err := c.ReadFrom(buf)
+		if err != nil {
+			return fmt.Errorf("no echo reply within %s", timeout)
+		}
+		if addr, ok := peer.(*net.IPAddr); !ok || !addr.IP.Equal(ip) {
+			continue
+		}
+		m, err := icmp.ParseMessage(proto, buf[:n])
+		if err != nil || m.Type != reply {
+			continue
+		}
+		if echo, ok := m.Body.(*icmp.Echo); ok && echo.ID == id {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,97 @@
+// SPDX-License-Identifier:Apache-2.0
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+
+	"go.universe.tf/metallb/api/v1beta1"
+	"go.universe.tf/metallb/api/v1beta2"
+	"go.universe.tf/metallb/internal/config"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// proposedPools returns the CIDRs of each pool of the configuration
+// made of the MetalLB resources in the YAML file, validated as the
+// controller running with the given BGP implementation would.
+func proposedPools(path, bgpType string) (map[string][]*net.IPNet, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	resources, err := readResources(f)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := config.For(resources, config.ValidationFor(bgpType))
+	if err != nil {
+		return nil, err
+	}
+	ret := map[string][]*net.IPNet{}
+	for name, p := range cfg.Pools {
+		ret[name] = p.CIDR
+	}
+	return ret, nil
+}
+
+// readResources decodes the MetalLB resources of the YAML documents
+// read from r. The password secrets of the peers are read too.
+func readResources(r io.Reader) (config.ClusterResources, error) {
+	res := config.ClusterResources{PasswordSecrets: map[string]corev1.Secret{}}
+	scheme := runtime.NewScheme()
+	for _, add := range []func(*runtime.Scheme) error{v1beta1.AddToScheme, v1beta2.AddToScheme, corev1.AddToScheme} {
+		if err := add(scheme); err != nil {
+			return res, err
+		}
+	}
+	decoder := serializer.NewCodecFactory(scheme).UniversalDeserializer()
+	reader := yaml.NewYAMLReader(bufio.NewReader(r))
+	for {
+		doc, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return res, nil
+		}
+		if err != nil {
+			return res, err
+		}
+		if len(doc) == 0 {
+			continue
+		}
+		obj, _, err := decoder.Decode(doc, nil, nil)
+		if err != nil {
+			return res, err
+		}
+		switch o := obj.(type) {
+		case *v1beta1.IPAddressPool:
+			res.Pools = append(res.Pools, *o)
+		case *v1beta1.AddressPool:
+			res.LegacyAddressPools = append(res.LegacyAddressPools, *o)
+		case *v1beta2.BGPPeer:
+			res.Peers = append(res.Peers, *o)
+		case *v1beta1.BFDProfile:
+			res.BFDProfiles = append(res.BFDProfiles, *o)
+		case *v1beta1.BGPAdvertisement:
+			res.BGPAdvs = append(res.BGPAdvs, *o)
+		case *v1beta1.L2Advertisement:
+			res.L2Advs = append(res.L2Advs, *o)
+		case *v1beta1.Community:
+			res.Communities = append(res.Communities, *o)
+		case *v1beta1.NamespaceIPQuota:
+			res.Quotas = append(res.Quotas, *o)
+		case *corev1.Secret:
+			res.PasswordSecrets[o.Name] = *o
+		default:
+			return res, fmt.Errorf("unexpected %s in the configuration", obj.GetObjectKind().GroupVersionKind().Kind)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+// SPDX-License-Identifier:Apache-2.0
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const proposedConfig = `
+apiVersion: metallb.io/v1beta1
+kind: IPAddressPool
+metadata:
+  name: pool1
+  namespace: metallb-system
+spec:
+  addresses:
+  - 1.2.3.0/24
+---
+apiVersion: metallb.io/v1beta1
+kind: IPAddressPool
+metadata:
+  name: pool2
+  namespace: metallb-system
+spec:
+  addresses:
+  - 1.2.4.10-1.2.4.11
+---
+apiVersion: metallb.io/v1beta1
+kind: L2Advertisement
+metadata:
+  name: l2
+  namespace: metallb-system
+`
+
+func TestProposedPools(t *testing.T) {
+	tests := []struct {
+		desc    string
+		config  string
+		want    map[string][]string
+		wantErr bool
+	}{
+		{
+			desc:   "valid",
+			config: proposedConfig,
+			want: map[string][]string{
+				"pool1": {"1.2.3.0/24"},
+				"pool2": {"1.2.4.10/31"},
+			},
+		},
+		{
+			desc: "overlapping pools",
+			config: proposedConfig + `---
+apiVersion: metallb.io/v1beta1
+kind: IPAddressPool
+metadata:
+  name: pool3
+  namespace: metallb-system
+spec:
+  addresses:
+  - 1.2.3.128/25
+`,
+			wantErr: true,
+		},
+		{
+			desc: "unexpected resource",
+			config: proposedConfig + `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+`,
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		if err := os.WriteFile(path, []byte(test.config), 0644); err != nil {
+			t.Fatalf("%s: writing the configuration: %s", test.desc, err)
+		}
+		pools, err := proposedPools(path, "native")
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected an error", test.desc)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %s", test.desc, err)
+		}
+		got := map[string][]string{}
+		for name, cidrs := range pools {
+			for _, cidr := range cidrs {
+				got[name] = append(got[name], cidr.String())
+			}
+		}
+		if len(got) != len(test.want) {
+			t.Fatalf("%s: want pools %v, got %v", test.desc, test.want, got)
+		}
+		for name, cidrs := range test.want {
+			if len(got[name]) != len(cidrs) || got[name][0] != cidrs[0] {
+				t.Errorf("%s: pool %s: want %v, got %v", test.desc, name, cidrs, got[name])
+			}
+		}
+	}
+}
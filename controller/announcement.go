@@ -0,0 +1,140 @@
+// SPDX-License-Identifier:Apache-2.0
+
+package main
+
+import (
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	v1 "k8s.io/api/core/v1"
+
+	"go.universe.tf/metallb/internal/config"
+)
+
+// announcements tracks the IPs assigned to the services that no speaker
+// announced yet. The IPs are confirmed from the events of the speakers,
+// concurrently with the processing of the services.
+type announcements struct {
+	sync.Mutex
+	// The deadline of the IPs waiting to be announced, by service.
+	pending map[string]map[string]time.Time
+	// Called when a deadline expires, to process the services again.
+	expired func()
+	// The IPs announced since the last call to takeAnnounced.
+	announced []net.IP
+}
+
+func newAnnouncements() *announcements {
+	return &announcements{pending: map[string]map[string]time.Time{}}
+}
+
+// expect records that the IPs of the service must be announced within
+// timeout.
+func (a *announcements) expect(key string, ips []net.IP, timeout time.Duration) {
+	if a == nil {
+		return
+	}
+	a.Lock()
+	defer a.Unlock()
+	deadline := time.Now().Add(timeout)
+	a.pending[key] = map[string]time.Time{}
+	for _, ip := range ips {
+		a.pending[key][ip.String()] = deadline
+	}
+	if a.expired != nil {
+		time.AfterFunc(timeout, a.expired)
+	}
+}
+
+// confirm records that ip was announced.
+func (a *announcements) confirm(ip net.IP) {
+	a.Lock()
+	defer a.Unlock()
+	a.announced = append(a.announced, ip)
+	for key, ips := range a.pending {
+		delete(ips, ip.String())
+		if len(ips) == 0 {
+			delete(a.pending, key)
+		}
+	}
+}
+
+// takeAnnounced returns the IPs announced since the last call.
+func (a *announcements) takeAnnounced() []net.IP {
+	if a == nil {
+		return nil
+	}
+	a.Lock()
+	defer a.Unlock()
+	ret := a.announced
+	a.announced = nil
+	return ret
+}
+
+// timedOut returns the IPs of the service that were not announced
+// before their deadline.
+func (a *announcements) timedOut(key string) []string {
+	if a == nil {
+		return nil
+	}
+	a.Lock()
+	defer a.Unlock()
+	var ret []string
+	now := time.Now()
+	for ip, deadline := range a.pending[key] {
+		if now.After(deadline) {
+			ret = append(ret, ip)
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// forget stops tracking the IPs of the service.
+func (a *announcements) forget(key string) {
+	if a == nil {
+		return
+	}
+	a.Lock()
+	defer a.Unlock()
+	delete(a.pending, key)
+}
+
+// watch confirms the IPs received from announced until it is closed.
+func (a *announcements) watch(announced <-chan net.IP) {
+	for ip := range announced {
+		a.confirm(ip)
+	}
+}
+
+// checkAnnouncement starts tracking the announcement of the IPs just
+// allocated to the service, if the pool has an announcement timeout.
+// It returns true if the IPs were not announced in time and were
+// released, in which case the service is processed again once its
+// status is cleared.
+func (c *controller) checkAnnouncement(l log.Logger, key string, svc *v1.Service, pool string, lbIPs []net.IP, allocated bool) bool {
+	timeout := c.pools[pool].AnnouncementTimeout
+	if timeout == 0 {
+		c.announcements.forget(key)
+		return false
+	}
+	if allocated {
+		c.announcements.expect(key, lbIPs, timeout)
+		return false
+	}
+	notAnnounced := c.announcements.timedOut(key)
+	if len(notAnnounced) == 0 {
+		return false
+	}
+	level.Warn(l).Log("event", "announcementTimeout", "ip", lbIPs, "pool", pool, "timeout", timeout, "msg", "IP not announced in time, releasing it")
+	c.client.Errorf(svc, "AnnouncementTimeout", "IP %q not announced within the %s allowed by pool %q, releasing it", notAnnounced, timeout, pool)
+	if f := c.pools[pool].FailoverGroup; f != nil && f.Condition == config.FailoverPoolDegraded {
+		c.setFailover(l, pool, true)
+	}
+	c.clearServiceState(l, key, svc)
+	return true
+}
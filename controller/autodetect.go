@@ -0,0 +1,212 @@
+// SPDX-License-Identifier:Apache-2.0
+
+package main
+
+import (
+	"math/big"
+	"net"
+	"sort"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	v1 "k8s.io/api/core/v1"
+
+	"go.universe.tf/metallb/internal/config"
+)
+
+// ipv6PodCIDRs returns the IPv6 PodCIDRs of node.
+func ipv6PodCIDRs(node *v1.Node) []*net.IPNet {
+	cidrs := node.Spec.PodCIDRs
+	if len(cidrs) == 0 && node.Spec.PodCIDR != "" {
+		cidrs = []string{node.Spec.PodCIDR}
+	}
+	var ret []*net.IPNet
+	for _, c := range cidrs {
+		_, n, err := net.ParseCIDR(c)
+		if err != nil || n.IP.To4() != nil {
+			continue
+		}
+		ret = append(ret, n)
+	}
+	return ret
+}
+
+// nextIPv6Prefix returns the prefix following the smallest one covering
+// all the cidrs, or nil if there are none or it is the last prefix of
+// its size.
+func nextIPv6Prefix(cidrs []*net.IPNet) *net.IPNet {
+	if len(cidrs) == 0 {
+		return nil
+	}
+	ones, _ := cidrs[0].Mask.Size()
+	first := cidrs[0].IP.To16()
+	for _, c := range cidrs[1:] {
+		o, _ := c.Mask.Size()
+		if o < ones {
+			ones = o
+		}
+		if common := commonPrefixLen(first, c.IP.To16()); common < ones {
+			ones = common
+		}
+	}
+
+	mask := net.CIDRMask(ones, 128)
+	network := new(big.Int).SetBytes(first.Mask(mask))
+	network.Add(network, new(big.Int).Lsh(big.NewInt(1), uint(128-ones)))
+	if network.BitLen() > 128 {
+		return nil
+	}
+	ip := make(net.IP, net.IPv6len)
+	network.FillBytes(ip)
+	return &net.IPNet{IP: ip, Mask: mask}
+}
+
+// commonPrefixLen returns the number of leading bits a and b share.
+func commonPrefixLen(a, b net.IP) int {
+	for i := range a {
+		if x := a[i] ^ b[i]; x != 0 {
+			n := i * 8
+			for x&0x80 == 0 {
+				n++
+				x <<= 1
+			}
+			return n
+		}
+	}
+	return len(a) * 8
+}
+
+// autodetectPools returns pools with the IPv6 range computed from the
+// PodCIDRs of the nodes added to the pools autodetecting it. The pools
+// are copied, not modified. An event is raised on the pools whose range
+// changed.
+func (c *controller) autodetectPools(l log.Logger, pools map[string]*config.Pool) map[string]*config.Pool {
+	var podCIDRs []*net.IPNet
+	nodes := make([]string, 0, len(c.nodePodCIDRs))
+	for node := range c.nodePodCIDRs {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	for _, node := range nodes {
+		podCIDRs = append(podCIDRs, c.nodePodCIDRs[node]...)
+	}
+	detected := nextIPv6Prefix(podCIDRs)
+
+	autodetected := map[string]string{}
+	defer func() { c.autodetected = autodetected }()
+	ret := make(map[string]*config.Pool, len(pools))
+	for name, p := range pools {
+		ret[name] = p
+		if !p.AutodetectIPv6 {
+			continue
+		}
+		cidr := detected
+		if cidr != nil && overlapsPools(cidr, pools) {
+			level.Error(l).Log("op", "autodetectIPv6", "pool", name, "cidr", cidr, "msg", "autodetected IPv6 range overlaps with an address pool, ignoring it")
+			cidr = nil
+		}
+		if cidr == nil {
+			continue
+		}
+		if c.autodetected[name] != cidr.String() {
+			level.Info(l).Log("op", "autodetectIPv6", "pool", name, "cidr", cidr, "msg", "IPv6 range of the pool autodetected")
+			c.client.PoolInfof(name, "IPv6PoolAutodetected", "Autodetected IPv6 range %s from the PodCIDRs of the nodes", cidr)
+		}
+		autodetected[name] = cidr.String()
+		withIPv6 := *p
+		withIPv6.CIDR = append(append([]*net.IPNet{}, p.CIDR...), cidr)
+		ret[name] = &withIPv6
+	}
+	return ret
+}
+
+// releaseMovedIPs releases the IPs of the services that are out of the
+// IPv6 range of their pool after it moved, so that they get an IP of the
+// new range when processed again. Without that the allocator would refuse
+// the pools as it does when a configuration drops IPs in use.
+func (c *controller) releaseMovedIPs(l log.Logger, previous map[string]string, pools map[string]*config.Pool) {
+	for name, cidr := range previous {
+		pool := pools[name]
+		if pool == nil || c.autodetected[name] == cidr {
+			continue
+		}
+		for _, key := range c.ips.ServicesInPool(name) {
+			moved := false
+			for _, ip := range c.ips.IPs(key) {
+				if !pool.ContainsIP(ip) {
+					moved = true
+				}
+			}
+			if !moved {
+				continue
+			}
+			level.Info(l).Log("op", "autodetectIPv6", "pool", name, "service", key, "msg", "releasing IPs out of the autodetected IPv6 range")
+			ips := c.ips.IPs(key)
+			if c.ips.Unassign(key) {
+				c.forgetIPAges(ips)
+				c.poolStats.Released(name, len(ips))
+				c.updatePoolStats(name)
+				if err := c.journal.Clear(key); err != nil {
+					level.Error(l).Log("op", "journal", "error", err, "msg", "failed to record the release of the IPs in the journal")
+				}
+			}
+		}
+	}
+}
+
+// overlapsPools returns true if cidr overlaps with one of the CIDRs of
+// the pools.
+func overlapsPools(cidr *net.IPNet, pools map[string]*config.Pool) bool {
+	for _, p := range pools {
+		for _, c := range p.CIDR {
+			if c.Contains(cidr.IP) || cidr.Contains(c.IP) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// setNodePodCIDRs records the IPv6 PodCIDRs of node, and returns true if
+// they changed.
+func (c *controller) setNodePodCIDRs(node *v1.Node) bool {
+	if c.nodePodCIDRs == nil {
+		c.nodePodCIDRs = map[string][]*net.IPNet{}
+	}
+	cidrs := ipv6PodCIDRs(node)
+	old := c.nodePodCIDRs[node.Name]
+	changed := len(old) != len(cidrs)
+	for i := 0; !changed && i < len(cidrs); i++ {
+		changed = old[i].String() != cidrs[i].String()
+	}
+	if !changed {
+		return false
+	}
+	if len(cidrs) == 0 {
+		delete(c.nodePodCIDRs, node.Name)
+	} else {
+		c.nodePodCIDRs[node.Name] = cidrs
+	}
+	return true
+}
+
+// deleteNodePodCIDRs forgets the IPv6 PodCIDRs of a deleted node, and
+// returns true if it had some.
+func (c *controller) deleteNodePodCIDRs(name string) bool {
+	if _, ok := c.nodePodCIDRs[name]; !ok {
+		return false
+	}
+	delete(c.nodePodCIDRs, name)
+	return true
+}
+
+// autodetectsIPv6 returns true if one of the pools autodetects its IPv6
+// range.
+func autodetectsIPv6(pools map[string]*config.Pool) bool {
+	for _, p := range pools {
+		if p.AutodetectIPv6 {
+			return true
+		}
+	}
+	return false
+}
@@ -3,20 +3,33 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"math/rand"
 	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
+	"go.universe.tf/metallb/internal/allocationhook"
 	"go.universe.tf/metallb/internal/allocator"
+	"go.universe.tf/metallb/internal/budget"
 	"go.universe.tf/metallb/internal/config"
+	"go.universe.tf/metallb/internal/ipfamily"
+	"go.universe.tf/metallb/internal/journal"
 	"go.universe.tf/metallb/internal/k8s/controllers"
 	"go.universe.tf/metallb/internal/k8s/epslices"
+	"go.universe.tf/metallb/internal/stats"
 
 	"github.com/go-kit/log"
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 )
 
 func diffService(a, b *v1.Service) string {
@@ -65,15 +78,24 @@ type testK8S struct {
 	updateService       *v1.Service
 	updateServiceStatus *v1.ServiceStatus
 	loggedWarning       bool
+	quotaWarning        bool
+	poolEvents          []string
+	events              []string
 	t                   *testing.T
 }
 
+func (s *testK8S) Update(svc *v1.Service) (*v1.Service, error) {
+	s.updateService = svc
+	return svc, nil
+}
+
 func (s *testK8S) UpdateStatus(svc *v1.Service) error {
 	s.updateServiceStatus = &svc.Status
 	return nil
 }
 
-func (s *testK8S) Infof(_ *v1.Service, evtType string, msg string, args ...interface{}) {
+func (s *testK8S) Infof(svc *v1.Service, evtType string, msg string, args ...interface{}) {
+	s.events = append(s.events, fmt.Sprintf("%s %s/%s", evtType, svc.Namespace, svc.Name))
 	s.t.Logf("k8s Info event %q: %s", evtType, fmt.Sprintf(msg, args...))
 }
 
@@ -82,10 +104,26 @@ func (s *testK8S) Errorf(_ *v1.Service, evtType string, msg string, args ...inte
 	s.loggedWarning = true
 }
 
+func (s *testK8S) QuotaErrorf(name string, evtType string, msg string, args ...interface{}) {
+	s.t.Logf("k8s Warning event %q on quota %s: %s", evtType, name, fmt.Sprintf(msg, args...))
+	s.quotaWarning = true
+}
+
+func (s *testK8S) PoolInfof(name string, evtType string, msg string, args ...interface{}) {
+	s.t.Logf("k8s Info event %q on pool %s: %s", evtType, name, fmt.Sprintf(msg, args...))
+	s.poolEvents = append(s.poolEvents, evtType+" "+name)
+}
+
+func (s *testK8S) PoolErrorf(name string, evtType string, msg string, args ...interface{}) {
+	s.t.Logf("k8s Warning event %q on pool %s: %s", evtType, name, fmt.Sprintf(msg, args...))
+	s.poolEvents = append(s.poolEvents, evtType+" "+name)
+}
+
 func (s *testK8S) reset() {
 	s.updateService = nil
 	s.updateServiceStatus = nil
 	s.loggedWarning = false
+	s.quotaWarning = false
 }
 
 func (s *testK8S) gotService(in *v1.Service) *v1.Service {
@@ -144,6 +182,10 @@ func TestControllerMutation(t *testing.T) {
 		t.Fatalf("SetPools failed")
 	}
 
+	// Services with allocateLoadBalancerNodePorts disabled have no node
+	// ports, and must get an IP all the same.
+	allocateNodePorts := false
+
 	// In steady state, every input below should be equivalent to a
 	// pure function that reliably produces the same end state
 	// regardless of past controller state.
@@ -184,6 +226,37 @@ func TestControllerMutation(t *testing.T) {
 			},
 		},
 
+		{
+			desc: "LoadBalancer without node ports",
+			in: &v1.Service{
+				Spec: v1.ServiceSpec{
+					Type:                          "LoadBalancer",
+					ClusterIPs:                    []string{"1.2.3.4"},
+					AllocateLoadBalancerNodePorts: &allocateNodePorts,
+					Ports: []v1.ServicePort{
+						{
+							Protocol: v1.ProtocolTCP,
+							Port:     80,
+						},
+					},
+				},
+			},
+			want: &v1.Service{
+				Spec: v1.ServiceSpec{
+					Type:                          "LoadBalancer",
+					ClusterIPs:                    []string{"1.2.3.4"},
+					AllocateLoadBalancerNodePorts: &allocateNodePorts,
+					Ports: []v1.ServicePort{
+						{
+							Protocol: v1.ProtocolTCP,
+							Port:     80,
+						},
+					},
+				},
+				Status: statusAssigned([]string{"1.2.3.0"}),
+			},
+		},
+
 		{
 			desc: "request specific IP",
 			in: &v1.Service{
@@ -933,6 +1006,335 @@ func TestDeleteRecyclesIP(t *testing.T) {
 		t.Fatal("svc2 didn't get an IP")
 	}
 }
+
+func TestControllerReleaseEvents(t *testing.T) {
+	k := &testK8S{t: t}
+	c := &controller{
+		ips:    allocator.New(),
+		client: k,
+	}
+
+	l := log.NewNopLogger()
+	pools := map[string]*config.Pool{
+		"default": {
+			AutoAssign: true,
+			CIDR:       []*net.IPNet{ipnet("1.2.3.0/31")},
+		},
+	}
+	if c.SetPools(l, pools) == controllers.SyncStateError {
+		t.Fatal("SetPools failed")
+	}
+
+	for _, name := range []string{"test1", "test2"} {
+		svc := &v1.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: name},
+			Spec: v1.ServiceSpec{
+				Type:       "LoadBalancer",
+				ClusterIPs: []string{"1.2.3.4"},
+			},
+		}
+		if c.SetBalancer(l, "ns/"+name, svc, epslices.EpsOrSlices{}) == controllers.SyncStateError {
+			t.Fatalf("SetBalancer %s failed", name)
+		}
+	}
+	k.events = nil
+
+	// Turning a service into a ClusterIP one releases its IP.
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "test1"},
+		Spec: v1.ServiceSpec{
+			Type:       "ClusterIP",
+			ClusterIPs: []string{"1.2.3.4"},
+		},
+		Status: statusAssigned([]string{"1.2.3.0"}),
+	}
+	if c.SetBalancer(l, "ns/test1", svc, epslices.EpsOrSlices{}) == controllers.SyncStateError {
+		t.Fatal("SetBalancer test1 failed")
+	}
+	// And so does deleting it.
+	if c.SetBalancer(l, "ns/test2", nil, epslices.EpsOrSlices{}) != controllers.SyncStateReprocessAll {
+		t.Fatal("SetBalancer with nil LB didn't tell us to reprocess all balancers")
+	}
+	want := []string{"IPReleased ns/test1", "IPReleased ns/test2"}
+	if diff := cmp.Diff(want, k.events); diff != "" {
+		t.Fatalf("unexpected events (-want +got):\n%s", diff)
+	}
+	if len(c.ips.IPs("ns/test1")) != 0 || len(c.ips.IPs("ns/test2")) != 0 {
+		t.Fatal("the IPs of the services were not released")
+	}
+}
+
+func TestControllerRetryOnRelease(t *testing.T) {
+	k := &testK8S{t: t}
+	c := &controller{
+		ips:    allocator.New(),
+		client: k,
+	}
+
+	l := log.NewNopLogger()
+	pools := map[string]*config.Pool{
+		"default": {
+			AutoAssign: true,
+			CIDR:       []*net.IPNet{ipnet("1.2.3.0/32")},
+		},
+	}
+	if c.SetPools(l, pools) == controllers.SyncStateError {
+		t.Fatal("SetPools failed")
+	}
+
+	svc1 := &v1.Service{
+		Spec: v1.ServiceSpec{
+			Type:       "LoadBalancer",
+			ClusterIPs: []string{"1.2.3.4"},
+		},
+	}
+	if c.SetBalancer(l, "test1", svc1, epslices.EpsOrSlices{}) != controllers.SyncStateSuccess {
+		t.Fatal("SetBalancer svc1 failed")
+	}
+	svc1 = k.gotService(svc1)
+	if svc1 == nil {
+		t.Fatal("Didn't get a balancer for svc1")
+	}
+
+	// The pool is exhausted, svc2 waits for an IP.
+	svc2 := &v1.Service{
+		Spec: v1.ServiceSpec{
+			Type:       "LoadBalancer",
+			ClusterIPs: []string{"1.2.3.4"},
+		},
+	}
+	if c.SetBalancer(l, "test2", svc2, epslices.EpsOrSlices{}) != controllers.SyncStateSuccess {
+		t.Fatal("SetBalancer svc2 failed")
+	}
+	if len(c.ips.IPs("test2")) != 0 {
+		t.Fatal("svc2 got an IP from an exhausted pool")
+	}
+
+	// Turning svc1 into a ClusterIP service frees its IP, the services
+	// waiting for an IP are processed again.
+	svc1.Spec.Type = "ClusterIP"
+	if c.SetBalancer(l, "test1", svc1, epslices.EpsOrSlices{}) != controllers.SyncStateReprocessAll {
+		t.Fatal("releasing the IP of svc1 didn't tell us to reprocess all balancers")
+	}
+	if c.SetBalancer(l, "test2", svc2, epslices.EpsOrSlices{}) != controllers.SyncStateSuccess {
+		t.Fatal("SetBalancer svc2 failed")
+	}
+	if len(c.ips.IPs("test2")) != 1 {
+		t.Fatal("svc2 didn't get the IP released by svc1")
+	}
+
+	// Nobody is waiting anymore, releasing an IP doesn't reprocess the
+	// other services.
+	svc2 = k.gotService(svc2)
+	svc2.Spec.Type = "ClusterIP"
+	if c.SetBalancer(l, "test2", svc2, epslices.EpsOrSlices{}) != controllers.SyncStateSuccess {
+		t.Fatal("releasing the IP of svc2 reprocessed all balancers")
+	}
+}
+
+func TestControllerRetryFailedAllocations(t *testing.T) {
+	k := &testK8S{t: t}
+	c := &controller{
+		ips:                    allocator.New(),
+		client:                 k,
+		retryFailedAllocations: true,
+	}
+
+	l := log.NewNopLogger()
+	pools := map[string]*config.Pool{
+		"default": {
+			AutoAssign: true,
+			CIDR:       []*net.IPNet{ipnet("1.2.3.0/32")},
+		},
+	}
+	if c.SetPools(l, pools) == controllers.SyncStateError {
+		t.Fatal("SetPools failed")
+	}
+
+	svc1 := &v1.Service{
+		Spec: v1.ServiceSpec{
+			Type:       "LoadBalancer",
+			ClusterIPs: []string{"1.2.3.4"},
+		},
+	}
+	if c.SetBalancer(l, "test1", svc1, epslices.EpsOrSlices{}) != controllers.SyncStateSuccess {
+		t.Fatal("SetBalancer svc1 failed")
+	}
+	svc1 = k.gotService(svc1)
+
+	// The pool is exhausted, svc2 is retried later.
+	svc2 := &v1.Service{
+		Spec: v1.ServiceSpec{
+			Type:       "LoadBalancer",
+			ClusterIPs: []string{"1.2.3.4"},
+		},
+	}
+	if c.SetBalancer(l, "test2", svc2, epslices.EpsOrSlices{}) != controllers.SyncStateRetry {
+		t.Fatal("svc2 failing to get an IP wasn't retried")
+	}
+	if c.SetBalancer(l, "test2", svc2, epslices.EpsOrSlices{}) != controllers.SyncStateRetry {
+		t.Fatal("svc2 still failing to get an IP wasn't retried")
+	}
+
+	svc1.Spec.Type = "ClusterIP"
+	if c.SetBalancer(l, "test1", svc1, epslices.EpsOrSlices{}) != controllers.SyncStateReprocessAll {
+		t.Fatal("releasing the IP of svc1 didn't tell us to reprocess all balancers")
+	}
+	if c.SetBalancer(l, "test2", svc2, epslices.EpsOrSlices{}) != controllers.SyncStateSuccess {
+		t.Fatal("svc2 getting the IP released by svc1 was retried")
+	}
+	if len(c.ips.IPs("test2")) != 1 {
+		t.Fatal("svc2 didn't get the IP released by svc1")
+	}
+}
+
+func TestControllerIgnore(t *testing.T) {
+	k := &testK8S{t: t}
+	c := &controller{
+		ips:    allocator.New(),
+		client: k,
+	}
+
+	l := log.NewNopLogger()
+	pools := map[string]*config.Pool{
+		"default": {
+			AutoAssign: true,
+			CIDR:       []*net.IPNet{ipnet("1.2.3.0/32")},
+		},
+	}
+	if c.SetPools(l, pools) == controllers.SyncStateError {
+		t.Fatal("SetPools failed")
+	}
+
+	// An ignored service doesn't get an IP.
+	ignored := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{annotationIgnore: "true"},
+		},
+		Spec: v1.ServiceSpec{
+			Type:       "LoadBalancer",
+			ClusterIPs: []string{"1.2.3.4"},
+		},
+	}
+	if c.SetBalancer(l, "ignored", ignored, epslices.EpsOrSlices{}) != controllers.SyncStateSuccess {
+		t.Fatal("SetBalancer of the ignored service failed")
+	}
+	if k.gotService(ignored) != nil {
+		t.Fatal("the ignored service was updated")
+	}
+	if len(c.ips.IPs("ignored")) != 0 {
+		t.Fatal("the ignored service got an IP")
+	}
+
+	svc := &v1.Service{
+		Spec: v1.ServiceSpec{
+			Type:       "LoadBalancer",
+			ClusterIPs: []string{"1.2.3.4"},
+		},
+	}
+	if c.SetBalancer(l, "test", svc, epslices.EpsOrSlices{}) != controllers.SyncStateSuccess {
+		t.Fatal("SetBalancer failed")
+	}
+	svc = k.gotService(svc)
+	if svc == nil || len(svc.Status.LoadBalancer.Ingress) != 1 {
+		t.Fatal("the service didn't get an IP")
+	}
+
+	// Ignoring the service releases its IP, without touching its
+	// status.
+	k.reset()
+	svc.Annotations = map[string]string{annotationIgnore: "true"}
+	if c.SetBalancer(l, "test", svc, epslices.EpsOrSlices{}) != controllers.SyncStateSuccess {
+		t.Fatal("SetBalancer of the ignored service failed")
+	}
+	if k.gotService(svc) != nil {
+		t.Fatal("the ignored service was updated")
+	}
+	if len(c.ips.IPs("test")) != 0 {
+		t.Fatal("the ignored service still holds its IP")
+	}
+}
+
+func TestControllerMigrateOrphanedIPs(t *testing.T) {
+	k := &testK8S{t: t}
+	c := &controller{
+		ips:    allocator.New(),
+		client: k,
+	}
+
+	l := log.NewNopLogger()
+	pools := map[string]*config.Pool{
+		"default": {
+			AutoAssign: true,
+			CIDR:       []*net.IPNet{ipnet("1.2.3.0/31")},
+		},
+	}
+	if c.SetPools(l, pools) == controllers.SyncStateError {
+		t.Fatal("SetPools failed")
+	}
+
+	svcs := map[string]*v1.Service{}
+	for _, name := range []string{"test1", "test2"} {
+		svc := &v1.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: name},
+			Spec: v1.ServiceSpec{
+				Type:       "LoadBalancer",
+				ClusterIPs: []string{"1.2.3.4"},
+			},
+		}
+		if c.SetBalancer(l, "ns/"+name, svc, epslices.EpsOrSlices{}) == controllers.SyncStateError {
+			t.Fatalf("SetBalancer %s failed", name)
+		}
+		svcs[name] = k.gotService(svc)
+	}
+
+	shrunk := map[string]*config.Pool{
+		"default": {
+			AutoAssign: true,
+			CIDR:       []*net.IPNet{ipnet("1.2.3.1/32"), ipnet("1.2.4.0/32")},
+		},
+	}
+	if c.SetPools(l, shrunk) != controllers.SyncStateError {
+		t.Fatal("SetPools accepted a configuration orphaning an IP")
+	}
+	c.migrateOrphanedIPs = true
+	if c.SetPools(l, shrunk) != controllers.SyncStateReprocessAll {
+		t.Fatal("SetPools failed to migrate the orphaned IP")
+	}
+
+	// The service keeping its IP is left alone.
+	k.reset()
+	if c.SetBalancer(l, "ns/test2", svcs["test2"], epslices.EpsOrSlices{}) == controllers.SyncStateError {
+		t.Fatal("SetBalancer test2 failed")
+	}
+	if k.gotService(svcs["test2"]) != nil {
+		t.Fatal("the service keeping its IP was updated")
+	}
+
+	// The orphaned IP is withdrawn first.
+	k.events = nil
+	if c.SetBalancer(l, "ns/test1", svcs["test1"], epslices.EpsOrSlices{}) == controllers.SyncStateError {
+		t.Fatal("SetBalancer test1 failed")
+	}
+	gotSvc := k.gotService(svcs["test1"])
+	if gotSvc == nil || len(gotSvc.Status.LoadBalancer.Ingress) != 0 {
+		t.Fatalf("the orphaned IP was not withdrawn: %v", gotSvc)
+	}
+	if diff := cmp.Diff([]string{"IPMigrating ns/test1"}, k.events); diff != "" {
+		t.Fatalf("unexpected events (-want +got):\n%s", diff)
+	}
+
+	// Then the service gets a new IP.
+	k.reset()
+	if c.SetBalancer(l, "ns/test1", gotSvc, epslices.EpsOrSlices{}) == controllers.SyncStateError {
+		t.Fatal("SetBalancer test1 failed")
+	}
+	gotSvc = k.gotService(gotSvc)
+	if gotSvc == nil || len(gotSvc.Status.LoadBalancer.Ingress) != 1 || gotSvc.Status.LoadBalancer.Ingress[0].IP != "1.2.4.0" {
+		t.Fatalf("the migrated service didn't get a new IP: %v", gotSvc)
+	}
+}
+
 func TestControllerDualStackConfig(t *testing.T) {
 	k := &testK8S{t: t}
 	c := &controller{
@@ -1083,3 +1485,1826 @@ func TestControllerSvcAddressSharing(t *testing.T) {
 		t.Fatalf("SetBalancer did not fail")
 	}
 }
+
+func TestControllerPreferNodeFamily(t *testing.T) {
+	k := &testK8S{t: t}
+	c := &controller{
+		ips:          allocator.New(),
+		client:       k,
+		nodeFamilies: map[string]ipfamily.Family{},
+	}
+	l := log.NewNopLogger()
+
+	pools := map[string]*config.Pool{
+		"a": {
+			AutoAssign: true,
+			CIDR:       []*net.IPNet{ipnet("1.2.3.0/24")},
+		},
+		"b": {
+			AutoAssign: true,
+			CIDR:       []*net.IPNet{ipnet("1.2.4.0/24"), ipnet("1000::/127")},
+		},
+	}
+	if c.SetPools(l, pools) == controllers.SyncStateError {
+		t.Fatalf("SetPools failed")
+	}
+
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node1"},
+		Status: v1.NodeStatus{
+			Addresses: []v1.NodeAddress{
+				{Type: v1.NodeInternalIP, Address: "1001::1"},
+			},
+		},
+	}
+	if c.SetNode(l, node) != controllers.SyncStateSuccess {
+		t.Fatalf("SetNode failed")
+	}
+
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{
+				annotationPreferSameIPFamilyAsNode: "true",
+			},
+		},
+		Spec: v1.ServiceSpec{
+			Type:      "LoadBalancer",
+			ClusterIP: "1.2.3.4",
+		},
+	}
+	if c.SetBalancer(l, "test", svc, epslices.EpsOrSlices{}) == controllers.SyncStateError {
+		t.Fatalf("SetBalancer failed")
+	}
+
+	gotSvc := k.gotService(svc)
+	wantSvc := new(v1.Service)
+	*wantSvc = *svc
+	wantSvc.Status = statusAssigned([]string{"1.2.4.0"})
+	if diff := diffService(wantSvc, gotSvc); diff != "" {
+		t.Errorf("SetBalancer produced unexpected mutation (-want +got)\n%s", diff)
+	}
+	// The service is ipv4 only, so it can't match the family of the node.
+	if !k.loggedWarning {
+		t.Error("SetBalancer did not warn about the ip family mismatch")
+	}
+
+	// The family of a deleted node is forgotten.
+	if c.DeleteNode(l, "node1") != controllers.SyncStateSuccess {
+		t.Fatalf("DeleteNode failed")
+	}
+	if _, ok := c.nodeFamilies["node1"]; ok {
+		t.Errorf("DeleteNode kept the family of node1")
+	}
+	if f := c.nodesFamily(); f != ipfamily.Unknown {
+		t.Errorf("expected the nodes family to be unknown once node1 is deleted, got %s", f)
+	}
+}
+
+func TestControllerMaxPendingAllocations(t *testing.T) {
+	k := &testK8S{t: t}
+	c := &controller{
+		ips:    allocator.New(),
+		client: k,
+	}
+	l := log.NewNopLogger()
+
+	pools := map[string]*config.Pool{
+		"small": {
+			AutoAssign:            true,
+			CIDR:                  []*net.IPNet{ipnet("1.2.3.0/32")},
+			MaxPendingAllocations: 1,
+		},
+	}
+	if c.SetPools(l, pools) == controllers.SyncStateError {
+		t.Fatalf("SetPools failed")
+	}
+
+	svcFor := func() *v1.Service {
+		return &v1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Annotations: map[string]string{
+					annotationAddressPool: "small",
+				},
+			},
+			Spec: v1.ServiceSpec{
+				Type:      "LoadBalancer",
+				ClusterIP: "1.2.3.4",
+			},
+		}
+	}
+
+	// The first service takes the only IP of the pool.
+	c.SetBalancer(l, "s1", svcFor(), epslices.EpsOrSlices{})
+	if k.gotService(nil) == nil {
+		t.Fatalf("s1 did not get an IP")
+	}
+
+	// The second one waits in the queue.
+	k.reset()
+	c.SetBalancer(l, "s2", svcFor(), epslices.EpsOrSlices{})
+	if !c.pending["small"]["s2"] {
+		t.Fatalf("s2 is not waiting for an IP")
+	}
+
+	// The third one is rejected, the queue is full.
+	k.reset()
+	c.SetBalancer(l, "s3", svcFor(), epslices.EpsOrSlices{})
+	if c.pending["small"]["s3"] {
+		t.Fatalf("s3 was queued on a full queue")
+	}
+	if !k.loggedWarning {
+		t.Fatalf("rejecting s3 did not log a warning")
+	}
+
+	// Freeing the IP lets the waiting service get it.
+	c.SetBalancer(l, "s1", nil, epslices.EpsOrSlices{})
+	k.reset()
+	c.SetBalancer(l, "s2", svcFor(), epslices.EpsOrSlices{})
+	if k.gotService(nil) == nil {
+		t.Fatalf("s2 did not get an IP")
+	}
+	if len(c.pending["small"]) != 0 {
+		t.Fatalf("pending queue not empty after allocation: %v", c.pending["small"])
+	}
+
+	// The services not requesting a pool wait for the auto-assign pools,
+	// and are bound by their limit too.
+	autoSvc := func() *v1.Service {
+		svc := svcFor()
+		svc.Annotations = nil
+		return svc
+	}
+	k.reset()
+	c.SetBalancer(l, "s4", autoSvc(), epslices.EpsOrSlices{})
+	if !c.pending["small"]["s4"] {
+		t.Fatalf("s4 is not waiting for an IP")
+	}
+	k.reset()
+	c.SetBalancer(l, "s5", autoSvc(), epslices.EpsOrSlices{})
+	if c.pending["small"]["s5"] {
+		t.Fatalf("s5 was queued on a full queue")
+	}
+	if !k.loggedWarning {
+		t.Fatalf("rejecting s5 did not log a warning")
+	}
+
+	// A full queue doesn't reject the services another pool can serve,
+	// nor the ones of another family.
+	pools["other"] = &config.Pool{
+		AutoAssign: true,
+		CIDR:       []*net.IPNet{ipnet("1.2.4.0/32")},
+	}
+	pools["v6"] = &config.Pool{
+		AutoAssign: true,
+		CIDR:       []*net.IPNet{ipnet("1000::/128")},
+	}
+	if c.SetPools(l, pools) == controllers.SyncStateError {
+		t.Fatalf("SetPools failed")
+	}
+	k.reset()
+	c.SetBalancer(l, "s6", autoSvc(), epslices.EpsOrSlices{})
+	if got := k.gotService(nil); got == nil || !cmp.Equal(got.Status, statusAssigned([]string{"1.2.4.0"})) {
+		t.Fatalf("s6 didn't get 1.2.4.0: %v", got)
+	}
+	v6Svc := func() *v1.Service {
+		svc := autoSvc()
+		svc.Spec.ClusterIP = "2000::1"
+		return svc
+	}
+	k.reset()
+	c.SetBalancer(l, "s7", v6Svc(), epslices.EpsOrSlices{})
+	if got := k.gotService(nil); got == nil || !cmp.Equal(got.Status, statusAssigned([]string{"1000::"})) {
+		t.Fatalf("s7 didn't get 1000::: %v", got)
+	}
+	k.reset()
+	c.SetBalancer(l, "s8", v6Svc(), epslices.EpsOrSlices{})
+	if c.pending["small"]["s8"] || !c.unallocated["s8"] {
+		t.Fatalf("s8 is not waiting for an IP of the v6 pool")
+	}
+}
+
+func TestControllerQuota(t *testing.T) {
+	k := &testK8S{t: t}
+	c := &controller{
+		ips:    allocator.New(),
+		client: k,
+	}
+	l := log.NewNopLogger()
+
+	pools := map[string]*config.Pool{
+		"pool1": {
+			AutoAssign: true,
+			CIDR:       []*net.IPNet{ipnet("1.2.3.0/28")},
+			Quotas: map[string]*config.Quota{
+				"limited": {
+					Name:   "quota1",
+					MaxIPs: 1,
+				},
+			},
+		},
+	}
+	if c.SetPools(l, pools) == controllers.SyncStateError {
+		t.Fatalf("SetPools failed")
+	}
+
+	svcFor := func(namespace string) *v1.Service {
+		return &v1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: namespace,
+			},
+			Spec: v1.ServiceSpec{
+				Type:      "LoadBalancer",
+				ClusterIP: "1.2.3.4",
+			},
+		}
+	}
+
+	c.SetBalancer(l, "limited/s1", svcFor("limited"), epslices.EpsOrSlices{})
+	if k.gotService(nil) == nil {
+		t.Fatalf("limited/s1 did not get an IP")
+	}
+
+	// The quota of the namespace is exhausted.
+	k.reset()
+	c.SetBalancer(l, "limited/s2", svcFor("limited"), epslices.EpsOrSlices{})
+	if k.gotService(nil) != nil {
+		t.Fatalf("limited/s2 got an IP beyond the quota")
+	}
+	if !k.loggedWarning || !k.quotaWarning {
+		t.Fatalf("exceeding the quota did not log warnings on both the service and the quota")
+	}
+	if c.ips.Pool("limited/s2") != "" {
+		t.Fatalf("limited/s2 kept its allocation after exceeding the quota")
+	}
+
+	// Other namespaces are not affected.
+	k.reset()
+	c.SetBalancer(l, "other/s1", svcFor("other"), epslices.EpsOrSlices{})
+	if k.gotService(nil) == nil {
+		t.Fatalf("other/s1 did not get an IP")
+	}
+
+	// Releasing the IP makes room for the next service.
+	c.SetBalancer(l, "limited/s1", nil, epslices.EpsOrSlices{})
+	k.reset()
+	c.SetBalancer(l, "limited/s2", svcFor("limited"), epslices.EpsOrSlices{})
+	if k.gotService(nil) == nil {
+		t.Fatalf("limited/s2 did not get an IP after the quota was freed")
+	}
+}
+
+func TestControllerAllocationHook(t *testing.T) {
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req allocationhook.Request
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode the hook request: %s", err)
+		}
+		if req.Namespace != "approved" {
+			_, _ = w.Write([]byte(`{"approved": false, "reason": "not approved"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"approved": true}`))
+	}))
+	defer hook.Close()
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer broken.Close()
+
+	svcFor := func(namespace, pool string) *v1.Service {
+		return &v1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   namespace,
+				Annotations: map[string]string{annotationAddressPool: pool},
+			},
+			Spec: v1.ServiceSpec{
+				Type:      "LoadBalancer",
+				ClusterIP: "1.2.3.4",
+			},
+		}
+	}
+
+	tests := []struct {
+		desc      string
+		svc       *v1.Service
+		wantIP    bool
+		wantEvent bool
+	}{
+		{
+			desc:   "approved by the hook",
+			svc:    svcFor("approved", "hooked"),
+			wantIP: true,
+		},
+		{
+			desc:      "rejected by the hook",
+			svc:       svcFor("other", "hooked"),
+			wantEvent: true,
+		},
+		{
+			desc:      "broken hook failing closed",
+			svc:       svcFor("approved", "closed"),
+			wantEvent: true,
+		},
+		{
+			desc:   "broken hook failing open",
+			svc:    svcFor("approved", "open"),
+			wantIP: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			k := &testK8S{t: t}
+			c := &controller{
+				ips:    allocator.New(),
+				client: k,
+			}
+			l := log.NewNopLogger()
+			pools := map[string]*config.Pool{
+				"hooked": {
+					CIDR:           []*net.IPNet{ipnet("1.2.3.0/28")},
+					AllocationHook: &config.HookConfig{URL: hook.URL, Timeout: time.Second},
+				},
+				"closed": {
+					CIDR:           []*net.IPNet{ipnet("1.2.4.0/28")},
+					AllocationHook: &config.HookConfig{URL: broken.URL, Timeout: time.Second},
+				},
+				"open": {
+					CIDR:           []*net.IPNet{ipnet("1.2.5.0/28")},
+					AllocationHook: &config.HookConfig{URL: broken.URL, Timeout: time.Second, FailOpen: true},
+				},
+			}
+			if c.SetPools(l, pools) == controllers.SyncStateError {
+				t.Fatalf("SetPools failed")
+			}
+
+			c.SetBalancer(l, test.svc.Namespace+"/s1", test.svc, epslices.EpsOrSlices{})
+			if got := k.gotService(nil) != nil; got != test.wantIP {
+				t.Fatalf("expected service to get an IP %v, got %v", test.wantIP, got)
+			}
+			if k.loggedWarning != test.wantEvent {
+				t.Fatalf("expected warning %v, got %v", test.wantEvent, k.loggedWarning)
+			}
+			if !test.wantIP && c.ips.Pool(test.svc.Namespace+"/s1") != "" {
+				t.Fatalf("the service kept its rejected allocation")
+			}
+		})
+	}
+}
+
+func TestControllerPoolSelectorLabels(t *testing.T) {
+	pools := map[string]*config.Pool{
+		"frontend": {
+			CIDR:   []*net.IPNet{ipnet("1.2.3.0/28")},
+			Labels: map[string]string{"env": "prod", "tier": "frontend"},
+		},
+		"backend": {
+			CIDR:   []*net.IPNet{ipnet("1.2.4.0/28")},
+			Labels: map[string]string{"env": "prod", "tier": "backend"},
+		},
+		"dev": {
+			AutoAssign: true,
+			CIDR:       []*net.IPNet{ipnet("1.2.5.0/28")},
+		},
+	}
+
+	tests := []struct {
+		desc     string
+		selector string
+		wantIP   string
+	}{
+		{
+			desc:     "all the labels of a pool",
+			selector: "env=prod,tier=frontend",
+			wantIP:   "1.2.3.0",
+		},
+		{
+			desc:     "a subset of the labels of a pool",
+			selector: "tier=backend",
+			wantIP:   "1.2.4.0",
+		},
+		{
+			desc:     "labels of several pools",
+			selector: "env=prod",
+			wantIP:   "1.2.4.0",
+		},
+		{
+			desc:     "labels of no pool",
+			selector: "env=prod,tier=db",
+		},
+		{
+			desc:     "invalid labels",
+			selector: "env",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			k := &testK8S{t: t}
+			c := &controller{
+				ips:    allocator.New(),
+				client: k,
+			}
+			l := log.NewNopLogger()
+			if c.SetPools(l, pools) == controllers.SyncStateError {
+				t.Fatalf("SetPools failed")
+			}
+
+			svc := &v1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{annotationPoolSelectorLabels: test.selector},
+				},
+				Spec: v1.ServiceSpec{
+					Type:      "LoadBalancer",
+					ClusterIP: "1.2.3.4",
+				},
+			}
+			c.SetBalancer(l, "test", svc, epslices.EpsOrSlices{})
+			gotSvc := k.gotService(svc)
+			if test.wantIP == "" {
+				if gotSvc != nil && len(gotSvc.Status.LoadBalancer.Ingress) != 0 {
+					t.Fatalf("expected no IP, got %v", gotSvc.Status.LoadBalancer.Ingress)
+				}
+				if !k.loggedWarning {
+					t.Fatalf("expected a warning")
+				}
+				return
+			}
+			if gotSvc == nil || len(gotSvc.Status.LoadBalancer.Ingress) != 1 || gotSvc.Status.LoadBalancer.Ingress[0].IP != test.wantIP {
+				t.Fatalf("expected IP %s, got %v", test.wantIP, gotSvc)
+			}
+		})
+	}
+}
+
+func TestControllerServiceAllocation(t *testing.T) {
+	pools := map[string]*config.Pool{
+		"tenant": {
+			AutoAssign: true,
+			CIDR:       []*net.IPNet{ipnet("1.2.3.0/28")},
+			ServiceAllocation: &config.ServiceAllocation{
+				Namespaces: map[string]bool{"tenant": true},
+			},
+		},
+		"shared": {
+			CIDR: []*net.IPNet{ipnet("1.2.4.0/28")},
+		},
+		"public": {
+			AutoAssign: true,
+			CIDR:       []*net.IPNet{ipnet("1.2.5.0/28")},
+			ServiceAllocation: &config.ServiceAllocation{
+				ServiceSelectors: []labels.Selector{
+					labels.SelectorFromSet(labels.Set{"tier": "public"}),
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		desc        string
+		namespace   string
+		labels      map[string]string
+		annotations map[string]string
+		requestedIP string
+		wantIP      string
+	}{
+		{
+			desc:      "allowed namespace",
+			namespace: "tenant",
+			wantIP:    "1.2.3.0",
+		},
+		{
+			desc:      "forbidden namespace",
+			namespace: "other",
+		},
+		{
+			desc:        "forbidden namespace requesting the pool",
+			namespace:   "other",
+			annotations: map[string]string{annotationAddressPool: "tenant"},
+		},
+		{
+			desc:        "forbidden namespace requesting an IP of the pool",
+			namespace:   "other",
+			requestedIP: "1.2.3.5",
+		},
+		{
+			desc:        "any namespace requesting an unrestricted pool",
+			namespace:   "other",
+			annotations: map[string]string{annotationAddressPool: "shared"},
+			wantIP:      "1.2.4.0",
+		},
+		{
+			desc:      "service matching the selector",
+			namespace: "other",
+			labels:    map[string]string{"tier": "public"},
+			wantIP:    "1.2.5.0",
+		},
+		{
+			desc:        "service not matching the selector requesting the pool",
+			namespace:   "other",
+			labels:      map[string]string{"tier": "private"},
+			annotations: map[string]string{annotationAddressPool: "public"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			k := &testK8S{t: t}
+			c := &controller{
+				ips:    allocator.New(),
+				client: k,
+			}
+			l := log.NewNopLogger()
+			if c.SetPools(l, pools) == controllers.SyncStateError {
+				t.Fatalf("SetPools failed")
+			}
+
+			svc := &v1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace:   test.namespace,
+					Labels:      test.labels,
+					Annotations: test.annotations,
+				},
+				Spec: v1.ServiceSpec{
+					Type:           "LoadBalancer",
+					ClusterIP:      "1.2.3.4",
+					LoadBalancerIP: test.requestedIP,
+				},
+			}
+			c.SetBalancer(l, test.namespace+"/test", svc, epslices.EpsOrSlices{})
+			gotSvc := k.gotService(svc)
+			if test.wantIP == "" {
+				if gotSvc != nil && len(gotSvc.Status.LoadBalancer.Ingress) != 0 {
+					t.Fatalf("expected no IP, got %v", gotSvc.Status.LoadBalancer.Ingress)
+				}
+				if !k.loggedWarning {
+					t.Fatalf("expected a warning")
+				}
+				return
+			}
+			if gotSvc == nil || len(gotSvc.Status.LoadBalancer.Ingress) != 1 || gotSvc.Status.LoadBalancer.Ingress[0].IP != test.wantIP {
+				t.Fatalf("expected IP %s, got %v", test.wantIP, gotSvc)
+			}
+		})
+	}
+}
+
+func TestControllerAllocationTrace(t *testing.T) {
+	pools := map[string]*config.Pool{
+		"a": {
+			CIDR:   []*net.IPNet{ipnet("1.2.3.0/32")},
+			Labels: map[string]string{"tier": "web"},
+		},
+		"b": {
+			CIDR:   []*net.IPNet{ipnet("1.2.4.0/30")},
+			Labels: map[string]string{"tier": "web"},
+		},
+	}
+	svc := func() *v1.Service {
+		return &v1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Annotations: map[string]string{annotationPoolSelectorLabels: "tier=web"},
+			},
+			Spec: v1.ServiceSpec{
+				Type:      "LoadBalancer",
+				ClusterIP: "1.2.3.4",
+			},
+		}
+	}
+
+	for _, enabled := range []bool{false, true} {
+		k := &testK8S{t: t}
+		c := &controller{
+			ips:              allocator.New(),
+			client:           k,
+			traceAllocations: enabled,
+		}
+		l := log.NewNopLogger()
+		if c.SetPools(l, pools) == controllers.SyncStateError {
+			t.Fatalf("SetPools failed")
+		}
+		c.SetBalancer(l, "test/s1", svc(), epslices.EpsOrSlices{})
+		k.reset()
+
+		c.SetBalancer(l, "test/s2", svc(), epslices.EpsOrSlices{})
+		gotSvc := k.gotService(nil)
+		if gotSvc == nil {
+			t.Fatalf("trace %v: s2 was not updated", enabled)
+		}
+		got, ok := gotSvc.Annotations[annotationAllocationTrace]
+		if !enabled {
+			if ok {
+				t.Fatalf("unexpected allocation trace %q", got)
+			}
+			continue
+		}
+		want := []string{
+			`pools with the labels "tier=web": a,b`,
+			`trying pool "a": 1/1 IPs used`,
+			`skipped pool "a": `,
+			`trying pool "b": 0/4 IPs used`,
+			`assigned 1.2.4.0 from pool "b"`,
+		}
+		for _, w := range want {
+			if !strings.Contains(got, w) {
+				t.Fatalf("allocation trace %q doesn't contain %q", got, w)
+			}
+		}
+	}
+}
+
+func TestControllerIPAge(t *testing.T) {
+	svc := &v1.Service{
+		Spec: v1.ServiceSpec{
+			Type:      "LoadBalancer",
+			ClusterIP: "1.2.3.4",
+		},
+		Status: v1.ServiceStatus{
+			LoadBalancer: v1.LoadBalancerStatus{
+				Ingress: []v1.LoadBalancerIngress{{IP: "1.2.3.0"}},
+			},
+		},
+	}
+
+	tests := []struct {
+		desc         string
+		maxAge       int
+		forceRecycle bool
+		age          time.Duration
+		wantWarning  bool
+		wantRecycled bool
+	}{
+		{
+			desc: "no maximum age",
+			age:  48 * time.Hour,
+		},
+		{
+			desc:   "recent IP",
+			maxAge: 1,
+			age:    30 * time.Minute,
+		},
+		{
+			desc:        "stale IP",
+			maxAge:      1,
+			age:         2 * time.Hour,
+			wantWarning: true,
+		},
+		{
+			desc:         "stale IP recycled",
+			maxAge:       1,
+			forceRecycle: true,
+			age:          2 * time.Hour,
+			wantWarning:  true,
+			wantRecycled: true,
+		},
+	}
+
+	for _, test := range tests {
+		k := &testK8S{t: t}
+		c := &controller{
+			ips:    allocator.New(),
+			client: k,
+		}
+		l := log.NewNopLogger()
+		pools := map[string]*config.Pool{
+			"default": {
+				CIDR:          []*net.IPNet{ipnet("1.2.3.0/31")},
+				MaxIPAgeHours: test.maxAge,
+				ForceRecycle:  test.forceRecycle,
+			},
+		}
+		if c.SetPools(l, pools) == controllers.SyncStateError {
+			t.Fatalf("%q: SetPools failed", test.desc)
+		}
+		if c.SetBalancer(l, "test", svc, epslices.EpsOrSlices{}) == controllers.SyncStateError {
+			t.Fatalf("%q: SetBalancer failed", test.desc)
+		}
+		if k.loggedWarning {
+			t.Fatalf("%q: unexpected warning for a new IP", test.desc)
+		}
+		if _, ok := c.ipAssignedAt["1.2.3.0"]; !ok {
+			t.Fatalf("%q: the age of the IP was not recorded", test.desc)
+		}
+
+		c.ipAssignedAt["1.2.3.0"] = time.Now().Add(-test.age)
+		k.reset()
+		if c.SetBalancer(l, "test", svc, epslices.EpsOrSlices{}) == controllers.SyncStateError {
+			t.Fatalf("%q: SetBalancer failed", test.desc)
+		}
+		if k.loggedWarning != test.wantWarning {
+			t.Errorf("%q: got warning %v, want %v", test.desc, k.loggedWarning, test.wantWarning)
+		}
+		gotSvc := k.gotService(svc)
+		recycled := gotSvc != nil && len(gotSvc.Status.LoadBalancer.Ingress) == 0
+		if recycled != test.wantRecycled {
+			t.Errorf("%q: got recycled %v, want %v", test.desc, recycled, test.wantRecycled)
+		}
+		if _, ok := c.ipAssignedAt["1.2.3.0"]; ok == recycled {
+			t.Errorf("%q: got the age of the IP recorded %v after recycling %v", test.desc, ok, recycled)
+		}
+	}
+}
+
+func TestControllerDualStackUpgrade(t *testing.T) {
+	k := &testK8S{t: t}
+	c := &controller{
+		ips:    allocator.New(),
+		client: k,
+	}
+	l := log.NewNopLogger()
+	pools := map[string]*config.Pool{
+		"dual": {
+			AutoAssign: true,
+			CIDR:       []*net.IPNet{ipnet("1.2.3.0/30"), ipnet("1000::/126")},
+		},
+	}
+	if c.SetPools(l, pools) == controllers.SyncStateError {
+		t.Fatalf("SetPools failed")
+	}
+
+	// The service got its IPv4 address before turning dual-stack.
+	svc := &v1.Service{
+		Spec: v1.ServiceSpec{
+			Type:       "LoadBalancer",
+			ClusterIPs: []string{"10.0.0.1"},
+		},
+		Status: v1.ServiceStatus{
+			LoadBalancer: v1.LoadBalancerStatus{
+				Ingress: []v1.LoadBalancerIngress{{IP: "1.2.3.2"}},
+			},
+		},
+	}
+	if c.SetBalancer(l, "test", svc, epslices.EpsOrSlices{}) == controllers.SyncStateError {
+		t.Fatalf("SetBalancer failed")
+	}
+
+	svc.Spec.ClusterIPs = []string{"10.0.0.1", "fd00::1"}
+	k.reset()
+	if c.SetBalancer(l, "test", svc, epslices.EpsOrSlices{}) == controllers.SyncStateError {
+		t.Fatalf("SetBalancer failed")
+	}
+	gotSvc := k.gotService(svc)
+	want := []v1.LoadBalancerIngress{{IP: "1.2.3.2"}, {IP: "1000::"}}
+	if gotSvc == nil || cmp.Diff(want, gotSvc.Status.LoadBalancer.Ingress) != "" {
+		t.Fatalf("unexpected service after turning dual-stack %v", gotSvc)
+	}
+}
+
+func TestControllerAnnouncementTimeout(t *testing.T) {
+	tests := []struct {
+		desc         string
+		timeout      time.Duration
+		announced    bool
+		wantReleased bool
+	}{
+		{
+			desc: "no timeout",
+		},
+		{
+			desc:      "announced in time",
+			timeout:   time.Minute,
+			announced: true,
+		},
+		{
+			desc:         "not announced",
+			timeout:      time.Minute,
+			wantReleased: true,
+		},
+	}
+
+	for _, test := range tests {
+		k := &testK8S{t: t}
+		c := &controller{
+			ips:           allocator.New(),
+			client:        k,
+			announcements: newAnnouncements(),
+		}
+		l := log.NewNopLogger()
+		pools := map[string]*config.Pool{
+			"default": {
+				AutoAssign:          true,
+				CIDR:                []*net.IPNet{ipnet("1.2.3.0/31")},
+				AnnouncementTimeout: test.timeout,
+			},
+		}
+		if c.SetPools(l, pools) == controllers.SyncStateError {
+			t.Fatalf("%q: SetPools failed", test.desc)
+		}
+		svc := &v1.Service{
+			Spec: v1.ServiceSpec{
+				Type:      "LoadBalancer",
+				ClusterIP: "1.2.3.4",
+			},
+		}
+		if c.SetBalancer(l, "test", svc, epslices.EpsOrSlices{}) == controllers.SyncStateError {
+			t.Fatalf("%q: SetBalancer failed", test.desc)
+		}
+		svc = k.gotService(svc)
+		if svc == nil || len(svc.Status.LoadBalancer.Ingress) != 1 {
+			t.Fatalf("%q: the service didn't get an IP", test.desc)
+		}
+		if test.announced {
+			c.announcements.confirm(net.ParseIP(svc.Status.LoadBalancer.Ingress[0].IP))
+		}
+		// Let the deadlines expire.
+		for ip := range c.announcements.pending["test"] {
+			c.announcements.pending["test"][ip] = time.Now().Add(-time.Second)
+		}
+
+		k.reset()
+		if c.SetBalancer(l, "test", svc, epslices.EpsOrSlices{}) == controllers.SyncStateError {
+			t.Fatalf("%q: SetBalancer failed", test.desc)
+		}
+		if k.loggedWarning != test.wantReleased {
+			t.Errorf("%q: got warning %v, want %v", test.desc, k.loggedWarning, test.wantReleased)
+		}
+		gotSvc := k.gotService(svc)
+		released := gotSvc != nil && len(gotSvc.Status.LoadBalancer.Ingress) == 0
+		if released != test.wantReleased {
+			t.Errorf("%q: got released %v, want %v", test.desc, released, test.wantReleased)
+		}
+		if _, ok := c.announcements.pending["test"]; ok {
+			t.Errorf("%q: the announcement of the service is still tracked", test.desc)
+		}
+	}
+}
+
+func TestControllerFailover(t *testing.T) {
+	l := log.NewNopLogger()
+	newController := func(condition string, active bool) (*controller, *testK8S) {
+		k := &testK8S{t: t}
+		c := &controller{
+			ips:           allocator.New(),
+			client:        k,
+			announcements: newAnnouncements(),
+		}
+		pools := map[string]*config.Pool{
+			"primary": {
+				AutoAssign:          true,
+				CIDR:                []*net.IPNet{ipnet("1.2.3.0/32")},
+				AnnouncementTimeout: time.Minute,
+				FailoverGroup: &config.FailoverGroup{
+					BackupPool: "backup",
+					Condition:  condition,
+					Active:     active,
+				},
+			},
+			"backup": {
+				CIDR: []*net.IPNet{ipnet("10.0.0.0/32")},
+			},
+		}
+		if c.SetPools(l, pools) == controllers.SyncStateError {
+			t.Fatalf("%s: SetPools failed", condition)
+		}
+		return c, k
+	}
+	newService := func() *v1.Service {
+		return &v1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Annotations: map[string]string{
+					annotationAddressPool: "primary",
+				},
+			},
+			Spec: v1.ServiceSpec{
+				Type:      "LoadBalancer",
+				ClusterIP: "1.2.3.4",
+			},
+		}
+	}
+	setBalancer := func(c *controller, k *testK8S, name string, svc *v1.Service) *v1.Service {
+		k.reset()
+		if c.SetBalancer(l, name, svc, epslices.EpsOrSlices{}) == controllers.SyncStateError {
+			t.Fatalf("SetBalancer of %s failed", name)
+		}
+		if got := k.gotService(svc); got != nil {
+			return got
+		}
+		return svc
+	}
+	ingressIP := func(svc *v1.Service) string {
+		if len(svc.Status.LoadBalancer.Ingress) != 1 {
+			return ""
+		}
+		return svc.Status.LoadBalancer.Ingress[0].IP
+	}
+
+	// The backup pool is used once the primary one is exhausted, until
+	// an IP of the primary one is released.
+	c, k := newController(config.FailoverPoolExhausted, false)
+	s1 := setBalancer(c, k, "test/s1", newService())
+	if ip := ingressIP(s1); ip != "1.2.3.0" {
+		t.Fatalf("exhausted: got IP %q for s1, want the IP of the primary pool", ip)
+	}
+	if want := []string{"FailoverActive primary"}; cmp.Diff(want, k.poolEvents) != "" {
+		t.Fatalf("exhausted: got pool events %v, want %v", k.poolEvents, want)
+	}
+	s2 := setBalancer(c, k, "test/s2", newService())
+	if ip := ingressIP(s2); ip != "10.0.0.0" {
+		t.Fatalf("exhausted: got IP %q for s2, want the IP of the backup pool", ip)
+	}
+	// The IP of the backup pool is kept, the service requesting the
+	// primary pool.
+	if got := setBalancer(c, k, "test/s2", s2); ingressIP(got) != "10.0.0.0" {
+		t.Fatalf("exhausted: s2 lost the IP of the backup pool: %v", got.Status)
+	}
+	k.poolEvents = nil
+	setBalancer(c, k, "test/s1", nil)
+	if want := []string{"FailoverResolved primary"}; cmp.Diff(want, k.poolEvents) != "" {
+		t.Fatalf("exhausted: got pool events %v, want %v", k.poolEvents, want)
+	}
+
+	// The manual failover skips the primary pool.
+	c, k = newController(config.FailoverManual, true)
+	if want := []string{"FailoverActive primary"}; cmp.Diff(want, k.poolEvents) != "" {
+		t.Fatalf("manual: got pool events %v, want %v", k.poolEvents, want)
+	}
+	if ip := ingressIP(setBalancer(c, k, "test/s1", newService())); ip != "10.0.0.0" {
+		t.Fatalf("manual: got IP %q, want the IP of the backup pool", ip)
+	}
+
+	// The failover of a degraded pool is active from an IP not
+	// announced in time, until an IP of the pool is announced.
+	c, k = newController(config.FailoverPoolDegraded, false)
+	s1 = setBalancer(c, k, "test/s1", newService())
+	if ip := ingressIP(s1); ip != "1.2.3.0" {
+		t.Fatalf("degraded: got IP %q, want the IP of the primary pool", ip)
+	}
+	c.announcements.pending["test/s1"]["1.2.3.0"] = time.Now().Add(-time.Second)
+	s1 = setBalancer(c, k, "test/s1", s1)
+	if want := []string{"FailoverActive primary"}; cmp.Diff(want, k.poolEvents) != "" {
+		t.Fatalf("degraded: got pool events %v, want %v", k.poolEvents, want)
+	}
+	if ip := ingressIP(setBalancer(c, k, "test/s1", s1)); ip != "10.0.0.0" {
+		t.Fatalf("degraded: got IP %q, want the IP of the backup pool", ip)
+	}
+	k.poolEvents = nil
+	c.announcements.confirm(net.ParseIP("1.2.3.0"))
+	setBalancer(c, k, "test/s2", newService())
+	if want := []string{"FailoverResolved primary"}; cmp.Diff(want, k.poolEvents) != "" {
+		t.Fatalf("degraded: got pool events %v, want %v", k.poolEvents, want)
+	}
+}
+
+func TestNextIPv6Prefix(t *testing.T) {
+	tests := []struct {
+		desc     string
+		podCIDRs []string
+		want     string
+	}{
+		{
+			desc: "no PodCIDR",
+		},
+		{
+			desc:     "single node",
+			podCIDRs: []string{"fd00:10:244::/64"},
+			want:     "fd00:10:244:1::/64",
+		},
+		{
+			desc:     "several nodes",
+			podCIDRs: []string{"fd00:10:244::/64", "fd00:10:244:1::/64", "fd00:10:244:2::/64"},
+			want:     "fd00:10:244:4::/62",
+		},
+		{
+			desc:     "different sizes",
+			podCIDRs: []string{"fd00:10:244:100::/56", "fd00:10:244:1ff::/64"},
+			want:     "fd00:10:244:200::/56",
+		},
+		{
+			desc:     "last prefix",
+			podCIDRs: []string{"ffff:ffff:ffff:ffff:ffff:ffff:ffff:ff00/120"},
+		},
+	}
+
+	for _, test := range tests {
+		var cidrs []*net.IPNet
+		for _, c := range test.podCIDRs {
+			cidrs = append(cidrs, ipnet(c))
+		}
+		got := nextIPv6Prefix(cidrs)
+		if got == nil {
+			if test.want != "" {
+				t.Errorf("%q: got no prefix, want %s", test.desc, test.want)
+			}
+			continue
+		}
+		if got.String() != test.want {
+			t.Errorf("%q: got prefix %s, want %q", test.desc, got, test.want)
+		}
+	}
+}
+
+func TestControllerAutodetectIPv6(t *testing.T) {
+	k := &testK8S{t: t}
+	c := &controller{
+		ips:          allocator.New(),
+		client:       k,
+		nodeFamilies: map[string]ipfamily.Family{},
+	}
+	l := log.NewNopLogger()
+	node := func(name string, podCIDRs ...string) *v1.Node {
+		return &v1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec:       v1.NodeSpec{PodCIDRs: podCIDRs},
+		}
+	}
+	c.SetNode(l, node("node1", "10.244.0.0/24", "fd00:10:244::/64"))
+
+	pools := map[string]*config.Pool{
+		"v4": {
+			CIDR: []*net.IPNet{ipnet("1.2.3.0/24")},
+		},
+		"auto": {
+			AutoAssign:     true,
+			AutodetectIPv6: true,
+		},
+	}
+	if c.SetPools(l, pools) == controllers.SyncStateError {
+		t.Fatalf("SetPools failed")
+	}
+	if len(pools["auto"].CIDR) != 0 {
+		t.Fatalf("the configured pool was modified")
+	}
+	if want := []string{"IPv6PoolAutodetected auto"}; cmp.Diff(want, k.poolEvents) != "" {
+		t.Fatalf("got pool events %v, want %v", k.poolEvents, want)
+	}
+
+	svc := &v1.Service{
+		Spec: v1.ServiceSpec{
+			Type:      "LoadBalancer",
+			ClusterIP: "fd00:96::1",
+		},
+	}
+	c.SetBalancer(l, "test/s1", svc, epslices.EpsOrSlices{})
+	gotSvc := k.gotService(svc)
+	if gotSvc == nil || len(gotSvc.Status.LoadBalancer.Ingress) != 1 || gotSvc.Status.LoadBalancer.Ingress[0].IP != "fd00:10:244:1::" {
+		t.Fatalf("unexpected service %v", gotSvc)
+	}
+
+	// An unrelated change doesn't change the range.
+	k.poolEvents = nil
+	if res := c.SetNode(l, node("node1", "10.244.0.0/24", "fd00:10:244::/64")); res != controllers.SyncStateSuccess {
+		t.Fatalf("got sync state %v for an unchanged node", res)
+	}
+
+	// A new node moves the range, and the service gets an IP of the new
+	// range.
+	if res := c.SetNode(l, node("node2", "10.244.1.0/24", "fd00:10:244:1::/64")); res != controllers.SyncStateReprocessAll {
+		t.Fatalf("got sync state %v for a new node, want to reprocess all", res)
+	}
+	if !c.pools["auto"].ContainsIP(net.ParseIP("fd00:10:244:2::")) || c.pools["auto"].ContainsIP(net.ParseIP("fd00:10:244:1::")) {
+		t.Fatalf("unexpected autodetected range %v", c.pools["auto"].CIDR)
+	}
+	if want := []string{"IPv6PoolAutodetected auto"}; cmp.Diff(want, k.poolEvents) != "" {
+		t.Fatalf("got pool events %v, want %v", k.poolEvents, want)
+	}
+	c.SetBalancer(l, "test/s1", gotSvc, epslices.EpsOrSlices{})
+	gotSvc = k.gotService(gotSvc)
+	if gotSvc == nil || len(gotSvc.Status.LoadBalancer.Ingress) != 1 || gotSvc.Status.LoadBalancer.Ingress[0].IP != "fd00:10:244:2::" {
+		t.Fatalf("unexpected service %v", gotSvc)
+	}
+
+	// Deleting the node moves the range back.
+	k.poolEvents = nil
+	if res := c.DeleteNode(l, "node2"); res != controllers.SyncStateReprocessAll {
+		t.Fatalf("got sync state %v for a deleted node, want to reprocess all", res)
+	}
+	if _, ok := c.nodePodCIDRs["node2"]; ok {
+		t.Fatalf("the PodCIDRs of the deleted node were kept")
+	}
+	if !c.pools["auto"].ContainsIP(net.ParseIP("fd00:10:244:1::")) {
+		t.Fatalf("unexpected autodetected range %v", c.pools["auto"].CIDR)
+	}
+	if want := []string{"IPv6PoolAutodetected auto"}; cmp.Diff(want, k.poolEvents) != "" {
+		t.Fatalf("got pool events %v, want %v", k.poolEvents, want)
+	}
+
+	// Deleting a node without IPv6 PodCIDRs changes nothing.
+	if res := c.DeleteNode(l, "node3"); res != controllers.SyncStateSuccess {
+		t.Fatalf("got sync state %v for a deleted node without PodCIDRs", res)
+	}
+}
+
+type journalStore struct {
+	data []byte
+}
+
+func (s *journalStore) Load() ([]byte, error) {
+	return s.data, nil
+}
+
+func (s *journalStore) Save(data []byte) error {
+	s.data = data
+	return nil
+}
+
+func TestControllerJournal(t *testing.T) {
+	k := &testK8S{t: t}
+	store := &journalStore{}
+	j, err := journal.New(store, journal.DefaultMaxEntries)
+	if err != nil {
+		t.Fatalf("creating the journal failed: %s", err)
+	}
+	// Simulate an allocation recorded by a previous instance of the controller,
+	// whose service lost its status.
+	if err := j.Assign("s1", []net.IP{net.ParseIP("1.2.3.7")}); err != nil {
+		t.Fatalf("recording the allocation failed: %s", err)
+	}
+	j, err = journal.New(store, journal.DefaultMaxEntries)
+	if err != nil {
+		t.Fatalf("reloading the journal failed: %s", err)
+	}
+	c := &controller{
+		ips:     allocator.New(),
+		client:  k,
+		journal: j,
+	}
+	l := log.NewNopLogger()
+
+	pools := map[string]*config.Pool{
+		"pool1": {
+			AutoAssign: true,
+			CIDR:       []*net.IPNet{ipnet("1.2.3.0/28")},
+		},
+	}
+	if c.SetPools(l, pools) == controllers.SyncStateError {
+		t.Fatalf("SetPools failed")
+	}
+
+	svc := &v1.Service{
+		Spec: v1.ServiceSpec{
+			Type:      "LoadBalancer",
+			ClusterIP: "1.2.3.4",
+		},
+	}
+	c.SetBalancer(l, "s1", svc, epslices.EpsOrSlices{})
+	gotSvc := k.gotService(svc)
+	if gotSvc == nil {
+		t.Fatalf("s1 did not get an IP")
+	}
+	if diff := cmp.Diff(statusAssigned([]string{"1.2.3.7"}), gotSvc.Status); diff != "" {
+		t.Fatalf("s1 did not get the journaled IP back (-want +got):\n%s", diff)
+	}
+
+	// Deleting the service clears it from the journal.
+	c.SetBalancer(l, "s1", nil, epslices.EpsOrSlices{})
+	if ips := c.journal.IPs("s1"); len(ips) != 0 {
+		t.Fatalf("s1 is still in the journal after deletion: %v", ips)
+	}
+
+	// A service deleted before getting its journaled IPs back is cleared
+	// from the journal too.
+	if err := j.Assign("s2", []net.IP{net.ParseIP("1.2.3.8")}); err != nil {
+		t.Fatalf("recording the allocation failed: %s", err)
+	}
+	c.SetBalancer(l, "s2", nil, epslices.EpsOrSlices{})
+	if ips := c.journal.IPs("s2"); len(ips) != 0 {
+		t.Fatalf("s2 is still in the journal after deletion: %v", ips)
+	}
+
+	// The services deleted while the controller was not running are
+	// pruned once the services are listed.
+	for _, svc := range []string{"s3", "s4"} {
+		if err := j.Assign(svc, []net.IP{net.ParseIP("1.2.3.9")}); err != nil {
+			t.Fatalf("recording the allocation failed: %s", err)
+		}
+	}
+	c.pruneJournal(l, func() (map[string]bool, error) {
+		return map[string]bool{"s4": true}, nil
+	})
+	if ips := c.journal.IPs("s3"); len(ips) != 0 {
+		t.Fatalf("s3 is still in the journal after pruning: %v", ips)
+	}
+	if ips := c.journal.IPs("s4"); len(ips) == 0 {
+		t.Fatalf("s4 was pruned from the journal")
+	}
+}
+
+func TestControllerPoolAnnotations(t *testing.T) {
+	k := &testK8S{t: t}
+	c := &controller{
+		ips:                   allocator.New(),
+		client:                k,
+		poolAnnotationsPrefix: "metallb.universe.tf/pool-",
+	}
+	l := log.NewNopLogger()
+
+	pools := map[string]*config.Pool{
+		"pool1": {
+			AutoAssign:  true,
+			CIDR:        []*net.IPNet{ipnet("1.2.3.0/28")},
+			Annotations: map[string]string{"team": "infra", "env": "prod"},
+			Labels:      map[string]string{"tier": "web"},
+		},
+		"pool2": {
+			AutoAssign: false,
+			CIDR:       []*net.IPNet{ipnet("4.5.6.0/28")},
+		},
+	}
+	if c.SetPools(l, pools) == controllers.SyncStateError {
+		t.Fatalf("SetPools failed")
+	}
+
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{"owner": "me", "metallb.universe.tf/pool-mine": "kept"},
+		},
+		Spec: v1.ServiceSpec{
+			Type:      "LoadBalancer",
+			ClusterIP: "1.2.3.4",
+		},
+	}
+	c.SetBalancer(l, "s1", svc, epslices.EpsOrSlices{})
+	gotSvc := k.gotService(svc)
+	if gotSvc == nil {
+		t.Fatalf("s1 was not updated")
+	}
+	want := map[string]string{
+		"owner":                          "me",
+		"metallb.universe.tf/pool-mine":  "kept",
+		"metallb.universe.tf/pool-team":  "infra",
+		"metallb.universe.tf/pool-env":   "prod",
+		annotationManagedPoolAnnotations: "metallb.universe.tf/pool-env,metallb.universe.tf/pool-team",
+	}
+	if diff := cmp.Diff(want, gotSvc.Annotations); diff != "" {
+		t.Fatalf("unexpected annotations (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(statusAssigned([]string{"1.2.3.0"}), gotSvc.Status); diff != "" {
+		t.Fatalf("unexpected status (-want +got):\n%s", diff)
+	}
+
+	// The annotations of the previous pool are removed when the service
+	// moves to a pool without annotations, the ones set by the user are
+	// kept even with the prefix.
+	k.reset()
+	svc = gotSvc.DeepCopy()
+	svc.Annotations[annotationAddressPool] = "pool2"
+	c.SetBalancer(l, "s1", svc, epslices.EpsOrSlices{})
+	gotSvc = k.gotService(svc)
+	if gotSvc == nil {
+		t.Fatalf("s1 was not updated")
+	}
+	want = map[string]string{
+		"owner":                         "me",
+		"metallb.universe.tf/pool-mine": "kept",
+		annotationAddressPool:           "pool2",
+	}
+	if diff := cmp.Diff(want, gotSvc.Annotations); diff != "" {
+		t.Fatalf("unexpected annotations after changing pool (-want +got):\n%s", diff)
+	}
+
+	// A converged service is not updated again.
+	k.reset()
+	c.SetBalancer(l, "s1", gotSvc, epslices.EpsOrSlices{})
+	if k.gotService(gotSvc) != nil {
+		t.Fatalf("converged service was updated")
+	}
+
+	// The pool selector of the service is kept along with the pool
+	// annotations.
+	k.reset()
+	svc = &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{annotationPoolSelectorLabels: "tier=web"},
+		},
+		Spec: v1.ServiceSpec{
+			Type:      "LoadBalancer",
+			ClusterIP: "1.2.3.4",
+		},
+	}
+	c.SetBalancer(l, "s2", svc, epslices.EpsOrSlices{})
+	gotSvc = k.gotService(svc)
+	if gotSvc == nil {
+		t.Fatalf("s2 was not updated")
+	}
+	want = map[string]string{
+		annotationPoolSelectorLabels:     "tier=web",
+		"metallb.universe.tf/pool-team":  "infra",
+		"metallb.universe.tf/pool-env":   "prod",
+		annotationManagedPoolAnnotations: "metallb.universe.tf/pool-env,metallb.universe.tf/pool-team",
+	}
+	if diff := cmp.Diff(want, gotSvc.Annotations); diff != "" {
+		t.Fatalf("unexpected annotations of the service selecting its pool (-want +got):\n%s", diff)
+	}
+}
+
+func TestControllerServiceConditions(t *testing.T) {
+	k := &testK8S{t: t}
+	c := &controller{
+		ips:               allocator.New(),
+		client:            k,
+		serviceConditions: true,
+	}
+	l := log.NewNopLogger()
+
+	pools := map[string]*config.Pool{
+		"pool1": {
+			AutoAssign: true,
+			CIDR:       []*net.IPNet{ipnet("1.2.3.0/32")},
+		},
+	}
+	if c.SetPools(l, pools) == controllers.SyncStateError {
+		t.Fatalf("SetPools failed")
+	}
+	ignoreTime := cmpopts.IgnoreFields(metav1.Condition{}, "LastTransitionTime")
+
+	svc1 := &v1.Service{
+		Spec: v1.ServiceSpec{
+			Type:      "LoadBalancer",
+			ClusterIP: "1.2.3.4",
+		},
+	}
+	c.SetBalancer(l, "s1", svc1, epslices.EpsOrSlices{})
+	gotSvc1 := k.gotService(svc1)
+	if gotSvc1 == nil {
+		t.Fatalf("s1 was not updated")
+	}
+	assigned := `Assigned IP ["1.2.3.0"] from pool "pool1"`
+	want := []metav1.Condition{
+		{Type: conditionProgressing, Status: metav1.ConditionFalse, Reason: "IPAssigned", Message: assigned},
+		{Type: conditionReady, Status: metav1.ConditionTrue, Reason: "IPAssigned", Message: assigned},
+		{Type: conditionDegraded, Status: metav1.ConditionFalse, Reason: "IPAssigned", Message: assigned},
+	}
+	if diff := cmp.Diff(want, gotSvc1.Status.Conditions, ignoreTime); diff != "" {
+		t.Fatalf("unexpected conditions for s1 (-want +got):\n%s", diff)
+	}
+
+	// A converged service is not updated again.
+	k.reset()
+	c.SetBalancer(l, "s1", gotSvc1, epslices.EpsOrSlices{})
+	if k.gotService(gotSvc1) != nil {
+		t.Fatalf("converged service was updated")
+	}
+
+	// The pool is full, the second service is degraded.
+	k.reset()
+	svc2 := &v1.Service{
+		Spec: v1.ServiceSpec{
+			Type:      "LoadBalancer",
+			ClusterIP: "1.2.3.5",
+		},
+	}
+	c.SetBalancer(l, "s2", svc2, epslices.EpsOrSlices{})
+	gotSvc2 := k.gotService(svc2)
+	if gotSvc2 == nil {
+		t.Fatalf("s2 was not updated")
+	}
+	failed := "Failed to allocate IP: no available IPs"
+	want = []metav1.Condition{
+		{Type: conditionProgressing, Status: metav1.ConditionTrue, Reason: "AllocatingIP", Message: "Allocating an IP"},
+		{Type: conditionReady, Status: metav1.ConditionFalse, Reason: "AllocationFailed", Message: failed},
+		{Type: conditionDegraded, Status: metav1.ConditionTrue, Reason: "AllocationFailed", Message: failed},
+	}
+	if diff := cmp.Diff(want, gotSvc2.Status.Conditions, ignoreTime); diff != "" {
+		t.Fatalf("unexpected conditions for s2 (-want +got):\n%s", diff)
+	}
+
+	// An invalid requested IP is reported as such.
+	k.reset()
+	svc3 := &v1.Service{
+		Spec: v1.ServiceSpec{
+			Type:           "LoadBalancer",
+			ClusterIP:      "1.2.3.6",
+			LoadBalancerIP: "invalid",
+		},
+	}
+	c.SetBalancer(l, "s3", svc3, epslices.EpsOrSlices{})
+	gotSvc3 := k.gotService(svc3)
+	if gotSvc3 == nil {
+		t.Fatalf("s3 was not updated")
+	}
+	failed = `Failed to allocate IP: invalid spec.loadBalancerIP "invalid"`
+	want = []metav1.Condition{
+		{Type: conditionProgressing, Status: metav1.ConditionTrue, Reason: "AllocatingIP", Message: "Allocating an IP"},
+		{Type: conditionReady, Status: metav1.ConditionFalse, Reason: "InvalidRequestedIP", Message: failed},
+		{Type: conditionDegraded, Status: metav1.ConditionTrue, Reason: "InvalidRequestedIP", Message: failed},
+	}
+	if diff := cmp.Diff(want, gotSvc3.Status.Conditions, ignoreTime); diff != "" {
+		t.Fatalf("unexpected conditions for s3 (-want +got):\n%s", diff)
+	}
+
+	// The conditions are removed when the service is no longer a
+	// LoadBalancer.
+	k.reset()
+	svc1 = gotSvc1.DeepCopy()
+	svc1.Spec.Type = "ClusterIP"
+	c.SetBalancer(l, "s1", svc1, epslices.EpsOrSlices{})
+	gotSvc1 = k.gotService(svc1)
+	if gotSvc1 == nil {
+		t.Fatalf("s1 was not updated")
+	}
+	if len(gotSvc1.Status.Conditions) != 0 {
+		t.Fatalf("expected no conditions, got %v", gotSvc1.Status.Conditions)
+	}
+}
+
+func TestControllerPoolStats(t *testing.T) {
+	k := &testK8S{t: t}
+	c := &controller{
+		ips:       allocator.New(),
+		client:    k,
+		poolStats: stats.New(),
+	}
+	l := log.NewNopLogger()
+
+	pools := map[string]*config.Pool{
+		"pool1": {
+			AutoAssign: true,
+			CIDR:       []*net.IPNet{ipnet("1.2.3.0/30")},
+		},
+	}
+	if c.SetPools(l, pools) == controllers.SyncStateError {
+		t.Fatalf("SetPools failed")
+	}
+
+	for i, ns := range []string{"ns1", "ns2", "ns2"} {
+		svc := &v1.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: ns},
+			Spec: v1.ServiceSpec{
+				Type:      "LoadBalancer",
+				ClusterIP: "1.2.3.4",
+			},
+		}
+		c.SetBalancer(l, fmt.Sprintf("%s/s%d", ns, i), svc, epslices.EpsOrSlices{})
+	}
+	c.SetBalancer(l, "ns2/s1", nil, epslices.EpsOrSlices{})
+
+	got, ok := c.poolStats.Stats("pool1", time.Hour)
+	if !ok {
+		t.Fatalf("no statistics for pool1")
+	}
+	want := stats.Stats{
+		Pool:             "pool1",
+		Window:           "1h0m0s",
+		AllocationRate:   3,
+		DeallocationRate: 1,
+		Utilization:      0.5,
+		PeakUtilization:  0.75,
+		TopNamespace:     "ns2",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected stats (-want +got):\n%s", diff)
+	}
+
+	// The statistics of a removed pool are dropped.
+	c.SetBalancer(l, "ns1/s0", nil, epslices.EpsOrSlices{})
+	c.SetBalancer(l, "ns2/s2", nil, epslices.EpsOrSlices{})
+	if c.SetPools(l, map[string]*config.Pool{}) == controllers.SyncStateError {
+		t.Fatalf("SetPools failed")
+	}
+	if _, ok := c.poolStats.Stats("pool1", time.Hour); ok {
+		t.Fatalf("expected no statistics for the removed pool")
+	}
+}
+
+func TestControllerBudgets(t *testing.T) {
+	k := &testK8S{t: t}
+	c := &controller{
+		ips:     allocator.New(),
+		client:  k,
+		budgets: budget.New(),
+	}
+	l := log.NewNopLogger()
+
+	pools := map[string]*config.Pool{
+		"pool1": {
+			AutoAssign: true,
+			CIDR:       []*net.IPNet{ipnet("1.2.3.0/28")},
+			Quotas: map[string]*config.Quota{
+				"ns1": {Name: "ns1-quota", MaxIPs: 3},
+				"ns2": {Name: "ns2-quota", MaxIPsPerService: 1},
+			},
+		},
+	}
+	if c.SetPools(l, pools) == controllers.SyncStateError {
+		t.Fatalf("SetPools failed")
+	}
+
+	for i, ns := range []string{"ns1", "ns1", "ns2"} {
+		svc := &v1.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: ns},
+			Spec: v1.ServiceSpec{
+				Type:      "LoadBalancer",
+				ClusterIP: "1.2.3.4",
+			},
+		}
+		c.SetBalancer(l, fmt.Sprintf("%s/s%d", ns, i), svc, epslices.EpsOrSlices{})
+	}
+	c.SetBalancer(l, "ns1/s1", nil, epslices.EpsOrSlices{})
+
+	got, ok := c.budgets.Budget("ns1")
+	if !ok {
+		t.Fatalf("no budget for ns1")
+	}
+	want := budget.Budget{
+		Namespace: "ns1",
+		Total:     3,
+		Used:      1,
+		Remaining: 2,
+		Pools:     []budget.PoolBudget{{Pool: "pool1", Total: 3, Used: 1, Remaining: 2}},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected budget (-want +got):\n%s", diff)
+	}
+	// A quota on the IPs per service only is not a budget.
+	if _, ok := c.budgets.Budget("ns2"); ok {
+		t.Fatalf("expected no budget for ns2")
+	}
+
+	// The budgets of a removed pool are dropped. The pool can only be
+	// removed once its IPs are released.
+	c.SetBalancer(l, "ns1/s0", nil, epslices.EpsOrSlices{})
+	c.SetBalancer(l, "ns2/s2", nil, epslices.EpsOrSlices{})
+	if _, ok := c.budgets.Budget("ns1"); !ok {
+		t.Fatalf("no budget for ns1 once its services are deleted")
+	}
+	if c.SetPools(l, map[string]*config.Pool{}) == controllers.SyncStateError {
+		t.Fatalf("SetPools failed")
+	}
+	if _, ok := c.budgets.Budget("ns1"); ok {
+		t.Fatalf("expected no budget for the removed pool")
+	}
+}
+
+func TestControllerStartupChecks(t *testing.T) {
+	tests := []struct {
+		desc              string
+		failOnEmptyPools  bool
+		failOnConfigError bool
+		configured        bool
+		pools             map[string]*config.Pool
+		configError       error
+		wantFatal         bool
+	}{
+		{
+			desc:  "no pools, checks disabled",
+			pools: map[string]*config.Pool{},
+		},
+		{
+			desc:             "no pools",
+			failOnEmptyPools: true,
+			pools:            map[string]*config.Pool{},
+			wantFatal:        true,
+		},
+		{
+			desc:             "no allocatable IP",
+			failOnEmptyPools: true,
+			pools: map[string]*config.Pool{
+				"pool1": {
+					CIDR:                []*net.IPNet{ipnet("1.2.3.4/32")},
+					ReservedBoundaryIPs: 1,
+				},
+			},
+			wantFatal: true,
+		},
+		{
+			desc:             "allocatable IPs",
+			failOnEmptyPools: true,
+			pools: map[string]*config.Pool{
+				"pool1": {CIDR: []*net.IPNet{ipnet("1.2.3.4/32")}},
+			},
+		},
+		{
+			desc:             "no pools after the startup",
+			failOnEmptyPools: true,
+			configured:       true,
+			pools:            map[string]*config.Pool{},
+		},
+		{
+			desc:        "invalid config, checks disabled",
+			configError: errors.New("invalid"),
+		},
+		{
+			desc:              "invalid config",
+			failOnConfigError: true,
+			configError:       errors.New("invalid"),
+			wantFatal:         true,
+		},
+		{
+			desc:              "invalid config after the startup",
+			failOnConfigError: true,
+			configured:        true,
+			configError:       errors.New("invalid"),
+		},
+	}
+
+	l := log.NewNopLogger()
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			var fatal error
+			c := &controller{
+				ips:               allocator.New(),
+				client:            &testK8S{t: t},
+				failOnEmptyPools:  test.failOnEmptyPools,
+				failOnConfigError: test.failOnConfigError,
+				fatal:             func(err error) { fatal = err },
+				configured:        make(chan struct{}),
+			}
+			if test.configured {
+				c.SetPools(l, map[string]*config.Pool{
+					"initial": {CIDR: []*net.IPNet{ipnet("1.2.3.0/24")}},
+				})
+			}
+
+			if test.configError != nil {
+				c.SetPoolConfigInvalid(l, test.configError)
+			} else {
+				c.SetPools(l, test.pools)
+			}
+			if (fatal != nil) != test.wantFatal {
+				t.Fatalf("expected fatal %v, got %v", test.wantFatal, fatal)
+			}
+			select {
+			case <-c.configured:
+				if test.wantFatal {
+					t.Fatalf("the controller is configured after a fatal error")
+				}
+			default:
+				if test.configError == nil && !test.wantFatal {
+					t.Fatalf("the controller is not configured")
+				}
+			}
+		})
+	}
+
+	// The controller stops if it's not configured in time.
+	var fatal error
+	c := &controller{
+		fatal:      func(err error) { fatal = err },
+		configured: make(chan struct{}),
+	}
+	c.waitForConfig(time.Millisecond)
+	if fatal == nil {
+		t.Fatalf("expected a fatal error without configuration")
+	}
+}
+
+func TestControllerSimulate(t *testing.T) {
+	k := &testK8S{t: t}
+	c := &controller{
+		ips:    allocator.New(),
+		client: k,
+	}
+	l := log.NewNopLogger()
+
+	pools := map[string]*config.Pool{
+		"pool1": {
+			AutoAssign: true,
+			CIDR:       []*net.IPNet{ipnet("1.2.3.0/31")},
+		},
+	}
+	if c.SetPools(l, pools) == controllers.SyncStateError {
+		t.Fatalf("SetPools failed")
+	}
+	newService := func(annotations map[string]string) *v1.Service {
+		return &v1.Service{
+			ObjectMeta: metav1.ObjectMeta{Annotations: annotations},
+			Spec: v1.ServiceSpec{
+				Type:      "LoadBalancer",
+				ClusterIP: "1.2.3.4",
+			},
+		}
+	}
+
+	c.SetBalancer(l, "s1", newService(nil), epslices.EpsOrSlices{})
+	if got := k.gotService(nil); got == nil || !cmp.Equal(got.Status, statusAssigned([]string{"1.2.3.0"})) {
+		t.Fatalf("s1 didn't get 1.2.3.0: %v", got)
+	}
+
+	// The simulated service is told which IP it would get, but doesn't
+	// get it.
+	k.reset()
+	svc2 := newService(map[string]string{annotationSimulate: "true"})
+	c.SetBalancer(l, "s2", svc2, epslices.EpsOrSlices{})
+	gotSvc2 := k.gotService(svc2)
+	if gotSvc2 == nil {
+		t.Fatalf("s2 was not updated")
+	}
+	want := map[string]string{
+		annotationSimulate:      "true",
+		annotationSimulatedIP:   "1.2.3.1",
+		annotationSimulatedPool: "pool1",
+	}
+	if diff := cmp.Diff(want, gotSvc2.Annotations); diff != "" {
+		t.Fatalf("unexpected annotations (-want +got):\n%s", diff)
+	}
+	if len(gotSvc2.Status.LoadBalancer.Ingress) != 0 {
+		t.Fatalf("simulated service got an IP: %v", gotSvc2.Status)
+	}
+
+	// A converged simulated service is not updated again.
+	k.reset()
+	c.SetBalancer(l, "s2", gotSvc2, epslices.EpsOrSlices{})
+	if k.gotService(gotSvc2) != nil {
+		t.Fatalf("converged simulated service was updated")
+	}
+
+	// The simulated IP is still available to the other services.
+	k.reset()
+	c.SetBalancer(l, "s3", newService(nil), epslices.EpsOrSlices{})
+	if got := k.gotService(nil); got == nil || !cmp.Equal(got.Status, statusAssigned([]string{"1.2.3.1"})) {
+		t.Fatalf("s3 didn't get 1.2.3.1: %v", got)
+	}
+
+	// The pool is full, the simulation fails.
+	k.reset()
+	c.SetBalancer(l, "s2", gotSvc2, epslices.EpsOrSlices{})
+	gotSvc2 = k.gotService(gotSvc2)
+	if gotSvc2 == nil {
+		t.Fatalf("s2 was not updated")
+	}
+	if !k.loggedWarning {
+		t.Fatalf("no warning for the failed simulation")
+	}
+	want = map[string]string{annotationSimulate: "true"}
+	if diff := cmp.Diff(want, gotSvc2.Annotations); diff != "" {
+		t.Fatalf("unexpected annotations after the failed simulation (-want +got):\n%s", diff)
+	}
+
+	// The simulated annotations are removed with the simulate one, and
+	// the service is allocated for real.
+	k.reset()
+	c.SetBalancer(l, "s1", nil, epslices.EpsOrSlices{})
+	svc2 = gotSvc2.DeepCopy()
+	svc2.Annotations = map[string]string{annotationSimulatedIP: "1.2.3.0", annotationSimulatedPool: "pool1"}
+	c.SetBalancer(l, "s2", svc2, epslices.EpsOrSlices{})
+	gotSvc2 = k.gotService(svc2)
+	if gotSvc2 == nil {
+		t.Fatalf("s2 was not updated")
+	}
+	if len(gotSvc2.Annotations) != 0 {
+		t.Fatalf("expected no annotations, got %v", gotSvc2.Annotations)
+	}
+	if diff := cmp.Diff(statusAssigned([]string{"1.2.3.0"}), gotSvc2.Status); diff != "" {
+		t.Fatalf("unexpected status (-want +got):\n%s", diff)
+	}
+
+	// Simulating a service holding an IP doesn't release it.
+	k.reset()
+	c.SetBalancer(l, "s3", nil, epslices.EpsOrSlices{})
+	svc2 = gotSvc2.DeepCopy()
+	svc2.Annotations = map[string]string{annotationSimulate: "true"}
+	c.SetBalancer(l, "s2", svc2, epslices.EpsOrSlices{})
+	gotSvc2 = k.gotService(svc2)
+	if gotSvc2 == nil {
+		t.Fatalf("s2 was not updated")
+	}
+	want = map[string]string{
+		annotationSimulate:      "true",
+		annotationSimulatedIP:   "1.2.3.1",
+		annotationSimulatedPool: "pool1",
+	}
+	if diff := cmp.Diff(want, gotSvc2.Annotations); diff != "" {
+		t.Fatalf("unexpected annotations (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(statusAssigned([]string{"1.2.3.0"}), gotSvc2.Status); diff != "" {
+		t.Fatalf("simulation changed the status (-want +got):\n%s", diff)
+	}
+	if ips := c.ips.IPs("s2"); len(ips) != 1 || !ips[0].Equal(net.ParseIP("1.2.3.0")) {
+		t.Fatalf("simulation released the IP of s2: %v", ips)
+	}
+}
+
+func TestControllerPoolEvents(t *testing.T) {
+	k := &testK8S{t: t}
+	c := &controller{
+		ips:    allocator.New(),
+		client: k,
+	}
+	l := log.NewNopLogger()
+
+	pool1 := &config.Pool{
+		AutoAssign:       true,
+		CIDR:             []*net.IPNet{ipnet("1.2.3.0/28")},
+		L2Advertisements: []*config.L2Advertisement{{}},
+	}
+	if c.SetPools(l, map[string]*config.Pool{"pool1": pool1}) == controllers.SyncStateError {
+		t.Fatalf("SetPools failed")
+	}
+	if len(k.poolEvents) != 0 {
+		t.Fatalf("unexpected events for the initial configuration %v", k.poolEvents)
+	}
+
+	pool2 := &config.Pool{
+		AutoAssign:        true,
+		CIDR:              []*net.IPNet{ipnet("4.5.6.0/30")},
+		BGPAdvertisements: []*config.BGPAdvertisement{{}},
+		L2Advertisements:  []*config.L2Advertisement{{}},
+	}
+	if c.SetPools(l, map[string]*config.Pool{"pool1": pool1, "pool2": pool2}) == controllers.SyncStateError {
+		t.Fatalf("SetPools failed")
+	}
+	if diff := cmp.Diff([]string{"PoolAvailable pool2"}, k.poolEvents); diff != "" {
+		t.Fatalf("unexpected events after adding a pool (-want +got):\n%s", diff)
+	}
+	if got := poolProtocols(pool2); got != "bgp+layer2" {
+		t.Fatalf("unexpected protocols %q for pool2", got)
+	}
+
+	k.poolEvents = nil
+	if c.SetPools(l, map[string]*config.Pool{"pool2": pool2}) == controllers.SyncStateError {
+		t.Fatalf("SetPools failed")
+	}
+	if diff := cmp.Diff([]string{"PoolRemoved pool1"}, k.poolEvents); diff != "" {
+		t.Fatalf("unexpected events after removing a pool (-want +got):\n%s", diff)
+	}
+}
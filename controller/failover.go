@@ -0,0 +1,114 @@
+// SPDX-License-Identifier:Apache-2.0
+
+package main
+
+import (
+	"net"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"go.universe.tf/metallb/internal/config"
+)
+
+// updateFailovers activates and resolves the failover of the pools to
+// their backup pool according to their failover condition. The pools
+// degraded by IPs not announced in time are activated by
+// checkAnnouncement, and resolved once one of their IPs is announced.
+func (c *controller) updateFailovers(l log.Logger) {
+	announced := c.announcements.takeAnnounced()
+	for name := range c.failovers {
+		if c.pools[name] == nil || c.pools[name].FailoverGroup == nil {
+			delete(c.failovers, name)
+		}
+	}
+	for name, p := range c.pools {
+		f := p.FailoverGroup
+		if f == nil {
+			continue
+		}
+		active := c.failovers[name]
+		switch f.Condition {
+		case config.FailoverPoolExhausted:
+			active = int64(c.ips.IPsInUse(name)) >= c.ips.PoolCapacity(name)
+		case config.FailoverPoolDegraded:
+			active = active && !poolContainsAny(p, announced)
+		case config.FailoverManual:
+			active = f.Active
+		}
+		c.setFailover(l, name, active)
+	}
+}
+
+// setFailover activates or resolves the failover of the pool, raising
+// an event on the pool when it changes.
+func (c *controller) setFailover(l log.Logger, pool string, active bool) {
+	if c.failovers[pool] == active {
+		return
+	}
+	f := c.pools[pool].FailoverGroup
+	if !active {
+		delete(c.failovers, pool)
+		level.Info(l).Log("op", "failover", "pool", pool, "backup", f.BackupPool, "msg", "failover resolved")
+		c.client.PoolInfof(pool, "FailoverResolved", "Failover to pool %q resolved", f.BackupPool)
+		return
+	}
+	if c.failovers == nil {
+		c.failovers = map[string]bool{}
+	}
+	c.failovers[pool] = true
+	level.Warn(l).Log("op", "failover", "pool", pool, "backup", f.BackupPool, "condition", f.Condition, "msg", "failover active")
+	c.client.PoolErrorf(pool, "FailoverActive", "Failover to pool %q active: %s", f.BackupPool, f.Condition)
+}
+
+// failoverBackup returns the backup pool of the pool, and whether the
+// primary pool must be skipped because the failover is active and the
+// primary pool is not just exhausted.
+func (c *controller) failoverBackup(pool string) (string, bool) {
+	p := c.pools[pool]
+	if p == nil || p.FailoverGroup == nil {
+		return "", false
+	}
+	skipPrimary := c.failovers[pool] && p.FailoverGroup.Condition != config.FailoverPoolExhausted
+	return p.FailoverGroup.BackupPool, skipPrimary
+}
+
+// satisfiesPool returns true if the IPs of the pool satisfy a service
+// requesting the desired pool, or the pools with the labels of the
+// selector, either of them possibly empty. The IPs of a backup pool
+// satisfy the services requesting the pools it is the backup of.
+func (c *controller) satisfiesPool(pool, desiredPool string, selector labels.Set) bool {
+	candidates := []string{pool}
+	for name, p := range c.pools {
+		if p.FailoverGroup != nil && p.FailoverGroup.BackupPool == pool {
+			candidates = append(candidates, name)
+		}
+	}
+	for _, p := range candidates {
+		if (desiredPool == "" || p == desiredPool) && (selector == nil || c.poolHasLabels(p, selector)) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasFailoverGroups returns true if one of the pools has a backup pool.
+func (c *controller) hasFailoverGroups() bool {
+	for _, p := range c.pools {
+		if p.FailoverGroup != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// poolContainsAny returns true if one of the ips belongs to the pool.
+func poolContainsAny(p *config.Pool, ips []net.IP) bool {
+	for _, ip := range ips {
+		if p.ContainsIP(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -15,36 +15,96 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"io/ioutil"
+	"net"
+	"net/http"
 	"os"
 	"reflect"
+	"strings"
+	"time"
 
 	"go.universe.tf/metallb/internal/allocator"
+	"go.universe.tf/metallb/internal/budget"
 	"go.universe.tf/metallb/internal/config"
+	"go.universe.tf/metallb/internal/ipfamily"
+	"go.universe.tf/metallb/internal/journal"
 	"go.universe.tf/metallb/internal/k8s"
 	"go.universe.tf/metallb/internal/k8s/controllers"
 	"go.universe.tf/metallb/internal/k8s/epslices"
 	"go.universe.tf/metallb/internal/logging"
+	"go.universe.tf/metallb/internal/remotewrite"
+	"go.universe.tf/metallb/internal/stats"
 	"go.universe.tf/metallb/internal/version"
 
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
 	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 // Service offers methods to mutate a Kubernetes service object.
 type service interface {
+	Update(svc *v1.Service) (*v1.Service, error)
 	UpdateStatus(svc *v1.Service) error
 	Infof(svc *v1.Service, desc, msg string, args ...interface{})
 	Errorf(svc *v1.Service, desc, msg string, args ...interface{})
+	QuotaErrorf(name, desc, msg string, args ...interface{})
+	PoolInfof(name, desc, msg string, args ...interface{})
+	PoolErrorf(name, desc, msg string, args ...interface{})
 }
 
 type controller struct {
-	client service
-	pools  map[string]*config.Pool
-	ips    *allocator.Allocator
+	client       service
+	pools        map[string]*config.Pool
+	ips          *allocator.Allocator
+	nodeFamilies map[string]ipfamily.Family // node name -> family of its primary InternalIP
+	nodePodCIDRs map[string][]*net.IPNet    // node name -> IPv6 PodCIDRs
+	autodetected map[string]string          // pool name -> autodetected IPv6 CIDR
+	pending      map[string]map[string]bool // pool name -> services waiting for an IP
+	unallocated  map[string]bool            // services whose allocation failed
+	journal      *journal.Journal
+	poolStats    *stats.Pools
+	budgets      *budget.Budgets
+	ipAssignedAt map[string]time.Time // ip -> when it was first seen assigned to a service
+	failovers    map[string]bool      // pool name -> whether its failover to its backup pool is active
+	migrating    map[string]bool      // services whose IPs left the pools, to withdraw before allocating again
+
+	// The pools as configured, before adding the autodetected IPv6
+	// ranges.
+	configuredPools map[string]*config.Pool
+	// The IPs waiting to be announced by the speakers, nil if the
+	// announcements are not watched.
+	announcements *announcements
+
+	// Prefix of the pool annotations added to the services, disabled
+	// if empty.
+	poolAnnotationsPrefix string
+	// Whether to report the provisioning of the load balancer in the
+	// conditions of the services.
+	serviceConditions bool
+	// Whether to record how the IPs of the services were allocated in
+	// their annotations.
+	traceAllocations bool
+	// Whether to release the IPs a configuration change takes out of
+	// the pools, instead of rejecting the configuration.
+	migrateOrphanedIPs bool
+
+	// Whether the controller must stop when its first configuration
+	// has no allocatable IP, or is invalid.
+	failOnEmptyPools  bool
+	failOnConfigError bool
+	// Whether the services whose allocation failed are retried with a
+	// backoff, on top of when IPs are released or the pools change.
+	retryFailedAllocations bool
+	// fatal stops the controller when a startup check fails.
+	fatal func(error)
+	// configured is closed once the first configuration is applied.
+	configured chan struct{}
 }
 
 func (c *controller) SetBalancer(l log.Logger, name string, svcRo *v1.Service, _ epslices.EpsOrSlices) controllers.SyncState {
@@ -53,6 +113,7 @@ func (c *controller) SetBalancer(l log.Logger, name string, svcRo *v1.Service, _
 
 	if svcRo == nil {
 		c.deleteBalancer(l, name)
+		c.updateFailovers(l)
 		// There might be other LBs stuck waiting for an IP, so when
 		// we delete a balancer we should reprocess all of them to
 		// check for newly feasible balancers.
@@ -70,17 +131,41 @@ func (c *controller) SetBalancer(l log.Logger, name string, svcRo *v1.Service, _
 	// copy makes the code much easier to follow, and we have a GC for
 	// a reason.
 	svc := svcRo.DeepCopy()
-	if !c.convergeBalancer(l, name, svc) {
+	held := c.ips.IPs(name)
+	converged := c.convergeBalancer(l, name, svc)
+	c.updateFailovers(l)
+	if !converged {
 		return controllers.SyncStateError
 	}
+	// The services waiting for an IP get another chance when the
+	// service gives back some of its IPs.
+	done := controllers.SyncStateSuccess
+	if len(c.unallocated) > 0 && releasedAny(held, c.ips.IPs(name)) {
+		level.Info(l).Log("event", "ipsReleased", "waiting", len(c.unallocated), "msg", "retrying the services waiting for an IP")
+		done = controllers.SyncStateReprocessAll
+	}
+	if done == controllers.SyncStateSuccess && c.retryFailedAllocations && c.unallocated[name] {
+		done = controllers.SyncStateRetry
+	}
 	if reflect.DeepEqual(svcRo, svc) {
 		level.Debug(l).Log("event", "noChange", "msg", "service converged, no change")
-		return controllers.SyncStateSuccess
+		return done
+	}
+
+	toUpdate := svcRo
+	if !reflect.DeepEqual(svcRo.Annotations, svc.Annotations) {
+		updated := svcRo.DeepCopy()
+		updated.Annotations = svc.Annotations
+		var err error
+		if toUpdate, err = c.client.Update(updated); err != nil {
+			level.Error(l).Log("op", "updateService", "error", err, "msg", "failed to update service annotations")
+			return controllers.SyncStateError
+		}
 	}
 
 	if !reflect.DeepEqual(svcRo.Status, svc.Status) {
 		var st v1.ServiceStatus
-		st, svc = svc.Status, svcRo.DeepCopy()
+		st, svc = svc.Status, toUpdate.DeepCopy()
 		svc.Status = st
 		if err := c.client.UpdateStatus(svc); err != nil {
 			level.Error(l).Log("op", "updateServiceStatus", "error", err, "msg", "failed to update service status")
@@ -89,13 +174,58 @@ func (c *controller) SetBalancer(l log.Logger, name string, svcRo *v1.Service, _
 	}
 	level.Info(l).Log("event", "serviceUpdated", "msg", "updated service object")
 
-	return controllers.SyncStateSuccess
+	return done
+}
+
+// releasedAny returns true if one of the IPs held before is not held
+// anymore.
+func releasedAny(before, after []net.IP) bool {
+	for _, ip := range before {
+		found := false
+		for _, other := range after {
+			if ip.Equal(other) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return true
+		}
+	}
+	return false
 }
 
 func (c *controller) deleteBalancer(l log.Logger, name string) {
+	c.dequeueAllocation(name)
+	delete(c.migrating, name)
+	c.announcements.forget(name)
+	pool, ips := c.ips.Pool(name), c.ips.IPs(name)
 	if c.ips.Unassign(name) {
+		c.forgetIPAges(ips)
+		c.poolStats.Released(pool, len(ips))
+		c.updatePoolStats(pool)
 		level.Info(l).Log("event", "serviceDeleted", "msg", "service deleted")
+		c.client.Infof(deletedService(name), "IPReleased", "Released IP %q of deleted service", ips)
+	}
+	// The journal may hold IPs the allocator doesn't know, e.g. of a
+	// service deleted before it got them back.
+	if c.journal.IPs(name) != nil {
+		if err := c.journal.Clear(name); err != nil {
+			level.Error(l).Log("op", "journal", "error", err, "msg", "failed to record the release of the IPs in the journal")
+		}
+	}
+}
+
+// deletedService returns a service object with the namespace and name
+// of the key, to raise events about a service that is gone. The object
+// has no UID: the events are listed by kubectl get events, but not
+// attached to a service created again with the same name.
+func deletedService(key string) *v1.Service {
+	ns, name, ok := strings.Cut(key, "/")
+	if !ok {
+		ns, name = "", key
 	}
+	return &v1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: ns, Name: name}}
 }
 
 func (c *controller) SetPools(l log.Logger, pools map[string]*config.Pool) controllers.SyncState {
@@ -106,15 +236,157 @@ func (c *controller) SetPools(l log.Logger, pools map[string]*config.Pool) contr
 		level.Error(l).Log("op", "setConfig", "error", "no MetalLB configuration in cluster", "msg", "configuration is missing, MetalLB will not function")
 		return controllers.SyncStateErrorNoRetry
 	}
+	c.configuredPools = pools
+	previous := c.autodetected
+	pools = c.autodetectPools(l, pools)
+	c.releaseMovedIPs(l, previous, pools)
+	if c.migrateOrphanedIPs {
+		c.releaseOrphanedIPs(l, pools)
+	}
 
 	if err := c.ips.SetPools(pools); err != nil {
 		level.Error(l).Log("op", "setConfig", "error", err, "msg", "applying new configuration failed")
 		return controllers.SyncStateError
 	}
+	if c.pools == nil && c.failOnEmptyPools {
+		if err := c.checkAllocatable(pools); err != nil {
+			level.Error(l).Log("op", "setConfig", "error", err, "msg", "the first configuration has no allocatable IP")
+			c.fatal(err)
+			return controllers.SyncStateErrorNoRetry
+		}
+	}
+	// The pools of the first configuration are not reported, restarting
+	// the controller doesn't change them.
+	if c.pools != nil {
+		c.reportPoolChanges(c.pools, pools)
+	}
+	for p := range c.pools {
+		if pools[p] == nil {
+			c.poolStats.Remove(p)
+			c.budgets.RemovePool(p)
+		}
+	}
+	if c.pools == nil && c.configured != nil {
+		close(c.configured)
+	}
 	c.pools = pools
+	for p := range c.pending {
+		if pools[p] == nil {
+			delete(c.pending, p)
+		}
+	}
+	for p := range pools {
+		c.updatePoolStats(p)
+		if pools[p].AnnouncementTimeout != 0 && c.announcements == nil {
+			level.Warn(l).Log("op", "setConfig", "pool", p, "msg", "announcementTimeout ignored, the announcements are not watched")
+		}
+	}
+	c.updateFailovers(l)
 	return controllers.SyncStateReprocessAll
 }
 
+// checkAllocatable returns an error if none of the pools has an IP to
+// allocate.
+func (c *controller) checkAllocatable(pools map[string]*config.Pool) error {
+	if len(pools) == 0 {
+		return errors.New("no address pool configured")
+	}
+	for name := range pools {
+		if c.ips.PoolCapacity(name) > 0 {
+			return nil
+		}
+	}
+	return fmt.Errorf("none of the %d address pools has an allocatable IP", len(pools))
+}
+
+// SetPoolConfigInvalid handles a configuration that failed to be
+// parsed. It stops the controller if it was not configured yet and
+// must fail on configuration errors, the error being logged only
+// otherwise.
+func (c *controller) SetPoolConfigInvalid(l log.Logger, err error) {
+	if c.pools != nil || !c.failOnConfigError {
+		return
+	}
+	c.fatal(fmt.Errorf("invalid configuration: %w", err))
+}
+
+// startupConfigTimeout is how long the controller waits for its first
+// configuration when it must fail on empty pools.
+const startupConfigTimeout = time.Minute
+
+// waitForConfig stops the controller if no configuration is applied
+// within timeout, as the pools reconciler is not triggered when there
+// is no pool at all.
+func (c *controller) waitForConfig(timeout time.Duration) {
+	select {
+	case <-c.configured:
+	case <-time.After(timeout):
+		c.fatal(fmt.Errorf("no configuration applied after %s", timeout))
+	}
+}
+
+// reportPoolChanges emits an event for each pool added or removed by
+// the new configuration, as a history of the pools of the cluster.
+func (c *controller) reportPoolChanges(old, new map[string]*config.Pool) {
+	for name, p := range new {
+		if old[name] != nil {
+			continue
+		}
+		cidrs := make([]string, 0, len(p.CIDR))
+		for _, cidr := range p.CIDR {
+			cidrs = append(cidrs, cidr.String())
+		}
+		c.client.PoolInfof(name, "PoolAvailable", "Pool %q available with %d IPs in %s, announced via %s", name, c.ips.PoolCapacity(name), strings.Join(cidrs, ","), poolProtocols(p))
+	}
+	for name := range old {
+		if new[name] == nil {
+			c.client.PoolInfof(name, "PoolRemoved", "Pool %q removed", name)
+		}
+	}
+}
+
+// poolProtocols returns the protocols the IPs of the pool are
+// announced with.
+func poolProtocols(p *config.Pool) string {
+	var protocols []string
+	if len(p.BGPAdvertisements) > 0 {
+		protocols = append(protocols, string(config.BGP))
+	}
+	if len(p.L2Advertisements) > 0 {
+		protocols = append(protocols, string(config.Layer2))
+	}
+	if len(protocols) == 0 {
+		return "none"
+	}
+	return strings.Join(protocols, "+")
+}
+
+func (c *controller) SetNode(l log.Logger, node *v1.Node) controllers.SyncState {
+	family := ipfamily.ForNode(node)
+	if c.nodeFamilies[node.Name] != family {
+		level.Debug(l).Log("event", "nodeFamilyChanged", "node", node.Name, "family", family, "msg", "primary ip family of node changed")
+		c.nodeFamilies[node.Name] = family
+	}
+	if c.setNodePodCIDRs(node) && autodetectsIPv6(c.configuredPools) {
+		level.Debug(l).Log("event", "nodePodCIDRsChanged", "node", node.Name, "msg", "IPv6 PodCIDRs of node changed, autodetecting the IPv6 ranges again")
+		return c.SetPools(l, c.configuredPools)
+	}
+	return controllers.SyncStateSuccess
+}
+
+// DeleteNode forgets what was recorded about the node, once deleted.
+func (c *controller) DeleteNode(l log.Logger, name string) controllers.SyncState {
+	if _, ok := c.nodeFamilies[name]; ok {
+		level.Debug(l).Log("event", "nodeDeleted", "node", name, "msg", "node deleted, forgetting its primary ip family")
+		delete(c.nodeFamilies, name)
+	}
+	if c.deleteNodePodCIDRs(name) && autodetectsIPv6(c.configuredPools) {
+		level.Debug(l).Log("event", "nodePodCIDRsChanged", "node", name, "msg", "node with IPv6 PodCIDRs deleted, autodetecting the IPv6 ranges again")
+		return c.SetPools(l, c.configuredPools)
+	}
+	return controllers.SyncStateSuccess
+}
+
 func main() {
 	var (
 		port                = flag.Int("port", 7472, "HTTP listening port for Prometheus metrics")
@@ -129,7 +401,28 @@ func main() {
 		certDir             = flag.String("cert-dir", "/tmp/k8s-webhook-server/serving-certs", "The directory where certs are stored")
 		certServiceName     = flag.String("cert-service-name", "webhook-service", "The service name used to generate the TLS cert's hostname")
 		loadBalancerClass   = flag.String("lb-class", "", "load balancer class. When enabled, metallb will handle only services whose spec.loadBalancerClass matches the given lb class")
+		lbClassDefault      = flag.Bool("lb-class-default", false, "when --lb-class is set, also handle the services without a spec.loadBalancerClass, metallb being the default load balancer of the cluster")
 		webhookMode         = flag.String("webhook-mode", "enabled", "webhook mode: can be enabled, disabled or only webhook if we want the controller to act as webhook endpoint only")
+		speakerRegistry     = flag.String("speaker-registry", "", "name of the ConfigMap the speakers register themselves in, to remove the dead ones. Disabled if empty")
+		speakerLabels       = flag.String("speaker-labels", "app=metallb,component=speaker", "labels matching the speaker pods")
+		journalConfigMap    = flag.String("journal-configmap", "", "name of the ConfigMap where the IP allocations are journaled, to recover them if the services lose their status. Disabled if empty")
+		remoteWriteURL      = flag.String("remote-write-url", "", "URL of a Prometheus remote_write endpoint to push the pool utilization metrics to. Disabled if empty")
+		remoteWriteInterval = flag.Duration("remote-write-interval", 60*time.Second, "how often the pool utilization metrics are pushed to the remote_write endpoint")
+		enablePoolStats     = flag.Bool("enable-pool-stats", false, "serve the allocation statistics of the pools over the last 24 hours on /api/v1/pools/{name}/stats of the metrics port")
+		enableBudgets       = flag.Bool("enable-namespace-budgets", false, "serve the IPs each namespace uses out of its quotas on /api/v1/namespaces/{namespace}/budget of the metrics port")
+		poolAnnotations     = flag.String("pool-annotations-prefix", "metallb.universe.tf/pool-", "prefix of the pool annotations added to the services getting an IP from the pool. Disabled if empty")
+		serviceConditions   = flag.Bool("service-conditions", false, "report the provisioning of the load balancer in the Progressing, Ready and Degraded conditions of the services")
+		traceAllocations    = flag.Bool("trace-allocations", false, "record the decisions taken to allocate the IPs of a service in its metallb.universe.tf/allocation-trace annotation")
+		failOnEmptyPools    = flag.Bool("fail-on-empty-pools", false, "exit at startup if the configuration has no address pool with allocatable IPs")
+		failOnConfigError   = flag.Bool("fail-on-config-error", false, "exit at startup if the configuration is invalid, instead of logging the error and waiting for a valid one")
+		watchAnnouncements  = flag.Bool("watch-announcements", false, "watch the events the speakers raise when announcing a service, to release the IPs not announced within the announcementTimeout of their pool")
+		ipAgeCheckInterval  = flag.Duration("ip-age-check-interval", 0, "how often all the services are reprocessed to check for IPs older than the maxIPAgeHours of their pool, on top of the check done every time a service is processed. Disabled if 0")
+		migrateOrphanedIPs  = flag.Bool("migrate-orphaned-ips", false, "when the configuration takes the IPs of services out of the pools, withdraw them and allocate new ones instead of rejecting the configuration")
+		eventsInterval      = flag.Duration("events-interval", 0, "emit an event identical to the last one about a service at most once per interval, counting the repeats dropped meanwhile. Disabled if 0")
+		retryFailedAllocs   = flag.Bool("retry-failed-allocations", false, "retry allocating the IPs of the services whose allocation failed with an exponential backoff, on top of when IPs are released or the pools change")
+		retryBaseDelay      = flag.Duration("retry-base-delay", 0, "delay before retrying to process a service that failed, doubling at each failure. The controller-runtime default applies if 0")
+		retryMaxDelay       = flag.Duration("retry-max-delay", 0, "maximum delay before retrying to process a service that failed. The controller-runtime default applies if 0")
+		leaderElect         = flag.Bool("leader-elect", false, "elect a leader among the controller replicas with a Lease, only the leader allocating the IPs, and serve the state of the election on /api/v1/leader of the metrics port")
 	)
 	flag.Parse()
 
@@ -151,8 +444,26 @@ func main() {
 	}
 
 	c := &controller{
-		ips: allocator.New(),
+		ips:                    allocator.New(),
+		nodeFamilies:           map[string]ipfamily.Family{},
+		nodePodCIDRs:           map[string][]*net.IPNet{},
+		autodetected:           map[string]string{},
+		pending:                map[string]map[string]bool{},
+		ipAssignedAt:           map[string]time.Time{},
+		poolAnnotationsPrefix:  *poolAnnotations,
+		serviceConditions:      *serviceConditions,
+		traceAllocations:       *traceAllocations,
+		migrateOrphanedIPs:     *migrateOrphanedIPs,
+		failOnEmptyPools:       *failOnEmptyPools,
+		failOnConfigError:      *failOnConfigError,
+		retryFailedAllocations: *retryFailedAllocs,
+		configured:             make(chan struct{}),
+		fatal: func(err error) {
+			level.Error(logger).Log("op", "startup", "error", err, "msg", "refusing to start")
+			os.Exit(1)
+		},
 	}
+	c.ips.SetAuditLogger(logger)
 
 	bgpType, present := os.LookupEnv("METALLB_BGP_TYPE")
 	if !present {
@@ -173,6 +484,10 @@ func main() {
 		Listener: k8s.Listener{
 			ServiceChanged: c.SetBalancer,
 			PoolChanged:    c.SetPools,
+			NodeChanged:    c.SetNode,
+			NodeDeleted:    c.DeleteNode,
+
+			PoolConfigInvalid: c.SetPoolConfigInvalid,
 		},
 		ValidateConfig:      validation,
 		EnableWebhook:       true,
@@ -180,6 +495,27 @@ func main() {
 		CertDir:             *certDir,
 		CertServiceName:     *certServiceName,
 		LoadBalancerClass:   *loadBalancerClass,
+		DefaultLoadBalancer: *lbClassDefault,
+		LeaderElection:      *leaderElect,
+		LeaderElectionID:    "metallb-controller",
+		EventsInterval:      *eventsInterval,
+		RetryBaseDelay:      *retryBaseDelay,
+		RetryMaxDelay:       *retryMaxDelay,
+	}
+	cfg.Handlers = map[string]http.Handler{}
+	if *enablePoolStats {
+		c.poolStats = stats.New()
+		cfg.Handlers[stats.HandlerPath] = c.poolStats.Handler()
+	}
+	if *enableBudgets {
+		c.budgets = budget.New()
+		cfg.Handlers[budget.HandlerPath] = c.budgets.Handler()
+	}
+	if *watchAnnouncements {
+		c.announcements = newAnnouncements()
+		announced := make(chan net.IP)
+		cfg.AnnouncedIPs = announced
+		go c.announcements.watch(announced)
 	}
 	switch *webhookMode {
 	case "enabled":
@@ -206,9 +542,125 @@ func main() {
 		}
 	}
 
+	if *journalConfigMap != "" {
+		c.journal, err = journal.New(client.ConfigMapStore(*namespace, *journalConfigMap), journal.DefaultMaxEntries)
+		if err != nil {
+			level.Error(logger).Log("op", "startup", "error", err, "msg", "failed to load the allocation journal")
+			os.Exit(1)
+		}
+		level.Info(logger).Log("op", "startup", "services", len(c.journal.State()), "msg", "allocation journal loaded")
+		if *webhookMode != "onlywebhook" {
+			go func() {
+				// The services are synced once the leader applied the
+				// configuration.
+				<-client.Elected()
+				<-c.configured
+				c.pruneJournal(logger, client.ServiceKeys)
+			}()
+		}
+	}
+
+	if *speakerRegistry != "" {
+		go func() {
+			// Only the leader prunes the registry.
+			<-client.Elected()
+			pruneSpeakers(logger, client.SpeakerRegistry(*namespace, *speakerRegistry), *speakerLabels)
+		}()
+	}
+
+	if *remoteWriteURL != "" {
+		go remoteWrite(logger, remotewrite.New(*remoteWriteURL, *remoteWriteInterval), *remoteWriteInterval)
+	}
+
+	if *ipAgeCheckInterval > 0 && *webhookMode != "onlywebhook" {
+		go func() {
+			<-client.Elected()
+			resyncServices(client.ForceSync, *ipAgeCheckInterval)
+		}()
+	}
+
+	if *failOnEmptyPools && *webhookMode != "onlywebhook" {
+		go func() {
+			// Only the leader gets the configuration.
+			<-client.Elected()
+			c.waitForConfig(startupConfigTimeout)
+		}()
+	}
+
+	if c.announcements != nil {
+		c.announcements.expired = client.ForceSync
+	}
+
 	c.client = client
 	if err := client.Run(nil); err != nil {
 		level.Error(logger).Log("op", "startup", "error", err, "msg", "failed to run k8s client")
 		os.Exit(1)
 	}
 }
+
+// pruneJournal clears the services deleted while the controller was not
+// running from the journal, as their deletion is never processed.
+func (c *controller) pruneJournal(l log.Logger, services func() (map[string]bool, error)) {
+	before := time.Now()
+	keys, err := services()
+	if err != nil {
+		level.Error(l).Log("op", "journal", "error", err, "msg", "failed to list the services to prune the journal")
+		return
+	}
+	pruned, err := c.journal.Prune(func(svc string) bool { return keys[svc] }, before)
+	if err != nil {
+		level.Error(l).Log("op", "journal", "error", err, "msg", "failed to prune the journal")
+		return
+	}
+	for _, svc := range pruned {
+		level.Info(l).Log("op", "journal", "service", svc, "msg", "cleared deleted service from the journal")
+	}
+}
+
+// How often dead speakers are removed from the speaker registry.
+const speakersPruneInterval = time.Minute
+
+// pruneSpeakers periodically removes the speakers whose pod doesn't
+// exist anymore from the registry. The registry is an inventory of the
+// speakers: the controller doesn't use it to pick the speakers
+// announcing the services, which is still up to the speakers.
+func pruneSpeakers(l log.Logger, registry *k8s.SpeakerRegistry, labels string) {
+	for {
+		removed, err := registry.Prune(labels)
+		if err != nil {
+			level.Error(l).Log("op", "pruneSpeakers", "error", err, "msg", "failed to remove dead speakers from the registry")
+		}
+		for _, node := range removed {
+			level.Info(l).Log("op", "pruneSpeakers", "node", node, "msg", "removed dead speaker from the registry")
+		}
+		time.Sleep(speakersPruneInterval)
+	}
+}
+
+// resyncServices periodically reprocesses all the services, so the age
+// of their IPs is checked even when they don't change.
+func resyncServices(sync func(), interval time.Duration) {
+	for {
+		time.Sleep(interval)
+		sync()
+	}
+}
+
+// remoteWrite periodically pushes the pool utilization metrics to the
+// remote_write endpoint, so they are retained beyond the Prometheus
+// scraping the controller.
+func remoteWrite(l log.Logger, client *remotewrite.Client, interval time.Duration) {
+	for {
+		time.Sleep(interval)
+		series, err := remotewrite.FromGatherer(prometheus.DefaultGatherer, "metallb_allocator_", time.Now())
+		if err != nil {
+			level.Error(l).Log("op", "remoteWrite", "error", err, "msg", "failed to gather the pool metrics")
+			continue
+		}
+		if err := client.Write(context.Background(), series); err != nil {
+			level.Error(l).Log("op", "remoteWrite", "error", err, "msg", "failed to push the pool metrics")
+			continue
+		}
+		level.Debug(l).Log("op", "remoteWrite", "series", len(series), "msg", "pool metrics pushed")
+	}
+}
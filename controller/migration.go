@@ -0,0 +1,65 @@
+// SPDX-License-Identifier:Apache-2.0
+
+package main
+
+import (
+	"net"
+	"sort"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+
+	"go.universe.tf/metallb/internal/config"
+)
+
+// releaseOrphanedIPs releases the IPs of the services that don't fit
+// in the new pools anymore, so the new configuration can be applied.
+// The IPs still in the pools are kept. The services released are
+// tracked as migrating, to withdraw their IPs before allocating them
+// new ones.
+func (c *controller) releaseOrphanedIPs(l log.Logger, pools map[string]*config.Pool) {
+	names := make([]string, 0, len(c.pools))
+	for name := range c.pools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, key := range c.ips.ServicesInPool(name) {
+			ips := c.ips.IPs(key)
+			if poolContainsAll(pools, ips) {
+				continue
+			}
+			level.Info(l).Log("op", "setConfig", "pool", name, "service", key, "ip", ips, "msg", "IP not in the pools anymore, migrating the service")
+			c.announcements.forget(key)
+			if c.ips.Unassign(key) {
+				c.forgetIPAges(ips)
+				c.poolStats.Released(name, len(ips))
+				if err := c.journal.Clear(key); err != nil {
+					level.Error(l).Log("op", "journal", "error", err, "msg", "failed to record the release of the IPs in the journal")
+				}
+			}
+			if c.migrating == nil {
+				c.migrating = map[string]bool{}
+			}
+			c.migrating[key] = true
+		}
+	}
+}
+
+// poolContainsAll returns true if one of the pools contains all the
+// ips.
+func poolContainsAll(pools map[string]*config.Pool, ips []net.IP) bool {
+	for _, p := range pools {
+		contained := true
+		for _, ip := range ips {
+			if !p.ContainsIP(ip) {
+				contained = false
+				break
+			}
+		}
+		if contained {
+			return true
+		}
+	}
+	return false
+}
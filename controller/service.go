@@ -15,35 +15,81 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net"
 	"reflect"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 
+	"go.universe.tf/metallb/internal/allocationhook"
 	"go.universe.tf/metallb/internal/allocator"
 	"go.universe.tf/metallb/internal/allocator/k8salloc"
+	"go.universe.tf/metallb/internal/budget"
+	"go.universe.tf/metallb/internal/config"
 	"go.universe.tf/metallb/internal/ipfamily"
 )
 
 const (
-	annotationAddressPool     = "metallb.universe.tf/address-pool"
-	annotationLoadBalancerIPs = "metallb.universe.tf/loadBalancerIPs"
+	annotationAddressPool              = "metallb.universe.tf/address-pool"
+	annotationAllocationTrace          = "metallb.universe.tf/allocation-trace"
+	annotationIgnore                   = "metallb.universe.tf/ignore"
+	annotationLoadBalancerIPs          = "metallb.universe.tf/loadBalancerIPs"
+	annotationManagedPoolAnnotations   = "metallb.universe.tf/managed-pool-annotations"
+	annotationPoolSelectorLabels       = "metallb.universe.tf/pool-selector-labels"
+	annotationPreferSameIPFamilyAsNode = "metallb.universe.tf/prefer-same-ip-family-as-node"
+	annotationSimulate                 = "metallb.universe.tf/simulate"
+	annotationSimulatedIP              = "metallb.universe.tf/simulated-ip"
+	annotationSimulatedPool            = "metallb.universe.tf/simulated-pool"
+)
+
+// simulatedKeySuffix is appended to the key of a service holding IPs
+// to simulate its allocation.
+const simulatedKeySuffix = "#simulated"
+
+// The conditions reporting the provisioning of the load balancer of a
+// service, when enabled.
+const (
+	conditionProgressing = "Progressing"
+	conditionReady       = "Ready"
+	conditionDegraded    = "Degraded"
 )
 
 func (c *controller) convergeBalancer(l log.Logger, key string, svc *v1.Service) bool {
 	lbIPs := []net.IP{}
+	// The IPs of the service before it turned dual-stack, given back
+	// instead of the journaled ones if available.
+	var previousIPs []net.IP
 	var err error
+	// An ignored service is managed by something else, its status is
+	// left alone and the IPs it might hold are released.
+	if svc.Annotations[annotationIgnore] == "true" {
+		level.Debug(l).Log("event", "clearAssignment", "reason", "ignored", "msg", "service ignored")
+		c.dequeueAllocation(key)
+		c.releaseIPs(l, key, svc)
+		return true
+	}
+	simulate := svc.Annotations[annotationSimulate] == "true"
+	if !simulate {
+		delete(svc.Annotations, annotationSimulatedIP)
+		delete(svc.Annotations, annotationSimulatedPool)
+	}
 	// Not a LoadBalancer, early exit. It might have been a balancer
 	// in the past, so we still need to clear LB state.
 	if svc.Spec.Type != "LoadBalancer" {
 		level.Debug(l).Log("event", "clearAssignment", "reason", "notLoadBalancer", "msg", "not a LoadBalancer")
-		c.clearServiceState(key, svc)
+		c.dequeueAllocation(key)
+		c.clearServiceState(l, key, svc)
+		c.removeServiceConditions(svc)
 		// Early return, we explicitly do *not* want to reallocate
 		// an IP.
 		return true
@@ -53,10 +99,26 @@ func (c *controller) convergeBalancer(l log.Logger, key string, svc *v1.Service)
 	// ipFamily to use.
 	if len(svc.Spec.ClusterIPs) == 0 && svc.Spec.ClusterIP == "" {
 		level.Info(l).Log("event", "clearAssignment", "reason", "noClusterIPs", "msg", "No ClusterIPs")
-		c.clearServiceState(key, svc)
+		c.clearServiceState(l, key, svc)
+		c.removeServiceConditions(svc)
 		return true
 	}
 
+	// A simulated service is only told which IPs it would get. The
+	// allocator refuses to simulate for a key holding IPs, so a service
+	// already having IPs is simulated under another key, and keeps them
+	// to avoid an outage.
+	if simulate {
+		if len(svc.Status.LoadBalancer.Ingress) == 0 {
+			c.dequeueAllocation(key)
+			c.clearServiceState(l, key, svc)
+			c.removeServiceConditions(svc)
+			c.simulateAllocation(l, key, key, svc)
+			return true
+		}
+		c.simulateAllocation(l, key, key+simulatedKeySuffix, svc)
+	}
+
 	// The assigned LB IP(s) is the end state of convergence. If there's
 	// none or a malformed one, nuke all controlled state so that we
 	// start converging from a clean slate.
@@ -67,7 +129,7 @@ func (c *controller) convergeBalancer(l log.Logger, key string, svc *v1.Service)
 		}
 	}
 	if len(lbIPs) == 0 {
-		c.clearServiceState(key, svc)
+		c.clearServiceState(l, key, svc)
 	} else {
 		lbIPsIPFamily, err := ipfamily.ForAddressesIPs(lbIPs)
 		if err != nil {
@@ -82,13 +144,29 @@ func (c *controller) convergeBalancer(l log.Logger, key string, svc *v1.Service)
 			return true
 		}
 		// Clear the lbIP if it has a different ipFamily compared to the clusterIP.
-		// (this should not happen since the "ipFamily" of a service is immutable)
+		// This happens when the ipFamilyPolicy of the service changes, a
+		// single stack service turned dual-stack keeping its IP.
 		if lbIPsIPFamily != clusterIPsIPFamily {
-			c.clearServiceState(key, svc)
+			c.clearServiceState(l, key, svc)
+			if clusterIPsIPFamily == ipfamily.DualStack {
+				previousIPs = lbIPs
+			}
 			lbIPs = []net.IP{}
 		}
 	}
 
+	// The IPs a configuration change took out of the pools are withdrawn
+	// first, the service getting new ones once its cleared status is
+	// processed again, so the speakers don't announce both.
+	if len(lbIPs) != 0 && c.migrating[key] {
+		delete(c.migrating, key)
+		level.Info(l).Log("event", "clearAssignment", "reason", "ipMigrating", "msg", "IP not in the pools anymore, withdrawing it before allocating a new one")
+		c.client.Infof(svc, "IPMigrating", "IP %q not in the pools anymore, withdrawing it before allocating a new one", lbIPs)
+		c.clearServiceState(l, key, svc)
+		return true
+	}
+	delete(c.migrating, key)
+
 	// It's possible the config mutated and the IP we have no longer
 	// makes sense. If so, clear it out and give the rest of the logic
 	// a chance to allocate again.
@@ -97,7 +175,7 @@ func (c *controller) convergeBalancer(l log.Logger, key string, svc *v1.Service)
 		// otherwise it'll fail and tell us why.
 		if err = c.ips.Assign(key, lbIPs, k8salloc.Ports(svc), k8salloc.SharingKey(svc), k8salloc.BackendKey(svc)); err != nil {
 			level.Info(l).Log("event", "clearAssignment", "error", err, "msg", "current IP not allowed by config, clearing")
-			c.clearServiceState(key, svc)
+			c.clearServiceState(l, key, svc)
 			// Check if we cannot assign IP because services were sharing IP using
 			// "allow-shared-ip" annotation and one of them changed so instead of allocating
 			// new service IP we fail.
@@ -112,11 +190,28 @@ func (c *controller) convergeBalancer(l log.Logger, key string, svc *v1.Service)
 		// requested a different pool than the one that is currently
 		// allocated.
 		desiredPool := svc.Annotations[annotationAddressPool]
-		if len(lbIPs) != 0 && desiredPool != "" && c.ips.Pool(key) != desiredPool {
+		if len(lbIPs) != 0 && desiredPool != "" && !c.satisfiesPool(c.ips.Pool(key), desiredPool, nil) {
 			level.Info(l).Log("event", "clearAssignment", "reason", "differentPoolRequested", "msg", "user requested a different pool than the one currently assigned")
-			c.clearServiceState(key, svc)
+			c.clearServiceState(l, key, svc)
 			lbIPs = []net.IP{}
 		}
+		// Or the pool labels it selects.
+		if selector, ok := svc.Annotations[annotationPoolSelectorLabels]; ok && len(lbIPs) != 0 {
+			want, err := labels.ConvertSelectorToLabelsMap(selector)
+			if err == nil && !c.satisfiesPool(c.ips.Pool(key), "", want) {
+				level.Info(l).Log("event", "clearAssignment", "reason", "differentPoolRequested", "msg", "user requested pool labels the currently assigned pool doesn't have")
+				c.clearServiceState(l, key, svc)
+				lbIPs = []net.IP{}
+			}
+		}
+		// Or the pool doesn't give IPs to the service anymore.
+		if len(lbIPs) != 0 {
+			if err := c.checkPoolAllowed(c.ips.Pool(key), svc); err != nil {
+				level.Info(l).Log("event", "clearAssignment", "reason", "poolNotAllowed", "error", err, "msg", "current pool doesn't allow the service anymore, clearing")
+				c.clearServiceState(l, key, svc)
+				lbIPs = []net.IP{}
+			}
+		}
 		// User set or changed the desired LB IP(s), nuke the
 		// state. allocateIP will pay attention to LoadBalancerIP(s) and try
 		// to meet the user's demands.
@@ -124,34 +219,88 @@ func (c *controller) convergeBalancer(l log.Logger, key string, svc *v1.Service)
 		if err != nil {
 			level.Error(l).Log("event", "loadbalancerIP", "error", err, "msg", "invalid requested loadbalancer IPs")
 			c.client.Errorf(svc, "LoadBalancerFailed", "invalid requested loadbalancer IPs: %s", err)
+			// The service keeps its current IPs, so it stays ready.
+			c.setServiceCondition(svc, conditionDegraded, metav1.ConditionTrue, "InvalidRequestedIP", fmt.Sprintf("Invalid requested loadbalancer IPs: %s", err))
 			return true
 		}
 		if len(desiredLbIPs) > 0 && !isEqualIPs(lbIPs, desiredLbIPs) {
 			level.Info(l).Log("event", "clearAssignment", "reason", "differentIPRequested", "msg", "user requested a different IP than the one currently assigned")
-			c.clearServiceState(key, svc)
+			c.clearServiceState(l, key, svc)
 			lbIPs = []net.IP{}
 		}
 	}
 
 	// If lbIP is still nil at this point, try to allocate.
+	allocated := false
 	if len(lbIPs) == 0 {
-		lbIPs, err = c.allocateIPs(key, svc)
+		c.setServiceCondition(svc, conditionProgressing, metav1.ConditionTrue, "AllocatingIP", "Allocating an IP")
+		trace := c.newAllocationTrace()
+		defer setAllocationTrace(svc, trace)
+		if previousIPs == nil {
+			previousIPs = c.journal.IPs(key)
+		}
+		lbIPs, err = c.allocateIPsWithTrace(key, svc, previousIPs, trace)
 		if err != nil {
+			waited := c.waitedPools(svc)
+			if fullPool, full := c.allocationQueueFull(key, waited); full {
+				level.Error(l).Log("op", "allocateIPs", "pool", fullPool, "error", err, "msg", "too many services waiting for an IP from the pool")
+				c.client.Errorf(svc, "AllocationQueueFull", "Too many services waiting for an IP from pool %q", fullPool)
+				c.setServiceFailed(svc, "AllocationQueueFull", fmt.Sprintf("Too many services waiting for an IP from pool %q", fullPool))
+				return true
+			}
 			level.Error(l).Log("op", "allocateIPs", "error", err, "msg", "IP allocation failed")
 			c.client.Errorf(svc, "AllocationFailed", "Failed to allocate IP for %q: %s", key, err)
+			reason := "AllocationFailed"
+			if _, _, err := getDesiredLbIPs(svc); err != nil {
+				reason = "InvalidRequestedIP"
+			}
+			c.setServiceFailed(svc, reason, fmt.Sprintf("Failed to allocate IP: %s", err))
+			c.queueAllocation(key, waited)
 			// The outer controller loop will retry converging this
-			// service when another service gets deleted, so there's
-			// nothing to do here but wait to get called again later.
+			// service when another service gives back its IPs or the
+			// pools change, so there's nothing to do here but wait to
+			// get called again later.
 			return true
 		}
+		allocated = true
+		c.dequeueAllocation(key)
+		c.poolStats.Allocated(c.ips.Pool(key), svc.Namespace, len(lbIPs))
+		if quota, err := c.checkQuota(key, svc, lbIPs); err != nil {
+			level.Error(l).Log("op", "allocateIPs", "quota", quota.Name, "error", err, "msg", "IP allocation exceeds quota")
+			c.client.Errorf(svc, "QuotaExceeded", "Failed to allocate IP for %q: %s", key, err)
+			c.client.QuotaErrorf(quota.Name, "QuotaExceeded", "Rejected IP allocation for %q: %s", key, err)
+			trace.add("rejected by quota %q: %s", quota.Name, err)
+			c.clearServiceState(l, key, svc)
+			c.setServiceFailed(svc, "QuotaExceeded", fmt.Sprintf("Failed to allocate IP: %s", err))
+			return true
+		}
+		if err := c.checkAllocationHook(l, key, svc, lbIPs); err != nil {
+			level.Error(l).Log("op", "allocateIPs", "error", err, "msg", "IP allocation rejected")
+			c.client.Errorf(svc, "AllocationRejected", "Failed to allocate IP for %q: %s", key, err)
+			trace.add("rejected: %s", err)
+			c.clearServiceState(l, key, svc)
+			c.setServiceFailed(svc, "AllocationRejected", fmt.Sprintf("Failed to allocate IP: %s", err))
+			return true
+		}
+		if err := c.journal.Assign(key, lbIPs); err != nil {
+			level.Error(l).Log("op", "journal", "error", err, "msg", "failed to record the allocation in the journal")
+		}
+		trace.add("assigned %s from pool %q", ipsString(lbIPs), c.ips.Pool(key))
 		level.Info(l).Log("event", "ipAllocated", "ip", lbIPs, "msg", "IP address assigned by controller")
 		c.client.Infof(svc, "IPAllocated", "Assigned IP %q", lbIPs)
+		if svc.Annotations[annotationPreferSameIPFamilyAsNode] == "true" {
+			nodeFamily := c.nodesFamily()
+			if nodeFamily != ipfamily.Unknown && !hasFamily(lbIPs, nodeFamily) {
+				level.Warn(l).Log("event", "ipFamilyMismatch", "ip", lbIPs, "nodefamily", nodeFamily, "msg", "assigned IP does not match the ip family of the nodes")
+				c.client.Errorf(svc, "IPFamilyMismatch", "Assigned IP %q does not match the %s family of the nodes", lbIPs, nodeFamily)
+			}
+		}
 	}
 
 	if len(lbIPs) == 0 {
 		level.Error(l).Log("bug", "true", "msg", "internal error: failed to allocate an IP, but did not exit convergeService early!")
 		c.client.Errorf(svc, "InternalError", "didn't allocate an IP but also did not fail")
-		c.clearServiceState(key, svc)
+		c.clearServiceState(l, key, svc)
 		return true
 	}
 
@@ -159,7 +308,14 @@ func (c *controller) convergeBalancer(l log.Logger, key string, svc *v1.Service)
 	if pool == "" || c.pools[pool] == nil {
 		level.Error(l).Log("bug", "true", "ip", lbIPs, "msg", "internal error: allocated IP has no matching address pool")
 		c.client.Errorf(svc, "InternalError", "allocated an IP that has no pool")
-		c.clearServiceState(key, svc)
+		c.clearServiceState(l, key, svc)
+		return true
+	}
+
+	if c.checkIPAge(l, key, svc, pool, lbIPs) {
+		return true
+	}
+	if c.checkAnnouncement(l, key, svc, pool, lbIPs, allocated) {
 		return true
 	}
 
@@ -170,17 +326,219 @@ func (c *controller) convergeBalancer(l log.Logger, key string, svc *v1.Service)
 		lbIngressIPs = append(lbIngressIPs, v1.LoadBalancerIngress{IP: lbIP.String()})
 	}
 	svc.Status.LoadBalancer.Ingress = lbIngressIPs
+	c.setPoolAnnotations(svc, c.pools[pool].Annotations)
+	c.updatePoolStats(pool)
+	message := fmt.Sprintf("Assigned IP %q from pool %q", lbIPs, pool)
+	c.setServiceCondition(svc, conditionProgressing, metav1.ConditionFalse, "IPAssigned", message)
+	c.setServiceCondition(svc, conditionReady, metav1.ConditionTrue, "IPAssigned", message)
+	c.setServiceCondition(svc, conditionDegraded, metav1.ConditionFalse, "IPAssigned", message)
 	return true
 }
 
+// setServiceCondition sets the given condition in the status of svc, if
+// the service conditions are enabled. The transition time changes only
+// when the status of the condition does, so that a converged service
+// is not updated again.
+func (c *controller) setServiceCondition(svc *v1.Service, conditionType string, status metav1.ConditionStatus, reason, message string) {
+	if !c.serviceConditions {
+		return
+	}
+	meta.SetStatusCondition(&svc.Status.Conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		ObservedGeneration: svc.Generation,
+		Reason:             reason,
+		Message:            message,
+	})
+}
+
+// setServiceFailed marks svc as degraded, and not ready, after a failed
+// allocation. The service stays progressing, as the allocation is
+// retried later.
+func (c *controller) setServiceFailed(svc *v1.Service, reason, message string) {
+	c.setServiceCondition(svc, conditionReady, metav1.ConditionFalse, reason, message)
+	c.setServiceCondition(svc, conditionDegraded, metav1.ConditionTrue, reason, message)
+}
+
+// removeServiceConditions removes the conditions managed by the
+// controller from the status of svc.
+func (c *controller) removeServiceConditions(svc *v1.Service) {
+	if !c.serviceConditions {
+		return
+	}
+	for _, t := range []string{conditionProgressing, conditionReady, conditionDegraded} {
+		meta.RemoveStatusCondition(&svc.Status.Conditions, t)
+	}
+}
+
 // clearServiceState clears all fields that are actively managed by
 // this controller.
-func (c *controller) clearServiceState(key string, svc *v1.Service) {
-	c.ips.Unassign(key)
+func (c *controller) clearServiceState(l log.Logger, key string, svc *v1.Service) {
+	c.releaseIPs(l, key, svc)
 	svc.Status.LoadBalancer = v1.LoadBalancerStatus{}
+	c.setPoolAnnotations(svc, nil)
 }
 
-func (c *controller) allocateIPs(key string, svc *v1.Service) ([]net.IP, error) {
+// releaseIPs gives the IPs of the service back to the allocator.
+func (c *controller) releaseIPs(l log.Logger, key string, svc *v1.Service) {
+	c.announcements.forget(key)
+	pool, ips := c.ips.Pool(key), c.ips.IPs(key)
+	if c.ips.Unassign(key) {
+		c.forgetIPAges(ips)
+		c.poolStats.Released(pool, len(ips))
+		c.updatePoolStats(pool)
+		if err := c.journal.Clear(key); err != nil {
+			level.Error(l).Log("op", "journal", "error", err, "msg", "failed to record the release of the IPs in the journal")
+		}
+		c.client.Infof(svc, "IPReleased", "Released IP %q", ips)
+	}
+}
+
+// checkIPAge records when the IPs of the service were first seen, and
+// warns if they are older than the maximum age of the pool. It returns
+// true if the IPs were released to be allocated again, in which case
+// the service is processed again once its status is cleared.
+func (c *controller) checkIPAge(l log.Logger, key string, svc *v1.Service, pool string, lbIPs []net.IP) bool {
+	if c.ipAssignedAt == nil {
+		c.ipAssignedAt = map[string]time.Time{}
+	}
+	now := time.Now()
+	var oldest time.Time
+	for _, ip := range lbIPs {
+		assignedAt, ok := c.ipAssignedAt[ip.String()]
+		if !ok {
+			assignedAt = now
+			c.ipAssignedAt[ip.String()] = now
+		}
+		if oldest.IsZero() || assignedAt.Before(oldest) {
+			oldest = assignedAt
+		}
+	}
+
+	maxAge := time.Duration(c.pools[pool].MaxIPAgeHours) * time.Hour
+	age := now.Sub(oldest)
+	if maxAge == 0 || age <= maxAge {
+		return false
+	}
+	level.Warn(l).Log("event", "staleIP", "ip", lbIPs, "pool", pool, "age", age, "msg", "IP assigned for longer than the maximum age of the pool")
+	c.client.Errorf(svc, "StaleIPAllocation", "IP %q assigned for %s, more than the %d hours allowed by pool %q", lbIPs, age.Round(time.Minute), c.pools[pool].MaxIPAgeHours, pool)
+	if !c.pools[pool].ForceRecycle {
+		return false
+	}
+	level.Info(l).Log("event", "clearAssignment", "reason", "staleIP", "msg", "recycling the stale IP")
+	c.clearServiceState(l, key, svc)
+	// The IPs might still be shared with other services, their age
+	// starts over so that the service can get them back.
+	for _, ip := range lbIPs {
+		delete(c.ipAssignedAt, ip.String())
+	}
+	return true
+}
+
+// forgetIPAges removes the age of the IPs that are not allocated to
+// any service anymore.
+func (c *controller) forgetIPAges(ips []net.IP) {
+	for _, ip := range ips {
+		if len(c.ips.ServicesOnIP(ip)) == 0 {
+			delete(c.ipAssignedAt, ip.String())
+		}
+	}
+}
+
+// updatePoolStats records the current utilization of the pool in the
+// pool statistics, and the budgets of the namespaces having a quota on
+// it.
+func (c *controller) updatePoolStats(pool string) {
+	c.poolStats.SetUtilization(pool, c.ips.IPsInUse(pool), c.ips.PoolCapacity(pool))
+	if c.budgets == nil || c.pools[pool] == nil {
+		return
+	}
+	usages := map[string]budget.Usage{}
+	for ns, quota := range c.pools[pool].Quotas {
+		// Only a quota on the IPs of the whole namespace is a budget.
+		if quota.MaxIPs == 0 {
+			continue
+		}
+		usages[ns] = budget.Usage{Total: quota.MaxIPs, Used: c.ips.CountInPoolForNamespace(pool, ns)}
+	}
+	c.budgets.SetPool(pool, usages)
+}
+
+// setPoolAnnotations replaces the pool annotations of svc with the
+// given ones, under the configured prefix. Only the annotations
+// previously added by setPoolAnnotations are removed, the others are
+// left alone even if they have the prefix.
+func (c *controller) setPoolAnnotations(svc *v1.Service, annotations map[string]string) {
+	if managed, ok := svc.Annotations[annotationManagedPoolAnnotations]; ok {
+		for _, k := range strings.Split(managed, ",") {
+			delete(svc.Annotations, k)
+		}
+		delete(svc.Annotations, annotationManagedPoolAnnotations)
+	}
+	if c.poolAnnotationsPrefix == "" || len(annotations) == 0 {
+		return
+	}
+	if svc.Annotations == nil {
+		svc.Annotations = map[string]string{}
+	}
+	keys := make([]string, 0, len(annotations))
+	for k, v := range annotations {
+		svc.Annotations[c.poolAnnotationsPrefix+k] = v
+		keys = append(keys, c.poolAnnotationsPrefix+k)
+	}
+	sort.Strings(keys)
+	svc.Annotations[annotationManagedPoolAnnotations] = strings.Join(keys, ",")
+}
+
+// simulateAllocation records the IPs svc would get, and their pool, in
+// its annotations, without assigning them. The allocation is simulated
+// under simKey, which differs from key when the service holds IPs.
+func (c *controller) simulateAllocation(l log.Logger, key, simKey string, svc *v1.Service) {
+	var previous []net.IP
+	if v := svc.Annotations[annotationSimulatedIP]; v != "" {
+		for _, s := range strings.Split(v, ",") {
+			if ip := net.ParseIP(s); ip != nil {
+				previous = append(previous, ip)
+			}
+		}
+	}
+	ips, pool, err := c.ips.Simulate(simKey, func() ([]net.IP, error) {
+		ips, err := c.allocateIPs(simKey, svc, previous)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := c.checkQuota(simKey, svc, ips); err != nil {
+			return nil, err
+		}
+		return ips, nil
+	})
+	if err != nil {
+		level.Info(l).Log("event", "allocationSimulated", "error", err, "msg", "simulated IP allocation failed")
+		c.client.Errorf(svc, "SimulationFailed", "Simulated IP allocation for %q failed: %s", key, err)
+		delete(svc.Annotations, annotationSimulatedIP)
+		delete(svc.Annotations, annotationSimulatedPool)
+		return
+	}
+
+	value := ipsString(ips)
+	if svc.Annotations[annotationSimulatedIP] == value && svc.Annotations[annotationSimulatedPool] == pool {
+		return
+	}
+	level.Info(l).Log("event", "allocationSimulated", "ip", value, "pool", pool, "msg", "simulated IP allocation")
+	c.client.Infof(svc, "AllocationSimulated", "Would assign IP %q from pool %q", ips, pool)
+	svc.Annotations[annotationSimulatedIP] = value
+	svc.Annotations[annotationSimulatedPool] = pool
+}
+
+// allocateIPs allocates IPs to svc. The previous IPs of the service,
+// if any, are preferred when they are still available.
+func (c *controller) allocateIPs(key string, svc *v1.Service, previous []net.IP) ([]net.IP, error) {
+	return c.allocateIPsWithTrace(key, svc, previous, nil)
+}
+
+// allocateIPsWithTrace allocates the IPs of svc like allocateIPs, and
+// records the decisions taken in trace, if not nil.
+func (c *controller) allocateIPsWithTrace(key string, svc *v1.Service, previous []net.IP, trace *allocationTrace) ([]net.IP, error) {
 	if len(svc.Spec.ClusterIPs) == 0 && svc.Spec.ClusterIP == "" {
 		// (we should never get here because the caller ensured that Spec.ClusterIP != nil)
 		return nil, fmt.Errorf("invalid ClusterIPs [%v] [%s], can't determine family", svc.Spec.ClusterIPs, svc.Spec.ClusterIP)
@@ -198,26 +556,442 @@ func (c *controller) allocateIPs(key string, svc *v1.Service) ([]net.IP, error)
 
 	// If the user asked for a specific IPs, try that.
 	if len(desiredLbIPs) > 0 {
+		trace.add("requested IPs %s", ipsString(desiredLbIPs))
 		if serviceIPFamily != desiredLbIPFamily {
 			return nil, fmt.Errorf("requested loadBalancer IP(s) %q does not match the ipFamily of the service", desiredLbIPs)
 		}
 		if err := c.ips.Assign(key, desiredLbIPs, k8salloc.Ports(svc), k8salloc.SharingKey(svc), k8salloc.BackendKey(svc)); err != nil {
+			trace.add("requested IPs not available: %s", err)
+			return nil, err
+		}
+		if err := c.checkPoolAllowed(c.ips.Pool(key), svc); err != nil {
+			trace.add("requested IPs not allowed: %s", err)
+			c.ips.Unassign(key)
 			return nil, err
 		}
 		return desiredLbIPs, nil
 	}
-	// Otherwise, did the user ask for a specific pool?
+	// Otherwise, did the user ask for a specific pool, or for the pools
+	// having some labels?
 	desiredPool := svc.Annotations[annotationAddressPool]
+	var poolSelector labels.Set
+	if s, ok := svc.Annotations[annotationPoolSelectorLabels]; ok {
+		if desiredPool != "" {
+			return nil, fmt.Errorf("%s and %s can't be used together", annotationAddressPool, annotationPoolSelectorLabels)
+		}
+		poolSelector, err = labels.ConvertSelectorToLabelsMap(s)
+		if err != nil || len(poolSelector) == 0 {
+			return nil, fmt.Errorf("invalid %s %q", annotationPoolSelectorLabels, s)
+		}
+	}
+
+	// If the service had IPs, try to give them back. A single stack
+	// service turned dual-stack keeps its IP, and gets one of the other
+	// family from the same pool.
+	if ips := previous; len(ips) > 0 {
+		trace.add("trying the previous IPs %s", ipsString(ips))
+		family, err := ipfamily.ForAddressesIPs(ips)
+		if err == nil && family != serviceIPFamily && serviceIPFamily == ipfamily.DualStack && len(ips) == 1 {
+			ips, err = c.ips.AllocateOtherFamily(key, k8salloc.Meta(svc), ips[0], k8salloc.Ports(svc), k8salloc.SharingKey(svc), k8salloc.BackendKey(svc), k8salloc.HighPriority(svc))
+			if err == nil {
+				trace.add("added %s of the other family to the previous IP", ipsString(ips[1:]))
+				family = serviceIPFamily
+			} else {
+				ips = previous
+			}
+		}
+		if err == nil && family == serviceIPFamily &&
+			c.ips.Assign(key, ips, k8salloc.Ports(svc), k8salloc.SharingKey(svc), k8salloc.BackendKey(svc)) == nil {
+			pool := c.ips.Pool(key)
+			if c.satisfiesPool(pool, desiredPool, poolSelector) && c.checkPoolAllowed(pool, svc) == nil {
+				return ips, nil
+			}
+			trace.add("skipped the previous IPs: pool %q not requested", pool)
+			c.ips.Unassign(key)
+		} else {
+			trace.add("skipped the previous IPs: not available")
+		}
+	}
+
 	if desiredPool != "" {
-		ips, err := c.ips.AllocateFromPool(key, serviceIPFamily, desiredPool, k8salloc.Ports(svc), k8salloc.SharingKey(svc), k8salloc.BackendKey(svc))
+		trace.add("requested pool %q", desiredPool)
+		ips, err := c.allocateFromPool(key, svc, serviceIPFamily, desiredPool, trace)
 		if err != nil {
 			return nil, err
 		}
 		return ips, nil
 	}
 
-	// Okay, in that case just bruteforce across all pools.
-	return c.ips.Allocate(key, serviceIPFamily, k8salloc.Ports(svc), k8salloc.SharingKey(svc), k8salloc.BackendKey(svc))
+	if poolSelector != nil {
+		poolNames := c.poolsWithLabels(poolSelector)
+		trace.add("pools with the labels %q: %s", poolSelector.String(), strings.Join(poolNames, ","))
+		err := fmt.Errorf("no pool has the labels %q", poolSelector.String())
+		for _, poolName := range poolNames {
+			var ips []net.IP
+			ips, err = c.allocateFromPool(key, svc, serviceIPFamily, poolName, trace)
+			if err == nil {
+				return ips, nil
+			}
+		}
+		return nil, err
+	}
+
+	// If the user asked for the same family of the nodes, try the pools
+	// having addresses of that family first.
+	if svc.Annotations[annotationPreferSameIPFamilyAsNode] == "true" {
+		if nodeFamily := c.nodesFamily(); nodeFamily != ipfamily.Unknown {
+			trace.add("preferring the pools of the %s family of the nodes", nodeFamily)
+			for _, poolName := range c.poolsWithFamily(nodeFamily) {
+				ips, err := c.allocateFromPool(key, svc, serviceIPFamily, poolName, trace)
+				if err == nil {
+					return ips, nil
+				}
+			}
+		}
+	}
+
+	// Okay, in that case just bruteforce across all pools. The pools
+	// failing over to their backup pool are tried one by one.
+	trace.add("trying all the pools")
+	if c.hasFailoverGroups() || c.hasServiceAllocations() {
+		err := errors.New("no available IPs")
+		for _, poolName := range c.autoAssignPools() {
+			var ips []net.IP
+			ips, err = c.allocateFromPool(key, svc, serviceIPFamily, poolName, trace)
+			if err == nil {
+				return ips, nil
+			}
+		}
+		trace.add("no pool available: %s", err)
+		return nil, err
+	}
+	ips, err := c.ips.Allocate(key, k8salloc.Meta(svc), serviceIPFamily, k8salloc.Ports(svc), k8salloc.SharingKey(svc), k8salloc.BackendKey(svc), k8salloc.HighPriority(svc))
+	if err != nil {
+		trace.add("no pool available: %s", err)
+	}
+	return ips, err
+}
+
+// allocateFromPool allocates the IPs of svc from the given pool, or
+// from its backup pool when the failover of the pool is active or the
+// pool has no IP left, recording the attempts in trace.
+func (c *controller) allocateFromPool(key string, svc *v1.Service, family ipfamily.Family, pool string, trace *allocationTrace) ([]net.IP, error) {
+	backup, skipPrimary := c.failoverBackup(pool)
+	if skipPrimary {
+		trace.add("pool %q failed over to pool %q", pool, backup)
+		return c.tryPool(key, svc, family, backup, trace)
+	}
+	ips, err := c.tryPool(key, svc, family, pool, trace)
+	if err != nil && backup != "" && c.pools[pool].FailoverGroup.Condition == config.FailoverPoolExhausted {
+		trace.add("falling back to the backup pool %q of pool %q", backup, pool)
+		return c.tryPool(key, svc, family, backup, trace)
+	}
+	return ips, err
+}
+
+// tryPool allocates the IPs of svc from the given pool only, recording
+// the attempt in trace.
+func (c *controller) tryPool(key string, svc *v1.Service, family ipfamily.Family, pool string, trace *allocationTrace) ([]net.IP, error) {
+	if err := c.checkPoolAllowed(pool, svc); err != nil {
+		trace.add("skipped pool %q: %s", pool, err)
+		return nil, err
+	}
+	trace.add("trying pool %q: %d/%d IPs used", pool, c.ips.IPsInUse(pool), c.ips.PoolCapacity(pool))
+	ips, err := c.ips.AllocateFromPool(key, k8salloc.Meta(svc), family, pool, k8salloc.Ports(svc), k8salloc.SharingKey(svc), k8salloc.BackendKey(svc), k8salloc.HighPriority(svc))
+	if err != nil {
+		trace.add("skipped pool %q: %s", pool, err)
+	}
+	return ips, err
+}
+
+// allocationTrace records the decisions taken to allocate the IPs of a
+// service. A nil allocationTrace records nothing.
+type allocationTrace []string
+
+func (t *allocationTrace) add(format string, args ...interface{}) {
+	if t == nil {
+		return
+	}
+	*t = append(*t, fmt.Sprintf(format, args...))
+}
+
+// newAllocationTrace returns an empty trace if the allocations are
+// traced, nil otherwise.
+func (c *controller) newAllocationTrace() *allocationTrace {
+	if !c.traceAllocations {
+		return nil
+	}
+	return &allocationTrace{}
+}
+
+// setAllocationTrace records trace in the annotations of svc, or
+// removes the trace of a previous allocation if trace is nil.
+func setAllocationTrace(svc *v1.Service, trace *allocationTrace) {
+	if trace == nil {
+		delete(svc.Annotations, annotationAllocationTrace)
+		return
+	}
+	if svc.Annotations == nil {
+		svc.Annotations = map[string]string{}
+	}
+	svc.Annotations[annotationAllocationTrace] = strings.Join(*trace, "; ")
+}
+
+func ipsString(ips []net.IP) string {
+	res := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		res = append(res, ip.String())
+	}
+	return strings.Join(res, ",")
+}
+
+// checkQuota verifies that the IPs allocated to svc don't exceed the
+// quota of its namespace on the pool they come from. If they do, the
+// exceeded quota is returned along with the error.
+func (c *controller) checkQuota(key string, svc *v1.Service, lbIPs []net.IP) (*config.Quota, error) {
+	pool := c.ips.Pool(key)
+	if pool == "" || c.pools[pool] == nil {
+		return nil, nil
+	}
+	quota := c.pools[pool].Quotas[svc.Namespace]
+	if quota == nil {
+		return nil, nil
+	}
+	if quota.MaxIPsPerService > 0 && len(lbIPs) > quota.MaxIPsPerService {
+		return quota, fmt.Errorf("service would get %d IPs from pool %q, quota allows %d per service", len(lbIPs), pool, quota.MaxIPsPerService)
+	}
+	if quota.MaxIPs > 0 {
+		if inUse := c.ips.CountInPoolForNamespace(pool, svc.Namespace); inUse > quota.MaxIPs {
+			return quota, fmt.Errorf("namespace %q would use %d IPs from pool %q, quota allows %d", svc.Namespace, inUse, pool, quota.MaxIPs)
+		}
+	}
+	return nil, nil
+}
+
+// checkAllocationHook asks the allocation hook of the pool the IPs of
+// svc come from, if any, to approve them. When the hook fails, the
+// allocation is rejected unless the hook fails open.
+func (c *controller) checkAllocationHook(l log.Logger, key string, svc *v1.Service, lbIPs []net.IP) error {
+	pool := c.ips.Pool(key)
+	if pool == "" || c.pools[pool] == nil || c.pools[pool].AllocationHook == nil {
+		return nil
+	}
+	hook := c.pools[pool].AllocationHook
+	res, err := allocationhook.Call(context.TODO(), hook.URL, hook.Timeout, allocationhook.Request{
+		Service:   svc.Name,
+		Namespace: svc.Namespace,
+		IP:        ipsString(lbIPs),
+		Pool:      pool,
+	})
+	if err != nil {
+		if hook.FailOpen {
+			level.Warn(l).Log("op", "allocationHook", "pool", pool, "error", err, "msg", "allocation hook failed, allowing the allocation")
+			return nil
+		}
+		return fmt.Errorf("allocation hook of pool %q failed: %w", pool, err)
+	}
+	if !res.Approved {
+		return fmt.Errorf("rejected by the allocation hook of pool %q: %s", pool, res.Reason)
+	}
+	return nil
+}
+
+// allocationQueueFull returns the pool among the given ones that has
+// reached its limit of services waiting for an IP, and true if there is
+// one and svc is not one of them.
+func (c *controller) allocationQueueFull(svc string, pools []string) (string, bool) {
+	for _, p := range pools {
+		waiting := c.pending[p]
+		if !waiting[svc] && len(waiting) >= c.pools[p].MaxPendingAllocations {
+			return p, true
+		}
+	}
+	return "", false
+}
+
+// queueAllocation tracks svc as waiting for an IP from the given pools.
+func (c *controller) queueAllocation(svc string, pools []string) {
+	if c.unallocated == nil {
+		c.unallocated = map[string]bool{}
+	}
+	c.unallocated[svc] = true
+	for _, p := range pools {
+		if c.pending == nil {
+			c.pending = map[string]map[string]bool{}
+		}
+		if c.pending[p] == nil {
+			c.pending[p] = map[string]bool{}
+		}
+		c.pending[p][svc] = true
+	}
+}
+
+// waitedPools returns the pools with a limit of services waiting for an
+// IP that svc waits for after failing to get one: the pool it requests,
+// the pools having the labels it selects, or the auto-assign pools,
+// restricted to the ones having addresses of its family. A service
+// requesting specific IPs doesn't wait for a pool.
+func (c *controller) waitedPools(svc *v1.Service) []string {
+	if ips, _, err := getDesiredLbIPs(svc); err != nil || len(ips) > 0 {
+		return nil
+	}
+	family, err := ipfamily.ForService(svc)
+	if err != nil {
+		return nil
+	}
+	var candidates []string
+	if pool := svc.Annotations[annotationAddressPool]; pool != "" {
+		candidates = []string{pool}
+	} else if s, ok := svc.Annotations[annotationPoolSelectorLabels]; ok {
+		selector, err := labels.ConvertSelectorToLabelsMap(s)
+		if err != nil {
+			return nil
+		}
+		candidates = c.poolsWithLabels(selector)
+	} else {
+		candidates = c.autoAssignPools()
+	}
+	res := []string{}
+	for _, name := range candidates {
+		p := c.pools[name]
+		if p == nil || p.MaxPendingAllocations == 0 || !poolHasFamily(p, family) {
+			continue
+		}
+		res = append(res, name)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// dequeueAllocation stops tracking svc as waiting for an IP.
+func (c *controller) dequeueAllocation(svc string) {
+	delete(c.unallocated, svc)
+	for pool, waiting := range c.pending {
+		delete(waiting, svc)
+		if len(waiting) == 0 {
+			delete(c.pending, pool)
+		}
+	}
+}
+
+// nodesFamily returns the family of the primary address shared by all
+// the nodes of the cluster, or Unknown if they don't agree.
+func (c *controller) nodesFamily() ipfamily.Family {
+	res := ipfamily.Unknown
+	for _, f := range c.nodeFamilies {
+		if f == ipfamily.Unknown {
+			continue
+		}
+		if res != ipfamily.Unknown && res != f {
+			return ipfamily.Unknown
+		}
+		res = f
+	}
+	return res
+}
+
+// poolsWithFamily returns the names of the auto-assignable pools, in
+// the order they are tried, having at least one CIDR of the given
+// family.
+func (c *controller) poolsWithFamily(family ipfamily.Family) []string {
+	res := []string{}
+	for _, name := range c.autoAssignPools() {
+		for _, cidr := range c.pools[name].CIDR {
+			if ipfamily.ForCIDR(cidr) == family {
+				res = append(res, name)
+				break
+			}
+		}
+	}
+	return res
+}
+
+// autoAssignPools returns the names of the pools the IPs are
+// automatically assigned from, in the order they are tried.
+func (c *controller) autoAssignPools() []string {
+	return c.ips.AutoAssignPools()
+}
+
+// hasServiceAllocations returns true if one of the pools restricts the
+// services it gives IPs to.
+func (c *controller) hasServiceAllocations() bool {
+	for _, p := range c.pools {
+		if p.ServiceAllocation != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// checkPoolAllowed returns an error if svc can't get IPs from the given
+// pool.
+func (c *controller) checkPoolAllowed(pool string, svc *v1.Service) error {
+	p := c.pools[pool]
+	if p == nil {
+		return nil
+	}
+	if !p.AllowsNamespace(svc.Namespace) {
+		return fmt.Errorf("pool %q doesn't allow the services of namespace %q", pool, svc.Namespace)
+	}
+	if !p.AllowsServiceLabels(svc.Labels) {
+		return fmt.Errorf("pool %q doesn't allow the service, its labels match none of the pool service selectors", pool)
+	}
+	return nil
+}
+
+// poolsWithLabels returns the sorted names of the pools having all the
+// given labels.
+func (c *controller) poolsWithLabels(want labels.Set) []string {
+	res := []string{}
+	for name := range c.pools {
+		if c.poolHasLabels(name, want) {
+			res = append(res, name)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// poolHasLabels returns true if the given pool has all the given labels,
+// with the same values.
+func (c *controller) poolHasLabels(pool string, want labels.Set) bool {
+	p := c.pools[pool]
+	if p == nil {
+		return false
+	}
+	return want.AsSelector().Matches(labels.Set(p.Labels))
+}
+
+// poolHasFamily returns true if the pool has addresses of the given
+// family, of both families for DualStack.
+func poolHasFamily(p *config.Pool, family ipfamily.Family) bool {
+	var v4, v6 bool
+	for _, cidr := range p.CIDR {
+		switch ipfamily.ForCIDR(cidr) {
+		case ipfamily.IPv4:
+			v4 = true
+		case ipfamily.IPv6:
+			v6 = true
+		}
+	}
+	switch family {
+	case ipfamily.IPv4:
+		return v4
+	case ipfamily.IPv6:
+		return v6
+	case ipfamily.DualStack:
+		return v4 && v6
+	}
+	return false
+}
+
+func hasFamily(ips []net.IP, family ipfamily.Family) bool {
+	for _, ip := range ips {
+		if ipfamily.ForAddress(ip) == family {
+			return true
+		}
+	}
+	return false
 }
 
 func getDesiredLbIPs(svc *v1.Service) ([]net.IP, ipfamily.Family, error) {
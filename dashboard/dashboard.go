@@ -0,0 +1,234 @@
+// SPDX-License-Identifier:Apache-2.0
+
+package main
+
+import "strings"
+
+// The subset of the Grafana dashboard JSON model we generate.
+type dashboard struct {
+	Title         string     `json:"title"`
+	UID           string     `json:"uid"`
+	Tags          []string   `json:"tags"`
+	SchemaVersion int        `json:"schemaVersion"`
+	Refresh       string     `json:"refresh"`
+	Time          timeRange  `json:"time"`
+	Templating    templating `json:"templating"`
+	Panels        []panel    `json:"panels"`
+}
+
+type timeRange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type templating struct {
+	List []variable `json:"list"`
+}
+
+type variable struct {
+	Name  string `json:"name"`
+	Label string `json:"label"`
+	Type  string `json:"type"`
+	Query string `json:"query"`
+}
+
+type panel struct {
+	ID          int         `json:"id"`
+	Title       string      `json:"title"`
+	Type        string      `json:"type"`
+	Datasource  string      `json:"datasource"`
+	GridPos     gridPos     `json:"gridPos"`
+	FieldConfig fieldConfig `json:"fieldConfig"`
+	Targets     []target    `json:"targets"`
+}
+
+type gridPos struct {
+	H int `json:"h"`
+	W int `json:"w"`
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+type fieldConfig struct {
+	Defaults fieldDefaults `json:"defaults"`
+}
+
+type fieldDefaults struct {
+	Unit string `json:"unit,omitempty"`
+}
+
+type target struct {
+	Expr         string `json:"expr"`
+	LegendFormat string `json:"legendFormat,omitempty"`
+	Instant      bool   `json:"instant,omitempty"`
+	Format       string `json:"format,omitempty"`
+	RefID        string `json:"refId"`
+}
+
+// panelSpec describes a panel, and the metrics it needs to be meaningful.
+type panelSpec struct {
+	title   string
+	kind    string
+	unit    string
+	metrics []string
+	targets []target
+}
+
+const (
+	datasource  = "${datasource}"
+	panelHeight = 8
+	panelWidth  = 12
+)
+
+var panelSpecs = []panelSpec{
+	{
+		title:   "Pool utilization",
+		kind:    "timeseries",
+		unit:    "percentunit",
+		metrics: []string{"metallb_allocator_addresses_in_use_total", "metallb_allocator_addresses_total"},
+		targets: []target{{
+			Expr:         "sum by (pool) (metallb_allocator_addresses_in_use_total) / sum by (pool) (metallb_allocator_addresses_total)",
+			LegendFormat: "{{pool}}",
+		}},
+	},
+	{
+		title:   "Allocation rate (net services allocated per 5m)",
+		kind:    "timeseries",
+		unit:    "short",
+		metrics: []string{"metallb_allocator_services_allocated_total"},
+		targets: []target{{
+			Expr:         "sum by (pool) (delta(metallb_allocator_services_allocated_total[5m]))",
+			LegendFormat: "{{pool}}",
+		}},
+	},
+	{
+		title:   "BGP sessions up",
+		kind:    "timeseries",
+		unit:    "short",
+		metrics: []string{"metallb_bgp_session_up"},
+		targets: []target{{
+			Expr:         "sum by (instance, peer) (metallb_bgp_session_up)",
+			LegendFormat: "{{instance}} - {{peer}}",
+		}},
+	},
+	{
+		title:   "BGP sessions uptime",
+		kind:    "timeseries",
+		unit:    "s",
+		metrics: []string{"metallb_bgp_session_uptime_seconds"},
+		targets: []target{{
+			Expr:         "max by (instance, peer) (metallb_bgp_session_uptime_seconds)",
+			LegendFormat: "{{instance}} - {{peer}}",
+		}},
+	},
+	{
+		title:   "BGP session flaps per 5m",
+		kind:    "timeseries",
+		unit:    "short",
+		metrics: []string{"metallb_bgp_session_flap_total"},
+		targets: []target{{
+			Expr:         "sum by (instance, peer) (increase(metallb_bgp_session_flap_total[5m]))",
+			LegendFormat: "{{instance}} - {{peer}}",
+		}},
+	},
+	{
+		title:   "BGP connection attempts per 5m",
+		kind:    "timeseries",
+		unit:    "short",
+		metrics: []string{"metallb_bgp_connect_attempts_total"},
+		targets: []target{{
+			Expr:         "sum by (instance, peer) (increase(metallb_bgp_connect_attempts_total[5m]))",
+			LegendFormat: "{{instance}} - {{peer}}",
+		}},
+	},
+	{
+		title:   "Top services by announcement age (up to 7d)",
+		kind:    "table",
+		unit:    "s",
+		metrics: []string{"metallb_speaker_announced"},
+		targets: []target{{
+			Expr:    "topk(10, max by (service) (time() - min_over_time(timestamp(metallb_speaker_announced)[7d:5m])))",
+			Instant: true,
+			Format:  "table",
+		}},
+	},
+}
+
+// newDashboard returns a dashboard with the panels whose metrics are all
+// available, and the titles of the panels that were skipped.
+func newDashboard(title string, available map[string]bool) (*dashboard, []string) {
+	res := &dashboard{
+		Title:         title,
+		UID:           uidFor(title),
+		Tags:          []string{"metallb"},
+		SchemaVersion: 36,
+		Refresh:       "30s",
+		Time:          timeRange{From: "now-6h", To: "now"},
+		Templating: templating{
+			List: []variable{{
+				Name:  "datasource",
+				Label: "Data source",
+				Type:  "datasource",
+				Query: "prometheus",
+			}},
+		},
+		Panels: []panel{},
+	}
+
+	skipped := []string{}
+	for _, s := range panelSpecs {
+		if !hasAll(available, s.metrics) {
+			skipped = append(skipped, s.title)
+			continue
+		}
+		i := len(res.Panels)
+		p := panel{
+			ID:         i + 1,
+			Title:      s.title,
+			Type:       s.kind,
+			Datasource: datasource,
+			GridPos: gridPos{
+				H: panelHeight,
+				W: panelWidth,
+				X: (i % 2) * panelWidth,
+				Y: (i / 2) * panelHeight,
+			},
+			FieldConfig: fieldConfig{Defaults: fieldDefaults{Unit: s.unit}},
+		}
+		for j, t := range s.targets {
+			t.RefID = string(rune('A' + j))
+			p.Targets = append(p.Targets, t)
+		}
+		res.Panels = append(res.Panels, p)
+	}
+	return res, skipped
+}
+
+func hasAll(available map[string]bool, metrics []string) bool {
+	for _, m := range metrics {
+		if !available[m] {
+			return false
+		}
+	}
+	return true
+}
+
+// uidFor derives a stable dashboard uid from its title, so that
+// importing a regenerated dashboard replaces the previous one.
+func uidFor(title string) string {
+	uid := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r - 'A' + 'a'
+		default:
+			return '-'
+		}
+	}, title)
+	// Grafana uids are limited to 40 characters.
+	if len(uid) > 40 {
+		uid = uid[:40]
+	}
+	return uid
+}
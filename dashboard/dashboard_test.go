@@ -0,0 +1,122 @@
+// SPDX-License-Identifier:Apache-2.0
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestNewDashboard(t *testing.T) {
+	tests := []struct {
+		desc        string
+		available   map[string]bool
+		wantPanels  []string
+		wantSkipped int
+	}{
+		{
+			desc: "controller only",
+			available: map[string]bool{
+				"metallb_allocator_addresses_in_use_total":   true,
+				"metallb_allocator_addresses_total":          true,
+				"metallb_allocator_services_allocated_total": true,
+			},
+			wantPanels:  []string{"Pool utilization", "Allocation rate (net services allocated per 5m)"},
+			wantSkipped: len(panelSpecs) - 2,
+		},
+		{
+			desc: "partial pool metrics",
+			available: map[string]bool{
+				"metallb_allocator_addresses_in_use_total": true,
+				"metallb_bgp_session_up":                   true,
+			},
+			wantPanels:  []string{"BGP sessions up"},
+			wantSkipped: len(panelSpecs) - 1,
+		},
+		{
+			desc:        "nothing",
+			available:   map[string]bool{},
+			wantPanels:  []string{},
+			wantSkipped: len(panelSpecs),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			d, skipped := newDashboard("MetalLB", test.available)
+			got := []string{}
+			for _, p := range d.Panels {
+				got = append(got, p.Title)
+			}
+			if !reflect.DeepEqual(got, test.wantPanels) {
+				t.Fatalf("got panels %v, want %v", got, test.wantPanels)
+			}
+			if len(skipped) != test.wantSkipped {
+				t.Fatalf("got %d skipped panels, want %d", len(skipped), test.wantSkipped)
+			}
+		})
+	}
+}
+
+func TestPanelsLayout(t *testing.T) {
+	available := map[string]bool{}
+	for _, s := range panelSpecs {
+		for _, m := range s.metrics {
+			available[m] = true
+		}
+	}
+	d, skipped := newDashboard("MetalLB on prod-1", available)
+	if len(skipped) != 0 {
+		t.Fatalf("unexpected skipped panels %v", skipped)
+	}
+	if d.UID != "metallb-on-prod-1" {
+		t.Fatalf("unexpected uid %q", d.UID)
+	}
+
+	seen := map[gridPos]bool{}
+	for i, p := range d.Panels {
+		if p.ID != i+1 {
+			t.Fatalf("panel %q has id %d, want %d", p.Title, p.ID, i+1)
+		}
+		if seen[p.GridPos] {
+			t.Fatalf("panel %q overlaps another panel at %+v", p.Title, p.GridPos)
+		}
+		seen[p.GridPos] = true
+		for _, target := range p.Targets {
+			if target.Expr == "" || target.RefID == "" {
+				t.Fatalf("panel %q has an invalid target %+v", p.Title, target)
+			}
+		}
+	}
+}
+
+func TestMetalLBMetrics(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/prometheus/api/v1/label/__name__/values" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `{"status":"success","data":["metallb_bgp_session_up","up","metallb_speaker_announced"]}`)
+	}))
+	defer srv.Close()
+
+	got, err := metalLBMetrics(context.Background(), srv.Client(), srv.URL+"/prometheus/")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := map[string]bool{
+		"metallb_bgp_session_up":    true,
+		"metallb_speaker_announced": true,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got metrics %v, want %v", got, want)
+	}
+
+	if _, err := metalLBMetrics(context.Background(), srv.Client(), srv.URL+"/other"); err == nil {
+		t.Fatalf("expected an error for an invalid endpoint")
+	}
+}
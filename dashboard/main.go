@@ -0,0 +1,91 @@
+// SPDX-License-Identifier:Apache-2.0
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const metricsPrefix = "metallb_"
+
+func main() {
+	prometheusURL := flag.String("prometheus-url", "http://localhost:9090", "URL of the Prometheus instance scraping MetalLB")
+	outputFile := flag.String("output-file", "metallb-dashboard.json", "file to write the Grafana dashboard to")
+	title := flag.String("title", "MetalLB", "title of the dashboard")
+	timeout := flag.Duration("timeout", 30*time.Second, "timeout of the queries to Prometheus")
+	flag.Parse()
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	available, err := metalLBMetrics(ctx, http.DefaultClient, *prometheusURL)
+	if err != nil {
+		log.Fatalf("failed to list the metrics from %s: %s", *prometheusURL, err)
+	}
+	if len(available) == 0 {
+		log.Fatalf("no MetalLB metrics found in %s, is it scraping the controller and the speakers?", *prometheusURL)
+	}
+
+	d, skipped := newDashboard(*title, available)
+	for _, s := range skipped {
+		log.Printf("skipping panel %q, its metrics are not available", s)
+	}
+
+	data, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		log.Fatalf("failed to marshal the dashboard: %s", err)
+	}
+	if err := ioutil.WriteFile(*outputFile, append(data, '\n'), 0644); err != nil {
+		log.Fatalf("failed to write %s: %s", *outputFile, err)
+	}
+	fmt.Printf("dashboard with %d panels written to %s\n", len(d.Panels), *outputFile)
+}
+
+// metalLBMetrics returns the names of the MetalLB metrics known to the
+// Prometheus instance at the given URL.
+func metalLBMetrics(ctx context.Context, client *http.Client, prometheusURL string) (map[string]bool, error) {
+	u, err := url.Parse(prometheusURL)
+	if err != nil {
+		return nil, err
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/api/v1/label/__name__/values"
+	u.RawQuery = url.Values{"match[]": {`{__name__=~"` + metricsPrefix + `.*"}`}}.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var res struct {
+		Status string   `json:"status"`
+		Data   []string `json:"data"`
+		Error  string   `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, fmt.Errorf("invalid response, status %s: %w", resp.Status, err)
+	}
+	if res.Status != "success" {
+		return nil, fmt.Errorf("query failed, status %s: %s", resp.Status, res.Error)
+	}
+
+	metrics := map[string]bool{}
+	for _, m := range res.Data {
+		if strings.HasPrefix(m, metricsPrefix) {
+			metrics[m] = true
+		}
+	}
+	return metrics, nil
+}
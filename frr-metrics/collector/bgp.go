@@ -21,6 +21,20 @@ var (
 		nil,
 	)
 
+	sessionUptimeDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(bgpstats.Namespace, bgpstats.Subsystem, bgpstats.SessionUptime.Name),
+		bgpstats.SessionUptime.Help,
+		bgpstats.Labels,
+		nil,
+	)
+
+	sessionFlapsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(bgpstats.Namespace, bgpstats.Subsystem, bgpstats.SessionFlaps.Name),
+		bgpstats.SessionFlaps.Help,
+		bgpstats.Labels,
+		nil,
+	)
+
 	updatesSentDesc = prometheus.NewDesc(
 		prometheus.BuildFQName(bgpstats.Namespace, bgpstats.Subsystem, bgpstats.UpdatesSent.Name),
 		bgpstats.UpdatesSent.Help,
@@ -28,6 +42,13 @@ var (
 		nil,
 	)
 
+	updatesReceivedDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(bgpstats.Namespace, bgpstats.Subsystem, bgpstats.UpdatesReceived.Name),
+		bgpstats.UpdatesReceived.Help,
+		bgpstats.Labels,
+		nil,
+	)
+
 	prefixesDesc = prometheus.NewDesc(
 		prometheus.BuildFQName(bgpstats.Namespace, bgpstats.Subsystem, bgpstats.Prefixes.Name),
 		bgpstats.Prefixes.Help,
@@ -48,7 +69,10 @@ func NewBGP(l log.Logger) *bgp {
 
 func (c *bgp) Describe(ch chan<- *prometheus.Desc) {
 	ch <- sessionUpDesc
+	ch <- sessionUptimeDesc
+	ch <- sessionFlapsDesc
 	ch <- updatesSentDesc
+	ch <- updatesReceivedDesc
 	ch <- prefixesDesc
 }
 
@@ -71,7 +95,10 @@ func updateNeighborsMetrics(ch chan<- prometheus.Metric, neighbors []*bgpfrr.Nei
 		peerLabel := fmt.Sprintf("%s:%d", n.Ip.String(), n.Port)
 
 		ch <- prometheus.MustNewConstMetric(sessionUpDesc, prometheus.GaugeValue, float64(sessionUp), peerLabel)
+		ch <- prometheus.MustNewConstMetric(sessionUptimeDesc, prometheus.GaugeValue, n.Uptime.Seconds(), peerLabel)
+		ch <- prometheus.MustNewConstMetric(sessionFlapsDesc, prometheus.CounterValue, float64(n.ConnectionsDropped), peerLabel)
 		ch <- prometheus.MustNewConstMetric(updatesSentDesc, prometheus.CounterValue, float64(n.UpdatesSent), peerLabel)
+		ch <- prometheus.MustNewConstMetric(updatesReceivedDesc, prometheus.CounterValue, float64(n.UpdatesReceived), peerLabel)
 		ch <- prometheus.MustNewConstMetric(prefixesDesc, prometheus.GaugeValue, float64(n.PrefixSent), peerLabel)
 	}
 }
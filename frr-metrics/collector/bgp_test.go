@@ -19,9 +19,18 @@ var (
 	# HELP metallb_bgp_session_up BGP session state (1 is up, 0 is down)
 	# TYPE metallb_bgp_session_up gauge
 	metallb_bgp_session_up{peer="{{ .NeighborIP }}"} {{ .SessionUp }}
+	# HELP metallb_bgp_session_uptime_seconds Number of seconds since the BGP session was established, 0 if down
+	# TYPE metallb_bgp_session_uptime_seconds gauge
+	metallb_bgp_session_uptime_seconds{peer="{{ .NeighborIP }}"} {{ .SessionUptime }}
+	# HELP metallb_bgp_session_flap_total Number of times the established BGP session went down
+	# TYPE metallb_bgp_session_flap_total counter
+	metallb_bgp_session_flap_total{peer="{{ .NeighborIP }}"} {{ .SessionFlaps }}
 	# HELP metallb_bgp_updates_total Number of BGP UPDATE messages sent
 	# TYPE metallb_bgp_updates_total counter
 	metallb_bgp_updates_total{peer="{{ .NeighborIP }}"} {{ .UpdatesTotal }}
+	# HELP metallb_bgp_updates_received_total Number of BGP UPDATE messages received
+	# TYPE metallb_bgp_updates_received_total counter
+	metallb_bgp_updates_received_total{peer="{{ .NeighborIP }}"} {{ .UpdatesReceived }}
 	`
 
 	tests = []struct {
@@ -30,7 +39,10 @@ var (
 		neighborIP        string
 		announcedPrefixes int
 		sessionUp         int
+		sessionUptime     int
+		sessionFlaps      int
 		updatesTotal      int
+		updatesReceived   int
 	}{
 		{
 			desc:              "Output contains only IPv4 advertisements",
@@ -38,7 +50,10 @@ var (
 			neighborIP:        "172.18.0.4:179",
 			announcedPrefixes: 3,
 			sessionUp:         1,
+			sessionUptime:     1082,
+			sessionFlaps:      0,
 			updatesTotal:      2,
+			updatesReceived:   2,
 		},
 		{
 			desc:              "Output contains mixed IPv4 and IPv6 advertisements",
@@ -46,7 +61,10 @@ var (
 			neighborIP:        "172.18.0.4:180",
 			announcedPrefixes: 6,
 			sessionUp:         1,
+			sessionUptime:     1082,
+			sessionFlaps:      2,
 			updatesTotal:      5,
+			updatesReceived:   4,
 		},
 	}
 	neighborsIPv4Only = `
@@ -261,7 +279,7 @@ var (
 			"notificationsSent":0,
 			"notificationsRecv":0,
 			"updatesSent":5,
-			"updatesRecv":5,
+			"updatesRecv":4,
 			"keepalivesSent":19,
 			"keepalivesRecv":19,
 			"routeRefreshSent":0,
@@ -294,7 +312,7 @@ var (
 			}
 		  },
 		  "connectionsEstablished":1,
-		  "connectionsDropped":0,
+		  "connectionsDropped":2,
 		  "lastResetTimerMsecs":1083000,
 		  "lastResetDueTo":"Waiting for peer OPEN",
 		  "lastResetCode":32,
@@ -328,7 +346,10 @@ func TestCollect(t *testing.T) {
 				"NeighborIP":        tc.neighborIP,
 				"AnnouncedPrefixes": tc.announcedPrefixes,
 				"SessionUp":         tc.sessionUp,
+				"SessionUptime":     tc.sessionUptime,
+				"SessionFlaps":      tc.sessionFlaps,
 				"UpdatesTotal":      tc.updatesTotal,
+				"UpdatesReceived":   tc.updatesReceived,
 			})
 
 			if err != nil {
@@ -0,0 +1,65 @@
+// SPDX-License-Identifier:Apache-2.0
+
+// Package allocationhook asks an external HTTP service to approve the
+// IPs allocated to the services.
+package allocationhook // import "go.universe.tf/metallb/internal/allocationhook"
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Request is the allocation POSTed to the hook.
+type Request struct {
+	Service   string `json:"service"`
+	Namespace string `json:"namespace"`
+	// Comma separated IPs allocated to the service, two for a dual
+	// stack service.
+	IP   string `json:"ip"`
+	Pool string `json:"pool"`
+}
+
+// Response is the decision of the hook.
+type Response struct {
+	Approved bool   `json:"approved"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// Call posts req to the hook at url, and returns its decision. An
+// error is returned if the hook can't be reached within timeout, or
+// doesn't answer with a 2xx status and a valid response.
+func Call(ctx context.Context, url string, timeout time.Duration, req Request) (Response, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return Response{}, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return Response{}, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		return Response{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return Response{}, fmt.Errorf("allocation hook %s failed with status %s: %s", url, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	var res Response
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&res); err != nil {
+		return Response{}, fmt.Errorf("invalid response from allocation hook %s: %s", url, err)
+	}
+	return res, nil
+}
@@ -0,0 +1,89 @@
+// SPDX-License-Identifier:Apache-2.0
+
+package allocationhook
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCall(t *testing.T) {
+	req := Request{
+		Service:   "svc1",
+		Namespace: "ns1",
+		IP:        "1.2.3.4",
+		Pool:      "pool1",
+	}
+
+	tests := []struct {
+		desc    string
+		handler http.HandlerFunc
+		want    Response
+		wantErr bool
+	}{
+		{
+			desc: "approved",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				var got Request
+				if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+					t.Errorf("failed to decode the request: %s", err)
+				}
+				if diff := cmp.Diff(req, got); diff != "" {
+					t.Errorf("unexpected request (-want +got):\n%s", diff)
+				}
+				_, _ = w.Write([]byte(`{"approved": true}`))
+			},
+			want: Response{Approved: true},
+		},
+		{
+			desc: "rejected",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte(`{"approved": false, "reason": "reserved for the DMZ"}`))
+			},
+			want: Response{Reason: "reserved for the DMZ"},
+		},
+		{
+			desc: "server error",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			},
+			wantErr: true,
+		},
+		{
+			desc: "invalid response",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte(`approved`))
+			},
+			wantErr: true,
+		},
+		{
+			desc: "timeout",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				time.Sleep(200 * time.Millisecond)
+				_, _ = w.Write([]byte(`{"approved": true}`))
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			s := httptest.NewServer(test.handler)
+			defer s.Close()
+
+			got, err := Call(context.Background(), s.URL, 50*time.Millisecond, req)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("expected error %v, got %v", test.wantErr, err)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Fatalf("unexpected response (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -7,11 +7,15 @@ import (
 	"fmt"
 	"math"
 	"net"
+	"sort"
 	"strings"
 
 	"go.universe.tf/metallb/internal/config"
 	"go.universe.tf/metallb/internal/ipfamily"
+	"go.universe.tf/metallb/internal/state"
 
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
 	"github.com/mikioh/ipaddr"
 )
 
@@ -22,8 +26,19 @@ type Allocator struct {
 	allocated       map[string]*alloc          // svc -> alloc
 	sharingKeyForIP map[string]*key            // ip.String() -> assigned sharing key
 	portsInUse      map[string]map[Port]string // ip.String() -> Port -> svc
-	servicesOnIP    map[string]map[string]bool // ip.String() -> svc -> allocated?
+	servicesOnIP    *state.SafeIPMap           // ip.String() -> services
 	poolIPsInUse    map[string]map[string]int  // poolName -> ip.String() -> number of users
+	free            map[string]*freeIPs        // cidr.String() -> addresses no service uses
+
+	strategies    map[string]AllocationStrategy // poolName -> allocation strategy
+	lastAllocated map[string]net.IP             // cidr.String() -> last IP allocated by round-robin
+	releasedAt    map[string]uint64             // ip.String() -> sequence number of its last release
+	releases      uint64
+
+	auditLogger log.Logger
+	// Whether an allocation is being simulated, the changes of the IPs
+	// in use not being reported then.
+	simulating bool
 }
 
 // Port represents one port in use by a service.
@@ -51,15 +66,51 @@ type alloc struct {
 
 // New returns an Allocator managing no pools.
 func New() *Allocator {
-	return &Allocator{
+	a := &Allocator{
 		pools: map[string]*config.Pool{},
 
 		allocated:       map[string]*alloc{},
 		sharingKeyForIP: map[string]*key{},
 		portsInUse:      map[string]map[Port]string{},
-		servicesOnIP:    map[string]map[string]bool{},
+		servicesOnIP:    state.NewSafeIPMap(),
 		poolIPsInUse:    map[string]map[string]int{},
+		free:            map[string]*freeIPs{},
+
+		strategies:    map[string]AllocationStrategy{},
+		lastAllocated: map[string]net.IP{},
+		releasedAt:    map[string]uint64{},
+
+		auditLogger: log.NewNopLogger(),
+	}
+	a.servicesOnIP.OnSet = a.ipInUse
+	a.servicesOnIP.OnDelete = a.ipReleased
+	return a
+}
+
+// SetAuditLogger makes the allocator log each IP taken into use or
+// released to l, at debug level.
+func (a *Allocator) SetAuditLogger(l log.Logger) {
+	a.auditLogger = l
+}
+
+// ipInUse reports that svc started using ip.
+func (a *Allocator) ipInUse(ip, svc string) {
+	if a.simulating {
+		return
 	}
+	pool := poolFor(a.pools, []net.IP{net.ParseIP(ip)})
+	stats.ipAssignments.WithLabelValues(pool).Inc()
+	level.Debug(a.auditLogger).Log("op", "audit", "event", "ipInUse", "ip", ip, "service", svc, "pool", pool)
+}
+
+// ipReleased reports that ip is not used by any service anymore.
+func (a *Allocator) ipReleased(ip string) {
+	if a.simulating {
+		return
+	}
+	pool := poolFor(a.pools, []net.IP{net.ParseIP(ip)})
+	stats.ipReleases.WithLabelValues(pool).Inc()
+	level.Debug(a.auditLogger).Log("op", "audit", "event", "ipReleased", "ip", ip, "pool", pool)
 }
 
 var ErrCannotShareKey = errors.New("services can't share key")
@@ -75,6 +126,17 @@ func (a *Allocator) SetPools(pools map[string]*config.Pool) error {
 			return fmt.Errorf("new config not compatible with assigned IPs: service %q cannot own %q under new config", svc, alloc.ips)
 		}
 	}
+	poolStrategies := map[string]AllocationStrategy{}
+	for n, p := range pools {
+		s := strategies[p.AllocationStrategy]
+		if s == nil {
+			return fmt.Errorf("unknown allocation strategy %q in pool %q", p.AllocationStrategy, n)
+		}
+		if p.GenerationPlugin != "" && ipGenerationPlugin(p.GenerationPlugin) == nil {
+			return fmt.Errorf("unknown generation plugin %q in pool %q", p.GenerationPlugin, n)
+		}
+		poolStrategies[n] = s
+	}
 
 	for n := range a.pools {
 		if pools[n] == nil {
@@ -85,6 +147,7 @@ func (a *Allocator) SetPools(pools map[string]*config.Pool) error {
 	}
 
 	a.pools = pools
+	a.strategies = poolStrategies
 
 	// Need to rearrange existing pool mappings and counts
 	for svc, alloc := range a.allocated {
@@ -98,6 +161,8 @@ func (a *Allocator) SetPools(pools map[string]*config.Pool) error {
 		}
 	}
 
+	a.indexFreeIPs()
+
 	// Refresh or initiate stats
 	for n, p := range a.pools {
 		stats.poolCapacity.WithLabelValues(n).Set(float64(poolCount(p)))
@@ -120,13 +185,13 @@ func (a *Allocator) assign(svc string, alloc *alloc) {
 		for _, port := range alloc.ports {
 			a.portsInUse[ip.String()][port] = svc
 		}
-		if a.servicesOnIP[ip.String()] == nil {
-			a.servicesOnIP[ip.String()] = map[string]bool{}
-		}
-		a.servicesOnIP[ip.String()][svc] = true
+		a.servicesOnIP.Set(ip.String(), svc)
 		if a.poolIPsInUse[alloc.pool] == nil {
 			a.poolIPsInUse[alloc.pool] = map[string]int{}
 		}
+		if a.poolIPsInUse[alloc.pool][ip.String()] == 0 {
+			a.freeIPsFor(alloc.pool, ip).use(ip)
+		}
 		a.poolIPsInUse[alloc.pool][ip.String()]++
 	}
 	stats.poolCapacity.WithLabelValues(alloc.pool).Set(float64(poolCount(a.pools[alloc.pool])))
@@ -154,6 +219,15 @@ func (a *Allocator) Assign(svc string, ips []net.IP, ports []Port, sharingKey, b
 		return fmt.Errorf("%q %q has the same family", ips[0], ips[1])
 	}
 
+	for _, ip := range ips {
+		if isReservedIP(a.pools[pool], ip) {
+			return fmt.Errorf("%q is reserved at the boundary of pool %q", ip, pool)
+		}
+		if a.pools[pool].AvoidBuggyIPs && isBuggyIP(ip) {
+			return fmt.Errorf("%q is avoided by pool %q as a buggy IP", ip, pool)
+		}
+	}
+
 	for _, ip := range ips {
 		// Does the IP already have allocs? If so, needs to be the same
 		// sharing key, and have non-overlapping ports. If not, the
@@ -197,7 +271,7 @@ func (a *Allocator) Unassign(svc string) bool {
 			delete(a.portsInUse[ip.String()], port)
 		}
 
-		delete(a.servicesOnIP[ip.String()], svc)
+		a.servicesOnIP.Delete(ip.String(), svc)
 		if len(a.portsInUse[ip.String()]) == 0 {
 			delete(a.portsInUse, ip.String())
 			delete(a.sharingKeyForIP, ip.String())
@@ -207,6 +281,9 @@ func (a *Allocator) Unassign(svc string) bool {
 			// Explicitly delete unused IPs from the pool, so that len()
 			// is an accurate count of IPs in use.
 			delete(a.poolIPsInUse[al.pool], ip.String())
+			a.freeIPsFor(al.pool, ip).release(ip)
+			a.releases++
+			a.releasedAt[ip.String()] = a.releases
 		}
 	}
 	stats.poolActive.WithLabelValues(al.pool).Set(float64(len(a.poolIPsInUse[al.pool])))
@@ -214,7 +291,7 @@ func (a *Allocator) Unassign(svc string) bool {
 }
 
 // AllocateFromPool assigns an available IP from pool to service.
-func (a *Allocator) AllocateFromPool(svc string, serviceIPFamily ipfamily.Family, poolName string, ports []Port, sharingKey, backendKey string) ([]net.IP, error) {
+func (a *Allocator) AllocateFromPool(svc string, meta ServiceMeta, serviceIPFamily ipfamily.Family, poolName string, ports []Port, sharingKey, backendKey string, highPriority bool) ([]net.IP, error) {
 	if alloc := a.allocated[svc]; alloc != nil {
 		// Handle the case where the svc has already been assigned an IP but from the wrong family.
 		// This "should-not-happen" since the "serviceIPFamily" is an immutable field in services.
@@ -238,6 +315,7 @@ func (a *Allocator) AllocateFromPool(svc string, serviceIPFamily ipfamily.Family
 
 	ips := []net.IP{}
 	ipfamilySel := make(map[ipfamily.Family]bool)
+	fromEnd := allocateFromEnd(pool.ReservationMode, highPriority)
 
 	switch serviceIPFamily {
 	case ipfamily.DualStack:
@@ -252,7 +330,15 @@ func (a *Allocator) AllocateFromPool(svc string, serviceIPFamily ipfamily.Family
 			// Not the right ip-family
 			continue
 		}
-		ip := a.getIPFromCIDR(cidr, svc, ports, sharingKey, backendKey)
+		var ip net.IP
+		if pool.GenerationPlugin != "" {
+			var err error
+			if ip, err = a.generateIP(poolName, cidr, svc, meta, ports, sharingKey, backendKey); err != nil {
+				return nil, err
+			}
+		} else {
+			ip = a.getIPFromCIDR(cidr, pool, fromEnd, a.strategies[poolName], svc, ports, sharingKey, backendKey)
+		}
 		if ip != nil {
 			ips = append(ips, ip)
 			delete(ipfamilySel, cidrIPFamily)
@@ -263,6 +349,9 @@ func (a *Allocator) AllocateFromPool(svc string, serviceIPFamily ipfamily.Family
 		// Woops, run out of IPs :( Fail.
 		return nil, fmt.Errorf("no available IPs in pool %q for %s IPFamily", poolName, serviceIPFamily)
 	}
+	if !highPriority && a.inEmergencyReserve(poolName, ips) {
+		return nil, fmt.Errorf("only the emergency reserve of pool %q is left", poolName)
+	}
 	err := a.Assign(svc, ips, ports, sharingKey, backendKey)
 	if err != nil {
 		return nil, err
@@ -270,8 +359,62 @@ func (a *Allocator) AllocateFromPool(svc string, serviceIPFamily ipfamily.Family
 	return ips, nil
 }
 
+// AllocateOtherFamily assigns ip to service along with an available IP
+// of the other family from the same pool, and returns both in the order
+// of the CIDRs of the pool, as Allocate does. It lets a single stack
+// service turned dual-stack keep its IP.
+func (a *Allocator) AllocateOtherFamily(svc string, meta ServiceMeta, ip net.IP, ports []Port, sharingKey, backendKey string, highPriority bool) ([]net.IP, error) {
+	poolName := poolFor(a.pools, []net.IP{ip})
+	if poolName == "" {
+		return nil, fmt.Errorf("%q is not allowed in config", ip)
+	}
+	pool := a.pools[poolName]
+	family := ipfamily.IPv6
+	if ipfamily.ForAddress(ip) == ipfamily.IPv6 {
+		family = ipfamily.IPv4
+	}
+
+	kept := 0
+	for i, cidr := range pool.CIDR {
+		if cidr.Contains(ip) {
+			kept = i
+			break
+		}
+	}
+
+	for i, cidr := range pool.CIDR {
+		if ipfamily.ForCIDR(cidr) != family {
+			continue
+		}
+		var other net.IP
+		if pool.GenerationPlugin != "" {
+			var err error
+			if other, err = a.generateIP(poolName, cidr, svc, meta, ports, sharingKey, backendKey); err != nil {
+				return nil, err
+			}
+		} else {
+			other = a.getIPFromCIDR(cidr, pool, allocateFromEnd(pool.ReservationMode, highPriority), a.strategies[poolName], svc, ports, sharingKey, backendKey)
+		}
+		if other == nil {
+			continue
+		}
+		ips := []net.IP{ip, other}
+		if i < kept {
+			ips = []net.IP{other, ip}
+		}
+		if !highPriority && a.inEmergencyReserve(poolName, ips) {
+			return nil, fmt.Errorf("only the emergency reserve of pool %q is left", poolName)
+		}
+		if err := a.Assign(svc, ips, ports, sharingKey, backendKey); err != nil {
+			return nil, err
+		}
+		return ips, nil
+	}
+	return nil, fmt.Errorf("no available IPs in pool %q for %s IPFamily", poolName, family)
+}
+
 // Allocate assigns any available and assignable IP to service.
-func (a *Allocator) Allocate(svc string, serviceIPFamily ipfamily.Family, ports []Port, sharingKey, backendKey string) ([]net.IP, error) {
+func (a *Allocator) Allocate(svc string, meta ServiceMeta, serviceIPFamily ipfamily.Family, ports []Port, sharingKey, backendKey string, highPriority bool) ([]net.IP, error) {
 	if alloc := a.allocated[svc]; alloc != nil {
 		if err := a.Assign(svc, alloc.ips, ports, sharingKey, backendKey); err != nil {
 			return nil, err
@@ -279,11 +422,8 @@ func (a *Allocator) Allocate(svc string, serviceIPFamily ipfamily.Family, ports
 		return alloc.ips, nil
 	}
 
-	for poolName := range a.pools {
-		if !a.pools[poolName].AutoAssign {
-			continue
-		}
-		if ips, err := a.AllocateFromPool(svc, serviceIPFamily, poolName, ports, sharingKey, backendKey); err == nil {
+	for _, poolName := range a.AutoAssignPools() {
+		if ips, err := a.AllocateFromPool(svc, meta, serviceIPFamily, poolName, ports, sharingKey, backendKey, highPriority); err == nil {
 			return ips, nil
 		}
 	}
@@ -291,6 +431,60 @@ func (a *Allocator) Allocate(svc string, serviceIPFamily ipfamily.Family, ports
 	return nil, errors.New("no available IPs")
 }
 
+// AutoAssignPools returns the names of the pools the IPs are
+// automatically assigned from, in the order they are tried: by
+// priority, the pools without priority last, then by name.
+func (a *Allocator) AutoAssignPools() []string {
+	res := []string{}
+	for name, p := range a.pools {
+		if p.AutoAssign {
+			res = append(res, name)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		pi, pj := a.pools[res[i]].AllocationPriority(), a.pools[res[j]].AllocationPriority()
+		if pi != pj {
+			if pi == 0 || pj == 0 {
+				return pj == 0
+			}
+			return pi < pj
+		}
+		return res[i] < res[j]
+	})
+	return res
+}
+
+// Simulate calls allocate, which allocates IPs to svc, and reverts the
+// allocation. It returns the IPs allocate got and their pool. The
+// history used by the allocation strategies is left untouched, so the
+// simulation doesn't influence the next allocations.
+func (a *Allocator) Simulate(svc string, allocate func() ([]net.IP, error)) ([]net.IP, string, error) {
+	if a.allocated[svc] != nil {
+		return nil, "", fmt.Errorf("service %q already has IPs assigned", svc)
+	}
+	lastAllocated := make(map[string]net.IP, len(a.lastAllocated))
+	for k, v := range a.lastAllocated {
+		lastAllocated[k] = v
+	}
+	releasedAt := make(map[string]uint64, len(a.releasedAt))
+	for k, v := range a.releasedAt {
+		releasedAt[k] = v
+	}
+	releases := a.releases
+	a.simulating = true
+	defer func() {
+		a.Unassign(svc)
+		a.lastAllocated, a.releasedAt, a.releases = lastAllocated, releasedAt, releases
+		a.simulating = false
+	}()
+
+	ips, err := allocate()
+	if err != nil {
+		return nil, "", err
+	}
+	return ips, a.Pool(svc), nil
+}
+
 // Pool returns the pool from which service's IP was allocated. If
 // service has no IP allocated, "" is returned.
 func (a *Allocator) Pool(svc string) string {
@@ -300,6 +494,47 @@ func (a *Allocator) Pool(svc string) string {
 	return ""
 }
 
+// IPs returns the IPs allocated to service, or nil if it has none.
+func (a *Allocator) IPs(svc string) []net.IP {
+	if alloc := a.allocated[svc]; alloc != nil {
+		return alloc.ips
+	}
+	return nil
+}
+
+// ServicesOnIP returns the services the IP is allocated to.
+func (a *Allocator) ServicesOnIP(ip net.IP) []string {
+	return a.servicesOnIP.Services(ip.String())
+}
+
+// ServicesInPool returns the services having IPs of the given pool,
+// sorted by name.
+func (a *Allocator) ServicesInPool(pool string) []string {
+	var ret []string
+	for svc, alloc := range a.allocated {
+		if alloc.pool == pool {
+			ret = append(ret, svc)
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// CountInPoolForNamespace returns the number of distinct IPs of the
+// given pool that are allocated to services of the given namespace.
+func (a *Allocator) CountInPoolForNamespace(pool, namespace string) int {
+	ips := map[string]bool{}
+	for svc, alloc := range a.allocated {
+		if alloc.pool != pool || !strings.HasPrefix(svc, namespace+"/") {
+			continue
+		}
+		for _, ip := range alloc.ips {
+			ips[ip.String()] = true
+		}
+	}
+	return len(ips)
+}
+
 func sharingOK(existing, new *key) error {
 	if existing.sharing == "" {
 		return errors.New("existing service does not allow sharing")
@@ -316,6 +551,22 @@ func sharingOK(existing, new *key) error {
 	return nil
 }
 
+// IPsInUse returns the number of distinct IPs of the pool with the
+// given name that are allocated to services.
+func (a *Allocator) IPsInUse(pool string) int {
+	return len(a.poolIPsInUse[pool])
+}
+
+// PoolCapacity returns the number of addresses in the pool with the
+// given name, or 0 if there is no such pool.
+func (a *Allocator) PoolCapacity(pool string) int64 {
+	p := a.pools[pool]
+	if p == nil {
+		return 0
+	}
+	return poolCount(p)
+}
+
 // poolCount returns the number of addresses in the pool.
 func poolCount(p *config.Pool) int64 {
 	var total int64
@@ -327,6 +578,13 @@ func poolCount(p *config.Pool) int64 {
 			return math.MaxInt64
 		}
 		sz := int64(math.Pow(2, float64(b-o)))
+		sz -= 2 * int64(p.ReservedBoundaryIPs)
+		if p.AvoidBuggyIPs {
+			sz -= buggyIPCount(cidr, p.ReservedBoundaryIPs)
+		}
+		if sz < 0 {
+			sz = 0
+		}
 		total += sz
 	}
 	return total
@@ -337,11 +595,8 @@ func poolFor(pools map[string]*config.Pool, ips []net.IP) string {
 	for pname, p := range pools {
 		cnt := 0
 		for _, ip := range ips {
-			for _, cidr := range p.CIDR {
-				if cidr.Contains(ip) {
-					cnt++
-					break
-				}
+			if p.ContainsIP(ip) {
+				cnt++
 			}
 		}
 		if cnt == len(ips) {
@@ -351,21 +606,181 @@ func poolFor(pools map[string]*config.Pool, ips []net.IP) string {
 	return ""
 }
 
-func (a *Allocator) getIPFromCIDR(cidr *net.IPNet, svc string, ports []Port, sharingKey, backendKey string) net.IP {
+// getIPFromCIDR returns the IP of the CIDR the service can use picked
+// by the strategy, or nil if there is none. The IPs conflicting with
+// the services already using them, because of their sharing key or
+// ports, are skipped, so a conflict doesn't make the allocation move to
+// another pool while the CIDR has usable IPs.
+func (a *Allocator) getIPFromCIDR(cidr *net.IPNet, pool *config.Pool, fromEnd bool, strategy AllocationStrategy, svc string, ports []Port, sharingKey, backendKey string) net.IP {
 	sk := &key{
 		sharing: sharingKey,
 		backend: backendKey,
 	}
-	c := ipaddr.NewCursor([]ipaddr.Prefix{*ipaddr.NewPrefix(cidr)})
-	for pos := c.First(); pos != nil; pos = c.Next() {
-		if a.checkSharing(svc, pos.IP.String(), ports, sk) != nil {
-			continue
+	reservedIPs := boundaryIPs(cidr, pool.ReservedBoundaryIPs)
+	usable := func(ip net.IP) bool {
+		if reservedIPs[ip.String()] || (pool.AvoidBuggyIPs && isBuggyIP(ip)) {
+			return false
+		}
+		return a.checkSharing(svc, ip.String(), ports, sk) == nil
+	}
+	// A service that doesn't share its IP can only get a free one, the
+	// sequential strategy takes the first of them from the index
+	// instead of walking the IPs in use.
+	sequentialStrategy := pool.AllocationStrategy == "" || pool.AllocationStrategy == config.StrategySequential
+	if free := a.free[cidr.String()]; free != nil && sequentialStrategy && sharingKey == "" {
+		return free.find(fromEnd, usable)
+	}
+	if strategy == nil {
+		strategy = sequential
+	}
+	return strategy(a, cidr, svc, fromEnd, usable)
+}
+
+// indexFreeIPs indexes the addresses of the CIDRs of the pools that no
+// service uses.
+func (a *Allocator) indexFreeIPs() {
+	a.free = map[string]*freeIPs{}
+	for _, p := range a.pools {
+		for _, cidr := range p.CIDR {
+			a.free[cidr.String()] = newFreeIPs(cidr)
+		}
+	}
+	for pool, ips := range a.poolIPsInUse {
+		for ip := range ips {
+			parsed := net.ParseIP(ip)
+			a.freeIPsFor(pool, parsed).use(parsed)
+		}
+	}
+}
+
+// freeIPsFor returns the index of the free addresses of the CIDR of
+// the pool containing ip, or nil if it is not indexed.
+func (a *Allocator) freeIPsFor(pool string, ip net.IP) *freeIPs {
+	p := a.pools[pool]
+	if p == nil {
+		return nil
+	}
+	for _, cidr := range p.CIDR {
+		if cidr.Contains(ip) {
+			return a.free[cidr.String()]
 		}
-		return pos.IP
 	}
 	return nil
 }
 
+// inEmergencyReserve returns true if allocating the given IPs would
+// take addresses from the emergency reserve of the pool. The IPs
+// already in use, shared with other services, don't count.
+func (a *Allocator) inEmergencyReserve(poolName string, ips []net.IP) bool {
+	pool := a.pools[poolName]
+	if pool.EmergencyReserveFraction <= 0 {
+		return false
+	}
+	inUse := int64(len(a.poolIPsInUse[poolName]))
+	for _, ip := range ips {
+		if a.poolIPsInUse[poolName][ip.String()] == 0 {
+			inUse++
+		}
+	}
+	capacity := poolCount(pool)
+	reserve := int64(math.Ceil(float64(capacity) * pool.EmergencyReserveFraction))
+	return inUse > capacity-reserve
+}
+
+// allocateFromEnd returns true if the IPs of a service with the given
+// priority must be allocated from the end of the CIDRs of a pool with
+// the given reservation mode.
+func allocateFromEnd(reservationMode string, highPriority bool) bool {
+	switch reservationMode {
+	case config.ReservedFirst:
+		return !highPriority
+	case config.ReservedLast:
+		return highPriority
+	}
+	return false
+}
+
+// boundaryIPs returns the first and last n addresses of cidr.
+func boundaryIPs(cidr *net.IPNet, n int) map[string]bool {
+	res := map[string]bool{}
+	if n <= 0 {
+		return res
+	}
+	c := ipaddr.NewCursor([]ipaddr.Prefix{*ipaddr.NewPrefix(cidr)})
+	for i, pos := 0, c.First(); i < n && pos != nil; i, pos = i+1, c.Next() {
+		res[pos.IP.String()] = true
+	}
+	for i, pos := 0, last(c); i < n && pos != nil; i, pos = i+1, c.Prev() {
+		res[pos.IP.String()] = true
+	}
+	return res
+}
+
+// isReservedIP returns true if ip is one of the addresses the pool
+// reserves at the boundaries of its CIDRs.
+func isReservedIP(p *config.Pool, ip net.IP) bool {
+	if p == nil || p.ReservedBoundaryIPs == 0 {
+		return false
+	}
+	for _, cidr := range p.CIDR {
+		if cidr.Contains(ip) {
+			return boundaryIPs(cidr, p.ReservedBoundaryIPs)[ip.String()]
+		}
+	}
+	return false
+}
+
+// isBuggyIP returns true if ip is an address that some clients and
+// routers mishandle: the IPv4 addresses ending in .0 or .255, which
+// look like network or broadcast addresses, and the IPv6 addresses
+// with an all zeros interface identifier, which look like
+// Subnet-Router anycast addresses.
+func isBuggyIP(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4[3] == 0 || ip4[3] == 255
+	}
+	ip16 := ip.To16()
+	if ip16 == nil {
+		return false
+	}
+	for _, b := range ip16[8:] {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// buggyIPCount returns the number of buggy IPs of cidr that are not
+// among the reserved addresses at its boundaries.
+func buggyIPCount(cidr *net.IPNet, reserved int) int64 {
+	var res int64
+	o, b := cidr.Mask.Size()
+	switch {
+	case b == 32 && o <= 24:
+		res = 2 * int64(math.Pow(2, float64(24-o)))
+	case b == 128 && o < 64:
+		res = int64(math.Pow(2, float64(64-o)))
+	default:
+		c := ipaddr.NewCursor([]ipaddr.Prefix{*ipaddr.NewPrefix(cidr)})
+		for _, pos := range []*ipaddr.Position{c.First(), last(c)} {
+			if isBuggyIP(pos.IP) {
+				res++
+			}
+		}
+		if o == b && res == 2 {
+			// The first and last addresses are the same.
+			res = 1
+		}
+	}
+	for ip := range boundaryIPs(cidr, reserved) {
+		if isBuggyIP(net.ParseIP(ip)) {
+			res--
+		}
+	}
+	return res
+}
+
 func (a *Allocator) checkSharing(svc string, ip string, ports []Port, sk *key) error {
 	if existingSK := a.sharingKeyForIP[ip]; existingSK != nil {
 		if err := sharingOK(existingSK, sk); err != nil {
@@ -373,7 +788,7 @@ func (a *Allocator) checkSharing(svc string, ip string, ports []Port, sk *key) e
 			// the same service, and is the only user of the IP, we
 			// can just update its sharing key in place.
 			var otherSvcs []string
-			for otherSvc := range a.servicesOnIP[ip] {
+			for _, otherSvc := range a.servicesOnIP.Services(ip) {
 				if otherSvc != svc {
 					otherSvcs = append(otherSvcs, otherSvc)
 				}
@@ -3,6 +3,7 @@
 package allocator
 
 import (
+	"hash/fnv"
 	"math"
 	"net"
 	"reflect"
@@ -13,6 +14,7 @@ import (
 	"go.universe.tf/metallb/internal/config"
 	"go.universe.tf/metallb/internal/ipfamily"
 
+	"github.com/go-kit/log"
 	ptu "github.com/prometheus/client_golang/prometheus/testutil"
 )
 
@@ -730,7 +732,7 @@ func TestPoolAllocation(t *testing.T) {
 			alloc.Unassign(test.svc)
 			continue
 		}
-		ips, err := alloc.AllocateFromPool(test.svc, test.ipFamily, "test", test.ports, test.sharingKey, "")
+		ips, err := alloc.AllocateFromPool(test.svc, ServiceMeta{}, test.ipFamily, "test", test.ports, test.sharingKey, "", false)
 		if test.wantErr {
 			if err == nil {
 				t.Errorf("%s: should have caused an error, but did not", test.desc)
@@ -755,7 +757,7 @@ func TestPoolAllocation(t *testing.T) {
 	}
 
 	alloc.Unassign("s5")
-	if _, err := alloc.AllocateFromPool("s5", ipfamily.IPv4, "nonexistentpool", nil, "", ""); err == nil {
+	if _, err := alloc.AllocateFromPool("s5", ServiceMeta{}, ipfamily.IPv4, "nonexistentpool", nil, "", "", false); err == nil {
 		t.Error("Allocating from non-existent pool succeeded")
 	}
 }
@@ -1063,7 +1065,7 @@ func TestAllocation(t *testing.T) {
 			alloc.Unassign(test.svc)
 			continue
 		}
-		ips, err := alloc.Allocate(test.svc, test.ipFamily, test.ports, test.sharingKey, "")
+		ips, err := alloc.Allocate(test.svc, ServiceMeta{}, test.ipFamily, test.ports, test.sharingKey, "", false)
 		if test.wantErr {
 			if err == nil {
 				t.Errorf("%s: should have caused an error, but did not", test.desc)
@@ -1136,7 +1138,7 @@ func TestBuggyIPs(t *testing.T) {
 	}
 
 	for i, test := range tests {
-		ips, err := alloc.Allocate(test.svc, ipfamily.IPv4, nil, "", "")
+		ips, err := alloc.Allocate(test.svc, ServiceMeta{}, ipfamily.IPv4, nil, "", "", false)
 		if test.wantErr {
 			if err == nil {
 				t.Errorf("#%d should have caused an error, but did not", i+1)
@@ -1156,6 +1158,805 @@ func TestBuggyIPs(t *testing.T) {
 
 }
 
+func TestReservationMode(t *testing.T) {
+	tests := []struct {
+		desc            string
+		reservationMode string
+		highPriority    bool
+		want            []string
+	}{
+		{
+			desc: "no reservation",
+			want: []string{"1.2.3.0", "1.2.3.1", "1.2.3.2"},
+		},
+		{
+			desc:         "no reservation, high priority",
+			highPriority: true,
+			want:         []string{"1.2.3.0", "1.2.3.1", "1.2.3.2"},
+		},
+		{
+			desc:            "reserved first, high priority",
+			reservationMode: config.ReservedFirst,
+			highPriority:    true,
+			want:            []string{"1.2.3.0", "1.2.3.1", "1.2.3.2"},
+		},
+		{
+			desc:            "reserved first, regular",
+			reservationMode: config.ReservedFirst,
+			want:            []string{"1.2.3.7", "1.2.3.6", "1.2.3.5"},
+		},
+		{
+			desc:            "reserved last, high priority",
+			reservationMode: config.ReservedLast,
+			highPriority:    true,
+			want:            []string{"1.2.3.7", "1.2.3.6", "1.2.3.5"},
+		},
+		{
+			desc:            "reserved last, regular",
+			reservationMode: config.ReservedLast,
+			want:            []string{"1.2.3.0", "1.2.3.1", "1.2.3.2"},
+		},
+	}
+
+	for _, test := range tests {
+		alloc := New()
+		if err := alloc.SetPools(map[string]*config.Pool{
+			"test": {
+				AutoAssign:      true,
+				CIDR:            []*net.IPNet{ipnet("1.2.3.0/29")},
+				ReservationMode: test.reservationMode,
+			},
+		}); err != nil {
+			t.Fatalf("%s: SetPools: %s", test.desc, err)
+		}
+		for i, want := range test.want {
+			svc := "s" + strconv.Itoa(i)
+			ips, err := alloc.AllocateFromPool(svc, ServiceMeta{}, ipfamily.IPv4, "test", nil, "", "", test.highPriority)
+			if err != nil {
+				t.Fatalf("%s: AllocateFromPool(%q): %s", test.desc, svc, err)
+			}
+			if !ips[0].Equal(net.ParseIP(want)) {
+				t.Errorf("%s: AllocateFromPool(%q): want %q, got %q", test.desc, svc, want, ips[0])
+			}
+		}
+	}
+}
+
+func TestAllocationStrategy(t *testing.T) {
+	type step struct {
+		svc      string
+		release  bool
+		wantIP   string
+		wantFail bool
+	}
+	tests := []struct {
+		desc     string
+		strategy string
+		steps    []step
+	}{
+		{
+			desc: "sequential",
+			steps: []step{
+				{svc: "s1", wantIP: "1.2.3.0"},
+				{svc: "s2", wantIP: "1.2.3.1"},
+				{svc: "s1", release: true},
+				{svc: "s3", wantIP: "1.2.3.0"},
+			},
+		},
+		{
+			desc:     "round robin",
+			strategy: config.StrategyRoundRobin,
+			steps: []step{
+				{svc: "s1", wantIP: "1.2.3.0"},
+				{svc: "s2", wantIP: "1.2.3.1"},
+				{svc: "s1", release: true},
+				{svc: "s3", wantIP: "1.2.3.2"},
+				{svc: "s4", wantIP: "1.2.3.3"},
+				{svc: "s5", wantIP: "1.2.3.0"},
+				{svc: "s6", wantFail: true},
+			},
+		},
+		{
+			desc:     "least recently used",
+			strategy: config.StrategyLeastRecentlyUsed,
+			steps: []step{
+				{svc: "s1", wantIP: "1.2.3.0"},
+				{svc: "s2", wantIP: "1.2.3.1"},
+				{svc: "s2", release: true},
+				{svc: "s1", release: true},
+				{svc: "s3", wantIP: "1.2.3.2"},
+				{svc: "s4", wantIP: "1.2.3.3"},
+				{svc: "s5", wantIP: "1.2.3.1"},
+				{svc: "s6", wantIP: "1.2.3.0"},
+				{svc: "s7", wantFail: true},
+			},
+		},
+		{
+			desc:     "hashed",
+			strategy: config.StrategyHashed,
+			steps: []step{
+				{svc: "s1", wantIP: "1.2.3.1"},
+				{svc: "s2", wantIP: "1.2.3.0"},
+				{svc: "s2", release: true},
+				{svc: "s2", wantIP: "1.2.3.0"},
+				{svc: "s5", wantIP: "1.2.3.2"},
+				{svc: "s3", wantIP: "1.2.3.3"},
+				{svc: "s4", wantFail: true},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		alloc := New()
+		if err := alloc.SetPools(map[string]*config.Pool{
+			"test": {
+				AutoAssign:         true,
+				CIDR:               []*net.IPNet{ipnet("1.2.3.0/30")},
+				AllocationStrategy: test.strategy,
+			},
+		}); err != nil {
+			t.Fatalf("%s: SetPools: %s", test.desc, err)
+		}
+		for _, step := range test.steps {
+			if step.release {
+				alloc.Unassign(step.svc)
+				continue
+			}
+			ips, err := alloc.AllocateFromPool(step.svc, ServiceMeta{}, ipfamily.IPv4, "test", nil, "", "", false)
+			if step.wantFail {
+				if err == nil {
+					t.Errorf("%s: AllocateFromPool(%q): expected an error, got %q", test.desc, step.svc, ips)
+				}
+				continue
+			}
+			if err != nil {
+				t.Fatalf("%s: AllocateFromPool(%q): %s", test.desc, step.svc, err)
+			}
+			if !ips[0].Equal(net.ParseIP(step.wantIP)) {
+				t.Errorf("%s: AllocateFromPool(%q): want %q, got %q", test.desc, step.svc, step.wantIP, ips[0])
+			}
+		}
+	}
+}
+
+func TestRandomAllocationStrategy(t *testing.T) {
+	alloc := New()
+	if err := alloc.SetPools(map[string]*config.Pool{
+		"test": {
+			AutoAssign:          true,
+			CIDR:                []*net.IPNet{ipnet("1.2.3.0/29"), ipnet("1000::/64")},
+			ReservedBoundaryIPs: 1,
+			AllocationStrategy:  config.StrategyRandom,
+		},
+	}); err != nil {
+		t.Fatalf("SetPools: %s", err)
+	}
+
+	// All the usable IPs get allocated, in any order.
+	seen := map[string]bool{}
+	for i := 0; i < 6; i++ {
+		svc := "s" + strconv.Itoa(i)
+		ips, err := alloc.AllocateFromPool(svc, ServiceMeta{}, ipfamily.IPv4, "test", nil, "", "", false)
+		if err != nil {
+			t.Fatalf("AllocateFromPool(%q): %s", svc, err)
+		}
+		ip := ips[0].String()
+		if seen[ip] || ip == "1.2.3.0" || ip == "1.2.3.7" {
+			t.Fatalf("AllocateFromPool(%q): got unexpected IP %q", svc, ip)
+		}
+		seen[ip] = true
+	}
+	if ips, err := alloc.AllocateFromPool("s6", ServiceMeta{}, ipfamily.IPv4, "test", nil, "", "", false); err == nil {
+		t.Fatalf("AllocateFromPool(\"s6\") allocated %q from an exhausted pool", ips)
+	}
+
+	ips, err := alloc.AllocateFromPool("s7", ServiceMeta{}, ipfamily.IPv6, "test", nil, "", "", false)
+	if err != nil {
+		t.Fatalf("AllocateFromPool(\"s7\"): %s", err)
+	}
+	if !ipnet("1000::/64").Contains(ips[0]) {
+		t.Fatalf("AllocateFromPool(\"s7\"): got %q, outside of the pool", ips[0])
+	}
+}
+
+func TestSimulate(t *testing.T) {
+	alloc := New()
+	if err := alloc.SetPools(map[string]*config.Pool{
+		"test": {
+			AutoAssign:         true,
+			CIDR:               []*net.IPNet{ipnet("1.2.3.0/30")},
+			AllocationStrategy: config.StrategyRoundRobin,
+		},
+	}); err != nil {
+		t.Fatalf("SetPools: %s", err)
+	}
+	if _, err := alloc.AllocateFromPool("s1", ServiceMeta{}, ipfamily.IPv4, "test", nil, "", "", false); err != nil {
+		t.Fatalf("AllocateFromPool(s1): %s", err)
+	}
+
+	simulate := func(svc string) ([]net.IP, string, error) {
+		return alloc.Simulate(svc, func() ([]net.IP, error) {
+			return alloc.AllocateFromPool(svc, ServiceMeta{}, ipfamily.IPv4, "test", nil, "", "", false)
+		})
+	}
+	for i := 0; i < 2; i++ {
+		ips, pool, err := simulate("s2")
+		if err != nil {
+			t.Fatalf("Simulate(s2): %s", err)
+		}
+		if pool != "test" || !ips[0].Equal(net.ParseIP("1.2.3.1")) {
+			t.Fatalf("Simulate(s2): want 1.2.3.1 from test, got %q from %q", ips, pool)
+		}
+		if got := assigned(alloc, "s2"); len(got) != 0 {
+			t.Fatalf("Simulate(s2) left IPs assigned: %q", got)
+		}
+	}
+
+	// The simulations don't move the round robin forward.
+	ips, err := alloc.AllocateFromPool("s3", ServiceMeta{}, ipfamily.IPv4, "test", nil, "", "", false)
+	if err != nil {
+		t.Fatalf("AllocateFromPool(s3): %s", err)
+	}
+	if !ips[0].Equal(net.ParseIP("1.2.3.1")) {
+		t.Fatalf("AllocateFromPool(s3): want 1.2.3.1, got %q", ips[0])
+	}
+
+	if _, _, err := simulate("s1"); err == nil {
+		t.Fatalf("Simulate(s1) succeeded on a service with IPs")
+	}
+	if got := assigned(alloc, "s1"); len(got) != 1 {
+		t.Fatalf("Simulate(s1) released the IPs of s1, got %q", got)
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	alloc := New()
+	if err := alloc.SetPools(map[string]*config.Pool{
+		"test": {
+			AutoAssign: true,
+			CIDR:       []*net.IPNet{ipnet("1.2.3.0/30")},
+		},
+	}); err != nil {
+		t.Fatalf("SetPools: %s", err)
+	}
+	got := []string{}
+	alloc.SetAuditLogger(log.LoggerFunc(func(kv ...interface{}) error {
+		for i := 0; i < len(kv)-1; i += 2 {
+			if kv[i] == "event" {
+				got = append(got, kv[i+1].(string))
+			}
+		}
+		return nil
+	}))
+
+	ip := []net.IP{net.ParseIP("1.2.3.0")}
+	if err := alloc.Assign("s1", ip, ports("tcp/80"), "key", ""); err != nil {
+		t.Fatalf("Assign(s1): %s", err)
+	}
+	if err := alloc.Assign("s2", ip, ports("tcp/443"), "key", ""); err != nil {
+		t.Fatalf("Assign(s2): %s", err)
+	}
+	if _, _, err := alloc.Simulate("s3", func() ([]net.IP, error) {
+		return alloc.AllocateFromPool("s3", ServiceMeta{}, ipfamily.IPv4, "test", nil, "", "", false)
+	}); err != nil {
+		t.Fatalf("Simulate(s3): %s", err)
+	}
+	alloc.Unassign("s1")
+	alloc.Unassign("s2")
+
+	// The shared IP is released once, when its last service leaves, and
+	// the simulated allocations are not reported.
+	want := []string{"ipInUse", "ipInUse", "ipReleased"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got audit events %v, want %v", got, want)
+	}
+}
+
+func TestIPGenerationPlugin(t *testing.T) {
+	// stableHash gives a service the IP at the offset of the hash of its
+	// app label, or of its name without one, or the next free one.
+	stableHash := func(pool *config.Pool, cidr *net.IPNet, allocated map[string]string, svc string, meta ServiceMeta) (net.IP, error) {
+		h := fnv.New32a()
+		if app := meta.Labels["app"]; app != "" {
+			_, _ = h.Write([]byte(app))
+		} else {
+			_, _ = h.Write([]byte(svc))
+		}
+		ones, bits := cidr.Mask.Size()
+		size := uint32(1) << (bits - ones)
+		for i := uint32(0); i < size; i++ {
+			ip := addToIP(cidr.IP, uint64((h.Sum32()+i)%size))
+			if _, used := allocated[ip.String()]; !used {
+				return ip, nil
+			}
+		}
+		return nil, nil
+	}
+	RegisterIPGenerationPlugin("test-stable-hash", stableHash)
+	RegisterIPGenerationPlugin("test-out-of-cidr", func(*config.Pool, *net.IPNet, map[string]string, string, ServiceMeta) (net.IP, error) {
+		return net.ParseIP("10.0.0.1"), nil
+	})
+
+	alloc := New()
+	if err := alloc.SetPools(map[string]*config.Pool{
+		"test": {CIDR: []*net.IPNet{ipnet("1.2.3.0/28")}, GenerationPlugin: "test-unknown"},
+	}); err == nil {
+		t.Fatalf("SetPools accepted an unknown generation plugin")
+	}
+	if err := alloc.SetPools(map[string]*config.Pool{
+		"test":       {CIDR: []*net.IPNet{ipnet("1.2.3.0/28")}, GenerationPlugin: "test-stable-hash"},
+		"broken":     {CIDR: []*net.IPNet{ipnet("1.2.4.0/28")}, GenerationPlugin: "test-out-of-cidr"},
+		"sequential": {CIDR: []*net.IPNet{ipnet("1.2.5.0/30")}, GenerationPlugin: SequentialPlugin, AvoidBuggyIPs: true},
+	}); err != nil {
+		t.Fatalf("SetPools: %s", err)
+	}
+
+	allocate := func(svc string, meta ServiceMeta, pool string) net.IP {
+		t.Helper()
+		ips, err := alloc.AllocateFromPool(svc, meta, ipfamily.IPv4, pool, nil, "", "", false)
+		if err != nil {
+			t.Fatalf("AllocateFromPool(%s): %s", svc, err)
+		}
+		return ips[0]
+	}
+	first := allocate("ns/s1", ServiceMeta{}, "test")
+	other := allocate("ns/s2", ServiceMeta{}, "test")
+	if first.Equal(other) {
+		t.Fatalf("s1 and s2 got the same IP %s", first)
+	}
+	// The service gets the same IP back once it was released.
+	alloc.Unassign("ns/s1")
+	if ip := allocate("ns/s1", ServiceMeta{}, "test"); !ip.Equal(first) {
+		t.Fatalf("s1 got %s after its release, want %s", ip, first)
+	}
+	// The plugin sees the labels of the service: a service created again
+	// under another name gets the same IP.
+	web := allocate("ns/web", ServiceMeta{Labels: map[string]string{"app": "web"}}, "test")
+	alloc.Unassign("ns/web")
+	if ip := allocate("ns/web-v2", ServiceMeta{Labels: map[string]string{"app": "web"}}, "test"); !ip.Equal(web) {
+		t.Fatalf("web-v2 got %s, want the IP %s of web", ip, web)
+	}
+
+	if _, err := alloc.AllocateFromPool("ns/s3", ServiceMeta{}, ipfamily.IPv4, "broken", nil, "", "", false); err == nil {
+		t.Fatalf("AllocateFromPool accepted an IP out of the pool")
+	}
+
+	// The built-in sequential plugin gives the first free IPs, skipping
+	// the buggy .0 one.
+	for i, want := range []string{"1.2.5.1", "1.2.5.2", "1.2.5.3"} {
+		if ip := allocate("ns/seq"+strconv.Itoa(i), ServiceMeta{}, "sequential"); ip.String() != want {
+			t.Fatalf("seq%d got %s, want %s", i, ip, want)
+		}
+	}
+	if _, err := alloc.AllocateFromPool("ns/seq3", ServiceMeta{}, ipfamily.IPv4, "sequential", nil, "", "", false); err == nil {
+		t.Fatalf("AllocateFromPool allocated from a full pool")
+	}
+}
+
+func TestUnknownAllocationStrategy(t *testing.T) {
+	alloc := New()
+	err := alloc.SetPools(map[string]*config.Pool{
+		"test": {
+			CIDR:               []*net.IPNet{ipnet("1.2.3.0/30")},
+			AllocationStrategy: "fastest",
+		},
+	})
+	if err == nil {
+		t.Fatalf("SetPools accepted an unknown allocation strategy")
+	}
+}
+
+func TestEmergencyReserve(t *testing.T) {
+	alloc := New()
+	if err := alloc.SetPools(map[string]*config.Pool{
+		"test": {
+			AutoAssign:               true,
+			CIDR:                     []*net.IPNet{ipnet("1.2.3.0/29")},
+			EmergencyReserveFraction: 0.25,
+		},
+	}); err != nil {
+		t.Fatalf("SetPools: %s", err)
+	}
+
+	for i := 0; i < 6; i++ {
+		svc := "s" + strconv.Itoa(i)
+		if _, err := alloc.AllocateFromPool(svc, ServiceMeta{}, ipfamily.IPv4, "test", ports("tcp/80"), "key", "", false); err != nil {
+			t.Fatalf("AllocateFromPool(%q): %s", svc, err)
+		}
+	}
+	// Only the reserve is left.
+	if ips, err := alloc.Allocate("s6", ServiceMeta{}, ipfamily.IPv4, ports("tcp/80"), "key", "", false); err == nil {
+		t.Fatalf("Allocate(\"s6\") allocated %q from the emergency reserve", ips)
+	}
+	// Sharing an IP in use doesn't take from the reserve.
+	ips, err := alloc.AllocateFromPool("s7", ServiceMeta{}, ipfamily.IPv4, "test", ports("tcp/443"), "key", "", false)
+	if err != nil {
+		t.Fatalf("AllocateFromPool(\"s7\"): %s", err)
+	}
+	if !ips[0].Equal(net.ParseIP("1.2.3.0")) {
+		t.Fatalf("AllocateFromPool(\"s7\"): want the shared 1.2.3.0, got %q", ips[0])
+	}
+	// The high priority services get the reserve.
+	for _, svc := range []string{"s8", "s9"} {
+		if _, err := alloc.AllocateFromPool(svc, ServiceMeta{}, ipfamily.IPv4, "test", ports("tcp/80"), "key", "", true); err != nil {
+			t.Fatalf("AllocateFromPool(%q): %s", svc, err)
+		}
+	}
+	if ips, err := alloc.AllocateFromPool("s10", ServiceMeta{}, ipfamily.IPv4, "test", ports("tcp/80"), "key", "", true); err == nil {
+		t.Fatalf("AllocateFromPool(\"s10\") allocated %q from an exhausted pool", ips)
+	}
+}
+
+func TestAllocateSkipsConflictingIPs(t *testing.T) {
+	alloc := New()
+	if err := alloc.SetPools(map[string]*config.Pool{
+		"test": {
+			AutoAssign: true,
+			CIDR:       []*net.IPNet{ipnet("1.2.3.0/30")},
+		},
+		"other": {
+			AutoAssign: false,
+			CIDR:       []*net.IPNet{ipnet("4.5.6.0/30")},
+		},
+	}); err != nil {
+		t.Fatalf("SetPools: %s", err)
+	}
+
+	// s1 takes 1.2.3.0 with a sharing key, so services with another
+	// sharing key or the same port conflict with it.
+	if err := alloc.Assign("s1", []net.IP{net.ParseIP("1.2.3.0")}, ports("tcp/80"), "key1", ""); err != nil {
+		t.Fatalf("Assign(s1): %s", err)
+	}
+
+	tests := []struct {
+		svc        string
+		ports      []Port
+		sharingKey string
+		want       string
+	}{
+		{svc: "s2", ports: ports("tcp/80"), sharingKey: "key2", want: "1.2.3.1"},
+		{svc: "s3", ports: ports("tcp/80"), sharingKey: "key1", want: "1.2.3.2"},
+		{svc: "s4", ports: ports("tcp/443"), sharingKey: "key1", want: "1.2.3.0"},
+	}
+	for _, test := range tests {
+		ips, err := alloc.Allocate(test.svc, ServiceMeta{}, ipfamily.IPv4, test.ports, test.sharingKey, "", false)
+		if err != nil {
+			t.Fatalf("Allocate(%q): %s", test.svc, err)
+		}
+		if !ips[0].Equal(net.ParseIP(test.want)) {
+			t.Errorf("Allocate(%q): want %q from the same pool, got %q", test.svc, test.want, ips[0])
+		}
+	}
+}
+
+func TestAllocateOtherFamily(t *testing.T) {
+	alloc := New()
+	if err := alloc.SetPools(map[string]*config.Pool{
+		"dual": {
+			AutoAssign: true,
+			CIDR:       []*net.IPNet{ipnet("1.2.3.0/30"), ipnet("1000::/126")},
+		},
+		"v4": {
+			AutoAssign: true,
+			CIDR:       []*net.IPNet{ipnet("4.5.6.0/30")},
+		},
+	}); err != nil {
+		t.Fatalf("SetPools: %s", err)
+	}
+
+	ips, err := alloc.AllocateOtherFamily("s1", ServiceMeta{}, net.ParseIP("1.2.3.2"), nil, "", "", false)
+	if err != nil {
+		t.Fatalf("AllocateOtherFamily(s1): %s", err)
+	}
+	if len(ips) != 2 || !ips[0].Equal(net.ParseIP("1.2.3.2")) || !ips[1].Equal(net.ParseIP("1000::")) {
+		t.Errorf("AllocateOtherFamily(s1): want [1.2.3.2 1000::], got %q", ips)
+	}
+	if got := alloc.IPs("s1"); len(got) != 2 {
+		t.Errorf("s1 got assigned %q, want both IPs", got)
+	}
+
+	// The IPs come in the order of the CIDRs of the pool, whichever is
+	// kept.
+	ips, err = alloc.AllocateOtherFamily("s4", ServiceMeta{}, net.ParseIP("1000::2"), nil, "", "", false)
+	if err != nil {
+		t.Fatalf("AllocateOtherFamily(s4): %s", err)
+	}
+	if len(ips) != 2 || !ips[0].Equal(net.ParseIP("1.2.3.0")) || !ips[1].Equal(net.ParseIP("1000::2")) {
+		t.Errorf("AllocateOtherFamily(s4): want [1.2.3.0 1000::2], got %q", ips)
+	}
+
+	if _, err := alloc.AllocateOtherFamily("s2", ServiceMeta{}, net.ParseIP("4.5.6.0"), nil, "", "", false); err == nil {
+		t.Errorf("AllocateOtherFamily(s2) succeeded from a pool without IPv6 addresses")
+	}
+	if _, err := alloc.AllocateOtherFamily("s3", ServiceMeta{}, net.ParseIP("7.8.9.0"), nil, "", "", false); err == nil {
+		t.Errorf("AllocateOtherFamily(s3) succeeded with an IP out of the pools")
+	}
+}
+
+func TestAllocatePoolPriority(t *testing.T) {
+	alloc := New()
+	if err := alloc.SetPools(map[string]*config.Pool{
+		"a": {
+			AutoAssign: true,
+			CIDR:       []*net.IPNet{ipnet("1.2.3.0/32")},
+		},
+		"b": {
+			AutoAssign:        true,
+			CIDR:              []*net.IPNet{ipnet("1.2.4.0/32")},
+			ServiceAllocation: &config.ServiceAllocation{Priority: 2},
+		},
+		"c": {
+			AutoAssign:        true,
+			CIDR:              []*net.IPNet{ipnet("1.2.5.0/32")},
+			ServiceAllocation: &config.ServiceAllocation{Priority: 1},
+		},
+		"d": {
+			AutoAssign: true,
+			CIDR:       []*net.IPNet{ipnet("1.2.6.0/32")},
+		},
+		"manual": {
+			CIDR:              []*net.IPNet{ipnet("1.2.7.0/32")},
+			ServiceAllocation: &config.ServiceAllocation{Priority: 1},
+		},
+	}); err != nil {
+		t.Fatalf("SetPools: %s", err)
+	}
+
+	want := []string{"c", "b", "a", "d"}
+	if got := alloc.AutoAssignPools(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("AutoAssignPools: want %q, got %q", want, got)
+	}
+	for i, wantIP := range []string{"1.2.5.0", "1.2.4.0", "1.2.3.0", "1.2.6.0"} {
+		svc := "s" + strconv.Itoa(i)
+		ips, err := alloc.Allocate(svc, ServiceMeta{}, ipfamily.IPv4, nil, "", "", false)
+		if err != nil {
+			t.Fatalf("Allocate(%s): %s", svc, err)
+		}
+		if len(ips) != 1 || ips[0].String() != wantIP {
+			t.Fatalf("Allocate(%s): want %s, got %q", svc, wantIP, ips)
+		}
+	}
+}
+
+func TestReservedBoundaryIPs(t *testing.T) {
+	alloc := New()
+	if err := alloc.SetPools(map[string]*config.Pool{
+		"test": {
+			AutoAssign:          true,
+			CIDR:                []*net.IPNet{ipnet("1.2.3.0/29"), ipnet("1000::/125")},
+			ReservedBoundaryIPs: 2,
+		},
+	}); err != nil {
+		t.Fatalf("SetPools: %s", err)
+	}
+
+	validIPs := map[string]bool{
+		"1.2.3.2": true,
+		"1.2.3.3": true,
+		"1.2.3.4": true,
+		"1.2.3.5": true,
+	}
+	for i := 1; i <= 4; i++ {
+		svc := "s" + strconv.Itoa(i)
+		ips, err := alloc.Allocate(svc, ServiceMeta{}, ipfamily.IPv4, nil, "", "", false)
+		if err != nil {
+			t.Fatalf("Allocate(%q): %s", svc, err)
+		}
+		for _, ip := range ips {
+			if !validIPs[ip.String()] {
+				t.Errorf("Allocate(%q) allocated reserved IP %q", svc, ip)
+			}
+		}
+	}
+	if _, err := alloc.Allocate("s5", ServiceMeta{}, ipfamily.IPv4, nil, "", "", false); err == nil {
+		t.Errorf("Allocate(\"s5\") allocated an IP from an exhausted pool")
+	}
+
+	ips, err := alloc.Allocate("s6", ServiceMeta{}, ipfamily.IPv6, nil, "", "", false)
+	if err != nil {
+		t.Fatalf("Allocate(\"s6\"): %s", err)
+	}
+	if want := net.ParseIP("1000::2"); !ips[0].Equal(want) {
+		t.Errorf("Allocate(\"s6\"): want %q, got %q", want, ips[0])
+	}
+
+	for _, ip := range []string{"1.2.3.0", "1.2.3.1", "1.2.3.6", "1.2.3.7", "1000::7"} {
+		if err := alloc.Assign("s7", []net.IP{net.ParseIP(ip)}, nil, "", ""); err == nil {
+			t.Errorf("Assign(\"s7\", %q) assigned a reserved IP", ip)
+		}
+	}
+
+	if got := poolCount(alloc.pools["test"]); got != 8 {
+		t.Errorf("wrong pool count, want 8, got %d", got)
+	}
+}
+
+func TestAvoidBuggyIPs(t *testing.T) {
+	alloc := New()
+	if err := alloc.SetPools(map[string]*config.Pool{
+		"test": {
+			AutoAssign:    true,
+			CIDR:          []*net.IPNet{ipnet("1.2.3.254/31"), ipnet("1.2.4.0/31"), ipnet("1000::/127")},
+			AvoidBuggyIPs: true,
+		},
+	}); err != nil {
+		t.Fatalf("SetPools: %s", err)
+	}
+
+	validIPs := map[string]bool{
+		"1.2.3.254": true,
+		"1.2.4.1":   true,
+	}
+	for i := 1; i <= 2; i++ {
+		svc := "s" + strconv.Itoa(i)
+		ips, err := alloc.Allocate(svc, ServiceMeta{}, ipfamily.IPv4, nil, "", "", false)
+		if err != nil {
+			t.Fatalf("Allocate(%q): %s", svc, err)
+		}
+		for _, ip := range ips {
+			if !validIPs[ip.String()] {
+				t.Errorf("Allocate(%q) allocated buggy IP %q", svc, ip)
+			}
+		}
+	}
+	if _, err := alloc.Allocate("s3", ServiceMeta{}, ipfamily.IPv4, nil, "", "", false); err == nil {
+		t.Errorf("Allocate(\"s3\") allocated an IP from an exhausted pool")
+	}
+
+	ips, err := alloc.Allocate("s4", ServiceMeta{}, ipfamily.IPv6, nil, "", "", false)
+	if err != nil {
+		t.Fatalf("Allocate(\"s4\"): %s", err)
+	}
+	if want := net.ParseIP("1000::1"); !ips[0].Equal(want) {
+		t.Errorf("Allocate(\"s4\"): want %q, got %q", want, ips[0])
+	}
+
+	for _, ip := range []string{"1.2.3.255", "1.2.4.0", "1000::"} {
+		if err := alloc.Assign("s5", []net.IP{net.ParseIP(ip)}, nil, "", ""); err == nil {
+			t.Errorf("Assign(\"s5\", %q) assigned a buggy IP", ip)
+		}
+	}
+
+	if got := poolCount(alloc.pools["test"]); got != 3 {
+		t.Errorf("wrong pool count, want 3, got %d", got)
+	}
+}
+
+func TestBuggyIPCount(t *testing.T) {
+	tests := []struct {
+		cidr     string
+		reserved int
+		want     int64
+	}{
+		{"1.2.3.0/24", 0, 2},
+		{"1.2.0.0/22", 0, 8},
+		{"1.2.0.0/22", 1, 6},
+		{"1.2.3.0/25", 0, 1},
+		{"1.2.3.128/25", 0, 1},
+		{"1.2.3.64/26", 0, 0},
+		{"1.2.3.0/32", 0, 1},
+		{"1.2.3.4/32", 0, 0},
+		{"1000::/120", 0, 1},
+		{"1000::100/120", 0, 0},
+		{"1000::/60", 0, 16},
+	}
+	for _, test := range tests {
+		if got := buggyIPCount(ipnet(test.cidr), test.reserved); got != test.want {
+			t.Errorf("buggyIPCount(%s, %d): want %d, got %d", test.cidr, test.reserved, test.want, got)
+		}
+	}
+}
+
+func TestFreeIPs(t *testing.T) {
+	free := newFreeIPs(ipnet("1.2.3.0/29"))
+	for _, ip := range []string{"1.2.3.0", "1.2.3.3", "1.2.3.4", "1.2.3.7", "1.2.3.3"} {
+		free.use(net.ParseIP(ip))
+	}
+	want := []interval{{1, 2}, {5, 6}}
+	if !reflect.DeepEqual(free.intervals, want) {
+		t.Fatalf("unexpected intervals after use: want %v, got %v", want, free.intervals)
+	}
+
+	all := func(net.IP) bool { return true }
+	if got := free.find(false, all); !got.Equal(net.ParseIP("1.2.3.1")) {
+		t.Errorf("find from the beginning: want 1.2.3.1, got %s", got)
+	}
+	if got := free.find(true, all); !got.Equal(net.ParseIP("1.2.3.6")) {
+		t.Errorf("find from the end: want 1.2.3.6, got %s", got)
+	}
+	notFirst := func(ip net.IP) bool { return !ip.Equal(net.ParseIP("1.2.3.1")) }
+	if got := free.find(false, notFirst); !got.Equal(net.ParseIP("1.2.3.2")) {
+		t.Errorf("find skipping 1.2.3.1: want 1.2.3.2, got %s", got)
+	}
+
+	for _, ip := range []string{"1.2.3.4", "1.2.3.3", "1.2.3.7", "1.2.3.5"} {
+		free.release(net.ParseIP(ip))
+	}
+	want = []interval{{1, 7}}
+	if !reflect.DeepEqual(free.intervals, want) {
+		t.Fatalf("unexpected intervals after release: want %v, got %v", want, free.intervals)
+	}
+
+	if newFreeIPs(ipnet("1000::/64")) != nil {
+		t.Errorf("a /64 was indexed")
+	}
+	free = newFreeIPs(ipnet("1000::ff00/120"))
+	free.use(net.ParseIP("1000::ff00"))
+	if got := free.find(false, all); !got.Equal(net.ParseIP("1000::ff01")) {
+		t.Errorf("find in an IPv6 CIDR: want 1000::ff01, got %s", got)
+	}
+}
+
+func TestIndexedAllocation(t *testing.T) {
+	alloc := New()
+	if err := alloc.SetPools(map[string]*config.Pool{
+		"test": {
+			AutoAssign: true,
+			CIDR:       []*net.IPNet{ipnet("1.2.3.0/30")},
+		},
+	}); err != nil {
+		t.Fatalf("SetPools: %s", err)
+	}
+	if err := alloc.Assign("s1", []net.IP{net.ParseIP("1.2.3.0")}, nil, "", ""); err != nil {
+		t.Fatalf("Assign(s1): %s", err)
+	}
+	// The index survives a configuration change.
+	if err := alloc.SetPools(map[string]*config.Pool{
+		"test": {
+			AutoAssign: true,
+			CIDR:       []*net.IPNet{ipnet("1.2.3.0/30")},
+		},
+	}); err != nil {
+		t.Fatalf("SetPools: %s", err)
+	}
+	for i, want := range []string{"1.2.3.1", "1.2.3.2", "1.2.3.3"} {
+		svc := "s" + strconv.Itoa(i+2)
+		ips, err := alloc.Allocate(svc, ServiceMeta{}, ipfamily.IPv4, nil, "", "", false)
+		if err != nil {
+			t.Fatalf("Allocate(%q): %s", svc, err)
+		}
+		if !ips[0].Equal(net.ParseIP(want)) {
+			t.Errorf("Allocate(%q): want %s, got %s", svc, want, ips[0])
+		}
+	}
+	alloc.Unassign("s3")
+	ips, err := alloc.Allocate("s5", ServiceMeta{}, ipfamily.IPv4, nil, "", "", false)
+	if err != nil {
+		t.Fatalf("Allocate(\"s5\"): %s", err)
+	}
+	if want := net.ParseIP("1.2.3.2"); !ips[0].Equal(want) {
+		t.Errorf("Allocate(\"s5\"): want %s, got %s", want, ips[0])
+	}
+	// The IPs in use are still offered to the services sharing them.
+	if _, err := alloc.Allocate("s6", ServiceMeta{}, ipfamily.IPv4, nil, "share", "", false); err == nil {
+		t.Errorf("Allocate(\"s6\") shared an IP with a service not allowing it")
+	}
+}
+
+func BenchmarkAllocate(b *testing.B) {
+	alloc := New()
+	if err := alloc.SetPools(map[string]*config.Pool{
+		"test": {
+			AutoAssign: true,
+			CIDR:       []*net.IPNet{ipnet("10.0.0.0/16")},
+		},
+	}); err != nil {
+		b.Fatalf("SetPools: %s", err)
+	}
+	for i := 0; i < 60000; i++ {
+		if _, err := alloc.Allocate("s"+strconv.Itoa(i), ServiceMeta{}, ipfamily.IPv4, nil, "", "", false); err != nil {
+			b.Fatalf("Allocate: %s", err)
+		}
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := alloc.Allocate("bench", ServiceMeta{}, ipfamily.IPv4, nil, "", "", false); err != nil {
+			b.Fatalf("Allocate: %s", err)
+		}
+		alloc.Unassign("bench")
+	}
+}
+
 func TestConfigReload(t *testing.T) {
 	alloc := New()
 	if err := alloc.SetPools(map[string]*config.Pool{
@@ -1472,7 +2273,7 @@ func TestAutoAssign(t *testing.T) {
 			alloc.Unassign(test.svc)
 			continue
 		}
-		ips, err := alloc.Allocate(test.svc, test.ipFamily, nil, "", "")
+		ips, err := alloc.Allocate(test.svc, ServiceMeta{}, test.ipFamily, nil, "", "", false)
 		if test.wantErr {
 			if err == nil {
 				t.Errorf("#%d should have caused an error, but did not", i+1)
@@ -1533,6 +2334,51 @@ func TestPoolCount(t *testing.T) {
 	}
 }
 
+func TestCountInPoolForNamespace(t *testing.T) {
+	alloc := New()
+	if err := alloc.SetPools(map[string]*config.Pool{
+		"pool1": {
+			AutoAssign: true,
+			CIDR:       []*net.IPNet{ipnet("1.2.3.0/30")},
+		},
+		"pool2": {
+			AutoAssign: true,
+			CIDR:       []*net.IPNet{ipnet("1.2.4.0/30")},
+		},
+	}); err != nil {
+		t.Fatalf("SetPools: %s", err)
+	}
+
+	assign := func(svc, ip, sharingKey, port string) {
+		t.Helper()
+		if err := alloc.Assign(svc, []net.IP{net.ParseIP(ip)}, ports(port), sharingKey, ""); err != nil {
+			t.Fatalf("Assign(%s, %s): %s", svc, ip, err)
+		}
+	}
+	assign("ns1/s1", "1.2.3.0", "key", "tcp/80")
+	assign("ns1/s2", "1.2.3.0", "key", "tcp/443")
+	assign("ns1/s3", "1.2.3.1", "", "tcp/80")
+	assign("ns1/s4", "1.2.4.0", "", "tcp/80")
+	assign("ns10/s1", "1.2.3.2", "", "tcp/80")
+
+	tests := []struct {
+		pool      string
+		namespace string
+		want      int
+	}{
+		{"pool1", "ns1", 2},
+		{"pool2", "ns1", 1},
+		{"pool1", "ns10", 1},
+		{"pool2", "ns10", 0},
+		{"pool1", "ns2", 0},
+	}
+	for _, test := range tests {
+		if got := alloc.CountInPoolForNamespace(test.pool, test.namespace); got != test.want {
+			t.Errorf("CountInPoolForNamespace(%q, %q): want %d, got %d", test.pool, test.namespace, test.want, got)
+		}
+	}
+}
+
 func TestPoolMetrics(t *testing.T) {
 	alloc := New()
 	if err := alloc.SetPools(map[string]*config.Pool{
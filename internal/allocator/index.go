@@ -0,0 +1,150 @@
+// SPDX-License-Identifier:Apache-2.0
+
+package allocator
+
+import (
+	"net"
+	"sort"
+)
+
+// maxIndexedHostBits is the size of the largest CIDRs whose free
+// addresses are indexed. The larger ones never run out of addresses,
+// scanning them finds a free one right away.
+const maxIndexedHostBits = 62
+
+// freeIPs indexes the addresses of a CIDR that no service uses, as
+// sorted intervals of offsets from the beginning of the CIDR. The first
+// or last free address is found without walking the used ones, and
+// taking or releasing an address costs a binary search.
+type freeIPs struct {
+	base net.IP
+	// Sorted, non overlapping and non adjacent.
+	intervals []interval
+}
+
+// interval is a range of offsets, both ends included.
+type interval struct {
+	first, last uint64
+}
+
+// newFreeIPs returns the index of the addresses of cidr, all of them
+// free, or nil if cidr is too large to be indexed.
+func newFreeIPs(cidr *net.IPNet) *freeIPs {
+	ones, bits := cidr.Mask.Size()
+	if bits-ones > maxIndexedHostBits {
+		return nil
+	}
+	base := cidr.IP.Mask(cidr.Mask)
+	if v4 := base.To4(); v4 != nil {
+		base = v4
+	}
+	return &freeIPs{
+		base:      base,
+		intervals: []interval{{0, uint64(1)<<(bits-ones) - 1}},
+	}
+}
+
+// offset returns the offset of ip from the beginning of the CIDR.
+func (f *freeIPs) offset(ip net.IP) uint64 {
+	if v4 := ip.To4(); v4 != nil && len(f.base) == net.IPv4len {
+		ip = v4
+	}
+	return lowBits(ip) - lowBits(f.base)
+}
+
+// lowBits returns the lowest 64 bits of ip.
+func lowBits(ip net.IP) uint64 {
+	start := len(ip) - 8
+	if start < 0 {
+		start = 0
+	}
+	var res uint64
+	for _, b := range ip[start:] {
+		res = res<<8 | uint64(b)
+	}
+	return res
+}
+
+// use records that ip is not free anymore.
+func (f *freeIPs) use(ip net.IP) {
+	if f == nil {
+		return
+	}
+	off := f.offset(ip)
+	i := sort.Search(len(f.intervals), func(i int) bool { return f.intervals[i].last >= off })
+	if i == len(f.intervals) || f.intervals[i].first > off {
+		return
+	}
+	cur := f.intervals[i]
+	switch {
+	case cur.first == off && cur.last == off:
+		f.intervals = append(f.intervals[:i], f.intervals[i+1:]...)
+	case cur.first == off:
+		f.intervals[i].first++
+	case cur.last == off:
+		f.intervals[i].last--
+	default:
+		f.intervals = append(f.intervals, interval{})
+		copy(f.intervals[i+1:], f.intervals[i:])
+		f.intervals[i] = interval{cur.first, off - 1}
+		f.intervals[i+1] = interval{off + 1, cur.last}
+	}
+}
+
+// release records that ip is free again.
+func (f *freeIPs) release(ip net.IP) {
+	if f == nil {
+		return
+	}
+	off := f.offset(ip)
+	// i is the first interval after ip.
+	i := sort.Search(len(f.intervals), func(i int) bool { return f.intervals[i].first > off })
+	if i > 0 && f.intervals[i-1].last >= off {
+		return
+	}
+	joinsPrev := i > 0 && f.intervals[i-1].last+1 == off
+	joinsNext := i < len(f.intervals) && f.intervals[i].first-1 == off
+	switch {
+	case joinsPrev && joinsNext:
+		f.intervals[i-1].last = f.intervals[i].last
+		f.intervals = append(f.intervals[:i], f.intervals[i+1:]...)
+	case joinsPrev:
+		f.intervals[i-1].last = off
+	case joinsNext:
+		f.intervals[i].first = off
+	default:
+		f.intervals = append(f.intervals, interval{})
+		copy(f.intervals[i+1:], f.intervals[i:])
+		f.intervals[i] = interval{off, off}
+	}
+}
+
+// find returns the first free IP, or the last one when fromEnd is set,
+// that is usable, or nil if there is none.
+func (f *freeIPs) find(fromEnd bool, usable func(ip net.IP) bool) net.IP {
+	if !fromEnd {
+		for _, in := range f.intervals {
+			for off := in.first; ; off++ {
+				if ip := addToIP(f.base, off); usable(ip) {
+					return ip
+				}
+				if off == in.last {
+					break
+				}
+			}
+		}
+		return nil
+	}
+	for i := len(f.intervals) - 1; i >= 0; i-- {
+		in := f.intervals[i]
+		for off := in.last; ; off-- {
+			if ip := addToIP(f.base, off); usable(ip) {
+				return ip
+			}
+			if off == in.first {
+				break
+			}
+		}
+	}
+	return nil
+}
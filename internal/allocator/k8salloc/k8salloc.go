@@ -25,6 +25,23 @@ func SharingKey(svc *v1.Service) string {
 	return svc.Annotations["metallb.universe.tf/allow-shared-ip"]
 }
 
+// HighPriority returns true if the service requests its IPs from the
+// reserved end of the pools, and may use their emergency reserve.
+// Emergency services are high priority.
+func HighPriority(svc *v1.Service) bool {
+	return svc.Annotations["metallb.universe.tf/priority"] == "high" ||
+		svc.Annotations["metallb.universe.tf/emergency"] == "true"
+}
+
+// Meta extracts the metadata of a service the IP generation plugins
+// pick its IP from.
+func Meta(svc *v1.Service) allocator.ServiceMeta {
+	return allocator.ServiceMeta{
+		Labels:      svc.Labels,
+		Annotations: svc.Annotations,
+	}
+}
+
 // BackendKey extracts the backend key for a service.
 func BackendKey(svc *v1.Service) string {
 	if svc.Spec.ExternalTrafficPolicy == v1.ServiceExternalTrafficPolicyTypeLocal {
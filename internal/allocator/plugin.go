@@ -0,0 +1,112 @@
+// SPDX-License-Identifier:Apache-2.0
+
+package allocator
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"go.universe.tf/metallb/internal/config"
+)
+
+// ServiceMeta holds the metadata of a service the IP generation
+// plugins can pick its IP from.
+type ServiceMeta struct {
+	Labels      map[string]string
+	Annotations map[string]string
+}
+
+// An IPGenerationFunc returns the IP of cidr, one of the CIDRs of pool,
+// the service svc gets, or nil if there is none. allocated maps the
+// IPs of the pool in use to the services using them, separated by
+// commas, and meta holds the metadata of the service. The IP is
+// rejected if the service can't use it, because it is reserved or
+// conflicts with the services already using it.
+type IPGenerationFunc func(pool *config.Pool, cidr *net.IPNet, allocated map[string]string, svc string, meta ServiceMeta) (net.IP, error)
+
+// SequentialPlugin is the name of the built-in IP generation plugin
+// giving the services the first free IP of the pools, as the pools
+// without a plugin do by default.
+const SequentialPlugin = "sequential"
+
+var (
+	pluginsMu sync.RWMutex
+	// plugins holds the IP generation plugins, by the name used in the
+	// configuration of the pools.
+	plugins = map[string]IPGenerationFunc{}
+)
+
+func init() {
+	RegisterIPGenerationPlugin(SequentialPlugin, sequentialPlugin)
+}
+
+// sequentialPlugin runs the sequential scanner over the IPs of the CIDR
+// no service uses.
+func sequentialPlugin(pool *config.Pool, cidr *net.IPNet, allocated map[string]string, _ string, _ ServiceMeta) (net.IP, error) {
+	reservedIPs := boundaryIPs(cidr, pool.ReservedBoundaryIPs)
+	return sequential(nil, cidr, "", false, func(ip net.IP) bool {
+		if _, used := allocated[ip.String()]; used {
+			return false
+		}
+		return !reservedIPs[ip.String()] && !(pool.AvoidBuggyIPs && isBuggyIP(ip))
+	}), nil
+}
+
+// RegisterIPGenerationPlugin makes fn pick the IPs of the pools with the
+// given GenerationPlugin. The pools without one use their allocation
+// strategy, the sequential scanner by default, which unlike the
+// plugins lets the services share an IP. It is meant to be
+// called at init time, and panics if the name is already registered.
+func RegisterIPGenerationPlugin(name string, fn IPGenerationFunc) {
+	pluginsMu.Lock()
+	defer pluginsMu.Unlock()
+	if name == "" || fn == nil {
+		panic("allocator: invalid IP generation plugin")
+	}
+	if plugins[name] != nil {
+		panic(fmt.Sprintf("allocator: IP generation plugin %q registered twice", name))
+	}
+	plugins[name] = fn
+}
+
+func ipGenerationPlugin(name string) IPGenerationFunc {
+	pluginsMu.RLock()
+	defer pluginsMu.RUnlock()
+	return plugins[name]
+}
+
+// generateIP returns the IP of the CIDR the generation plugin of the
+// pool picks for the service, or nil if there is none.
+func (a *Allocator) generateIP(poolName string, cidr *net.IPNet, svc string, meta ServiceMeta, ports []Port, sharingKey, backendKey string) (net.IP, error) {
+	pool := a.pools[poolName]
+	fn := ipGenerationPlugin(pool.GenerationPlugin)
+	if fn == nil {
+		return nil, fmt.Errorf("unknown generation plugin %q in pool %q", pool.GenerationPlugin, poolName)
+	}
+	allocated := map[string]string{}
+	for ip := range a.poolIPsInUse[poolName] {
+		allocated[ip] = strings.Join(a.servicesOnIP.Services(ip), ",")
+	}
+	ip, err := fn(pool, cidr, allocated, svc, meta)
+	if err != nil {
+		return nil, fmt.Errorf("generation plugin %q of pool %q failed: %w", pool.GenerationPlugin, poolName, err)
+	}
+	if ip == nil {
+		return nil, nil
+	}
+	if !cidr.Contains(ip) {
+		return nil, fmt.Errorf("generation plugin %q of pool %q returned %s, out of %s", pool.GenerationPlugin, poolName, ip, cidr)
+	}
+	if boundaryIPs(cidr, pool.ReservedBoundaryIPs)[ip.String()] {
+		return nil, fmt.Errorf("generation plugin %q of pool %q returned the reserved IP %s", pool.GenerationPlugin, poolName, ip)
+	}
+	if pool.AvoidBuggyIPs && isBuggyIP(ip) {
+		return nil, fmt.Errorf("generation plugin %q of pool %q returned the buggy IP %s", pool.GenerationPlugin, poolName, ip)
+	}
+	if err := a.checkSharing(svc, ip.String(), ports, &key{sharing: sharingKey, backend: backendKey}); err != nil {
+		return nil, fmt.Errorf("generation plugin %q of pool %q returned %s, which can't be used: %w", pool.GenerationPlugin, poolName, ip, err)
+	}
+	return ip, nil
+}
@@ -8,6 +8,8 @@ var stats = struct {
 	poolCapacity  *prometheus.GaugeVec
 	poolActive    *prometheus.GaugeVec
 	poolAllocated *prometheus.GaugeVec
+	ipAssignments *prometheus.CounterVec
+	ipReleases    *prometheus.CounterVec
 }{
 	poolCapacity: prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Namespace: "metallb",
@@ -33,10 +35,28 @@ var stats = struct {
 	}, []string{
 		"pool",
 	}),
+	ipAssignments: prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "metallb",
+		Subsystem: "allocator",
+		Name:      "ip_assignments_total",
+		Help:      "Number of times a service started using an IP, per pool",
+	}, []string{
+		"pool",
+	}),
+	ipReleases: prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "metallb",
+		Subsystem: "allocator",
+		Name:      "ip_releases_total",
+		Help:      "Number of times an IP stopped being used by any service, per pool",
+	}, []string{
+		"pool",
+	}),
 }
 
 func init() {
 	prometheus.MustRegister(stats.poolCapacity)
 	prometheus.MustRegister(stats.poolActive)
 	prometheus.MustRegister(stats.poolAllocated)
+	prometheus.MustRegister(stats.ipAssignments)
+	prometheus.MustRegister(stats.ipReleases)
 }
@@ -0,0 +1,157 @@
+// SPDX-License-Identifier:Apache-2.0
+
+package allocator
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"net"
+
+	"go.universe.tf/metallb/internal/config"
+
+	"github.com/mikioh/ipaddr"
+)
+
+// An AllocationStrategy returns the IP of cidr the service svc gets, or
+// nil if there is none. usable reports whether the service can get an
+// IP, the reserved and conflicting ones being excluded. fromEnd is set
+// when the reservation mode of the pool requires allocating from the
+// end of the CIDR.
+type AllocationStrategy func(a *Allocator, cidr *net.IPNet, svc string, fromEnd bool, usable func(ip net.IP) bool) net.IP
+
+// strategies holds the allocation strategies, by the name used in the
+// configuration of the pools.
+var strategies = map[string]AllocationStrategy{
+	"":                               sequential,
+	config.StrategySequential:        sequential,
+	config.StrategyRandom:            random,
+	config.StrategyRoundRobin:        roundRobin,
+	config.StrategyLeastRecentlyUsed: leastRecentlyUsed,
+	config.StrategyHashed:            hashed,
+}
+
+// sequential returns the first usable IP of the CIDR, or the last one
+// when allocating from the end.
+func sequential(_ *Allocator, cidr *net.IPNet, _ string, fromEnd bool, usable func(ip net.IP) bool) net.IP {
+	c := ipaddr.NewCursor([]ipaddr.Prefix{*ipaddr.NewPrefix(cidr)})
+	first, next := c.First, c.Next
+	if fromEnd {
+		first, next = func() *ipaddr.Position { return last(c) }, c.Prev
+	}
+	for pos := first(); pos != nil; pos = next() {
+		if usable(pos.IP) {
+			return pos.IP
+		}
+	}
+	return nil
+}
+
+// random returns the first usable IP following a random one of the
+// CIDR.
+func random(_ *Allocator, cidr *net.IPNet, _ string, _ bool, usable func(ip net.IP) bool) net.IP {
+	ones, bits := cidr.Mask.Size()
+	hostBits := bits - ones
+	if hostBits > 62 {
+		hostBits = 62
+	}
+	start := addToIP(cidr.IP, uint64(rand.Int63n(int64(1)<<hostBits)))
+	return scanFrom(cidr, start, usable)
+}
+
+// roundRobin returns the first usable IP following the last one
+// allocated from the CIDR.
+func roundRobin(a *Allocator, cidr *net.IPNet, _ string, _ bool, usable func(ip net.IP) bool) net.IP {
+	start := cidr.IP
+	if prev := a.lastAllocated[cidr.String()]; prev != nil {
+		if next := addToIP(prev, 1); cidr.Contains(next) {
+			start = next
+		}
+	}
+	ip := scanFrom(cidr, start, usable)
+	if ip != nil {
+		a.lastAllocated[cidr.String()] = ip
+	}
+	return ip
+}
+
+// leastRecentlyUsed returns the first usable IP of the CIDR that was
+// never allocated, or the one released the longest ago.
+func leastRecentlyUsed(a *Allocator, cidr *net.IPNet, _ string, _ bool, usable func(ip net.IP) bool) net.IP {
+	var oldest net.IP
+	var oldestRelease uint64
+	c := ipaddr.NewCursor([]ipaddr.Prefix{*ipaddr.NewPrefix(cidr)})
+	for pos := c.First(); pos != nil; pos = c.Next() {
+		if !usable(pos.IP) {
+			continue
+		}
+		release, used := a.releasedAt[pos.IP.String()]
+		if !used {
+			return pos.IP
+		}
+		if oldest == nil || release < oldestRelease {
+			oldest, oldestRelease = pos.IP, release
+		}
+	}
+	return oldest
+}
+
+// hashed returns the first usable IP following the one at the offset
+// of the hash of the service key in the CIDR, so a service gets the
+// same IP across controller restarts and cluster rebuilds as long as it
+// is free.
+func hashed(_ *Allocator, cidr *net.IPNet, svc string, _ bool, usable func(ip net.IP) bool) net.IP {
+	ones, bits := cidr.Mask.Size()
+	hostBits := bits - ones
+	if hostBits > 62 {
+		hostBits = 62
+	}
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(svc))
+	start := addToIP(cidr.IP, h.Sum64()%(uint64(1)<<hostBits))
+	return scanFrom(cidr, start, usable)
+}
+
+// scanFrom returns the first usable IP of the CIDR from start to its
+// end, then from its beginning up to start.
+func scanFrom(cidr *net.IPNet, start net.IP, usable func(ip net.IP) bool) net.IP {
+	prefix := ipaddr.NewPrefix(cidr)
+	c := ipaddr.NewCursor([]ipaddr.Prefix{*prefix})
+	if err := c.Set(&ipaddr.Position{IP: start, Prefix: *prefix}); err != nil {
+		start = c.First().IP
+	}
+	for pos := c.Pos(); pos != nil; pos = c.Next() {
+		if usable(pos.IP) {
+			return pos.IP
+		}
+	}
+	c.Reset(nil)
+	for pos := c.Pos(); pos != nil && !pos.IP.Equal(start); pos = c.Next() {
+		if usable(pos.IP) {
+			return pos.IP
+		}
+	}
+	return nil
+}
+
+// last moves the cursor to its last position, and returns it. Unlike
+// Cursor.Last, the cursor can then be moved backwards with Prev.
+func last(c *ipaddr.Cursor) *ipaddr.Position {
+	pos := c.Last()
+	_ = c.Set(pos)
+	return pos
+}
+
+// addToIP returns ip + n.
+func addToIP(ip net.IP, n uint64) net.IP {
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+	}
+	res := make(net.IP, len(ip))
+	copy(res, ip)
+	for i := len(res) - 1; i >= 0 && n > 0; i-- {
+		sum := uint64(res[i]) + n&0xff
+		res[i] = byte(sum)
+		n = n>>8 + sum>>8
+	}
+	return res
+}
@@ -21,6 +21,9 @@ type Advertisement struct {
 	LocalPref uint32
 	// BGP communities to attach to the path.
 	Communities []uint32
+	// IPv6 flow label (RFC 6437) to attach to the path as a color
+	// extended community. Zero means none.
+	FlowLabel uint32
 	// Used to declare the intent of announcing IPs
 	// only to the BGPPeers in this list.
 	Peers []string
@@ -34,6 +37,9 @@ func (a *Advertisement) Equal(b *Advertisement) bool {
 	if a.LocalPref != b.LocalPref {
 		return false
 	}
+	if a.FlowLabel != b.FlowLabel {
+		return false
+	}
 
 	if !reflect.DeepEqual(a.Peers, b.Peers) {
 		return false
@@ -60,7 +66,27 @@ type Session interface {
 	Set(advs ...*Advertisement) error
 }
 
+// SessionParameters are the parameters of a BGP session.
+type SessionParameters struct {
+	PeerAddress     string
+	SourceAddress   net.IP
+	MyASN           uint32
+	RouterID        net.IP
+	PeerASN         uint32
+	HoldTime        time.Duration
+	KeepAliveTime   time.Duration
+	WatchdogTimeout time.Duration
+	InitialDelay    time.Duration
+	Password        string
+	CurrentNode     string
+	BFDProfile      string
+	VRFName         string
+	EBGPMultiHop    bool
+	GracefulRestart bool
+	SessionName     string
+}
+
 type SessionManager interface {
-	NewSession(logger log.Logger, addr string, srcAddr net.IP, myASN uint32, routerID net.IP, asn uint32, hold, keepalive time.Duration, password, myNode, bfdProfile string, ebgpMultiHop bool, name string) (Session, error)
+	NewSession(logger log.Logger, args SessionParameters) (Session, error)
 	SyncBFDProfiles(profiles map[string]*config.BFDProfile) error
 }
@@ -67,6 +67,13 @@ route-map {{$n.Addr}}-out permit {{counter $n.Addr}}
   set community {{$c}} additive
   on-match next
 {{- end }}
+{{- if not (eq $a.FlowLabel 0)}}
+{{frrIPFamily $n.IPFamily}} prefix-list {{flowLabelPrefixList $n $a.FlowLabel}} permit {{$a.Prefix}}
+route-map {{$n.Addr}}-out permit {{counter $n.Addr}}
+  match {{frrIPFamily $n.IPFamily}} address prefix-list {{flowLabelPrefixList $n $a.FlowLabel}}
+  set extcommunity color {{$a.FlowLabel}}
+  on-match next
+{{- end }}
 {{frrIPFamily $a.IPFamily}} prefix-list {{allowedPrefixList $n}} permit {{$a.Prefix}}
 {{- end }}
 route-map {{$n.Addr}}-out permit {{counter $n.Addr}}
@@ -77,7 +84,7 @@ route-map {{$n.Addr}}-out permit {{counter $n.Addr}}
 {{- end }}
 
 {{range $r := .Routers -}}
-router bgp {{$r.MyASN}}
+router bgp {{$r.MyASN}}{{ if $r.VRF }} vrf {{$r.VRF}}{{end}}
   no bgp ebgp-requires-policy
   no bgp network import-check
   no bgp default ipv4-unicast
@@ -89,6 +96,9 @@ router bgp {{$r.MyASN}}
   {{- if .EBGPMultiHop }}
   neighbor {{.Addr}} ebgp-multihop
   {{- end }}
+  {{- if .GracefulRestart }}
+  neighbor {{.Addr}} graceful-restart
+  {{- end }}
   {{ if .Port -}}
   neighbor {{.Addr}} port {{.Port}}
   {{- end }}
@@ -171,6 +181,7 @@ type frrConfig struct {
 type routerConfig struct {
 	MyASN     uint32
 	RouterId  string
+	VRF       string
 	Neighbors map[string]*neighborConfig
 }
 
@@ -186,18 +197,19 @@ type BFDProfile struct {
 }
 
 type neighborConfig struct {
-	IPFamily       ipfamily.Family
-	Name           string
-	ASN            uint32
-	Addr           string
-	SrcAddr        string
-	Port           uint16
-	HoldTime       uint64
-	KeepaliveTime  uint64
-	Password       string
-	Advertisements []*advertisementConfig
-	BFDProfile     string
-	EBGPMultiHop   bool
+	IPFamily        ipfamily.Family
+	Name            string
+	ASN             uint32
+	Addr            string
+	SrcAddr         string
+	Port            uint16
+	HoldTime        uint64
+	KeepaliveTime   uint64
+	Password        string
+	Advertisements  []*advertisementConfig
+	BFDProfile      string
+	EBGPMultiHop    bool
+	GracefulRestart bool
 }
 
 type advertisementConfig struct {
@@ -205,12 +217,13 @@ type advertisementConfig struct {
 	Prefix      string
 	Communities []string
 	LocalPref   uint32
+	FlowLabel   uint32
 }
 
 // routerName() defines the format of the key of the "Routers" map in the
 // frrConfig struct.
-func routerName(srcAddr string, myASN uint32) string {
-	return fmt.Sprintf("%d@%s", myASN, srcAddr)
+func routerName(srcAddr string, myASN uint32, vrf string) string {
+	return fmt.Sprintf("%d@%s@%s", myASN, vrf, srcAddr)
 }
 
 // neighborName() defines the format of key of the 'Neighbors' map in the
@@ -246,6 +259,9 @@ func templateConfig(data interface{}) (string, error) {
 			"communityPrefixList": func(neighbor *neighborConfig, community string) string {
 				return fmt.Sprintf("%s-%s-%s-community-prefixes", neighbor.Addr, community, neighbor.IPFamily)
 			},
+			"flowLabelPrefixList": func(neighbor *neighborConfig, flowLabel uint32) string {
+				return fmt.Sprintf("%s-%d-%s-flowlabel-prefixes", neighbor.Addr, flowLabel, neighbor.IPFamily)
+			},
 			"allowedPrefixList": func(neighbor *neighborConfig) string {
 				return fmt.Sprintf("%s-pl-%s", neighbor.Addr, neighbor.IPFamily)
 			},
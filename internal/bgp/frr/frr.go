@@ -32,21 +32,23 @@ type sessionManager struct {
 }
 
 type session struct {
-	name           string
-	myASN          uint32
-	routerID       net.IP // May be nil, meaning "derive from context"
-	myNode         string
-	addr           string
-	srcAddr        net.IP
-	asn            uint32
-	holdTime       time.Duration
-	keepaliveTime  time.Duration
-	logger         log.Logger
-	password       string
-	advertised     []*bgp.Advertisement
-	bfdProfile     string
-	ebgpMultiHop   bool
-	sessionManager *sessionManager
+	name            string
+	myASN           uint32
+	routerID        net.IP // May be nil, meaning "derive from context"
+	myNode          string
+	addr            string
+	srcAddr         net.IP
+	asn             uint32
+	holdTime        time.Duration
+	keepaliveTime   time.Duration
+	logger          log.Logger
+	password        string
+	advertised      []*bgp.Advertisement
+	bfdProfile      string
+	ebgpMultiHop    bool
+	gracefulRestart bool
+	vrf             string
+	sessionManager  *sessionManager
 }
 
 // Create a variable for os.Hostname() in order to make it easy to mock out
@@ -118,25 +120,27 @@ func (s *session) Close() error {
 //
 // The session will immediately try to connect and synchronize its
 // local state with the peer.
-func (sm *sessionManager) NewSession(l log.Logger, addr string, srcAddr net.IP, myASN uint32, routerID net.IP, asn uint32, holdTime, keepaliveTime time.Duration, password, myNode, bfdProfile string, ebgpMultiHop bool, name string) (bgp.Session, error) {
+func (sm *sessionManager) NewSession(l log.Logger, args bgp.SessionParameters) (bgp.Session, error) {
 	sm.Lock()
 	defer sm.Unlock()
 	s := &session{
-		name:           name,
-		myASN:          myASN,
-		routerID:       routerID,
-		myNode:         myNode,
-		addr:           addr,
-		srcAddr:        srcAddr,
-		asn:            asn,
-		holdTime:       holdTime,
-		keepaliveTime:  keepaliveTime,
-		logger:         log.With(l, "peer", addr, "localASN", myASN, "peerASN", asn),
-		password:       password,
-		advertised:     []*bgp.Advertisement{},
-		sessionManager: sm,
-		bfdProfile:     bfdProfile,
-		ebgpMultiHop:   ebgpMultiHop,
+		name:            args.SessionName,
+		myASN:           args.MyASN,
+		routerID:        args.RouterID,
+		myNode:          args.CurrentNode,
+		addr:            args.PeerAddress,
+		srcAddr:         args.SourceAddress,
+		asn:             args.PeerASN,
+		holdTime:        args.HoldTime,
+		keepaliveTime:   args.KeepAliveTime,
+		logger:          log.With(l, "peer", args.PeerAddress, "localASN", args.MyASN, "peerASN", args.PeerASN),
+		password:        args.Password,
+		advertised:      []*bgp.Advertisement{},
+		sessionManager:  sm,
+		bfdProfile:      args.BFDProfile,
+		ebgpMultiHop:    args.EBGPMultiHop,
+		gracefulRestart: args.GracefulRestart,
+		vrf:             args.VRFName,
 	}
 
 	_ = sm.addSession(s)
@@ -216,10 +220,11 @@ func (sm *sessionManager) createConfig() (*frrConfig, error) {
 		var neighbor *neighborConfig
 		var exist bool
 
-		routerName := routerName(s.routerID.String(), s.myASN)
+		routerName := routerName(s.routerID.String(), s.myASN, s.vrf)
 		if router, exist = config.Routers[routerName]; !exist {
 			router = &routerConfig{
 				MyASN:     s.myASN,
+				VRF:       s.vrf,
 				Neighbors: make(map[string]*neighborConfig),
 			}
 			if s.routerID != nil {
@@ -243,16 +248,17 @@ func (sm *sessionManager) createConfig() (*frrConfig, error) {
 			family := ipfamily.ForAddress(net.ParseIP(host))
 
 			neighbor = &neighborConfig{
-				IPFamily:       family,
-				ASN:            s.asn,
-				Addr:           host,
-				Port:           uint16(portUint),
-				HoldTime:       uint64(s.holdTime / time.Second),
-				KeepaliveTime:  uint64(s.keepaliveTime / time.Second),
-				Password:       s.password,
-				Advertisements: make([]*advertisementConfig, 0),
-				BFDProfile:     s.bfdProfile,
-				EBGPMultiHop:   s.ebgpMultiHop,
+				IPFamily:        family,
+				ASN:             s.asn,
+				Addr:            host,
+				Port:            uint16(portUint),
+				HoldTime:        uint64(s.holdTime / time.Second),
+				KeepaliveTime:   uint64(s.keepaliveTime / time.Second),
+				Password:        s.password,
+				Advertisements:  make([]*advertisementConfig, 0),
+				BFDProfile:      s.bfdProfile,
+				EBGPMultiHop:    s.ebgpMultiHop,
+				GracefulRestart: s.gracefulRestart,
 			}
 			if s.srcAddr != nil {
 				neighbor.SrcAddr = s.srcAddr.String()
@@ -285,6 +291,7 @@ func (sm *sessionManager) createConfig() (*frrConfig, error) {
 				Prefix:      adv.Prefix.String(),
 				Communities: communities,
 				LocalPref:   adv.LocalPref,
+				FlowLabel:   adv.FlowLabel,
 			}
 
 			neighbor.Advertisements = append(neighbor.Advertisements, &advConfig)
@@ -7,19 +7,23 @@ import (
 	"fmt"
 	"net"
 	"strconv"
+	"time"
 
 	"github.com/pkg/errors"
 )
 
 type Neighbor struct {
-	Ip             net.IP
-	Connected      bool
-	LocalAS        string
-	RemoteAS       string
-	UpdatesSent    int
-	PrefixSent     int
-	Port           int
-	RemoteRouterID string
+	Ip                 net.IP
+	Connected          bool
+	LocalAS            string
+	RemoteAS           string
+	UpdatesSent        int
+	UpdatesReceived    int
+	PrefixSent         int
+	Port               int
+	RemoteRouterID     string
+	Uptime             time.Duration
+	ConnectionsDropped int
 }
 
 type Route struct {
@@ -38,10 +42,13 @@ type FRRNeighbor struct {
 	BgpVersion     int    `json:"bgpVersion"`
 	BgpState       string `json:"bgpState"`
 	PortForeign    int    `json:"portForeign"`
+	BgpTimerUpMsec int64  `json:"bgpTimerUpMsec"`
 	MessageStats   struct {
-		UpdatesSent int `json:"updatesSent"`
+		UpdatesSent     int `json:"updatesSent"`
+		UpdatesReceived int `json:"updatesRecv"`
 	} `json:"messageStats"`
-	AddressFamilyInfo map[string]struct {
+	ConnectionsDropped int `json:"connectionsDropped"`
+	AddressFamilyInfo  map[string]struct {
 		SentPrefixCounter int `json:"sentPrefixCounter"`
 	} `json:"addressFamilyInfo"`
 }
@@ -112,15 +119,22 @@ func ParseNeighbour(vtyshRes string) (*Neighbor, error) {
 		for _, s := range n.AddressFamilyInfo {
 			prefixSent += s.SentPrefixCounter
 		}
+		var uptime time.Duration
+		if connected {
+			uptime = time.Duration(n.BgpTimerUpMsec) * time.Millisecond
+		}
 		return &Neighbor{
-			Ip:             ip,
-			Connected:      connected,
-			LocalAS:        strconv.Itoa(n.LocalAs),
-			RemoteAS:       strconv.Itoa(n.RemoteAs),
-			UpdatesSent:    n.MessageStats.UpdatesSent,
-			PrefixSent:     prefixSent,
-			Port:           n.PortForeign,
-			RemoteRouterID: n.RemoteRouterID,
+			Ip:                 ip,
+			Connected:          connected,
+			LocalAS:            strconv.Itoa(n.LocalAs),
+			RemoteAS:           strconv.Itoa(n.RemoteAs),
+			UpdatesSent:        n.MessageStats.UpdatesSent,
+			UpdatesReceived:    n.MessageStats.UpdatesReceived,
+			PrefixSent:         prefixSent,
+			Port:               n.PortForeign,
+			RemoteRouterID:     n.RemoteRouterID,
+			Uptime:             uptime,
+			ConnectionsDropped: n.ConnectionsDropped,
 		}, nil
 	}
 	return nil, errors.New("no peers were returned")
@@ -149,15 +163,22 @@ func ParseNeighbours(vtyshRes string) ([]*Neighbor, error) {
 		for _, s := range n.AddressFamilyInfo {
 			prefixSent += s.SentPrefixCounter
 		}
+		var uptime time.Duration
+		if connected {
+			uptime = time.Duration(n.BgpTimerUpMsec) * time.Millisecond
+		}
 		res = append(res, &Neighbor{
-			Ip:             ip,
-			Connected:      connected,
-			LocalAS:        strconv.Itoa(n.LocalAs),
-			RemoteAS:       strconv.Itoa(n.RemoteAs),
-			UpdatesSent:    n.MessageStats.UpdatesSent,
-			PrefixSent:     prefixSent,
-			Port:           n.PortForeign,
-			RemoteRouterID: n.RemoteRouterID,
+			Ip:                 ip,
+			Connected:          connected,
+			LocalAS:            strconv.Itoa(n.LocalAs),
+			RemoteAS:           strconv.Itoa(n.RemoteAs),
+			UpdatesSent:        n.MessageStats.UpdatesSent,
+			UpdatesReceived:    n.MessageStats.UpdatesReceived,
+			PrefixSent:         prefixSent,
+			Port:               n.PortForeign,
+			RemoteRouterID:     n.RemoteRouterID,
+			Uptime:             uptime,
+			ConnectionsDropped: n.ConnectionsDropped,
 		})
 	}
 	return res, nil
@@ -0,0 +1,83 @@
+// SPDX-License-Identifier:Apache-2.0
+
+package native
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// AlarmShortLived is raised when a session goes down before being
+	// up for MinUptimeSeconds.
+	AlarmShortLived = "BGPSessionShortLived"
+	// AlarmFlapping is raised when a session goes down more than
+	// MaxFlapCount times in an hour.
+	AlarmFlapping = "BGPSessionFlappingHourly"
+	// AlarmSlowAnnouncement is raised when the changes of the
+	// advertisements take more than MaxAnnouncementLatency to be sent
+	// to the peer.
+	AlarmSlowAnnouncement = "BGPAnnouncementSlow"
+)
+
+// SessionAlarmPolicy holds the thresholds above which the reliability
+// of the BGP sessions is reported. A zero threshold disables the
+// corresponding alarm.
+type SessionAlarmPolicy struct {
+	// MinUptimeSeconds raises an alarm when a session goes down before
+	// being up for this long.
+	MinUptimeSeconds int
+	// MaxFlapCount raises an alarm when a session goes down more than
+	// this many times in the last hour.
+	MaxFlapCount int
+	// MaxAnnouncementLatency raises an alarm when the changes of the
+	// advertisements take longer than this to be sent to the peer.
+	MaxAnnouncementLatency time.Duration
+	// Alarm, if not nil, is called with the name and the address of the
+	// peer when a threshold is breached.
+	Alarm func(name, addr, reason, message string)
+}
+
+// alarms checks the sessions against a SessionAlarmPolicy.
+type alarms struct {
+	policy SessionAlarmPolicy
+	flaps  *flapDetector
+}
+
+func newAlarms(policy SessionAlarmPolicy) *alarms {
+	a := &alarms{policy: policy}
+	if policy.MaxFlapCount > 0 {
+		a.flaps = newFlapDetector(policy.MaxFlapCount, time.Hour)
+	}
+	return a
+}
+
+// sessionDown checks a session with addr that went down at now, after
+// being up for uptime.
+func (a *alarms) sessionDown(name, addr string, uptime time.Duration, now time.Time) {
+	if a == nil {
+		return
+	}
+	minUptime := time.Duration(a.policy.MinUptimeSeconds) * time.Second
+	if minUptime > 0 && uptime < minUptime {
+		a.raise(name, addr, AlarmShortLived, fmt.Sprintf("BGP session with %s went down after %s, less than %s", addr, uptime.Round(time.Second), minUptime))
+	}
+	if a.flaps != nil && a.flaps.Flap(addr, now) {
+		a.raise(name, addr, AlarmFlapping, fmt.Sprintf("BGP session with %s went down more than %d times in the last hour", addr, a.policy.MaxFlapCount))
+	}
+}
+
+// announced checks the time it took to send the changes of the
+// advertisements to the peer with addr.
+func (a *alarms) announced(name, addr string, latency time.Duration) {
+	if a == nil || a.policy.MaxAnnouncementLatency == 0 || latency <= a.policy.MaxAnnouncementLatency {
+		return
+	}
+	a.raise(name, addr, AlarmSlowAnnouncement, fmt.Sprintf("BGP announcements to %s took %s, more than %s", addr, latency.Round(time.Millisecond), a.policy.MaxAnnouncementLatency))
+}
+
+func (a *alarms) raise(name, addr, reason, message string) {
+	if a.policy.Alarm != nil {
+		a.policy.Alarm(name, addr, reason, message)
+	}
+}
@@ -0,0 +1,86 @@
+// SPDX-License-Identifier:Apache-2.0
+
+package native
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAlarms(t *testing.T) {
+	start := time.Now()
+
+	tests := []struct {
+		desc    string
+		policy  SessionAlarmPolicy
+		down    []time.Duration // uptime of the sessions going down, one minute apart
+		latency time.Duration
+		want    []string
+	}{
+		{
+			desc: "disabled",
+			down: []time.Duration{0, 0, 0},
+			// An announcement never raises an alarm without a threshold.
+			latency: time.Hour,
+		},
+		{
+			desc:   "long lived session",
+			policy: SessionAlarmPolicy{MinUptimeSeconds: 60},
+			down:   []time.Duration{time.Hour},
+		},
+		{
+			desc:   "short lived session",
+			policy: SessionAlarmPolicy{MinUptimeSeconds: 60},
+			down:   []time.Duration{30 * time.Second},
+			want:   []string{AlarmShortLived},
+		},
+		{
+			desc:   "flaps below the threshold",
+			policy: SessionAlarmPolicy{MaxFlapCount: 2},
+			down:   []time.Duration{time.Hour, time.Hour},
+		},
+		{
+			desc:   "flaps above the threshold",
+			policy: SessionAlarmPolicy{MaxFlapCount: 2},
+			down:   []time.Duration{time.Hour, time.Hour, time.Hour},
+			want:   []string{AlarmFlapping},
+		},
+		{
+			desc:    "fast announcement",
+			policy:  SessionAlarmPolicy{MaxAnnouncementLatency: time.Second},
+			latency: time.Second,
+		},
+		{
+			desc:    "slow announcement",
+			policy:  SessionAlarmPolicy{MaxAnnouncementLatency: time.Second},
+			latency: 2 * time.Second,
+			want:    []string{AlarmSlowAnnouncement},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			got := []string{}
+			test.policy.Alarm = func(name, addr, reason, message string) {
+				if name != "peer1" || addr != "1.2.3.4:179" {
+					t.Fatalf("unexpected alarm for peer %s (%s)", name, addr)
+				}
+				got = append(got, reason)
+			}
+			a := newAlarms(test.policy)
+			for i, uptime := range test.down {
+				a.sessionDown("peer1", "1.2.3.4:179", uptime, start.Add(time.Duration(i)*time.Minute))
+			}
+			a.announced("peer1", "1.2.3.4:179", test.latency)
+
+			if len(got) != len(test.want) {
+				t.Fatalf("got alarms %v, want %v", got, test.want)
+			}
+			for i := range got {
+				if got[i] != test.want[i] {
+					t.Fatalf("got alarms %v, want %v", got, test.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+// SPDX-License-Identifier:Apache-2.0
+
+package native
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// FlapThreshold is the number of session drops within FlapWindow
+	// above which a session is considered flapping.
+	FlapThreshold = 3
+	// FlapWindow is the period over which session drops are counted.
+	FlapWindow = 5 * time.Minute
+)
+
+// flapDetector counts the drops of the BGP sessions, per peer address.
+type flapDetector struct {
+	sync.Mutex
+	threshold int
+	window    time.Duration
+	drops     map[string][]time.Time
+}
+
+func newFlapDetector(threshold int, window time.Duration) *flapDetector {
+	return &flapDetector{
+		threshold: threshold,
+		window:    window,
+		drops:     map[string][]time.Time{},
+	}
+}
+
+// Flap records a drop of the session with addr at the given time, and
+// returns true if the session dropped more than threshold times within
+// the window. The drops are then forgotten, so that a flapping session
+// is reported once per threshold drops.
+func (d *flapDetector) Flap(addr string, now time.Time) bool {
+	d.Lock()
+	defer d.Unlock()
+
+	drops := []time.Time{}
+	for _, t := range d.drops[addr] {
+		if now.Sub(t) < d.window {
+			drops = append(drops, t)
+		}
+	}
+	drops = append(drops, now)
+	if len(drops) > d.threshold {
+		delete(d.drops, addr)
+		return true
+	}
+	d.drops[addr] = drops
+	return false
+}
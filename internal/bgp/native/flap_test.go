@@ -0,0 +1,37 @@
+// SPDX-License-Identifier:Apache-2.0
+
+package native
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFlapDetector(t *testing.T) {
+	d := newFlapDetector(3, 5*time.Minute)
+	start := time.Now()
+
+	tests := []struct {
+		desc     string
+		addr     string
+		at       time.Duration
+		flapping bool
+	}{
+		{"first drop", "1.2.3.4:179", 0, false},
+		{"second drop", "1.2.3.4:179", time.Minute, false},
+		{"other peer", "1.2.3.5:179", time.Minute, false},
+		{"third drop", "1.2.3.4:179", 2 * time.Minute, false},
+		{"fourth drop in the window", "1.2.3.4:179", 3 * time.Minute, true},
+		{"drops are forgotten after reporting", "1.2.3.4:179", 4 * time.Minute, false},
+		{"second drop after reporting", "1.2.3.4:179", 5 * time.Minute, false},
+		{"third drop after reporting", "1.2.3.4:179", 6 * time.Minute, false},
+		{"old drops are outside the window", "1.2.3.4:179", 10 * time.Minute, false},
+		{"other peer drops again", "1.2.3.5:179", 2 * time.Minute, false},
+	}
+
+	for _, test := range tests {
+		if got := d.Flap(test.addr, start.Add(test.at)); got != test.flapping {
+			t.Fatalf("%s: got flapping %v, want %v", test.desc, got, test.flapping)
+		}
+	}
+}
@@ -14,6 +14,10 @@ import (
 	"go.universe.tf/metallb/internal/bgp"
 )
 
+// asTrans is the 2-byte ASN standing for a 4-byte one, for the peers
+// not supporting 4-byte ASNs (RFC 6793).
+const asTrans = 23456
+
 func sendOpen(w io.Writer, asn uint32, routerID net.IP, holdTime time.Duration) error {
 	if routerID.To4() == nil {
 		panic("non-ipv4 address used as RouterID")
@@ -37,7 +41,7 @@ func sendOpen(w io.Writer, asn uint32, routerID net.IP, holdTime time.Duration)
 		OptLen  uint8
 
 		// Capabilities: multiprotocol extension for IPv4+IPv6
-		// unicast, and 4-byte ASNs
+		// unicast, 4-byte ASNs and route refresh
 
 		MP4Type uint8
 		MP4Len  uint8
@@ -52,6 +56,9 @@ func sendOpen(w io.Writer, asn uint32, routerID net.IP, holdTime time.Duration)
 		CapType uint8
 		CapLen  uint8
 		ASN32   uint32
+
+		RRType uint8
+		RRLen  uint8
 	}{
 		Marker1: 0xffffffffffffffff,
 		Marker2: 0xffffffffffffffff,
@@ -63,9 +70,9 @@ func sendOpen(w io.Writer, asn uint32, routerID net.IP, holdTime time.Duration)
 		HoldTime: uint16(holdTime.Seconds()),
 		// RouterID filled below
 
-		OptsLen: 20,
+		OptsLen: 22,
 		OptType: 2, // Capabilities
-		OptLen:  18,
+		OptLen:  20,
 
 		MP4Type: 1, // BGP Multi-protocol Extensions
 		MP4Len:  4,
@@ -80,10 +87,13 @@ func sendOpen(w io.Writer, asn uint32, routerID net.IP, holdTime time.Duration)
 		CapType: 65, // 4-byte ASN
 		CapLen:  4,
 		ASN32:   asn,
+
+		RRType: 2, // Route refresh
+		RRLen:  0,
 	}
 	msg.Len = uint16(binary.Size(msg))
 	if asn > 65535 {
-		msg.ASN16 = 23456
+		msg.ASN16 = asTrans
 	}
 	copy(msg.RouterID[:], routerID.To4())
 
@@ -97,6 +107,8 @@ type openResult struct {
 	mp6      bool
 	// Four-byte ASN supported
 	fbasn bool
+	// Route refresh (RFC 2918) supported
+	routeRefresh bool
 }
 
 var notificationCodes = map[uint16]string{
@@ -276,6 +288,8 @@ func readCapabilities(r io.Reader, ret *openResult) error {
 			case af.AFI == 2 && af.SAFI == 1:
 				ret.mp6 = true
 			}
+		case 2:
+			ret.routeRefresh = true
 		default:
 			// TODO: only ignore capabilities that we know are fine to
 			// ignore.
@@ -311,7 +325,10 @@ func sendUpdate(w io.Writer, asn uint32, ibgp, fbasn bool, nextHop net.IP, adv *
 		return err
 	}
 	binary.BigEndian.PutUint16(b.Bytes()[21:23], uint16(b.Len()-l))
-	encodePrefixes(&b, []*net.IPNet{adv.Prefix})
+	if adv.Prefix.IP.To4() != nil {
+		// The IPv6 prefixes are in the MP_REACH_NLRI attribute.
+		encodePrefixes(&b, []*net.IPNet{adv.Prefix})
+	}
 	binary.BigEndian.PutUint16(b.Bytes()[16:18], uint16(b.Len()))
 
 	if _, err := io.Copy(w, &b); err != nil {
@@ -324,10 +341,61 @@ func encodePrefixes(b *bytes.Buffer, pfxs []*net.IPNet) {
 	for _, pfx := range pfxs {
 		o, _ := pfx.Mask.Size()
 		b.WriteByte(byte(o))
-		b.Write(pfx.IP.To4()[:bytesForBits(o)])
+		ip := pfx.IP.To4()
+		if ip == nil {
+			ip = pfx.IP.To16()
+		}
+		b.Write(ip[:bytesForBits(o)])
 	}
 }
 
+// Address family identifiers for IPv6 unicast, per RFC 4760.
+const (
+	afiIPv6     = 2
+	safiUnicast = 1
+)
+
+// encodeMPReach writes the MP_REACH_NLRI attribute announcing the IPv6
+// prefix pfx, with the given next hop.
+func encodeMPReach(b *bytes.Buffer, nextHop net.IP, pfx *net.IPNet) error {
+	var nlri bytes.Buffer
+	encodePrefixes(&nlri, []*net.IPNet{pfx})
+	b.Write([]byte{
+		0x80, 14, // optional, mp-reach-nlri
+		byte(5 + net.IPv6len + nlri.Len()), // len
+	})
+	if err := binary.Write(b, binary.BigEndian, uint16(afiIPv6)); err != nil {
+		return err
+	}
+	b.Write([]byte{
+		safiUnicast,
+		net.IPv6len, // next hop len
+	})
+	b.Write(nextHop.To16())
+	b.WriteByte(0) // reserved
+	b.Write(nlri.Bytes())
+	return nil
+}
+
+// encodeMPUnreach writes the MP_UNREACH_NLRI attribute withdrawing the
+// IPv6 prefixes pfxs.
+func encodeMPUnreach(b *bytes.Buffer, pfxs []*net.IPNet) error {
+	var nlri bytes.Buffer
+	encodePrefixes(&nlri, pfxs)
+	b.Write([]byte{
+		0x90, 15, // optional, extended length, mp-unreach-nlri
+	})
+	if err := binary.Write(b, binary.BigEndian, uint16(3+nlri.Len())); err != nil {
+		return err
+	}
+	if err := binary.Write(b, binary.BigEndian, uint16(afiIPv6)); err != nil {
+		return err
+	}
+	b.WriteByte(safiUnicast)
+	b.Write(nlri.Bytes())
+	return nil
+}
+
 func bytesForBits(n int) int {
 	// Evil bit hack that rounds n up to the next multiple of 8, then
 	// divides by 8. This returns the minimum number of whole bytes
@@ -361,17 +429,24 @@ func encodePathAttrs(b *bytes.Buffer, asn uint32, ibgp, fbasn bool, nextHop net.
 				2, // AS_SEQUENCE
 				1, // len (in number of ASes)
 			})
-			if err := binary.Write(b, binary.BigEndian, uint16(asn)); err != nil {
+			as2 := uint16(asn)
+			if asn > 65535 {
+				as2 = asTrans
+			}
+			if err := binary.Write(b, binary.BigEndian, as2); err != nil {
 				return err
 			}
 		}
 	}
-	b.Write([]byte{
-		0x40, 3, // mandatory, next-hop
-		4, // len
-	})
+	// IPv6 routes carry their next hop in MP_REACH_NLRI instead.
+	if adv.Prefix.IP.To4() != nil {
+		b.Write([]byte{
+			0x40, 3, // mandatory, next-hop
+			4, // len
+		})
 
-	b.Write(nextHop)
+		b.Write(nextHop.To4())
+	}
 
 	if ibgp {
 		b.Write([]byte{
@@ -397,6 +472,26 @@ func encodePathAttrs(b *bytes.Buffer, asn uint32, ibgp, fbasn bool, nextHop net.
 		}
 	}
 
+	if adv.Prefix.IP.To4() == nil {
+		if err := encodeMPReach(b, nextHop, adv.Prefix); err != nil {
+			return err
+		}
+	}
+
+	if !ibgp && !fbasn && asn > 65535 {
+		// The peer only knows 2-byte ASNs, the actual AS path goes
+		// along in AS4_PATH.
+		b.Write([]byte{
+			0xc0, 17, // optional transitive, as4-path
+			6, // len (1x 4-byte ASN)
+			2, // AS_SEQUENCE
+			1, // len (in number of ASes)
+		})
+		if err := binary.Write(b, binary.BigEndian, asn); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -416,12 +511,27 @@ func sendWithdraw(w io.Writer, prefixes []*net.IPNet) error {
 	if err := binary.Write(&b, binary.BigEndian, hdr); err != nil {
 		return err
 	}
+	var v4, v6 []*net.IPNet
+	for _, pfx := range prefixes {
+		if pfx.IP.To4() != nil {
+			v4 = append(v4, pfx)
+		} else {
+			v6 = append(v6, pfx)
+		}
+	}
 	l := b.Len()
-	encodePrefixes(&b, prefixes)
+	encodePrefixes(&b, v4)
 	binary.BigEndian.PutUint16(b.Bytes()[19:21], uint16(b.Len()-l))
 	if err := binary.Write(&b, binary.BigEndian, uint16(0)); err != nil {
 		return err
 	}
+	if len(v6) > 0 {
+		l = b.Len()
+		if err := encodeMPUnreach(&b, v6); err != nil {
+			return err
+		}
+		binary.BigEndian.PutUint16(b.Bytes()[l-2:l], uint16(b.Len()-l))
+	}
 	binary.BigEndian.PutUint16(b.Bytes()[16:18], uint16(b.Len()))
 
 	if _, err := io.Copy(w, &b); err != nil {
@@ -430,6 +540,21 @@ func sendWithdraw(w io.Writer, prefixes []*net.IPNet) error {
 	return nil
 }
 
+// readRouteRefresh reads the body of a ROUTE-REFRESH message (header
+// has already been consumed), and returns the address family whose
+// routes the peer asks for.
+func readRouteRefresh(r io.Reader) (afi uint16, safi uint8, err error) {
+	msg := struct {
+		AFI      uint16
+		Reserved uint8
+		SAFI     uint8
+	}{}
+	if err := binary.Read(r, binary.BigEndian, &msg); err != nil {
+		return 0, 0, err
+	}
+	return msg.AFI, msg.SAFI, nil
+}
+
 func sendKeepalive(w io.Writer) error {
 	msg := struct {
 		Marker1, Marker2 uint64
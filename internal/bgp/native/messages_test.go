@@ -9,6 +9,8 @@ import (
 	"path/filepath"
 	"testing"
 	"time"
+
+	"go.universe.tf/metallb/internal/bgp"
 )
 
 // Just test that sendOpen and readOpen can at least talk to each other.
@@ -29,6 +31,25 @@ func TestOpen(t *testing.T) {
 	if op.asn != wantASN {
 		t.Errorf("Wrong ASN, want %d, got %d", wantASN, op.asn)
 	}
+	if !op.routeRefresh {
+		t.Errorf("Route refresh capability not advertised")
+	}
+}
+
+func TestRouteRefresh(t *testing.T) {
+	// ROUTE-REFRESH body for IPv4 unicast, the header being consumed.
+	b := bytes.NewBuffer([]byte{0x00, 0x01, 0x00, 0x01})
+	afi, safi, err := readRouteRefresh(b)
+	if err != nil {
+		t.Fatalf("Read route refresh: %s", err)
+	}
+	if afi != 1 || safi != 1 {
+		t.Errorf("Wrong address family, want 1/1, got %d/%d", afi, safi)
+	}
+
+	if _, _, err := readRouteRefresh(bytes.NewBuffer([]byte{0x00, 0x01})); err == nil {
+		t.Errorf("Read truncated route refresh, expected an error")
+	}
 }
 
 func TestPcapInterop(t *testing.T) {
@@ -94,3 +115,91 @@ func TestOpenFourByteASN(t *testing.T) {
 		}
 	}
 }
+
+func TestPathAttrsFourByteASN(t *testing.T) {
+	origin := []byte{0x40, 1, 1, 0}
+	nextHop := []byte{0x40, 3, 4, 10, 0, 0, 1}
+	tests := []struct {
+		desc  string
+		asn   uint32
+		fbasn bool
+		want  [][]byte
+	}{
+		{
+			desc:  "2-byte ASN, 2-byte peer",
+			asn:   65001,
+			fbasn: false,
+			want:  [][]byte{origin, {0x40, 2, 4, 2, 1, 0xfd, 0xe9}, nextHop},
+		},
+		{
+			desc:  "4-byte ASN, 4-byte peer",
+			asn:   4200000000,
+			fbasn: true,
+			want:  [][]byte{origin, {0x40, 2, 6, 2, 1, 0xfa, 0x56, 0xea, 0x00}, nextHop},
+		},
+		{
+			desc:  "4-byte ASN, 2-byte peer",
+			asn:   4200000000,
+			fbasn: false,
+			want:  [][]byte{origin, {0x40, 2, 4, 2, 1, 0x5b, 0xa0}, nextHop, {0xc0, 17, 6, 2, 1, 0xfa, 0x56, 0xea, 0x00}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			var b bytes.Buffer
+			adv := &bgp.Advertisement{Prefix: &net.IPNet{IP: net.IP{1, 2, 3, 4}, Mask: net.CIDRMask(32, 32)}}
+			if err := encodePathAttrs(&b, test.asn, false, test.fbasn, net.IP{10, 0, 0, 1}, adv); err != nil {
+				t.Fatalf("encoding the path attributes: %s", err)
+			}
+			if want := bytes.Join(test.want, nil); !bytes.Equal(b.Bytes(), want) {
+				t.Fatalf("expected path attributes %x, got %x", want, b.Bytes())
+			}
+		})
+	}
+}
+
+func TestUpdateIPv6(t *testing.T) {
+	marker := bytes.Repeat([]byte{0xff}, 16)
+	nextHop := net.ParseIP("2001:db8::1")
+	prefix := &net.IPNet{IP: net.ParseIP("2001:db8:1::5"), Mask: net.CIDRMask(128, 128)}
+
+	var b bytes.Buffer
+	if err := sendUpdate(&b, 64500, false, true, nextHop, &bgp.Advertisement{Prefix: prefix}); err != nil {
+		t.Fatalf("sending the update: %s", err)
+	}
+	want := bytes.Join([][]byte{
+		marker,
+		{0, 77, 2}, // len, UPDATE
+		{0, 0},     // no withdrawn routes
+		{0, 54},    // path attributes len
+		{0x40, 1, 1, 0},
+		{0x40, 2, 6, 2, 1, 0, 0, 0xfb, 0xf4},
+		{0x80, 14, 38, 0, 2, 1, 16},
+		nextHop.To16(),
+		{0, 128},
+		prefix.IP.To16(),
+	}, nil)
+	if !bytes.Equal(b.Bytes(), want) {
+		t.Fatalf("expected update %x, got %x", want, b.Bytes())
+	}
+
+	b.Reset()
+	v4 := &net.IPNet{IP: net.IP{10, 0, 0, 1}, Mask: net.CIDRMask(32, 32)}
+	v6 := &net.IPNet{IP: net.ParseIP("2001:db8:1::"), Mask: net.CIDRMask(64, 128)}
+	if err := sendWithdraw(&b, []*net.IPNet{v4, v6}); err != nil {
+		t.Fatalf("sending the withdraw: %s", err)
+	}
+	want = bytes.Join([][]byte{
+		marker,
+		{0, 44, 2}, // len, UPDATE
+		{0, 5},     // withdrawn routes len
+		{32, 10, 0, 0, 1},
+		{0, 16}, // path attributes len
+		{0x90, 15, 0, 12, 0, 2, 1},
+		{64, 0x20, 0x01, 0x0d, 0xb8, 0, 1, 0, 0},
+	}, nil)
+	if !bytes.Equal(b.Bytes(), want) {
+		t.Fatalf("expected withdraw %x, got %x", want, b.Bytes())
+	}
+}
@@ -39,6 +39,8 @@ type session struct {
 	peerFBASNSupport bool
 	holdTime         time.Duration
 	keepaliveTime    time.Duration
+	watchdogTimeout  time.Duration
+	initialDelay     time.Duration
 	logger           log.Logger
 	password         string
 
@@ -51,44 +53,78 @@ type session struct {
 	conn           net.Conn
 	actualHoldTime time.Duration
 	nextHop        net.IP
+	lastReceived   time.Time
+	established    time.Time
 	advertised     map[string]*bgp.Advertisement
 	new            map[string]*bgp.Advertisement
+	pendingSince   time.Time // when the advertisements not sent yet were set
+	refresh        bool      // whether all the advertisements must be sent again
+
+	flaps    *flapDetector
+	flapping func(name, addr string)
+	alarms   *alarms
+	manager  *sessionManager
 }
 
 // The 'Native' implementation does not require a session manager .
 type sessionManager struct {
+	flaps    *flapDetector
+	flapping func(name, addr string)
+	alarms   *alarms
+
+	mu       sync.Mutex
+	sessions map[string]*session // peer address -> session
 }
 
-func NewSessionManager(l log.Logger) *sessionManager {
-	return &sessionManager{}
+// NewSessionManager returns a session manager for native sessions.
+// flapping, if not nil, is called when the session with a peer went
+// down more than FlapThreshold times in FlapWindow. The sessions are
+// checked against the thresholds of alarmPolicy.
+func NewSessionManager(l log.Logger, flapping func(name, addr string), alarmPolicy SessionAlarmPolicy) *sessionManager {
+	return &sessionManager{
+		flaps:    newFlapDetector(FlapThreshold, FlapWindow),
+		flapping: flapping,
+		alarms:   newAlarms(alarmPolicy),
+		sessions: map[string]*session{},
+	}
 }
 
 // NewSession() creates a BGP session using the given session parameters.
 //
 // The session will immediately try to connect and synchronize its
 // local state with the peer.
-func (sm *sessionManager) NewSession(l log.Logger, addr string, srcAddr net.IP, myASN uint32, routerID net.IP, asn uint32, holdTime, keepaliveTime time.Duration, password, myNode, bfdProfile string, ebgpMultiHop bool, name string) (bgp.Session, error) {
+func (sm *sessionManager) NewSession(l log.Logger, args bgp.SessionParameters) (bgp.Session, error) {
 	ret := &session{
-		name:          name,
-		addr:          addr,
-		srcAddr:       srcAddr,
-		myASN:         myASN,
-		routerID:      routerID.To4(),
-		myNode:        myNode,
-		asn:           asn,
-		holdTime:      holdTime,
-		keepaliveTime: keepaliveTime,
-		logger:        log.With(l, "peer", addr, "localASN", myASN, "peerASN", asn),
-		newHoldTime:   make(chan bool, 1),
-		advertised:    map[string]*bgp.Advertisement{},
-		password:      password,
+		name:            args.SessionName,
+		addr:            args.PeerAddress,
+		srcAddr:         args.SourceAddress,
+		myASN:           args.MyASN,
+		routerID:        args.RouterID.To4(),
+		myNode:          args.CurrentNode,
+		asn:             args.PeerASN,
+		holdTime:        args.HoldTime,
+		keepaliveTime:   args.KeepAliveTime,
+		watchdogTimeout: args.WatchdogTimeout,
+		initialDelay:    args.InitialDelay,
+		logger:          log.With(l, "peer", args.PeerAddress, "localASN", args.MyASN, "peerASN", args.PeerASN),
+		newHoldTime:     make(chan bool, 1),
+		advertised:      map[string]*bgp.Advertisement{},
+		password:        args.Password,
+		flaps:           sm.flaps,
+		flapping:        sm.flapping,
+		alarms:          sm.alarms,
+		manager:         sm,
 	}
 	ret.cond = sync.NewCond(&ret.mu)
+	sm.mu.Lock()
+	sm.sessions[args.PeerAddress] = ret
+	sm.mu.Unlock()
+	stats.NewSession(ret.addr)
 	go ret.sendKeepalives()
 	go ret.run()
-
-	stats.sessionUp.WithLabelValues(ret.addr).Set(0)
-	stats.prefixes.WithLabelValues(ret.addr).Set(0)
+	if ret.watchdogTimeout != 0 {
+		go ret.watchdog()
+	}
 
 	return ret, nil
 }
@@ -97,14 +133,49 @@ func (sm *sessionManager) SyncBFDProfiles(profiles map[string]*config.BFDProfile
 	return errors.New("bfd profiles not supported in native mode")
 }
 
+// TriggerSoftReset sends again all the advertisements of the session
+// with the given peer address, without resetting the session. This
+// propagates the changes of the route policies that don't show in the
+// advertisements themselves.
+func (sm *sessionManager) TriggerSoftReset(peer string) error {
+	sm.mu.Lock()
+	s := sm.sessions[peer]
+	sm.mu.Unlock()
+	if s == nil {
+		return fmt.Errorf("no BGP session with %s", peer)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return fmt.Errorf("BGP session with %s is not established", peer)
+	}
+	s.refreshAdvertisements()
+	return nil
+}
+
+func (sm *sessionManager) removeSession(s *session) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	if sm.sessions[s.addr] == s {
+		delete(sm.sessions, s.addr)
+	}
+}
+
 // run tries to stay connected to the peer, and pumps route updates to it.
 func (s *session) run() {
 	defer stats.DeleteSession(s.addr)
+	if s.initialDelay > 0 {
+		level.Debug(s.logger).Log("op", "connect", "delay", s.initialDelay, "msg", "delaying the first connection to the peer")
+		time.Sleep(s.initialDelay)
+	}
 	for {
+		stats.ConnectAttempt(s.addr)
 		if err := s.connect(); err != nil {
 			if err == errClosed {
 				return
 			}
+			stats.Error(s.addr)
 			level.Error(s.logger).Log("op", "connect", "error", err, "msg", "failed to connect to peer")
 			backoff := s.backoff.Duration()
 			time.Sleep(backoff)
@@ -142,19 +213,23 @@ func (s *session) sendUpdates() bool {
 	if s.new != nil {
 		s.advertised, s.new = s.new, nil
 	}
+	// All the advertisements are sent on a new connection.
+	s.refresh = false
 
 	for c, adv := range s.advertised {
 		if err := sendUpdate(s.conn, s.myASN, ibgp, fbasn, s.nextHop, adv); err != nil {
 			s.abort()
+			stats.Error(s.addr)
 			level.Error(s.logger).Log("op", "sendUpdate", "ip", c, "error", err, "msg", "failed to send BGP update")
 			return true
 		}
 		stats.UpdateSent(s.addr)
 	}
 	stats.AdvertisedPrefixes(s.addr, len(s.advertised))
+	s.announced()
 
 	for {
-		for s.new == nil && s.conn != nil {
+		for s.new == nil && !s.refresh && s.conn != nil {
 			s.cond.Wait()
 		}
 
@@ -164,14 +239,19 @@ func (s *session) sendUpdates() bool {
 		if s.conn == nil {
 			return true
 		}
+		refresh := s.refresh
+		s.refresh = false
 		if s.new == nil {
-			// nil is "no pending updates", contrast to a non-nil
-			// empty map which means "withdraw all".
-			continue
+			if !refresh {
+				// nil is "no pending updates", contrast to a non-nil
+				// empty map which means "withdraw all".
+				continue
+			}
+			s.new = s.advertised
 		}
 
 		for c, adv := range s.new {
-			if adv2, ok := s.advertised[c]; ok && adv.Equal(adv2) {
+			if adv2, ok := s.advertised[c]; ok && adv.Equal(adv2) && !refresh {
 				// Peer already has correct state for this
 				// advertisement, nothing to do.
 				continue
@@ -179,6 +259,7 @@ func (s *session) sendUpdates() bool {
 
 			if err := sendUpdate(s.conn, s.myASN, ibgp, fbasn, s.nextHop, adv); err != nil {
 				s.abort()
+				stats.Error(s.addr)
 				level.Error(s.logger).Log("op", "sendUpdate", "prefix", c, "error", err, "msg", "failed to send BGP update")
 				return true
 			}
@@ -194,6 +275,7 @@ func (s *session) sendUpdates() bool {
 		if len(wdr) > 0 {
 			if err := sendWithdraw(s.conn, wdr); err != nil {
 				s.abort()
+				stats.Error(s.addr)
 				for _, pfx := range wdr {
 					level.Error(s.logger).Log("op", "sendWithdraw", "prefix", pfx, "error", err, "msg", "failed to send BGP withdraw")
 				}
@@ -203,7 +285,18 @@ func (s *session) sendUpdates() bool {
 		}
 		s.advertised, s.new = s.new, nil
 		stats.AdvertisedPrefixes(s.addr, len(s.advertised))
+		s.announced()
+	}
+}
+
+// announced records that the pending advertisements were sent to the
+// peer, and checks how long it took.
+func (s *session) announced() {
+	if s.pendingSince.IsZero() {
+		return
 	}
+	s.alarms.announced(s.name, s.addr, time.Since(s.pendingSince))
+	s.pendingSince = time.Time{}
 }
 
 // connect establishes the BGP session with the peer.
@@ -259,9 +352,9 @@ func (s *session) connect() error {
 		return fmt.Errorf("unexpected peer ASN %d, want %d", op.asn, s.asn)
 	}
 	s.peerFBASNSupport = op.fbasn
-	if s.myASN > 65536 && !s.peerFBASNSupport {
+	if s.nextHop.To4() == nil && !op.mp6 {
 		conn.Close()
-		return fmt.Errorf("peer does not support 4-byte ASNs")
+		return fmt.Errorf("peer does not support the IPv6 unicast routes")
 	}
 
 	// BGP session is established, clear the connect timeout deadline.
@@ -290,6 +383,8 @@ func (s *session) connect() error {
 	}
 
 	s.conn = conn
+	s.lastReceived = time.Now()
+	s.established = s.lastReceived
 	return nil
 }
 
@@ -394,14 +489,50 @@ func (s *session) sendKeepalive() error {
 		// No connection established, othing to do.
 		return nil
 	}
+	stats.SessionUptime(s.addr, time.Since(s.established))
 	if err := sendKeepalive(s.conn); err != nil {
 		s.abort()
+		stats.Error(s.addr)
 		level.Error(s.logger).Log("op", "sendKeepalive", "error", err, "msg", "failed to send keepalive")
 		return fmt.Errorf("sending keepalive to %q: %s", s.addr, err)
 	}
 	return nil
 }
 
+// watchdog tears down the connection when the peer stops sending
+// messages for longer than watchdogTimeout. Some routers keep the TCP
+// connection up while the BGP session is stalled, and since we don't
+// enforce the hold time on received messages we would never notice.
+func (s *session) watchdog() {
+	t := time.NewTicker(s.watchdogTimeout / 4)
+	defer t.Stop()
+	for now := range t.C {
+		if err := s.checkWatchdog(now); err == errClosed {
+			return
+		}
+	}
+}
+
+// checkWatchdog aborts the connection if no message was received from
+// the peer since watchdogTimeout before now.
+func (s *session) checkWatchdog(now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return errClosed
+	}
+	if s.conn == nil {
+		return nil
+	}
+	if now.Sub(s.lastReceived) <= s.watchdogTimeout {
+		return nil
+	}
+	stats.Error(s.addr)
+	level.Warn(s.logger).Log("event", "watchdogExpired", "lastReceived", s.lastReceived, "msg", "no message received from peer, resetting session")
+	s.abort()
+	return nil
+}
+
 // consumeBGP receives BGP messages from the peer, and ignores
 // them. It does minimal checks for the well-formedness of messages,
 // and terminates the connection if something looks wrong.
@@ -433,27 +564,76 @@ func (s *session) consumeBGP(conn io.ReadCloser) {
 		if hdr.Type == 3 {
 			// TODO: propagate better than just logging directly.
 			err := readNotification(conn)
+			stats.Error(s.addr)
 			level.Error(s.logger).Log("event", "peerNotification", "error", err, "msg", "peer sent notification, closing session")
 			return
 		}
+		if hdr.Type == 5 {
+			body := io.LimitReader(conn, int64(hdr.Len)-19)
+			afi, safi, err := readRouteRefresh(body)
+			if err != nil {
+				return
+			}
+			if _, err := io.Copy(ioutil.Discard, body); err != nil {
+				return
+			}
+			level.Info(s.logger).Log("event", "routeRefresh", "afi", afi, "safi", safi, "msg", "peer requested a route refresh")
+			s.mu.Lock()
+			if s.conn == conn {
+				s.lastReceived = time.Now()
+				// Only unicast routes are advertised, IPv4 (AFI 1) or
+				// IPv6 (AFI 2) depending on the family of the peer.
+				if (afi == 1 || afi == 2) && safi == 1 {
+					s.refreshAdvertisements()
+				}
+			}
+			s.mu.Unlock()
+			continue
+		}
 		if _, err := io.Copy(ioutil.Discard, io.LimitReader(conn, int64(hdr.Len)-19)); err != nil {
 			// TODO: propagate
 			return
 		}
+		if hdr.Type == 2 {
+			stats.UpdateReceived(s.addr)
+		}
+		if hdr.Type == 2 || hdr.Type == 4 {
+			// UPDATE or KEEPALIVE, the peer is alive.
+			s.mu.Lock()
+			if s.conn == conn {
+				s.lastReceived = time.Now()
+			}
+			s.mu.Unlock()
+		}
 	}
 }
 
 func validate(adv *bgp.Advertisement) error {
-	if adv.Prefix.IP.To4() == nil {
-		return fmt.Errorf("cannot advertise non-v4 prefix %q", adv.Prefix)
-	}
-
 	if len(adv.Communities) > 63 {
 		return fmt.Errorf("max supported communities is 63, got %d", len(adv.Communities))
 	}
 	return nil
 }
 
+// refreshAdvertisements sends again all the advertisements to the
+// peer. It must be called with the lock held.
+func (s *session) refreshAdvertisements() {
+	s.refresh = true
+	s.cond.Broadcast()
+}
+
+// carries returns true if the session announces the prefixes of the
+// family of pfx: the sessions with IPv4 peers announce the IPv4
+// prefixes, the ones with IPv6 peers the IPv6 prefixes.
+func (s *session) carries(pfx *net.IPNet) bool {
+	host, _, err := net.SplitHostPort(s.addr)
+	if err != nil {
+		return false
+	}
+	peer := net.ParseIP(host)
+	return peer != nil && (peer.To4() == nil) == (pfx.IP.To4() == nil)
+}
+
 // Set updates the set of Advertisements that this session's peer should receive.
 //
 // Changes are propagated to the peer asynchronously, Set may return
@@ -464,7 +644,7 @@ func (s *session) Set(advs ...*bgp.Advertisement) error {
 
 	newAdvs := map[string]*bgp.Advertisement{}
 	for _, adv := range advs {
-		if !adv.MatchesPeer(s.name) {
+		if !adv.MatchesPeer(s.name) || !s.carries(adv.Prefix) {
 			continue
 		}
 		err := validate(adv)
@@ -475,6 +655,9 @@ func (s *session) Set(advs ...*bgp.Advertisement) error {
 	}
 
 	s.new = newAdvs
+	if s.pendingSince.IsZero() {
+		s.pendingSince = time.Now()
+	}
 	stats.PendingPrefixes(s.addr, len(s.new))
 	s.cond.Broadcast()
 
@@ -488,6 +671,9 @@ func (s *session) abort() {
 		s.conn.Close()
 		s.conn = nil
 		stats.SessionDown(s.addr)
+		if !s.closed {
+			s.flapped()
+		}
 	}
 	// Next time we retry the connection, we can just skip straight to
 	// the desired end state.
@@ -498,12 +684,30 @@ func (s *session) abort() {
 	s.cond.Broadcast()
 }
 
+// flapped records that the established session went down, and
+// notifies if it did so too often recently.
+func (s *session) flapped() {
+	stats.SessionFlapped(s.addr)
+	now := time.Now()
+	s.alarms.sessionDown(s.name, s.addr, now.Sub(s.established), now)
+	if s.flaps == nil || !s.flaps.Flap(s.addr, now) {
+		return
+	}
+	level.Warn(s.logger).Log("event", "sessionFlapping", "threshold", FlapThreshold, "window", FlapWindow, "msg", "BGP session is flapping")
+	if s.flapping != nil {
+		s.flapping(s.name, s.addr)
+	}
+}
+
 // Close shuts down the BGP session.
 func (s *session) Close() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.closed = true
 	s.abort()
+	if s.manager != nil {
+		s.manager.removeSession(s)
+	}
 	return nil
 }
 
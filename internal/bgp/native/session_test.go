@@ -0,0 +1,109 @@
+// SPDX-License-Identifier:Apache-2.0
+
+package native
+
+import (
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"go.universe.tf/metallb/internal/bgp"
+)
+
+// readMessageType reads a BGP message, and returns its type.
+func readMessageType(t *testing.T, r io.Reader) uint8 {
+	t.Helper()
+	hdr := struct {
+		Marker1, Marker2 uint64
+		Len              uint16
+		Type             uint8
+	}{}
+	if err := binary.Read(r, binary.BigEndian, &hdr); err != nil {
+		t.Fatalf("reading message header: %s", err)
+	}
+	if _, err := io.Copy(ioutil.Discard, io.LimitReader(r, int64(hdr.Len)-19)); err != nil {
+		t.Fatalf("reading message body: %s", err)
+	}
+	return hdr.Type
+}
+
+func TestSoftReset(t *testing.T) {
+	sm := NewSessionManager(log.NewNopLogger(), nil, SessionAlarmPolicy{})
+	local, peer := net.Pipe()
+	defer peer.Close()
+
+	_, prefix, _ := net.ParseCIDR("1.2.3.4/32")
+	s := &session{
+		addr:       "1.2.3.5:179",
+		myASN:      64500,
+		asn:        64501,
+		nextHop:    net.ParseIP("1.2.3.6"),
+		logger:     log.NewNopLogger(),
+		conn:       local,
+		advertised: map[string]*bgp.Advertisement{prefix.String(): {Prefix: prefix}},
+		manager:    sm,
+	}
+	s.cond = sync.NewCond(&s.mu)
+	sm.sessions[s.addr] = s
+
+	if err := sm.TriggerSoftReset("1.2.3.7:179"); err == nil {
+		t.Fatalf("soft reset of an unknown peer succeeded")
+	}
+
+	done := make(chan bool)
+	go func() { done <- s.sendUpdates() }()
+
+	// The advertisements are sent when the session starts, then again
+	// on each soft reset.
+	for i := 0; i < 3; i++ {
+		if typ := readMessageType(t, peer); typ != 2 {
+			t.Fatalf("got message type %d, want UPDATE", typ)
+		}
+		if i < 2 {
+			if err := sm.TriggerSoftReset(s.addr); err != nil {
+				t.Fatalf("soft reset failed: %s", err)
+			}
+		}
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatalf("closing the session: %s", err)
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("the session didn't stop sending updates")
+	}
+	if err := sm.TriggerSoftReset(s.addr); err == nil {
+		t.Fatalf("soft reset of a closed session succeeded")
+	}
+}
+
+func TestSetAddressFamilies(t *testing.T) {
+	_, v4, _ := net.ParseCIDR("1.2.3.4/32")
+	_, v6, _ := net.ParseCIDR("2001:db8::4/128")
+	advs := []*bgp.Advertisement{{Prefix: v4}, {Prefix: v6}}
+
+	tests := []struct {
+		addr string
+		want string
+	}{
+		{"1.2.3.5:179", v4.String()},
+		{"[2001:db8::5]:179", v6.String()},
+	}
+	for _, test := range tests {
+		s := &session{addr: test.addr, logger: log.NewNopLogger()}
+		s.cond = sync.NewCond(&s.mu)
+		if err := s.Set(advs...); err != nil {
+			t.Fatalf("%s: setting the advertisements: %s", test.addr, err)
+		}
+		if len(s.new) != 1 || s.new[test.want] == nil {
+			t.Fatalf("%s: expected only %s to be announced, got %v", test.addr, test.want, s.new)
+		}
+	}
+}
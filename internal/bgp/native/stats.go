@@ -2,7 +2,11 @@
 
 package native
 
-import "github.com/prometheus/client_golang/prometheus"
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
 
 type stat struct {
 	Name string
@@ -19,15 +23,40 @@ var (
 		Help: "BGP session state (1 is up, 0 is down)",
 	}
 
+	SessionUptime = stat{
+		Name: "session_uptime_seconds",
+		Help: "Number of seconds since the BGP session was established, 0 if down",
+	}
+
+	SessionFlaps = stat{
+		Name: "session_flap_total",
+		Help: "Number of times the established BGP session went down",
+	}
+
 	UpdatesSent = stat{
 		Name: "updates_total",
 		Help: "Number of BGP UPDATE messages sent",
 	}
 
+	UpdatesReceived = stat{
+		Name: "updates_received_total",
+		Help: "Number of BGP UPDATE messages received",
+	}
+
 	Prefixes = stat{
 		Name: "announced_prefixes_total",
 		Help: "Number of prefixes currently being advertised on the BGP session",
 	}
+
+	ConnectAttempts = stat{
+		Name: "connect_attempts_total",
+		Help: "Number of attempts to establish the BGP session",
+	}
+
+	LastError = stat{
+		Name: "last_error_timestamp_seconds",
+		Help: "Unix time of the last error on the BGP session, 0 if none",
+	}
 )
 
 var stats = metrics{
@@ -38,6 +67,20 @@ var stats = metrics{
 		Help:      SessionUp.Help,
 	}, Labels),
 
+	sessionUptime: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Subsystem: Subsystem,
+		Name:      SessionUptime.Name,
+		Help:      SessionUptime.Help,
+	}, Labels),
+
+	sessionFlaps: prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Subsystem: Subsystem,
+		Name:      SessionFlaps.Name,
+		Help:      SessionFlaps.Help,
+	}, Labels),
+
 	updatesSent: prometheus.NewCounterVec(prometheus.CounterOpts{
 		Namespace: Namespace,
 		Subsystem: Subsystem,
@@ -45,6 +88,13 @@ var stats = metrics{
 		Help:      UpdatesSent.Help,
 	}, Labels),
 
+	updatesReceived: prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Subsystem: Subsystem,
+		Name:      UpdatesReceived.Name,
+		Help:      UpdatesReceived.Help,
+	}, Labels),
+
 	prefixes: prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Namespace: Namespace,
 		Subsystem: Subsystem,
@@ -58,34 +108,68 @@ var stats = metrics{
 		Name:      "pending_prefixes_total",
 		Help:      "Number of prefixes that should be advertised on the BGP session",
 	}, Labels),
+
+	connectAttempts: prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Subsystem: Subsystem,
+		Name:      ConnectAttempts.Name,
+		Help:      ConnectAttempts.Help,
+	}, Labels),
+
+	lastError: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Subsystem: Subsystem,
+		Name:      LastError.Name,
+		Help:      LastError.Help,
+	}, Labels),
 }
 
 type metrics struct {
 	sessionUp       *prometheus.GaugeVec
+	sessionUptime   *prometheus.GaugeVec
+	sessionFlaps    *prometheus.CounterVec
 	updatesSent     *prometheus.CounterVec
+	updatesReceived *prometheus.CounterVec
 	prefixes        *prometheus.GaugeVec
 	pendingPrefixes *prometheus.GaugeVec
+	connectAttempts *prometheus.CounterVec
+	lastError       *prometheus.GaugeVec
 }
 
 func init() {
 	prometheus.MustRegister(stats.sessionUp)
+	prometheus.MustRegister(stats.sessionUptime)
+	prometheus.MustRegister(stats.sessionFlaps)
 	prometheus.MustRegister(stats.updatesSent)
+	prometheus.MustRegister(stats.updatesReceived)
 	prometheus.MustRegister(stats.prefixes)
 	prometheus.MustRegister(stats.pendingPrefixes)
+	prometheus.MustRegister(stats.connectAttempts)
+	prometheus.MustRegister(stats.lastError)
 }
 
 func (m *metrics) NewSession(addr string) {
 	m.sessionUp.WithLabelValues(addr).Set(0)
+	m.sessionUptime.WithLabelValues(addr).Set(0)
 	m.prefixes.WithLabelValues(addr).Set(0)
 	m.pendingPrefixes.WithLabelValues(addr).Set(0)
-	m.updatesSent.WithLabelValues(addr).Add(0) // just creates the metric
+	m.sessionFlaps.WithLabelValues(addr).Add(0) // just creates the metric
+	m.updatesSent.WithLabelValues(addr).Add(0)
+	m.updatesReceived.WithLabelValues(addr).Add(0)
+	m.connectAttempts.WithLabelValues(addr).Add(0)
+	m.lastError.WithLabelValues(addr).Set(0)
 }
 
 func (m *metrics) DeleteSession(addr string) {
 	m.sessionUp.DeleteLabelValues(addr)
+	m.sessionUptime.DeleteLabelValues(addr)
 	m.prefixes.DeleteLabelValues(addr)
 	m.pendingPrefixes.DeleteLabelValues(addr)
+	m.sessionFlaps.DeleteLabelValues(addr)
 	m.updatesSent.DeleteLabelValues(addr)
+	m.updatesReceived.DeleteLabelValues(addr)
+	m.connectAttempts.DeleteLabelValues(addr)
+	m.lastError.DeleteLabelValues(addr)
 }
 
 func (m *metrics) SessionUp(addr string) {
@@ -95,13 +179,34 @@ func (m *metrics) SessionUp(addr string) {
 
 func (m *metrics) SessionDown(addr string) {
 	m.sessionUp.WithLabelValues(addr).Set(0)
+	m.sessionUptime.WithLabelValues(addr).Set(0)
 	m.prefixes.WithLabelValues(addr).Set(0)
 }
 
+func (m *metrics) SessionUptime(addr string, uptime time.Duration) {
+	m.sessionUptime.WithLabelValues(addr).Set(uptime.Seconds())
+}
+
+func (m *metrics) SessionFlapped(addr string) {
+	m.sessionFlaps.WithLabelValues(addr).Inc()
+}
+
+func (m *metrics) ConnectAttempt(addr string) {
+	m.connectAttempts.WithLabelValues(addr).Inc()
+}
+
+func (m *metrics) Error(addr string) {
+	m.lastError.WithLabelValues(addr).SetToCurrentTime()
+}
+
 func (m *metrics) UpdateSent(addr string) {
 	m.updatesSent.WithLabelValues(addr).Inc()
 }
 
+func (m *metrics) UpdateReceived(addr string) {
+	m.updatesReceived.WithLabelValues(addr).Inc()
+}
+
 func (m *metrics) PendingPrefixes(addr string, n int) {
 	m.pendingPrefixes.WithLabelValues(addr).Set(float64(n))
 }
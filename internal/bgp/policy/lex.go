@@ -0,0 +1,105 @@
+// SPDX-License-Identifier:Apache-2.0
+
+package policy
+
+import (
+	"fmt"
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenNumber
+	tokenOp
+	tokenAnd
+	tokenOr
+	tokenNot
+	tokenLParen
+	tokenRParen
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of policy"
+	case tokenString:
+		return fmt.Sprintf("'%s'", t.text)
+	default:
+		return fmt.Sprintf("%q", t.text)
+	}
+}
+
+// lex splits the policy into tokens, ending with a tokenEOF.
+func lex(s string) ([]token, error) {
+	var tokens []token
+	i := 0
+	for i < len(s) {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case c == '\'' || c == '"':
+			end := strings.IndexByte(s[i+1:], c)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string at position %d", i)
+			}
+			tokens = append(tokens, token{kind: tokenString, text: s[i+1 : i+1+end], pos: i})
+			i += end + 2
+		case isLetter(c):
+			start := i
+			for i < len(s) && (isLetter(s[i]) || isDigit(s[i])) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: s[start:i], pos: start})
+		case isDigit(c):
+			start := i
+			for i < len(s) && isDigit(s[i]) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: s[start:i], pos: start})
+		case strings.HasPrefix(s[i:], "&&"):
+			tokens = append(tokens, token{kind: tokenAnd, text: "&&", pos: i})
+			i += 2
+		case strings.HasPrefix(s[i:], "||"):
+			tokens = append(tokens, token{kind: tokenOr, text: "||", pos: i})
+			i += 2
+		case strings.HasPrefix(s[i:], "=="), strings.HasPrefix(s[i:], "!="),
+			strings.HasPrefix(s[i:], "<="), strings.HasPrefix(s[i:], ">="):
+			tokens = append(tokens, token{kind: tokenOp, text: s[i : i+2], pos: i})
+			i += 2
+		case c == '<' || c == '>':
+			tokens = append(tokens, token{kind: tokenOp, text: s[i : i+1], pos: i})
+			i++
+		case c == '!':
+			tokens = append(tokens, token{kind: tokenNot, text: "!", pos: i})
+			i++
+		case c == '(':
+			tokens = append(tokens, token{kind: tokenLParen, text: "(", pos: i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{kind: tokenRParen, text: ")", pos: i})
+			i++
+		default:
+			return nil, fmt.Errorf("unexpected character %q at position %d", c, i)
+		}
+	}
+	return append(tokens, token{kind: tokenEOF, pos: len(s)}), nil
+}
+
+func isLetter(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
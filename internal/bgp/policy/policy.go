@@ -0,0 +1,232 @@
+// SPDX-License-Identifier:Apache-2.0
+
+// Package policy implements a small expression language selecting the
+// routes announced to a BGP peer, for example:
+//
+//	pool == 'prod' && community contains '64512:100'
+//
+// The attributes of a route are:
+//
+//   - pool: the name of the pool of the route, compared with == and !=.
+//   - prefix: the announced prefix, e.g. '10.0.0.1/32', compared with
+//     == and !=.
+//   - localPref: the local preference, compared with ==, !=, <, <=, >
+//     and >= to a number.
+//   - community: the communities of the route, in the 'x:y' form,
+//     matched with contains.
+//
+// Comparisons can be combined with &&, || and !, and grouped with
+// parentheses.
+package policy // import "go.universe.tf/metallb/internal/bgp/policy"
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Route holds the attributes of a route a policy is evaluated against.
+type Route struct {
+	Pool        string
+	Prefix      string
+	LocalPref   uint32
+	Communities []string
+}
+
+// Policy is a parsed route policy.
+type Policy struct {
+	expr node
+}
+
+// Parse parses the given policy expression.
+func Parse(s string) (*Policy, error) {
+	tokens, err := lex(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	expr, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, fmt.Errorf("unexpected %s at position %d", t, t.pos)
+	}
+	return &Policy{expr: expr}, nil
+}
+
+// Match returns true if the route matches the policy.
+func (p *Policy) Match(r Route) bool {
+	return p.expr.eval(r)
+}
+
+type node interface {
+	eval(r Route) bool
+}
+
+type and struct{ left, right node }
+
+func (n and) eval(r Route) bool { return n.left.eval(r) && n.right.eval(r) }
+
+type or struct{ left, right node }
+
+func (n or) eval(r Route) bool { return n.left.eval(r) || n.right.eval(r) }
+
+type not struct{ expr node }
+
+func (n not) eval(r Route) bool { return !n.expr.eval(r) }
+
+type stringCompare struct {
+	attr  func(Route) string
+	equal bool
+	value string
+}
+
+func (n stringCompare) eval(r Route) bool { return (n.attr(r) == n.value) == n.equal }
+
+type numberCompare struct {
+	op    string
+	value uint64
+}
+
+func (n numberCompare) eval(r Route) bool {
+	v := uint64(r.LocalPref)
+	switch n.op {
+	case "==":
+		return v == n.value
+	case "!=":
+		return v != n.value
+	case "<":
+		return v < n.value
+	case "<=":
+		return v <= n.value
+	case ">":
+		return v > n.value
+	default:
+		return v >= n.value
+	}
+}
+
+type communityContains struct{ value string }
+
+func (n communityContains) eval(r Route) bool {
+	for _, c := range r.Communities {
+		if c == n.value {
+			return true
+		}
+	}
+	return false
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) or() (node, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokenOr {
+		p.next()
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		left = or{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) and() (node, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokenAnd {
+		p.next()
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		left = and{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) unary() (node, error) {
+	switch t := p.next(); t.kind {
+	case tokenNot:
+		expr, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return not{expr}, nil
+	case tokenLParen:
+		expr, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if t := p.next(); t.kind != tokenRParen {
+			return nil, fmt.Errorf("expected ) at position %d, got %s", t.pos, t)
+		}
+		return expr, nil
+	case tokenIdent:
+		return p.comparison(t)
+	default:
+		return nil, fmt.Errorf("unexpected %s at position %d", t, t.pos)
+	}
+}
+
+func (p *parser) comparison(attr token) (node, error) {
+	op := p.next()
+	value := p.next()
+	switch attr.text {
+	case "pool", "prefix":
+		if op.kind != tokenOp || (op.text != "==" && op.text != "!=") {
+			return nil, fmt.Errorf("%s must be compared with == or !=, got %s at position %d", attr.text, op, op.pos)
+		}
+		if value.kind != tokenString {
+			return nil, fmt.Errorf("%s must be compared to a string, got %s at position %d", attr.text, value, value.pos)
+		}
+		get := func(r Route) string { return r.Pool }
+		if attr.text == "prefix" {
+			get = func(r Route) string { return r.Prefix }
+		}
+		return stringCompare{attr: get, equal: op.text == "==", value: value.text}, nil
+	case "localPref":
+		if op.kind != tokenOp {
+			return nil, fmt.Errorf("localPref must be compared with a comparison operator, got %s at position %d", op, op.pos)
+		}
+		if value.kind != tokenNumber {
+			return nil, fmt.Errorf("localPref must be compared to a number, got %s at position %d", value, value.pos)
+		}
+		n, err := strconv.ParseUint(value.text, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %s at position %d", value.text, value.pos)
+		}
+		return numberCompare{op: op.text, value: n}, nil
+	case "community":
+		if op.kind != tokenIdent || op.text != "contains" {
+			return nil, fmt.Errorf("community must be matched with contains, got %s at position %d", op, op.pos)
+		}
+		if value.kind != tokenString {
+			return nil, fmt.Errorf("community must be matched against a string, got %s at position %d", value, value.pos)
+		}
+		return communityContains{value: value.text}, nil
+	default:
+		return nil, fmt.Errorf("unknown attribute %q at position %d", attr.text, attr.pos)
+	}
+}
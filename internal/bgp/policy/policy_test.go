@@ -0,0 +1,87 @@
+// SPDX-License-Identifier:Apache-2.0
+
+package policy
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	prod := Route{
+		Pool:        "prod",
+		Prefix:      "10.0.0.1/32",
+		LocalPref:   100,
+		Communities: []string{"64512:100", "64512:200"},
+	}
+	dev := Route{
+		Pool:      "dev",
+		Prefix:    "10.1.0.0/24",
+		LocalPref: 50,
+	}
+
+	tests := []struct {
+		policy   string
+		wantProd bool
+		wantDev  bool
+	}{
+		{policy: "pool == 'prod'", wantProd: true},
+		{policy: `pool != "prod"`, wantDev: true},
+		{policy: "pool == 'prod' && community contains '64512:100'", wantProd: true},
+		{policy: "pool == 'prod' && community contains '64512:300'"},
+		{policy: "community contains '64512:300' || prefix == '10.1.0.0/24'", wantDev: true},
+		{policy: "localPref >= 100", wantProd: true},
+		{policy: "localPref < 100", wantDev: true},
+		{policy: "localPref<=50||localPref>99", wantProd: true, wantDev: true},
+		{policy: "localPref == 50", wantDev: true},
+		{policy: "localPref != 50", wantProd: true},
+		{policy: "!(pool == 'prod')", wantDev: true},
+		{policy: "!pool == 'prod' && localPref > 10", wantDev: true},
+		{policy: "pool == 'dev' || pool == 'prod' && localPref > 100", wantDev: true},
+		{policy: "(pool == 'dev' || pool == 'prod') && localPref > 10", wantProd: true, wantDev: true},
+	}
+
+	for _, test := range tests {
+		p, err := Parse(test.policy)
+		if err != nil {
+			t.Fatalf("parsing %q failed: %s", test.policy, err)
+		}
+		if got := p.Match(prod); got != test.wantProd {
+			t.Errorf("%q on the prod route: got %v, want %v", test.policy, got, test.wantProd)
+		}
+		if got := p.Match(dev); got != test.wantDev {
+			t.Errorf("%q on the dev route: got %v, want %v", test.policy, got, test.wantDev)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		policy  string
+		wantErr string
+	}{
+		{policy: "", wantErr: "unexpected end of policy"},
+		{policy: "pool == 'prod", wantErr: "unterminated string"},
+		{policy: "pool = 'prod'", wantErr: "unexpected character"},
+		{policy: "color == 'red'", wantErr: `unknown attribute "color"`},
+		{policy: "pool contains 'prod'", wantErr: "pool must be compared with == or !="},
+		{policy: "pool == 3", wantErr: "pool must be compared to a string"},
+		{policy: "localPref > 'high'", wantErr: "localPref must be compared to a number"},
+		{policy: "localPref contains 3", wantErr: "localPref must be compared with a comparison operator"},
+		{policy: "localPref > 99999999999", wantErr: "invalid number"},
+		{policy: "community == '64512:100'", wantErr: "community must be matched with contains"},
+		{policy: "(pool == 'prod'", wantErr: "expected )"},
+		{policy: "pool == 'prod' pool == 'dev'", wantErr: `unexpected "pool" at position 15`},
+		{policy: "pool == 'prod' &&", wantErr: "unexpected end of policy"},
+	}
+
+	for _, test := range tests {
+		_, err := Parse(test.policy)
+		if err == nil {
+			t.Fatalf("expected parsing %q to fail", test.policy)
+		}
+		if !strings.Contains(err.Error(), test.wantErr) {
+			t.Errorf("parsing %q: error %q does not contain %q", test.policy, err, test.wantErr)
+		}
+	}
+}
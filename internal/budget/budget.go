@@ -0,0 +1,145 @@
+// SPDX-License-Identifier:Apache-2.0
+
+// Package budget tracks the IPs the namespaces use out of their
+// quotas, and serves them over HTTP.
+package budget // import "go.universe.tf/metallb/internal/budget"
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Usage is the quota of a namespace on a pool, and the IPs it uses.
+type Usage struct {
+	Total int
+	Used  int
+}
+
+// PoolBudget is the budget of a namespace on a pool.
+type PoolBudget struct {
+	Pool      string `json:"pool"`
+	Total     int    `json:"total"`
+	Used      int    `json:"used"`
+	Remaining int    `json:"remaining"`
+}
+
+// Budget is the budget of a namespace over all the pools it has a
+// quota on.
+type Budget struct {
+	Namespace string       `json:"namespace"`
+	Total     int          `json:"total"`
+	Used      int          `json:"used"`
+	Remaining int          `json:"remaining"`
+	Pools     []PoolBudget `json:"pools"`
+}
+
+// Budgets records the budgets of the namespaces. A nil Budgets records
+// nothing.
+type Budgets struct {
+	sync.Mutex
+	pools map[string]map[string]Usage // pool -> namespace -> usage
+}
+
+// New returns an empty Budgets.
+func New() *Budgets {
+	return &Budgets{pools: map[string]map[string]Usage{}}
+}
+
+// SetPool replaces the usages of the pool, indexed by namespace.
+func (b *Budgets) SetPool(pool string, usages map[string]Usage) {
+	if b == nil {
+		return
+	}
+	b.Lock()
+	defer b.Unlock()
+	for ns := range b.pools[pool] {
+		if _, ok := usages[ns]; !ok {
+			stats.deleteBudget(ns, pool)
+		}
+	}
+	if len(usages) == 0 {
+		delete(b.pools, pool)
+		return
+	}
+	b.pools[pool] = usages
+	for ns, u := range usages {
+		stats.setBudget(ns, pool, u)
+	}
+}
+
+// RemovePool drops the usages of the pool.
+func (b *Budgets) RemovePool(pool string) {
+	b.SetPool(pool, nil)
+}
+
+// Budget returns the budget of the namespace, and false if it has no
+// quota.
+func (b *Budgets) Budget(namespace string) (Budget, bool) {
+	if b == nil {
+		return Budget{}, false
+	}
+	b.Lock()
+	defer b.Unlock()
+	res := Budget{Namespace: namespace}
+	for pool, usages := range b.pools {
+		u, ok := usages[namespace]
+		if !ok {
+			continue
+		}
+		p := PoolBudget{
+			Pool:      pool,
+			Total:     u.Total,
+			Used:      u.Used,
+			Remaining: remaining(u),
+		}
+		res.Total += p.Total
+		res.Used += p.Used
+		res.Remaining += p.Remaining
+		res.Pools = append(res.Pools, p)
+	}
+	if len(res.Pools) == 0 {
+		return Budget{}, false
+	}
+	sort.Slice(res.Pools, func(i, j int) bool { return res.Pools[i].Pool < res.Pools[j].Pool })
+	return res, true
+}
+
+// remaining returns the IPs the namespace can still use, a lowered
+// quota being possibly exceeded by the IPs already in use.
+func remaining(u Usage) int {
+	if u.Used >= u.Total {
+		return 0
+	}
+	return u.Total - u.Used
+}
+
+// HandlerPath is the path the handler returned by Handler must be
+// registered on.
+const HandlerPath = "/api/v1/namespaces/"
+
+// Handler serves the budget of a namespace on
+// /api/v1/namespaces/{namespace}/budget.
+func (b *Budgets) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, HandlerPath), "/")
+		if len(parts) != 2 || parts[0] == "" || parts[1] != "budget" {
+			http.NotFound(w, r)
+			return
+		}
+
+		res, ok := b.Budget(parts[0])
+		if !ok {
+			http.Error(w, "no quota for namespace "+parts[0], http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(res)
+	})
+}
@@ -0,0 +1,128 @@
+// SPDX-License-Identifier:Apache-2.0
+
+package budget
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	ptu "github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestBudgets(t *testing.T) {
+	b := New()
+	b.SetPool("pool1", map[string]Usage{
+		"ns1": {Total: 4, Used: 1},
+		"ns2": {Total: 2, Used: 2},
+	})
+	b.SetPool("pool2", map[string]Usage{
+		// A lowered quota can be exceeded.
+		"ns1": {Total: 1, Used: 3},
+	})
+
+	want := Budget{
+		Namespace: "ns1",
+		Total:     5,
+		Used:      4,
+		Remaining: 3,
+		Pools: []PoolBudget{
+			{Pool: "pool1", Total: 4, Used: 1, Remaining: 3},
+			{Pool: "pool2", Total: 1, Used: 3, Remaining: 0},
+		},
+	}
+	got, ok := b.Budget("ns1")
+	if !ok {
+		t.Fatalf("expected a budget for ns1")
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected budget (-want +got):\n%s", diff)
+	}
+	if v := ptu.ToFloat64(stats.used.WithLabelValues("ns1", "pool2")); v != 3 {
+		t.Fatalf("expected 3 IPs used by ns1 in pool2, got %v", v)
+	}
+	if v := ptu.ToFloat64(stats.total.WithLabelValues("ns2", "pool1")); v != 2 {
+		t.Fatalf("expected a budget of 2 IPs for ns2 in pool1, got %v", v)
+	}
+
+	b.SetPool("pool1", map[string]Usage{"ns1": {Total: 4, Used: 2}})
+	if _, ok := b.Budget("ns2"); ok {
+		t.Fatalf("expected no budget for ns2 after its quota was removed")
+	}
+	b.RemovePool("pool2")
+	got, _ = b.Budget("ns1")
+	if len(got.Pools) != 1 || got.Used != 2 {
+		t.Fatalf("expected the budget of ns1 in pool1 only, got %+v", got)
+	}
+	if n := ptu.CollectAndCount(stats.used); n != 1 {
+		t.Fatalf("expected 1 used gauge left, got %d", n)
+	}
+}
+
+func TestBudgetsHandler(t *testing.T) {
+	b := New()
+	b.SetPool("pool1", map[string]Usage{"ns1": {Total: 4, Used: 1}})
+
+	tests := []struct {
+		desc       string
+		method     string
+		url        string
+		wantStatus int
+		want       *Budget
+	}{
+		{
+			desc:       "namespace with a quota",
+			url:        "/api/v1/namespaces/ns1/budget",
+			wantStatus: http.StatusOK,
+			want: &Budget{
+				Namespace: "ns1",
+				Total:     4,
+				Used:      1,
+				Remaining: 3,
+				Pools:     []PoolBudget{{Pool: "pool1", Total: 4, Used: 1, Remaining: 3}},
+			},
+		},
+		{
+			desc:       "namespace without quota",
+			url:        "/api/v1/namespaces/ns2/budget",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			desc:       "unknown path",
+			url:        "/api/v1/namespaces/ns1",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			desc:       "wrong method",
+			method:     http.MethodPost,
+			url:        "/api/v1/namespaces/ns1/budget",
+			wantStatus: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			method := test.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			rec := httptest.NewRecorder()
+			b.Handler().ServeHTTP(rec, httptest.NewRequest(method, test.url, nil))
+			if rec.Code != test.wantStatus {
+				t.Fatalf("expected status %d, got %d", test.wantStatus, rec.Code)
+			}
+			if test.want == nil {
+				return
+			}
+			got := &Budget{}
+			if err := json.Unmarshal(rec.Body.Bytes(), got); err != nil {
+				t.Fatalf("failed to decode the response: %s", err)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Fatalf("unexpected budget (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
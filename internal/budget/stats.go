@@ -0,0 +1,46 @@
+// SPDX-License-Identifier:Apache-2.0
+
+package budget
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var stats = metrics{
+	used: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "metallb",
+		Subsystem: "namespace",
+		Name:      "budget_used",
+		Help:      "Number of IP addresses of the pool used by the namespace",
+	}, []string{
+		"namespace",
+		"pool",
+	}),
+	total: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "metallb",
+		Subsystem: "namespace",
+		Name:      "budget_total",
+		Help:      "Number of IP addresses of the pool the quota of the namespace allows",
+	}, []string{
+		"namespace",
+		"pool",
+	}),
+}
+
+type metrics struct {
+	used  *prometheus.GaugeVec
+	total *prometheus.GaugeVec
+}
+
+func init() {
+	prometheus.MustRegister(stats.used)
+	prometheus.MustRegister(stats.total)
+}
+
+func (m *metrics) setBudget(namespace, pool string, u Usage) {
+	m.used.WithLabelValues(namespace, pool).Set(float64(u.Used))
+	m.total.WithLabelValues(namespace, pool).Set(float64(u.Total))
+}
+
+func (m *metrics) deleteBudget(namespace, pool string) {
+	m.used.DeleteLabelValues(namespace, pool)
+	m.total.DeleteLabelValues(namespace, pool)
+}
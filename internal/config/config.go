@@ -18,6 +18,7 @@ import (
 	"bytes"
 	"fmt"
 	"net"
+	"net/url"
 	"reflect"
 	"sort"
 	"strconv"
@@ -28,6 +29,7 @@ import (
 	"github.com/pkg/errors"
 	metallbv1beta1 "go.universe.tf/metallb/api/v1beta1"
 	metallbv1beta2 "go.universe.tf/metallb/api/v1beta2"
+	"go.universe.tf/metallb/internal/bgp/policy"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
@@ -42,8 +44,10 @@ type ClusterResources struct {
 	L2Advs             []metallbv1beta1.L2Advertisement  `json:"l2advertisements"`
 	LegacyAddressPools []metallbv1beta1.AddressPool      `json:"legacyaddresspools"`
 	Communities        []metallbv1beta1.Community        `json:"communities"`
+	Quotas             []metallbv1beta1.NamespaceIPQuota `json:"namespaceipquotas"`
 	PasswordSecrets    map[string]corev1.Secret          `json:"passwordsecrets"`
 	Nodes              []corev1.Node                     `json:"nodes"`
+	Namespaces         []corev1.Namespace                `json:"namespaces"`
 }
 
 // Config is a parsed MetalLB configuration.
@@ -69,6 +73,58 @@ var Protocols = []Proto{
 	BGP, Layer2,
 }
 
+// Orders in which the IPs of hybrid pools are announced.
+const (
+	AnnounceSimultaneous = "simultaneous"
+	AnnounceBGPFirst     = "bgp-first"
+	AnnounceL2First      = "l2-first"
+)
+
+const defaultBGPSettleTime = time.Second
+
+const defaultHookTimeout = 5 * time.Second
+
+// defaultInitialJitter spreads the first connections of the speakers to
+// a peer over this time.
+const defaultInitialJitter = 5 * time.Second
+
+// Reservation modes of the pools.
+const (
+	// High priority services are allocated from the beginning of the
+	// CIDRs, the others from the end.
+	ReservedFirst = "reserved-first"
+	// High priority services are allocated from the end of the CIDRs,
+	// the others from the beginning.
+	ReservedLast = "reserved-last"
+)
+
+// Allocation strategies of the pools.
+const (
+	// The first free IP of the pool is allocated.
+	StrategySequential = "sequential"
+	// A free IP is picked at random.
+	StrategyRandom = "random"
+	// The free IP following the last allocated one is allocated.
+	StrategyRoundRobin = "round-robin"
+	// The IPs never used are allocated first, then the ones released
+	// the longest ago.
+	StrategyLeastRecentlyUsed = "least-recently-used"
+	// The IP at the offset of the hash of the service key is allocated,
+	// or the next free one.
+	StrategyHashed = "hashed"
+)
+
+// Conditions activating the failover of a pool to its backup pool.
+const (
+	// The pool has no IP left.
+	FailoverPoolExhausted = "pool-exhausted"
+	// The IPs of the pool are not announced within its announcement
+	// timeout.
+	FailoverPoolDegraded = "pool-degraded"
+	// The failover is activated by the user.
+	FailoverManual = "manual"
+)
+
 // Peer is the configuration of a BGP peering session.
 type Peer struct {
 	// Peer name.
@@ -98,6 +154,24 @@ type Peer struct {
 	BFDProfile string
 	// Optional ebgp peer is multi-hops away.
 	EBGPMultiHop bool
+	// If true, the graceful restart capability is negotiated with the
+	// peer.
+	EnableGracefulRestart bool
+	// The VRF the session is established in, the default one if empty.
+	VRF string
+	// If not zero, the session is re-established when the peer doesn't
+	// send any message for this long.
+	SessionWatchdogTimeout time.Duration
+	// If true, the IPv6 /128 prefixes announced to this peer carry the
+	// flow label of their service as a color extended community.
+	FlowLabelECMPEnabled bool
+	// Time to wait before the first connection attempt to the peer.
+	InitialDelay time.Duration
+	// Upper bound of the random time added to InitialDelay.
+	InitialJitter time.Duration
+	// Expression selecting the routes announced to the peer, all of
+	// them if empty.
+	RoutePolicy string
 	// TODO: more BGP session settings
 }
 
@@ -112,12 +186,105 @@ type Pool struct {
 	// from this pool.
 	AutoAssign bool
 
+	// If true, the controller adds to CIDR an IPv6 range computed from
+	// the IPv6 PodCIDRs of the nodes.
+	AutodetectIPv6 bool
+
+	// If true, the configured address ranges have been split into
+	// sub-CIDRs of AutoSplitSize addresses, which are the ones listed
+	// in CIDR.
+	AutoSplit bool
+	// Number of addresses of each sub-CIDR when AutoSplit is set.
+	AutoSplitSize int
+
+	// Maximum number of services that can wait for an IP from this
+	// pool. Zero means unlimited.
+	MaxPendingAllocations int
+
+	// Number of addresses at the beginning and at the end of each
+	// CIDR that are never allocated.
+	ReservedBoundaryIPs int
+
+	// If true, the addresses that some clients and routers mishandle,
+	// ending in .0 or .255 for IPv4, or with an all zeros interface
+	// identifier for IPv6, are never allocated.
+	AvoidBuggyIPs bool
+
+	// How the CIDRs are split between the high priority services and
+	// the others, one of the Reserved* constants. Empty means all the
+	// services are allocated from the beginning of the CIDRs.
+	ReservationMode string
+
+	// How the IP of a service is picked among the free ones, one of the
+	// Strategy* constants. Empty means sequential.
+	AllocationStrategy string
+
+	// The name of the plugin picking the IP of a service instead of the
+	// AllocationStrategy, empty if none.
+	GenerationPlugin string
+
+	// Fraction of the addresses of the pool, between 0 and 1, kept for
+	// the high priority services.
+	EmergencyReserveFraction float64
+
+	// Number of hours after which the IPs of the pool are reported as
+	// stale. Zero disables the check.
+	MaxIPAgeHours int
+
+	// If true, the stale IPs are released and the services allocated
+	// again.
+	ForceRecycle bool
+
+	// If true, all the eligible nodes announce the IPs via L2 instead
+	// of the elected one only.
+	MultiPathL2 bool
+
+	// If true, the IPs are announced via BGP only from the node
+	// announcing them via L2.
+	Hybrid bool
+
+	// The order in which the IPs of an hybrid pool are announced via
+	// BGP and L2, one of the Announce* constants. Empty means
+	// simultaneous.
+	AnnouncementOrder string
+
+	// How long to wait after the first announcement before the
+	// second one, when AnnouncementOrder is not simultaneous.
+	BGPSettleTime time.Duration
+
+	// How long the speakers have to announce the IPs assigned to a
+	// service before they are released. Zero means forever.
+	AnnouncementTimeout time.Duration
+
+	// Annotations added to the services getting an IP from this pool,
+	// under the prefix configured in the controller.
+	Annotations map[string]string
+
+	// The labels of the pool, matched against the pool selector of the
+	// services.
+	Labels map[string]string
+
+	// The external service approving the IPs allocated from this
+	// pool, nil if none.
+	AllocationHook *HookConfig
+
+	// The backup pool offering its IPs to the services that can't get
+	// one from this pool, nil if none.
+	FailoverGroup *FailoverGroup
+
 	// The list of BGPAdvertisements associated with this address pool.
 	BGPAdvertisements []*BGPAdvertisement
 
 	// The list of L2Advertisements associated with this address pool.
 	L2Advertisements []*L2Advertisement
 
+	// The quotas limiting the IPs each namespace can take from this
+	// pool, indexed by namespace.
+	Quotas map[string]*Quota
+
+	// The services the pool gives IPs to, any service if nil.
+	ServiceAllocation *ServiceAllocation
+
 	cidrsPerAddresses map[string][]*net.IPNet
 }
 
@@ -142,6 +309,88 @@ type BGPAdvertisement struct {
 	Peers []string
 }
 
+// ServiceAllocation restricts the services a pool gives IPs to.
+type ServiceAllocation struct {
+	// The namespaces whose services can get IPs from the pool, any
+	// namespace if nil.
+	Namespaces map[string]bool
+	// The selectors of the services that can get IPs from the pool, a
+	// service matching one of them. Any service if empty.
+	ServiceSelectors []labels.Selector
+	// The priority of the pool in the automatic assignments, lowest
+	// first. Zero means no priority: the pool is tried last.
+	Priority int
+}
+
+// AllowsNamespace returns true if the services of the given namespace
+// can get IPs from the pool.
+func (p *Pool) AllowsNamespace(namespace string) bool {
+	if p.ServiceAllocation == nil || p.ServiceAllocation.Namespaces == nil {
+		return true
+	}
+	return p.ServiceAllocation.Namespaces[namespace]
+}
+
+// AllocationPriority returns the priority of the pool in the automatic
+// assignments, zero if it has none.
+func (p *Pool) AllocationPriority() int {
+	if p.ServiceAllocation == nil {
+		return 0
+	}
+	return p.ServiceAllocation.Priority
+}
+
+// AllowsServiceLabels returns true if a service with the given labels
+// can get IPs from the pool.
+func (p *Pool) AllowsServiceLabels(svcLabels map[string]string) bool {
+	if p.ServiceAllocation == nil || len(p.ServiceAllocation.ServiceSelectors) == 0 {
+		return true
+	}
+	for _, s := range p.ServiceAllocation.ServiceSelectors {
+		if s.Matches(labels.Set(svcLabels)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Quota limits the number of IPs the services of a namespace can take
+// from a pool.
+type Quota struct {
+	// Name of the NamespaceIPQuota the quota comes from.
+	Name string
+	// Maximum number of IPs the namespace can take from the pool.
+	// Zero means unlimited.
+	MaxIPs int
+	// Maximum number of IPs a single service can take from the pool.
+	// Zero means unlimited.
+	MaxIPsPerService int
+}
+
+// HookConfig is an external HTTP service approving the IPs allocated
+// from a pool.
+type HookConfig struct {
+	// URL the allocations are POSTed to.
+	URL string
+	// Timeout of the requests to the hook.
+	Timeout time.Duration
+	// If true, the allocation proceeds when the hook can't be reached
+	// or fails.
+	FailOpen bool
+}
+
+// FailoverGroup is the backup pool of a pool, and the condition
+// activating it.
+type FailoverGroup struct {
+	// The name of the backup pool.
+	BackupPool string
+	// The condition activating the failover, one of the Failover*
+	// constants.
+	Condition string
+	// If true, the failover is active. Only for the manual condition.
+	Active bool
+}
+
 type L2Advertisement struct {
 	// The map of nodes allowed for this advertisement
 	Nodes map[string]bool
@@ -258,6 +507,12 @@ func poolsFor(resources ClusterResources) (map[string]*Pool, error) {
 		res[p.Name] = pool
 	}
 
+	for name, pool := range res {
+		if f := pool.FailoverGroup; f != nil && res[f.BackupPool] == nil {
+			return nil, fmt.Errorf("backup pool %q of pool %q not found", f.BackupPool, name)
+		}
+	}
+
 	err = setL2AdvertisementsToPools(resources.Pools, resources.L2Advs, resources.Nodes, res)
 	if err != nil {
 		return nil, err
@@ -301,6 +556,16 @@ func poolsFor(resources ClusterResources) (map[string]*Pool, error) {
 		res[p.Name] = pool
 	}
 
+	err = setQuotasToPools(resources.Quotas, res)
+	if err != nil {
+		return nil, err
+	}
+
+	err = setServiceAllocationsToPools(resources.Pools, resources.Namespaces, res)
+	if err != nil {
+		return nil, err
+	}
+
 	return res, nil
 }
 
@@ -353,6 +618,33 @@ func peerFromCR(p metallbv1beta2.BGPPeer, passwordSecrets map[string]corev1.Secr
 		return nil, fmt.Errorf("invalid keepaliveTime %q", p.Spec.KeepaliveTime)
 	}
 
+	// the watchdog must leave room for at least one keepalive from the peer
+	var watchdogTimeout time.Duration
+	if p.Spec.SessionWatchdogTimeout != nil {
+		watchdogTimeout = p.Spec.SessionWatchdogTimeout.Duration
+	}
+	if watchdogTimeout < 0 || (watchdogTimeout != 0 && watchdogTimeout <= keepaliveTime) {
+		return nil, fmt.Errorf("invalid sessionWatchdogTimeout %q: must be greater than the keepalive time %q", watchdogTimeout, keepaliveTime)
+	}
+
+	initialJitter := defaultInitialJitter
+	if p.Spec.InitialJitter != nil {
+		initialJitter = p.Spec.InitialJitter.Duration
+	}
+	var initialDelay time.Duration
+	if p.Spec.InitialDelay != nil {
+		initialDelay = p.Spec.InitialDelay.Duration
+	}
+	if initialDelay < 0 || initialJitter < 0 {
+		return nil, fmt.Errorf("invalid initialDelay %q or initialJitter %q: must not be negative", initialDelay, initialJitter)
+	}
+
+	if p.Spec.RoutePolicy != "" {
+		if _, err := policy.Parse(p.Spec.RoutePolicy); err != nil {
+			return nil, fmt.Errorf("invalid routePolicy %q: %s", p.Spec.RoutePolicy, err)
+		}
+	}
+
 	// Ideally we would set a default RouterID here, instead of having
 	// to do it elsewhere in the code. Unfortunately, we don't know
 	// the node IP here.
@@ -391,19 +683,26 @@ func peerFromCR(p metallbv1beta2.BGPPeer, passwordSecrets map[string]corev1.Secr
 	}
 
 	return &Peer{
-		Name:          p.Name,
-		MyASN:         p.Spec.MyASN,
-		ASN:           p.Spec.ASN,
-		Addr:          ip,
-		SrcAddr:       src,
-		Port:          p.Spec.Port,
-		HoldTime:      holdTime,
-		KeepaliveTime: keepaliveTime,
-		RouterID:      routerID,
-		NodeSelectors: nodeSels,
-		Password:      password,
-		BFDProfile:    p.Spec.BFDProfile,
-		EBGPMultiHop:  p.Spec.EBGPMultiHop,
+		Name:                   p.Name,
+		MyASN:                  p.Spec.MyASN,
+		ASN:                    p.Spec.ASN,
+		Addr:                   ip,
+		SrcAddr:                src,
+		Port:                   p.Spec.Port,
+		HoldTime:               holdTime,
+		KeepaliveTime:          keepaliveTime,
+		RouterID:               routerID,
+		NodeSelectors:          nodeSels,
+		Password:               password,
+		BFDProfile:             p.Spec.BFDProfile,
+		EBGPMultiHop:           p.Spec.EBGPMultiHop,
+		EnableGracefulRestart:  p.Spec.EnableGracefulRestart,
+		VRF:                    p.Spec.VRFName,
+		SessionWatchdogTimeout: watchdogTimeout,
+		FlowLabelECMPEnabled:   p.Spec.FlowLabelECMP,
+		InitialDelay:           initialDelay,
+		InitialJitter:          initialJitter,
+		RoutePolicy:            p.Spec.RoutePolicy,
 	}, nil
 }
 
@@ -439,30 +738,207 @@ func addressPoolFromCR(p metallbv1beta1.IPAddressPool) (*Pool, error) {
 	}
 
 	ret := &Pool{
-		AutoAssign: true,
+		AutoAssign:            true,
+		MaxPendingAllocations: p.Spec.MaxPendingAllocations,
+		ReservedBoundaryIPs:   p.Spec.ReservedBoundaryIPs,
+		AvoidBuggyIPs:         p.Spec.AvoidBuggyIPs,
+		Hybrid:                p.Spec.Hybrid,
+		MultiPathL2:           p.Spec.MultiPathL2,
+		ReservationMode:       p.Spec.ReservationMode,
+		AllocationStrategy:    p.Spec.AllocationStrategy,
+		GenerationPlugin:      p.Spec.GenerationPlugin,
+		MaxIPAgeHours:         p.Spec.MaxIPAgeHours,
+		ForceRecycle:          p.Spec.ForceRecycle,
+		Annotations:           p.Spec.ServiceAnnotations,
+		Labels:                p.Labels,
+		AutodetectIPv6:        p.Spec.AutodetectIPv6,
 	}
 
 	if p.Spec.AutoAssign != nil {
 		ret.AutoAssign = *p.Spec.AutoAssign
 	}
+	if p.Spec.AnnouncementTimeout != nil {
+		ret.AnnouncementTimeout = p.Spec.AnnouncementTimeout.Duration
+	}
 
-	if len(p.Spec.Addresses) == 0 {
+	if len(p.Spec.Addresses) == 0 && !ret.AutodetectIPv6 {
 		return nil, errors.New("pool has no prefixes defined")
 	}
 
+	if ret.AutodetectIPv6 && p.Spec.AutoSplit {
+		return nil, fmt.Errorf("autodetectIPv6 in pool %q can't be combined with autoSplit", p.Name)
+	}
+
+	if ret.MaxPendingAllocations < 0 {
+		return nil, fmt.Errorf("invalid maxPendingAllocations %d in pool %q", ret.MaxPendingAllocations, p.Name)
+	}
+
+	if ret.ReservedBoundaryIPs < 0 {
+		return nil, fmt.Errorf("invalid reservedBoundaryIPs %d in pool %q", ret.ReservedBoundaryIPs, p.Name)
+	}
+
+	switch ret.ReservationMode {
+	case "", ReservedFirst, ReservedLast:
+	default:
+		return nil, fmt.Errorf("invalid reservationMode %q in pool %q", ret.ReservationMode, p.Name)
+	}
+
+	switch ret.AllocationStrategy {
+	case "", StrategySequential:
+	case StrategyRandom, StrategyRoundRobin, StrategyLeastRecentlyUsed, StrategyHashed:
+		if ret.ReservationMode != "" {
+			return nil, fmt.Errorf("allocationStrategy %q in pool %q can't be combined with a reservationMode", ret.AllocationStrategy, p.Name)
+		}
+	default:
+		return nil, fmt.Errorf("invalid allocationStrategy %q in pool %q", ret.AllocationStrategy, p.Name)
+	}
+
+	if ret.GenerationPlugin != "" {
+		if ret.ReservationMode != "" {
+			return nil, fmt.Errorf("generationPlugin %q in pool %q can't be combined with a reservationMode", ret.GenerationPlugin, p.Name)
+		}
+		if ret.AllocationStrategy != "" && ret.AllocationStrategy != StrategySequential {
+			return nil, fmt.Errorf("generationPlugin %q in pool %q can't be combined with allocationStrategy %q", ret.GenerationPlugin, p.Name, ret.AllocationStrategy)
+		}
+	}
+
+	if p.Spec.EmergencyReservePercent < 0 || p.Spec.EmergencyReservePercent > 100 {
+		return nil, fmt.Errorf("invalid emergencyReservePercent %d in pool %q, must be between 0 and 100", p.Spec.EmergencyReservePercent, p.Name)
+	}
+	ret.EmergencyReserveFraction = float64(p.Spec.EmergencyReservePercent) / 100
+
+	if ret.MaxIPAgeHours < 0 {
+		return nil, fmt.Errorf("invalid maxIPAgeHours %d in pool %q", ret.MaxIPAgeHours, p.Name)
+	}
+	if ret.ForceRecycle && ret.MaxIPAgeHours == 0 {
+		return nil, fmt.Errorf("forceRecycle in pool %q requires a maxIPAgeHours", p.Name)
+	}
+
+	if ret.AnnouncementTimeout < 0 {
+		return nil, fmt.Errorf("invalid announcementTimeout %s in pool %q", ret.AnnouncementTimeout, p.Name)
+	}
+
+	for k := range ret.Annotations {
+		if k == "" || strings.Contains(k, "/") {
+			return nil, fmt.Errorf("invalid service annotation %q in pool %q, it must be a name without prefix", k, p.Name)
+		}
+	}
+
+	if h := p.Spec.AllocationHook; h != nil {
+		u, err := url.Parse(h.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid allocationHook url %q in pool %q", h.URL, p.Name)
+		}
+		if h.Timeout.Duration < 0 {
+			return nil, fmt.Errorf("invalid allocationHook timeout %s in pool %q", h.Timeout.Duration, p.Name)
+		}
+		ret.AllocationHook = &HookConfig{
+			URL:      h.URL,
+			Timeout:  defaultHookTimeout,
+			FailOpen: h.FailOpen,
+		}
+		if h.Timeout.Duration != 0 {
+			ret.AllocationHook.Timeout = h.Timeout.Duration
+		}
+	}
+
+	if f := p.Spec.FailoverGroup; f != nil {
+		if f.BackupPool == "" || f.BackupPool == p.Name {
+			return nil, fmt.Errorf("invalid failoverGroup backupPool %q in pool %q", f.BackupPool, p.Name)
+		}
+		switch f.FailoverCondition {
+		case FailoverPoolExhausted, FailoverManual:
+		case FailoverPoolDegraded:
+			if ret.AnnouncementTimeout == 0 {
+				return nil, fmt.Errorf("failoverCondition %q in pool %q requires an announcementTimeout", f.FailoverCondition, p.Name)
+			}
+		default:
+			return nil, fmt.Errorf("invalid failoverCondition %q in pool %q", f.FailoverCondition, p.Name)
+		}
+		if f.Active && f.FailoverCondition != FailoverManual {
+			return nil, fmt.Errorf("active failoverGroup in pool %q requires the %q failoverCondition", p.Name, FailoverManual)
+		}
+		ret.FailoverGroup = &FailoverGroup{
+			BackupPool: f.BackupPool,
+			Condition:  f.FailoverCondition,
+			Active:     f.Active,
+		}
+	}
+
+	switch p.Spec.AnnouncementOrder {
+	case "", AnnounceSimultaneous:
+	case AnnounceBGPFirst, AnnounceL2First:
+		if !ret.Hybrid {
+			return nil, fmt.Errorf("announcementOrder %q in pool %q requires an hybrid pool", p.Spec.AnnouncementOrder, p.Name)
+		}
+		ret.AnnouncementOrder = p.Spec.AnnouncementOrder
+		ret.BGPSettleTime = defaultBGPSettleTime
+		if p.Spec.BGPSettleTime != nil {
+			ret.BGPSettleTime = p.Spec.BGPSettleTime.Duration
+		}
+		if ret.BGPSettleTime < 0 {
+			return nil, fmt.Errorf("invalid bgpSettleTime %s in pool %q", ret.BGPSettleTime, p.Name)
+		}
+	default:
+		return nil, fmt.Errorf("invalid announcementOrder %q in pool %q", p.Spec.AnnouncementOrder, p.Name)
+	}
+
+	if p.Spec.AutoSplit {
+		ret.AutoSplit = true
+		ret.AutoSplitSize = defaultAutoSplitSize
+		if p.Spec.AutoSplitSize != 0 {
+			ret.AutoSplitSize = p.Spec.AutoSplitSize
+		}
+		if ret.AutoSplitSize < 2 || ret.AutoSplitSize&(ret.AutoSplitSize-1) != 0 {
+			return nil, fmt.Errorf("invalid autoSplitSize %d in pool %q: must be a power of two", ret.AutoSplitSize, p.Name)
+		}
+	}
+
 	ret.cidrsPerAddresses = map[string][]*net.IPNet{}
 	for _, cidr := range p.Spec.Addresses {
 		nets, err := ParseCIDR(cidr)
 		if err != nil {
 			return nil, fmt.Errorf("invalid CIDR %q in pool %q: %s", cidr, p.Name, err)
 		}
-		ret.CIDR = append(ret.CIDR, nets...)
 		ret.cidrsPerAddresses[cidr] = nets
+		if !ret.AutoSplit {
+			ret.CIDR = append(ret.CIDR, nets...)
+			continue
+		}
+		for _, n := range nets {
+			sub, err := splitCIDR(n, ret.AutoSplitSize)
+			if err != nil {
+				return nil, fmt.Errorf("invalid CIDR %q in pool %q: %s", cidr, p.Name, err)
+			}
+			ret.CIDR = append(ret.CIDR, sub...)
+		}
 	}
 
 	return ret, nil
 }
 
+// ContainsIP returns true if ip belongs to one of the address ranges
+// of the pool. When the pool was split, the ranges as configured are
+// checked instead of the (many more) sub-CIDRs.
+func (p *Pool) ContainsIP(ip net.IP) bool {
+	if p.AutoSplit && p.cidrsPerAddresses != nil {
+		for _, nets := range p.cidrsPerAddresses {
+			for _, n := range nets {
+				if n.Contains(ip) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	for _, cidr := range p.CIDR {
+		if cidr.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
 func addressPoolFromLegacyCR(p metallbv1beta1.AddressPool, bgpCommunities map[string]uint32, allNodes map[string]bool) (*Pool, error) {
 	if p.Name == "" {
 		return nil, errors.New("missing pool name")
@@ -616,6 +1092,88 @@ func setBGPAdvertisementsToPools(ipPools []metallbv1beta1.IPAddressPool, bgpAdvs
 	return nil
 }
 
+func setQuotasToPools(quotas []metallbv1beta1.NamespaceIPQuota, pools map[string]*Pool) error {
+	for _, q := range quotas {
+		if q.Spec.Namespace == "" {
+			return fmt.Errorf("quota %s: missing namespace", q.Name)
+		}
+		if q.Spec.Pool == "" {
+			return fmt.Errorf("quota %s: missing pool", q.Name)
+		}
+		if q.Spec.MaxIPs < 0 {
+			return fmt.Errorf("quota %s: invalid maxIPs %d, must be non negative", q.Name, q.Spec.MaxIPs)
+		}
+		if q.Spec.MaxIPsPerService < 0 {
+			return fmt.Errorf("quota %s: invalid maxIPsPerService %d, must be non negative", q.Name, q.Spec.MaxIPsPerService)
+		}
+		pool, ok := pools[q.Spec.Pool]
+		if !ok {
+			return TransientError{fmt.Sprintf("quota %s referencing non existing pool %s", q.Name, q.Spec.Pool)}
+		}
+		if pool.Quotas == nil {
+			pool.Quotas = map[string]*Quota{}
+		}
+		if existing, ok := pool.Quotas[q.Spec.Namespace]; ok {
+			return fmt.Errorf("quota %s: namespace %s already has quota %s on pool %s", q.Name, q.Spec.Namespace, existing.Name, q.Spec.Pool)
+		}
+		pool.Quotas[q.Spec.Namespace] = &Quota{
+			Name:             q.Name,
+			MaxIPs:           q.Spec.MaxIPs,
+			MaxIPsPerService: q.Spec.MaxIPsPerService,
+		}
+	}
+	return nil
+}
+
+// setServiceAllocationsToPools sets the services each pool gives IPs
+// to, resolving the namespace selectors against the given namespaces.
+func setServiceAllocationsToPools(ipPools []metallbv1beta1.IPAddressPool, namespaces []corev1.Namespace, pools map[string]*Pool) error {
+	for _, p := range ipPools {
+		sa := p.Spec.ServiceAllocation
+		if sa == nil {
+			continue
+		}
+		err := validateDuplicate(sa.Namespaces, "namespaces")
+		if err != nil {
+			return fmt.Errorf("pool %s: %s", p.Name, err)
+		}
+		err = validateLabelSelectorDuplicate(sa.NamespaceSelectors, "namespaceSelectors")
+		if err != nil {
+			return fmt.Errorf("pool %s: %s", p.Name, err)
+		}
+		err = validateLabelSelectorDuplicate(sa.ServiceSelectors, "serviceSelectors")
+		if err != nil {
+			return fmt.Errorf("pool %s: %s", p.Name, err)
+		}
+		if sa.Priority < 0 {
+			return fmt.Errorf("pool %s: invalid negative priority %d", p.Name, sa.Priority)
+		}
+		allocation := &ServiceAllocation{Priority: sa.Priority}
+		if len(sa.Namespaces) > 0 || len(sa.NamespaceSelectors) > 0 {
+			allocation.Namespaces = map[string]bool{}
+			for _, ns := range sa.Namespaces {
+				allocation.Namespaces[ns] = true
+			}
+			selected, err := selectedNamespaces(namespaces, sa.NamespaceSelectors)
+			if err != nil {
+				return fmt.Errorf("pool %s: %s", p.Name, err)
+			}
+			for ns := range selected {
+				allocation.Namespaces[ns] = true
+			}
+		}
+		for _, selector := range sa.ServiceSelectors {
+			l, err := metav1.LabelSelectorAsSelector(&selector)
+			if err != nil {
+				return fmt.Errorf("pool %s: %s", p.Name, errors.Wrapf(err, "Invalid label selector %v", selector))
+			}
+			allocation.ServiceSelectors = append(allocation.ServiceSelectors, l)
+		}
+		pools[p.Name].ServiceAllocation = allocation
+	}
+	return nil
+}
+
 func l2AdvertisementFromCR(crdAd metallbv1beta1.L2Advertisement, nodes []corev1.Node) (*L2Advertisement, error) {
 	err := validateDuplicate(crdAd.Spec.IPAddressPools, "ipAddressPools")
 	if err != nil {
@@ -888,6 +1446,56 @@ func ParseCIDR(cidr string) ([]*net.IPNet, error) {
 	return ret, nil
 }
 
+const (
+	defaultAutoSplitSize = 256
+	// maxAutoSplitBits caps the number of sub-CIDRs a single range
+	// can be split into (2^maxAutoSplitBits), so that a huge IPv6 range
+	// doesn't blow up the pool.
+	maxAutoSplitBits = 16
+)
+
+// splitCIDR splits n into sub-CIDRs of size addresses each. If n
+// isn't bigger than size, it is returned as is.
+func splitCIDR(n *net.IPNet, size int) ([]*net.IPNet, error) {
+	ones, bits := n.Mask.Size()
+	hostBits := 0
+	for s := size; s > 1; s >>= 1 {
+		hostBits++
+	}
+	subOnes := bits - hostBits
+	if subOnes <= ones {
+		return []*net.IPNet{n}, nil
+	}
+	if subOnes-ones > maxAutoSplitBits {
+		return nil, fmt.Errorf("splitting %q in ranges of %d addresses would create more than %d ranges", n, size, 1<<maxAutoSplitBits)
+	}
+
+	count := 1 << (subOnes - ones)
+	ret := make([]*net.IPNet, 0, count)
+	ip := make(net.IP, len(n.IP))
+	copy(ip, n.IP)
+	for i := 0; i < count; i++ {
+		sub := &net.IPNet{
+			IP:   make(net.IP, len(ip)),
+			Mask: net.CIDRMask(subOnes, bits),
+		}
+		copy(sub.IP, ip)
+		ret = append(ret, sub)
+		addToIP(ip, size)
+	}
+	return ret, nil
+}
+
+// addToIP adds n to ip in place.
+func addToIP(ip net.IP, n int) {
+	carry := n
+	for i := len(ip) - 1; i >= 0 && carry > 0; i-- {
+		sum := int(ip[i]) + carry
+		ip[i] = byte(sum)
+		carry = sum >> 8
+	}
+}
+
 func cidrsOverlap(a, b *net.IPNet) bool {
 	return cidrContainsCIDR(a, b) || cidrContainsCIDR(b, a)
 }
@@ -977,6 +1585,24 @@ OUTER:
 
 }
 
+// selectedNamespaces returns the names of the namespaces matching one
+// of the selectors, none if there is no selector.
+func selectedNamespaces(namespaces []corev1.Namespace, selectors []metav1.LabelSelector) (map[string]bool, error) {
+	res := make(map[string]bool)
+	for _, selector := range selectors {
+		l, err := metav1.LabelSelectorAsSelector(&selector)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Invalid label selector %v", selector)
+		}
+		for _, ns := range namespaces {
+			if l.Matches(labels.Set(ns.Labels)) {
+				res[ns.Name] = true
+			}
+		}
+	}
+	return res, nil
+}
+
 func selectedPools(pools []metallbv1beta1.IPAddressPool, selectors []metav1.LabelSelector) ([]string, error) {
 	labelSelectors := []labels.Selector{}
 	for _, selector := range selectors {
@@ -86,6 +86,9 @@ func TestParse(t *testing.T) {
 							ASN:          200,
 							Address:      "2.3.4.5",
 							EBGPMultiHop: false,
+
+							EnableGracefulRestart: true,
+							VRFName:               "red",
 							NodeSelectors: []v1.LabelSelector{
 								{
 									MatchLabels: map[string]string{
@@ -224,6 +227,7 @@ func TestParse(t *testing.T) {
 						Port:          1179,
 						HoldTime:      180 * time.Second,
 						KeepaliveTime: 60 * time.Second,
+						InitialJitter: 5 * time.Second,
 						RouterID:      net.ParseIP("10.20.30.40"),
 						NodeSelectors: []labels.Selector{labels.Everything()},
 						EBGPMultiHop:  true,
@@ -235,8 +239,12 @@ func TestParse(t *testing.T) {
 						Addr:          net.ParseIP("2.3.4.5"),
 						HoldTime:      90 * time.Second,
 						KeepaliveTime: 30 * time.Second,
+						InitialJitter: 5 * time.Second,
 						NodeSelectors: []labels.Selector{selector("bar in (quux),foo=bar")},
 						EBGPMultiHop:  false,
+
+						EnableGracefulRestart: true,
+						VRF:                   "red",
 					},
 				},
 				Pools: map[string]*Pool{
@@ -333,6 +341,7 @@ func TestParse(t *testing.T) {
 						Addr:          net.ParseIP("1.2.3.4"),
 						HoldTime:      90 * time.Second,
 						KeepaliveTime: 30 * time.Second,
+						InitialJitter: 5 * time.Second,
 						NodeSelectors: []labels.Selector{labels.Everything()},
 						EBGPMultiHop:  false,
 					},
@@ -413,6 +422,52 @@ func TestParse(t *testing.T) {
 				},
 			},
 		},
+		{
+			desc: "session watchdog timeout",
+			crs: ClusterResources{
+				Peers: []v1beta2.BGPPeer{
+					{
+						Spec: v1beta2.BGPPeerSpec{
+							MyASN:                  42,
+							ASN:                    42,
+							Address:                "1.2.3.4",
+							SessionWatchdogTimeout: &v1.Duration{Duration: 5 * time.Minute},
+						},
+					},
+				},
+			},
+			want: &Config{
+				Peers: []*Peer{
+					{
+						MyASN:                  42,
+						ASN:                    42,
+						Addr:                   net.ParseIP("1.2.3.4"),
+						HoldTime:               90 * time.Second,
+						KeepaliveTime:          30 * time.Second,
+						InitialJitter:          5 * time.Second,
+						NodeSelectors:          []labels.Selector{labels.Everything()},
+						SessionWatchdogTimeout: 5 * time.Minute,
+					},
+				},
+				Pools:       map[string]*Pool{},
+				BFDProfiles: map[string]*BFDProfile{},
+			},
+		},
+		{
+			desc: "invalid session watchdog timeout (shorter than keepalive)",
+			crs: ClusterResources{
+				Peers: []v1beta2.BGPPeer{
+					{
+						Spec: v1beta2.BGPPeerSpec{
+							MyASN:                  42,
+							ASN:                    42,
+							Address:                "1.2.3.4",
+							SessionWatchdogTimeout: &v1.Duration{Duration: 10 * time.Second},
+						},
+					},
+				},
+			},
+		},
 		{
 			desc: "invalid RouterID",
 			crs: ClusterResources{
@@ -449,13 +504,60 @@ func TestParse(t *testing.T) {
 						Addr:          net.ParseIP("1.2.3.4"),
 						HoldTime:      90 * time.Second,
 						KeepaliveTime: 30 * time.Second,
+						InitialJitter: 5 * time.Second,
+						NodeSelectors: []labels.Selector{labels.Everything()},
+					},
+				},
+				Pools:       map[string]*Pool{},
+				BFDProfiles: map[string]*BFDProfile{},
+			},
+		},
+		{
+			desc: "peer with route policy",
+			crs: ClusterResources{
+				Peers: []v1beta2.BGPPeer{
+					{
+						Spec: v1beta2.BGPPeerSpec{
+							MyASN:       42,
+							ASN:         42,
+							Address:     "1.2.3.4",
+							RoutePolicy: "pool == 'prod' && community contains '64512:100'",
+						},
+					},
+				},
+			},
+			want: &Config{
+				Peers: []*Peer{
+					{
+						MyASN:         42,
+						ASN:           42,
+						Addr:          net.ParseIP("1.2.3.4"),
+						HoldTime:      90 * time.Second,
+						KeepaliveTime: 30 * time.Second,
+						InitialJitter: 5 * time.Second,
 						NodeSelectors: []labels.Selector{labels.Everything()},
+						RoutePolicy:   "pool == 'prod' && community contains '64512:100'",
 					},
 				},
 				Pools:       map[string]*Pool{},
 				BFDProfiles: map[string]*BFDProfile{},
 			},
 		},
+		{
+			desc: "peer with invalid route policy",
+			crs: ClusterResources{
+				Peers: []v1beta2.BGPPeer{
+					{
+						Spec: v1beta2.BGPPeerSpec{
+							MyASN:       42,
+							ASN:         42,
+							Address:     "1.2.3.4",
+							RoutePolicy: "pool = 'prod'",
+						},
+					},
+				},
+			},
+		},
 		{
 			desc: "invalid expression node selector (missing key)",
 			crs: ClusterResources{
@@ -1175,6 +1277,1081 @@ func TestParse(t *testing.T) {
 				},
 			},
 		},
+		{
+			desc: "auto split pool",
+			crs: ClusterResources{
+				Pools: []v1beta1.IPAddressPool{
+					{
+						ObjectMeta: v1.ObjectMeta{Name: "pool1"},
+						Spec: v1beta1.IPAddressPoolSpec{
+							Addresses: []string{
+								"10.20.0.0/22",
+								"10.30.0.0/25",
+							},
+							AutoSplit: true,
+						},
+					},
+				},
+			},
+			want: &Config{
+				Pools: map[string]*Pool{
+					"pool1": {
+						AutoAssign:    true,
+						AutoSplit:     true,
+						AutoSplitSize: 256,
+						CIDR: []*net.IPNet{
+							ipnet("10.20.0.0/24"),
+							ipnet("10.20.1.0/24"),
+							ipnet("10.20.2.0/24"),
+							ipnet("10.20.3.0/24"),
+							ipnet("10.30.0.0/25"),
+						},
+					},
+				},
+				BFDProfiles: map[string]*BFDProfile{},
+			},
+		},
+		{
+			desc: "pool with reserved boundary IPs",
+			crs: ClusterResources{
+				Pools: []v1beta1.IPAddressPool{
+					{
+						ObjectMeta: v1.ObjectMeta{Name: "pool1"},
+						Spec: v1beta1.IPAddressPoolSpec{
+							Addresses: []string{
+								"10.20.0.0/24",
+							},
+							ReservedBoundaryIPs: 2,
+						},
+					},
+				},
+			},
+			want: &Config{
+				Pools: map[string]*Pool{
+					"pool1": {
+						AutoAssign:          true,
+						CIDR:                []*net.IPNet{ipnet("10.20.0.0/24")},
+						ReservedBoundaryIPs: 2,
+					},
+				},
+				BFDProfiles: map[string]*BFDProfile{},
+			},
+		},
+		{
+			desc: "pool avoiding buggy IPs",
+			crs: ClusterResources{
+				Pools: []v1beta1.IPAddressPool{
+					{
+						ObjectMeta: v1.ObjectMeta{Name: "pool1"},
+						Spec: v1beta1.IPAddressPoolSpec{
+							Addresses: []string{
+								"10.20.0.0/24",
+							},
+							AvoidBuggyIPs: true,
+						},
+					},
+				},
+			},
+			want: &Config{
+				Pools: map[string]*Pool{
+					"pool1": {
+						AutoAssign:    true,
+						CIDR:          []*net.IPNet{ipnet("10.20.0.0/24")},
+						AvoidBuggyIPs: true,
+					},
+				},
+				BFDProfiles: map[string]*BFDProfile{},
+			},
+		},
+		{
+			desc: "hybrid pool",
+			crs: ClusterResources{
+				Pools: []v1beta1.IPAddressPool{
+					{
+						ObjectMeta: v1.ObjectMeta{Name: "pool1"},
+						Spec: v1beta1.IPAddressPoolSpec{
+							Addresses: []string{
+								"10.20.0.0/24",
+							},
+							Hybrid: true,
+						},
+					},
+				},
+			},
+			want: &Config{
+				Pools: map[string]*Pool{
+					"pool1": {
+						AutoAssign: true,
+						CIDR:       []*net.IPNet{ipnet("10.20.0.0/24")},
+						Hybrid:     true,
+					},
+				},
+				BFDProfiles: map[string]*BFDProfile{},
+			},
+		},
+		{
+			desc: "hybrid pool announced via bgp first",
+			crs: ClusterResources{
+				Pools: []v1beta1.IPAddressPool{
+					{
+						ObjectMeta: v1.ObjectMeta{Name: "pool1"},
+						Spec: v1beta1.IPAddressPoolSpec{
+							Addresses: []string{
+								"10.20.0.0/24",
+							},
+							Hybrid:            true,
+							AnnouncementOrder: "bgp-first",
+						},
+					},
+					{
+						ObjectMeta: v1.ObjectMeta{Name: "pool2"},
+						Spec: v1beta1.IPAddressPoolSpec{
+							Addresses: []string{
+								"10.30.0.0/24",
+							},
+							Hybrid:            true,
+							AnnouncementOrder: "l2-first",
+							BGPSettleTime:     &v1.Duration{Duration: 3 * time.Second},
+						},
+					},
+				},
+			},
+			want: &Config{
+				Pools: map[string]*Pool{
+					"pool1": {
+						AutoAssign:        true,
+						CIDR:              []*net.IPNet{ipnet("10.20.0.0/24")},
+						Hybrid:            true,
+						AnnouncementOrder: AnnounceBGPFirst,
+						BGPSettleTime:     time.Second,
+					},
+					"pool2": {
+						AutoAssign:        true,
+						CIDR:              []*net.IPNet{ipnet("10.30.0.0/24")},
+						Hybrid:            true,
+						AnnouncementOrder: AnnounceL2First,
+						BGPSettleTime:     3 * time.Second,
+					},
+				},
+				BFDProfiles: map[string]*BFDProfile{},
+			},
+		},
+		{
+			desc: "announcement order on a non hybrid pool",
+			crs: ClusterResources{
+				Pools: []v1beta1.IPAddressPool{
+					{
+						ObjectMeta: v1.ObjectMeta{Name: "pool1"},
+						Spec: v1beta1.IPAddressPoolSpec{
+							Addresses: []string{
+								"10.20.0.0/24",
+							},
+							AnnouncementOrder: "bgp-first",
+						},
+					},
+				},
+			},
+		},
+		{
+			desc: "invalid announcement order",
+			crs: ClusterResources{
+				Pools: []v1beta1.IPAddressPool{
+					{
+						ObjectMeta: v1.ObjectMeta{Name: "pool1"},
+						Spec: v1beta1.IPAddressPoolSpec{
+							Addresses: []string{
+								"10.20.0.0/24",
+							},
+							Hybrid:            true,
+							AnnouncementOrder: "bgp-last",
+						},
+					},
+				},
+			},
+		},
+		{
+			desc: "pool with reservation mode",
+			crs: ClusterResources{
+				Pools: []v1beta1.IPAddressPool{
+					{
+						ObjectMeta: v1.ObjectMeta{Name: "pool1"},
+						Spec: v1beta1.IPAddressPoolSpec{
+							Addresses: []string{
+								"10.20.0.0/24",
+							},
+							ReservationMode: "reserved-last",
+						},
+					},
+				},
+			},
+			want: &Config{
+				Pools: map[string]*Pool{
+					"pool1": {
+						AutoAssign:      true,
+						CIDR:            []*net.IPNet{ipnet("10.20.0.0/24")},
+						ReservationMode: ReservedLast,
+					},
+				},
+				BFDProfiles: map[string]*BFDProfile{},
+			},
+		},
+		{
+			desc: "pool with invalid reservation mode",
+			crs: ClusterResources{
+				Pools: []v1beta1.IPAddressPool{
+					{
+						ObjectMeta: v1.ObjectMeta{Name: "pool1"},
+						Spec: v1beta1.IPAddressPoolSpec{
+							Addresses: []string{
+								"10.20.0.0/24",
+							},
+							ReservationMode: "reserved-middle",
+						},
+					},
+				},
+			},
+		},
+		{
+			desc: "pool with allocation strategy",
+			crs: ClusterResources{
+				Pools: []v1beta1.IPAddressPool{
+					{
+						ObjectMeta: v1.ObjectMeta{Name: "pool1"},
+						Spec: v1beta1.IPAddressPoolSpec{
+							Addresses: []string{
+								"10.20.0.0/24",
+							},
+							AllocationStrategy: "round-robin",
+						},
+					},
+				},
+			},
+			want: &Config{
+				Pools: map[string]*Pool{
+					"pool1": {
+						AutoAssign:         true,
+						CIDR:               []*net.IPNet{ipnet("10.20.0.0/24")},
+						AllocationStrategy: StrategyRoundRobin,
+					},
+				},
+				BFDProfiles: map[string]*BFDProfile{},
+			},
+		},
+		{
+			desc: "pool with hashed allocation strategy",
+			crs: ClusterResources{
+				Pools: []v1beta1.IPAddressPool{
+					{
+						ObjectMeta: v1.ObjectMeta{Name: "pool1"},
+						Spec: v1beta1.IPAddressPoolSpec{
+							Addresses: []string{
+								"10.20.0.0/24",
+							},
+							AllocationStrategy: "hashed",
+						},
+					},
+				},
+			},
+			want: &Config{
+				Pools: map[string]*Pool{
+					"pool1": {
+						AutoAssign:         true,
+						CIDR:               []*net.IPNet{ipnet("10.20.0.0/24")},
+						AllocationStrategy: StrategyHashed,
+					},
+				},
+				BFDProfiles: map[string]*BFDProfile{},
+			},
+		},
+		{
+			desc: "pool with invalid allocation strategy",
+			crs: ClusterResources{
+				Pools: []v1beta1.IPAddressPool{
+					{
+						ObjectMeta: v1.ObjectMeta{Name: "pool1"},
+						Spec: v1beta1.IPAddressPoolSpec{
+							Addresses: []string{
+								"10.20.0.0/24",
+							},
+							AllocationStrategy: "fastest",
+						},
+					},
+				},
+			},
+		},
+		{
+			desc: "pool with allocation strategy and reservation mode",
+			crs: ClusterResources{
+				Pools: []v1beta1.IPAddressPool{
+					{
+						ObjectMeta: v1.ObjectMeta{Name: "pool1"},
+						Spec: v1beta1.IPAddressPoolSpec{
+							Addresses: []string{
+								"10.20.0.0/24",
+							},
+							AllocationStrategy: "random",
+							ReservationMode:    "reserved-first",
+						},
+					},
+				},
+			},
+		},
+		{
+			desc: "pool with generation plugin",
+			crs: ClusterResources{
+				Pools: []v1beta1.IPAddressPool{
+					{
+						ObjectMeta: v1.ObjectMeta{Name: "pool1"},
+						Spec: v1beta1.IPAddressPoolSpec{
+							Addresses: []string{
+								"10.20.0.0/24",
+							},
+							GenerationPlugin: "stable-hash",
+						},
+					},
+				},
+			},
+			want: &Config{
+				Pools: map[string]*Pool{
+					"pool1": {
+						AutoAssign:       true,
+						CIDR:             []*net.IPNet{ipnet("10.20.0.0/24")},
+						GenerationPlugin: "stable-hash",
+					},
+				},
+				BFDProfiles: map[string]*BFDProfile{},
+			},
+		},
+		{
+			desc: "pool with generation plugin and allocation strategy",
+			crs: ClusterResources{
+				Pools: []v1beta1.IPAddressPool{
+					{
+						ObjectMeta: v1.ObjectMeta{Name: "pool1"},
+						Spec: v1beta1.IPAddressPoolSpec{
+							Addresses: []string{
+								"10.20.0.0/24",
+							},
+							GenerationPlugin:   "stable-hash",
+							AllocationStrategy: "random",
+						},
+					},
+				},
+			},
+		},
+		{
+			desc: "pool with generation plugin and reservation mode",
+			crs: ClusterResources{
+				Pools: []v1beta1.IPAddressPool{
+					{
+						ObjectMeta: v1.ObjectMeta{Name: "pool1"},
+						Spec: v1beta1.IPAddressPoolSpec{
+							Addresses: []string{
+								"10.20.0.0/24",
+							},
+							GenerationPlugin: "stable-hash",
+							ReservationMode:  "reserved-last",
+						},
+					},
+				},
+			},
+		},
+		{
+			desc: "pool with emergency reserve",
+			crs: ClusterResources{
+				Pools: []v1beta1.IPAddressPool{
+					{
+						ObjectMeta: v1.ObjectMeta{Name: "pool1"},
+						Spec: v1beta1.IPAddressPoolSpec{
+							Addresses: []string{
+								"10.20.0.0/24",
+							},
+							EmergencyReservePercent: 10,
+						},
+					},
+				},
+			},
+			want: &Config{
+				Pools: map[string]*Pool{
+					"pool1": {
+						AutoAssign:               true,
+						CIDR:                     []*net.IPNet{ipnet("10.20.0.0/24")},
+						EmergencyReserveFraction: 0.1,
+					},
+				},
+				BFDProfiles: map[string]*BFDProfile{},
+			},
+		},
+		{
+			desc: "pool with invalid emergency reserve",
+			crs: ClusterResources{
+				Pools: []v1beta1.IPAddressPool{
+					{
+						ObjectMeta: v1.ObjectMeta{Name: "pool1"},
+						Spec: v1beta1.IPAddressPoolSpec{
+							Addresses: []string{
+								"10.20.0.0/24",
+							},
+							EmergencyReservePercent: 150,
+						},
+					},
+				},
+			},
+		},
+		{
+			desc: "pool with IPv6 autodetection",
+			crs: ClusterResources{
+				Pools: []v1beta1.IPAddressPool{
+					{
+						ObjectMeta: v1.ObjectMeta{Name: "pool1"},
+						Spec: v1beta1.IPAddressPoolSpec{
+							AutodetectIPv6: true,
+						},
+					},
+				},
+			},
+			want: &Config{
+				Pools: map[string]*Pool{
+					"pool1": {
+						AutoAssign:     true,
+						AutodetectIPv6: true,
+					},
+				},
+				BFDProfiles: map[string]*BFDProfile{},
+			},
+		},
+		{
+			desc: "pool with IPv6 autodetection and auto split",
+			crs: ClusterResources{
+				Pools: []v1beta1.IPAddressPool{
+					{
+						ObjectMeta: v1.ObjectMeta{Name: "pool1"},
+						Spec: v1beta1.IPAddressPoolSpec{
+							Addresses: []string{
+								"10.20.0.0/24",
+							},
+							AutodetectIPv6: true,
+							AutoSplit:      true,
+						},
+					},
+				},
+			},
+		},
+		{
+			desc: "pool with max IP age",
+			crs: ClusterResources{
+				Pools: []v1beta1.IPAddressPool{
+					{
+						ObjectMeta: v1.ObjectMeta{Name: "pool1"},
+						Spec: v1beta1.IPAddressPoolSpec{
+							Addresses: []string{
+								"10.20.0.0/24",
+							},
+							MaxIPAgeHours: 24,
+							ForceRecycle:  true,
+						},
+					},
+				},
+			},
+			want: &Config{
+				Pools: map[string]*Pool{
+					"pool1": {
+						AutoAssign:    true,
+						CIDR:          []*net.IPNet{ipnet("10.20.0.0/24")},
+						MaxIPAgeHours: 24,
+						ForceRecycle:  true,
+					},
+				},
+				BFDProfiles: map[string]*BFDProfile{},
+			},
+		},
+		{
+			desc: "pool with negative max IP age",
+			crs: ClusterResources{
+				Pools: []v1beta1.IPAddressPool{
+					{
+						ObjectMeta: v1.ObjectMeta{Name: "pool1"},
+						Spec: v1beta1.IPAddressPoolSpec{
+							Addresses: []string{
+								"10.20.0.0/24",
+							},
+							MaxIPAgeHours: -1,
+						},
+					},
+				},
+			},
+		},
+		{
+			desc: "pool with force recycle without max IP age",
+			crs: ClusterResources{
+				Pools: []v1beta1.IPAddressPool{
+					{
+						ObjectMeta: v1.ObjectMeta{Name: "pool1"},
+						Spec: v1beta1.IPAddressPoolSpec{
+							Addresses: []string{
+								"10.20.0.0/24",
+							},
+							ForceRecycle: true,
+						},
+					},
+				},
+			},
+		},
+		{
+			desc: "pool with announcement timeout",
+			crs: ClusterResources{
+				Pools: []v1beta1.IPAddressPool{
+					{
+						ObjectMeta: v1.ObjectMeta{Name: "pool1"},
+						Spec: v1beta1.IPAddressPoolSpec{
+							Addresses: []string{
+								"10.20.0.0/24",
+							},
+							AnnouncementTimeout: &v1.Duration{Duration: 30 * time.Second},
+						},
+					},
+				},
+			},
+			want: &Config{
+				Pools: map[string]*Pool{
+					"pool1": {
+						AutoAssign:          true,
+						CIDR:                []*net.IPNet{ipnet("10.20.0.0/24")},
+						AnnouncementTimeout: 30 * time.Second,
+					},
+				},
+				BFDProfiles: map[string]*BFDProfile{},
+			},
+		},
+		{
+			desc: "pool with negative announcement timeout",
+			crs: ClusterResources{
+				Pools: []v1beta1.IPAddressPool{
+					{
+						ObjectMeta: v1.ObjectMeta{Name: "pool1"},
+						Spec: v1beta1.IPAddressPoolSpec{
+							Addresses: []string{
+								"10.20.0.0/24",
+							},
+							AnnouncementTimeout: &v1.Duration{Duration: -time.Second},
+						},
+					},
+				},
+			},
+		},
+		{
+			desc: "pool with failover group",
+			crs: ClusterResources{
+				Pools: []v1beta1.IPAddressPool{
+					{
+						ObjectMeta: v1.ObjectMeta{Name: "pool1"},
+						Spec: v1beta1.IPAddressPoolSpec{
+							Addresses: []string{
+								"10.20.0.0/24",
+							},
+							FailoverGroup: &v1beta1.FailoverGroupSpec{
+								BackupPool:        "backup",
+								FailoverCondition: "manual",
+								Active:            true,
+							},
+						},
+					},
+					{
+						ObjectMeta: v1.ObjectMeta{Name: "backup"},
+						Spec: v1beta1.IPAddressPoolSpec{
+							Addresses: []string{
+								"10.30.0.0/24",
+							},
+						},
+					},
+				},
+			},
+			want: &Config{
+				Pools: map[string]*Pool{
+					"pool1": {
+						AutoAssign: true,
+						CIDR:       []*net.IPNet{ipnet("10.20.0.0/24")},
+						FailoverGroup: &FailoverGroup{
+							BackupPool: "backup",
+							Condition:  FailoverManual,
+							Active:     true,
+						},
+					},
+					"backup": {
+						AutoAssign: true,
+						CIDR:       []*net.IPNet{ipnet("10.30.0.0/24")},
+					},
+				},
+				BFDProfiles: map[string]*BFDProfile{},
+			},
+		},
+		{
+			desc: "pool with service allocation",
+			crs: ClusterResources{
+				Pools: []v1beta1.IPAddressPool{
+					{
+						ObjectMeta: v1.ObjectMeta{Name: "pool1"},
+						Spec: v1beta1.IPAddressPoolSpec{
+							Addresses: []string{
+								"10.20.0.0/24",
+							},
+							ServiceAllocation: &v1beta1.ServiceAllocation{
+								Namespaces: []string{"ns1"},
+								NamespaceSelectors: []v1.LabelSelector{
+									{
+										MatchLabels: map[string]string{"team": "infra"},
+									},
+								},
+							},
+						},
+					},
+				},
+				Namespaces: []corev1.Namespace{
+					{
+						ObjectMeta: v1.ObjectMeta{Name: "ns2", Labels: map[string]string{"team": "infra"}},
+					},
+					{
+						ObjectMeta: v1.ObjectMeta{Name: "ns3", Labels: map[string]string{"team": "web"}},
+					},
+				},
+			},
+			want: &Config{
+				Pools: map[string]*Pool{
+					"pool1": {
+						AutoAssign: true,
+						CIDR:       []*net.IPNet{ipnet("10.20.0.0/24")},
+						ServiceAllocation: &ServiceAllocation{
+							Namespaces: map[string]bool{"ns1": true, "ns2": true},
+						},
+					},
+				},
+				BFDProfiles: map[string]*BFDProfile{},
+			},
+		},
+		{
+			desc: "pool with service selectors and priority",
+			crs: ClusterResources{
+				Pools: []v1beta1.IPAddressPool{
+					{
+						ObjectMeta: v1.ObjectMeta{Name: "pool1"},
+						Spec: v1beta1.IPAddressPoolSpec{
+							Addresses: []string{
+								"10.20.0.0/24",
+							},
+							ServiceAllocation: &v1beta1.ServiceAllocation{
+								ServiceSelectors: []v1.LabelSelector{
+									{
+										MatchLabels: map[string]string{"tier": "public"},
+									},
+								},
+								Priority: 3,
+							},
+						},
+					},
+				},
+			},
+			want: &Config{
+				Pools: map[string]*Pool{
+					"pool1": {
+						AutoAssign: true,
+						CIDR:       []*net.IPNet{ipnet("10.20.0.0/24")},
+						ServiceAllocation: &ServiceAllocation{
+							ServiceSelectors: []labels.Selector{
+								labels.SelectorFromSet(labels.Set{"tier": "public"}),
+							},
+							Priority: 3,
+						},
+					},
+				},
+				BFDProfiles: map[string]*BFDProfile{},
+			},
+		},
+		{
+			desc: "pool with negative priority",
+			crs: ClusterResources{
+				Pools: []v1beta1.IPAddressPool{
+					{
+						ObjectMeta: v1.ObjectMeta{Name: "pool1"},
+						Spec: v1beta1.IPAddressPoolSpec{
+							Addresses: []string{
+								"10.20.0.0/24",
+							},
+							ServiceAllocation: &v1beta1.ServiceAllocation{
+								Priority: -1,
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			desc: "pool with duplicate service allocation namespaces",
+			crs: ClusterResources{
+				Pools: []v1beta1.IPAddressPool{
+					{
+						ObjectMeta: v1.ObjectMeta{Name: "pool1"},
+						Spec: v1beta1.IPAddressPoolSpec{
+							Addresses: []string{
+								"10.20.0.0/24",
+							},
+							ServiceAllocation: &v1beta1.ServiceAllocation{
+								Namespaces: []string{"ns1", "ns1"},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			desc: "pool with failover to a missing pool",
+			crs: ClusterResources{
+				Pools: []v1beta1.IPAddressPool{
+					{
+						ObjectMeta: v1.ObjectMeta{Name: "pool1"},
+						Spec: v1beta1.IPAddressPoolSpec{
+							Addresses: []string{
+								"10.20.0.0/24",
+							},
+							FailoverGroup: &v1beta1.FailoverGroupSpec{
+								BackupPool:        "backup",
+								FailoverCondition: "pool-exhausted",
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			desc: "pool with degraded failover without announcement timeout",
+			crs: ClusterResources{
+				Pools: []v1beta1.IPAddressPool{
+					{
+						ObjectMeta: v1.ObjectMeta{Name: "pool1"},
+						Spec: v1beta1.IPAddressPoolSpec{
+							Addresses: []string{
+								"10.20.0.0/24",
+							},
+							FailoverGroup: &v1beta1.FailoverGroupSpec{
+								BackupPool:        "backup",
+								FailoverCondition: "pool-degraded",
+							},
+						},
+					},
+					{
+						ObjectMeta: v1.ObjectMeta{Name: "backup"},
+						Spec: v1beta1.IPAddressPoolSpec{
+							Addresses: []string{
+								"10.30.0.0/24",
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			desc: "pool with active failover not manual",
+			crs: ClusterResources{
+				Pools: []v1beta1.IPAddressPool{
+					{
+						ObjectMeta: v1.ObjectMeta{Name: "pool1"},
+						Spec: v1beta1.IPAddressPoolSpec{
+							Addresses: []string{
+								"10.20.0.0/24",
+							},
+							FailoverGroup: &v1beta1.FailoverGroupSpec{
+								BackupPool:        "backup",
+								FailoverCondition: "pool-exhausted",
+								Active:            true,
+							},
+						},
+					},
+					{
+						ObjectMeta: v1.ObjectMeta{Name: "backup"},
+						Spec: v1beta1.IPAddressPoolSpec{
+							Addresses: []string{
+								"10.30.0.0/24",
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			desc: "pool with allocation hook",
+			crs: ClusterResources{
+				Pools: []v1beta1.IPAddressPool{
+					{
+						ObjectMeta: v1.ObjectMeta{Name: "pool1"},
+						Spec: v1beta1.IPAddressPoolSpec{
+							Addresses: []string{
+								"10.20.0.0/24",
+							},
+							AllocationHook: &v1beta1.AllocationHook{
+								URL:      "https://ipam.example.com/approve",
+								FailOpen: true,
+							},
+						},
+					},
+				},
+			},
+			want: &Config{
+				Pools: map[string]*Pool{
+					"pool1": {
+						AutoAssign: true,
+						CIDR:       []*net.IPNet{ipnet("10.20.0.0/24")},
+						AllocationHook: &HookConfig{
+							URL:      "https://ipam.example.com/approve",
+							Timeout:  5 * time.Second,
+							FailOpen: true,
+						},
+					},
+				},
+				BFDProfiles: map[string]*BFDProfile{},
+			},
+		},
+		{
+			desc: "pool with invalid allocation hook url",
+			crs: ClusterResources{
+				Pools: []v1beta1.IPAddressPool{
+					{
+						ObjectMeta: v1.ObjectMeta{Name: "pool1"},
+						Spec: v1beta1.IPAddressPoolSpec{
+							Addresses: []string{
+								"10.20.0.0/24",
+							},
+							AllocationHook: &v1beta1.AllocationHook{
+								URL: "ipam.example.com/approve",
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			desc: "pool with service annotations",
+			crs: ClusterResources{
+				Pools: []v1beta1.IPAddressPool{
+					{
+						ObjectMeta: v1.ObjectMeta{Name: "pool1"},
+						Spec: v1beta1.IPAddressPoolSpec{
+							Addresses: []string{
+								"10.20.0.0/24",
+							},
+							ServiceAnnotations: map[string]string{"team": "infra"},
+						},
+					},
+				},
+			},
+			want: &Config{
+				Pools: map[string]*Pool{
+					"pool1": {
+						AutoAssign:  true,
+						CIDR:        []*net.IPNet{ipnet("10.20.0.0/24")},
+						Annotations: map[string]string{"team": "infra"},
+					},
+				},
+				BFDProfiles: map[string]*BFDProfile{},
+			},
+		},
+		{
+			desc: "pool with prefixed service annotation",
+			crs: ClusterResources{
+				Pools: []v1beta1.IPAddressPool{
+					{
+						ObjectMeta: v1.ObjectMeta{Name: "pool1"},
+						Spec: v1beta1.IPAddressPoolSpec{
+							Addresses: []string{
+								"10.20.0.0/24",
+							},
+							ServiceAnnotations: map[string]string{"example.com/team": "infra"},
+						},
+					},
+				},
+			},
+		},
+		{
+			desc: "pool with negative reserved boundary IPs",
+			crs: ClusterResources{
+				Pools: []v1beta1.IPAddressPool{
+					{
+						ObjectMeta: v1.ObjectMeta{Name: "pool1"},
+						Spec: v1beta1.IPAddressPoolSpec{
+							Addresses: []string{
+								"10.20.0.0/24",
+							},
+							ReservedBoundaryIPs: -1,
+						},
+					},
+				},
+			},
+		},
+		{
+			desc: "auto split pool with invalid size",
+			crs: ClusterResources{
+				Pools: []v1beta1.IPAddressPool{
+					{
+						ObjectMeta: v1.ObjectMeta{Name: "pool1"},
+						Spec: v1beta1.IPAddressPoolSpec{
+							Addresses: []string{
+								"10.20.0.0/22",
+							},
+							AutoSplit:     true,
+							AutoSplitSize: 100,
+						},
+					},
+				},
+			},
+		},
+		{
+			desc: "auto split pool with too many sub ranges",
+			crs: ClusterResources{
+				Pools: []v1beta1.IPAddressPool{
+					{
+						ObjectMeta: v1.ObjectMeta{Name: "pool1"},
+						Spec: v1beta1.IPAddressPoolSpec{
+							Addresses: []string{
+								"2001:db8::/64",
+							},
+							AutoSplit: true,
+						},
+					},
+				},
+			},
+		},
+		{
+			desc: "pool with quotas",
+			crs: ClusterResources{
+				Pools: []v1beta1.IPAddressPool{
+					{
+						ObjectMeta: v1.ObjectMeta{Name: "pool1"},
+						Spec: v1beta1.IPAddressPoolSpec{
+							Addresses: []string{
+								"10.20.0.0/24",
+							},
+						},
+					},
+				},
+				Quotas: []v1beta1.NamespaceIPQuota{
+					{
+						ObjectMeta: v1.ObjectMeta{Name: "quota1"},
+						Spec: v1beta1.NamespaceIPQuotaSpec{
+							Namespace:        "ns1",
+							Pool:             "pool1",
+							MaxIPs:           4,
+							MaxIPsPerService: 2,
+						},
+					},
+					{
+						ObjectMeta: v1.ObjectMeta{Name: "quota2"},
+						Spec: v1beta1.NamespaceIPQuotaSpec{
+							Namespace: "ns2",
+							Pool:      "pool1",
+							MaxIPs:    1,
+						},
+					},
+				},
+			},
+			want: &Config{
+				Pools: map[string]*Pool{
+					"pool1": {
+						AutoAssign: true,
+						CIDR:       []*net.IPNet{ipnet("10.20.0.0/24")},
+						Quotas: map[string]*Quota{
+							"ns1": {
+								Name:             "quota1",
+								MaxIPs:           4,
+								MaxIPsPerService: 2,
+							},
+							"ns2": {
+								Name:   "quota2",
+								MaxIPs: 1,
+							},
+						},
+					},
+				},
+				BFDProfiles: map[string]*BFDProfile{},
+			},
+		},
+		{
+			desc: "quota referencing non existing pool",
+			crs: ClusterResources{
+				Pools: []v1beta1.IPAddressPool{
+					{
+						ObjectMeta: v1.ObjectMeta{Name: "pool1"},
+						Spec: v1beta1.IPAddressPoolSpec{
+							Addresses: []string{
+								"10.20.0.0/24",
+							},
+						},
+					},
+				},
+				Quotas: []v1beta1.NamespaceIPQuota{
+					{
+						ObjectMeta: v1.ObjectMeta{Name: "quota1"},
+						Spec: v1beta1.NamespaceIPQuotaSpec{
+							Namespace: "ns1",
+							Pool:      "pool2",
+						},
+					},
+				},
+			},
+		},
+		{
+			desc: "duplicate quota for namespace and pool",
+			crs: ClusterResources{
+				Pools: []v1beta1.IPAddressPool{
+					{
+						ObjectMeta: v1.ObjectMeta{Name: "pool1"},
+						Spec: v1beta1.IPAddressPoolSpec{
+							Addresses: []string{
+								"10.20.0.0/24",
+							},
+						},
+					},
+				},
+				Quotas: []v1beta1.NamespaceIPQuota{
+					{
+						ObjectMeta: v1.ObjectMeta{Name: "quota1"},
+						Spec: v1beta1.NamespaceIPQuotaSpec{
+							Namespace: "ns1",
+							Pool:      "pool1",
+						},
+					},
+					{
+						ObjectMeta: v1.ObjectMeta{Name: "quota2"},
+						Spec: v1beta1.NamespaceIPQuotaSpec{
+							Namespace: "ns1",
+							Pool:      "pool1",
+						},
+					},
+				},
+			},
+		},
+		{
+			desc: "quota with negative max ips",
+			crs: ClusterResources{
+				Pools: []v1beta1.IPAddressPool{
+					{
+						ObjectMeta: v1.ObjectMeta{Name: "pool1"},
+						Spec: v1beta1.IPAddressPoolSpec{
+							Addresses: []string{
+								"10.20.0.0/24",
+							},
+						},
+					},
+				},
+				Quotas: []v1beta1.NamespaceIPQuota{
+					{
+						ObjectMeta: v1.ObjectMeta{Name: "quota1"},
+						Spec: v1beta1.NamespaceIPQuotaSpec{
+							Namespace: "ns1",
+							Pool:      "pool1",
+							MaxIPs:    -1,
+						},
+					},
+				},
+			},
+		},
 		{
 			desc: "Session with default BFD Profile",
 			crs: ClusterResources{
@@ -1223,6 +2400,7 @@ func TestParse(t *testing.T) {
 						Addr:          net.ParseIP("1.2.3.4"),
 						HoldTime:      90 * time.Second,
 						KeepaliveTime: 30 * time.Second,
+						InitialJitter: 5 * time.Second,
 						NodeSelectors: []labels.Selector{labels.Everything()},
 						BFDProfile:    "default",
 					},
@@ -1332,6 +2510,7 @@ func TestParse(t *testing.T) {
 						Port:          179,
 						HoldTime:      90 * time.Second,
 						KeepaliveTime: 30 * time.Second,
+						InitialJitter: 5 * time.Second,
 						NodeSelectors: []labels.Selector{labels.Everything()},
 						BFDProfile:    "",
 						Password:      "nopass",
@@ -1615,6 +2794,7 @@ func TestParse(t *testing.T) {
 						Port:          1179,
 						HoldTime:      180 * time.Second,
 						KeepaliveTime: 60 * time.Second,
+						InitialJitter: 5 * time.Second,
 						RouterID:      net.ParseIP("10.20.30.40"),
 						NodeSelectors: []labels.Selector{labels.Everything()},
 						EBGPMultiHop:  true,
@@ -1851,6 +3031,7 @@ func TestParse(t *testing.T) {
 					"pool1": {
 						CIDR:       []*net.IPNet{ipnet("10.20.0.0/16")},
 						AutoAssign: true,
+						Labels:     map[string]string{"test": "pool1"},
 						BGPAdvertisements: []*BGPAdvertisement{
 							{
 								AggregationLength:   32,
@@ -1867,6 +3048,7 @@ func TestParse(t *testing.T) {
 					"pool2": {
 						CIDR:       []*net.IPNet{ipnet("30.0.0.0/16")},
 						AutoAssign: true,
+						Labels:     map[string]string{"test": "pool2"},
 						BGPAdvertisements: []*BGPAdvertisement{
 							{
 								AggregationLength:   32,
@@ -2085,12 +3267,14 @@ func TestParse(t *testing.T) {
 					"pool1": {
 						CIDR:              []*net.IPNet{ipnet("10.20.0.0/16")},
 						AutoAssign:        true,
+						Labels:            map[string]string{"test": "pool1"},
 						BGPAdvertisements: nil,
 						L2Advertisements:  nil,
 					},
 					"pool2": {
 						CIDR:              []*net.IPNet{ipnet("30.0.0.0/16")},
 						AutoAssign:        true,
+						Labels:            map[string]string{"test": "pool2"},
 						BGPAdvertisements: nil,
 						L2Advertisements:  nil,
 					},
@@ -2562,6 +3746,7 @@ func TestParse(t *testing.T) {
 						Addr:          net.ParseIP("1.2.3.4"),
 						HoldTime:      90 * time.Second,
 						KeepaliveTime: 30 * time.Second,
+						InitialJitter: 5 * time.Second,
 						NodeSelectors: []labels.Selector{labels.Everything()},
 						EBGPMultiHop:  false,
 					},
@@ -0,0 +1,167 @@
+// SPDX-License-Identifier:Apache-2.0
+
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// MergeStrategy is how MergeConfigsWithStrategy handles the attributes
+// set by several configurations.
+type MergeStrategy string
+
+const (
+	// MergeStrict reports any attribute set to different values as a
+	// conflict.
+	MergeStrict MergeStrategy = "strict"
+	// MergeLastWriteWins lets the later configurations override the
+	// keys of the pool annotations set by the earlier ones.
+	MergeLastWriteWins MergeStrategy = "last-write-wins"
+)
+
+// MergeConfigs merges the configurations into one, with the strict
+// strategy.
+func MergeConfigs(configs ...*Config) (*Config, error) {
+	return MergeConfigsWithStrategy(MergeStrict, configs...)
+}
+
+// MergeConfigsWithStrategy merges the configurations into one. The
+// pools, peers and BFD profiles defined by several configurations must
+// be identical, except for the annotations of the pools, which are
+// merged according to the strategy. The CIDRs of different pools must
+// not overlap. All the conflicts are reported in the returned error.
+func MergeConfigsWithStrategy(strategy MergeStrategy, configs ...*Config) (*Config, error) {
+	switch strategy {
+	case MergeStrict, MergeLastWriteWins:
+	default:
+		return nil, fmt.Errorf("unknown merge strategy %q", strategy)
+	}
+
+	res := &Config{
+		Pools:       map[string]*Pool{},
+		BFDProfiles: map[string]*BFDProfile{},
+	}
+	var conflicts []string
+	peers := map[string]*Peer{}
+	for _, c := range configs {
+		if c == nil {
+			continue
+		}
+		for _, name := range poolNames(c.Pools) {
+			p := c.Pools[name]
+			existing := res.Pools[name]
+			if existing == nil {
+				merged := *p
+				merged.Annotations = copyAnnotations(p.Annotations)
+				res.Pools[name] = &merged
+				continue
+			}
+			conflicts = append(conflicts, mergePool(strategy, name, existing, p)...)
+		}
+
+		for _, p := range c.Peers {
+			existing := peers[p.Name]
+			if existing == nil {
+				peers[p.Name] = p
+				res.Peers = append(res.Peers, p)
+				continue
+			}
+			if !reflect.DeepEqual(existing, p) {
+				conflicts = append(conflicts, fmt.Sprintf("peer %q is defined differently", p.Name))
+			}
+		}
+
+		for name, b := range c.BFDProfiles {
+			existing := res.BFDProfiles[name]
+			if existing == nil {
+				res.BFDProfiles[name] = b
+				continue
+			}
+			if !reflect.DeepEqual(existing, b) {
+				conflicts = append(conflicts, fmt.Sprintf("BFD profile %q is defined differently", name))
+			}
+		}
+	}
+
+	conflicts = append(conflicts, overlappingPools(res.Pools)...)
+	if len(conflicts) > 0 {
+		return nil, fmt.Errorf("conflicting configurations: %s", strings.Join(conflicts, "; "))
+	}
+	return res, nil
+}
+
+// mergePool merges the annotations of p into existing, and returns the
+// conflicts between the two definitions of the pool.
+func mergePool(strategy MergeStrategy, name string, existing, p *Pool) []string {
+	if !reflect.DeepEqual(existing.CIDR, p.CIDR) {
+		return []string{fmt.Sprintf("pool %q is defined with different CIDRs", name)}
+	}
+	a, b := *existing, *p
+	a.Annotations, b.Annotations = nil, nil
+	if !reflect.DeepEqual(a, b) {
+		return []string{fmt.Sprintf("pool %q is defined differently", name)}
+	}
+
+	keys := make([]string, 0, len(p.Annotations))
+	for k := range p.Annotations {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var conflicts []string
+	for _, k := range keys {
+		v := p.Annotations[k]
+		old, ok := existing.Annotations[k]
+		if ok && old != v && strategy == MergeStrict {
+			conflicts = append(conflicts, fmt.Sprintf("pool %q has different values for annotation %q", name, k))
+			continue
+		}
+		if existing.Annotations == nil {
+			existing.Annotations = map[string]string{}
+		}
+		existing.Annotations[k] = v
+	}
+	return conflicts
+}
+
+// overlappingPools returns the conflicts between the CIDRs of different
+// pools.
+func overlappingPools(pools map[string]*Pool) []string {
+	var conflicts []string
+	names := poolNames(pools)
+	for i, n1 := range names {
+		for _, n2 := range names[i+1:] {
+			for _, c1 := range pools[n1].CIDR {
+				for _, c2 := range pools[n2].CIDR {
+					if cidrsOverlap(c1, c2) {
+						conflicts = append(conflicts, fmt.Sprintf("CIDR %q in pool %q overlaps with CIDR %q in pool %q", c1, n1, c2, n2))
+					}
+				}
+			}
+		}
+	}
+	return conflicts
+}
+
+func copyAnnotations(annotations map[string]string) map[string]string {
+	if annotations == nil {
+		return nil
+	}
+	res := make(map[string]string, len(annotations))
+	for k, v := range annotations {
+		res[k] = v
+	}
+	return res
+}
+
+func poolNames(pools map[string]*Pool) []string {
+	res := make([]string, 0, len(pools))
+	for k := range pools {
+		res = append(res, k)
+	}
+	sort.Strings(res)
+	return res
+}
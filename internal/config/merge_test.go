@@ -0,0 +1,168 @@
+// SPDX-License-Identifier:Apache-2.0
+
+package config
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMergeConfigs(t *testing.T) {
+	pool := func(cidr string, annotations map[string]string) *Pool {
+		return &Pool{
+			AutoAssign:  true,
+			CIDR:        []*net.IPNet{ipnet(cidr)},
+			Annotations: annotations,
+		}
+	}
+
+	tests := []struct {
+		desc      string
+		strategy  MergeStrategy
+		configs   []*Config
+		want      *Config
+		wantError []string
+	}{
+		{
+			desc:     "disjoint configs",
+			strategy: MergeStrict,
+			configs: []*Config{
+				{
+					Pools: map[string]*Pool{"pool1": pool("10.20.0.0/24", nil)},
+					Peers: []*Peer{{Name: "peer1", ASN: 64500}},
+				},
+				{
+					Pools:       map[string]*Pool{"pool2": pool("10.30.0.0/24", nil)},
+					BFDProfiles: map[string]*BFDProfile{"bfd1": {Name: "bfd1"}},
+				},
+			},
+			want: &Config{
+				Pools: map[string]*Pool{
+					"pool1": pool("10.20.0.0/24", nil),
+					"pool2": pool("10.30.0.0/24", nil),
+				},
+				Peers:       []*Peer{{Name: "peer1", ASN: 64500}},
+				BFDProfiles: map[string]*BFDProfile{"bfd1": {Name: "bfd1"}},
+			},
+		},
+		{
+			desc:     "same pool, merged annotations",
+			strategy: MergeStrict,
+			configs: []*Config{
+				{Pools: map[string]*Pool{"pool1": pool("10.20.0.0/24", map[string]string{"team": "infra"})}},
+				{Pools: map[string]*Pool{"pool1": pool("10.20.0.0/24", map[string]string{"team": "infra", "env": "prod"})}},
+			},
+			want: &Config{
+				Pools: map[string]*Pool{
+					"pool1": pool("10.20.0.0/24", map[string]string{"team": "infra", "env": "prod"}),
+				},
+				BFDProfiles: map[string]*BFDProfile{},
+			},
+		},
+		{
+			desc:     "conflicting annotations, strict",
+			strategy: MergeStrict,
+			configs: []*Config{
+				{Pools: map[string]*Pool{"pool1": pool("10.20.0.0/24", map[string]string{"team": "infra"})}},
+				{Pools: map[string]*Pool{"pool1": pool("10.20.0.0/24", map[string]string{"team": "apps"})}},
+			},
+			wantError: []string{`pool "pool1" has different values for annotation "team"`},
+		},
+		{
+			desc:     "conflicting annotations, last write wins",
+			strategy: MergeLastWriteWins,
+			configs: []*Config{
+				{Pools: map[string]*Pool{"pool1": pool("10.20.0.0/24", map[string]string{"team": "infra", "env": "prod"})}},
+				{Pools: map[string]*Pool{"pool1": pool("10.20.0.0/24", map[string]string{"team": "apps"})}},
+			},
+			want: &Config{
+				Pools: map[string]*Pool{
+					"pool1": pool("10.20.0.0/24", map[string]string{"team": "apps", "env": "prod"}),
+				},
+				BFDProfiles: map[string]*BFDProfile{},
+			},
+		},
+		{
+			desc:     "all the conflicts are reported",
+			strategy: MergeLastWriteWins,
+			configs: []*Config{
+				{
+					Pools: map[string]*Pool{
+						"pool1": pool("10.20.0.0/24", nil),
+						"pool2": pool("10.30.0.0/24", nil),
+					},
+					Peers: []*Peer{{Name: "peer1", ASN: 64500}},
+				},
+				{
+					Pools: map[string]*Pool{
+						"pool1": pool("10.40.0.0/24", nil),
+						"pool3": pool("10.30.0.128/25", nil),
+					},
+					Peers: []*Peer{{Name: "peer1", ASN: 64501}},
+				},
+			},
+			wantError: []string{
+				`pool "pool1" is defined with different CIDRs`,
+				`CIDR "10.30.0.0/24" in pool "pool2" overlaps with CIDR "10.30.0.128/25" in pool "pool3"`,
+				`peer "peer1" is defined differently`,
+			},
+		},
+		{
+			desc:     "same pool, different attributes",
+			strategy: MergeLastWriteWins,
+			configs: []*Config{
+				{Pools: map[string]*Pool{"pool1": pool("10.20.0.0/24", nil)}},
+				{Pools: map[string]*Pool{"pool1": {CIDR: []*net.IPNet{ipnet("10.20.0.0/24")}}}},
+			},
+			wantError: []string{`pool "pool1" is defined differently`},
+		},
+		{
+			desc:      "unknown strategy",
+			strategy:  "first-write-wins",
+			wantError: []string{`unknown merge strategy "first-write-wins"`},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			got, err := MergeConfigsWithStrategy(test.strategy, test.configs...)
+			if len(test.wantError) > 0 {
+				if err == nil {
+					t.Fatalf("expected an error, got %v", got)
+				}
+				for _, e := range test.wantError {
+					if !strings.Contains(err.Error(), e) {
+						t.Fatalf("error %q does not contain %q", err, e)
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if diff := cmp.Diff(test.want, got, cmp.AllowUnexported(Pool{})); diff != "" {
+				t.Fatalf("unexpected config (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestMergeConfigsDoesNotModifyInputs(t *testing.T) {
+	first := &Config{Pools: map[string]*Pool{"pool1": {
+		CIDR:        []*net.IPNet{ipnet("10.20.0.0/24")},
+		Annotations: map[string]string{"team": "infra"},
+	}}}
+	second := &Config{Pools: map[string]*Pool{"pool1": {
+		CIDR:        []*net.IPNet{ipnet("10.20.0.0/24")},
+		Annotations: map[string]string{"env": "prod"},
+	}}}
+	if _, err := MergeConfigs(first, second); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if diff := cmp.Diff(map[string]string{"team": "infra"}, first.Pools["pool1"].Annotations); diff != "" {
+		t.Fatalf("the first config was modified (-want +got):\n%s", diff)
+	}
+}
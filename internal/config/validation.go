@@ -30,28 +30,19 @@ func DiscardFRROnly(c ClusterResources) error {
 		if p.Spec.KeepaliveTime.Duration != 0 {
 			return fmt.Errorf("peer %s has keepalive-time set on native bgp mode", p.Spec.Address)
 		}
+		if p.Spec.FlowLabelECMP {
+			return fmt.Errorf("peer %s has flow-label-ecmp set on native bgp mode", p.Spec.Address)
+		}
+		if p.Spec.EnableGracefulRestart {
+			return fmt.Errorf("peer %s has graceful-restart set on native bgp mode", p.Spec.Address)
+		}
+		if p.Spec.VRFName != "" {
+			return fmt.Errorf("peer %s has vrf set on native bgp mode", p.Spec.Address)
+		}
 	}
 	if len(c.BFDProfiles) > 0 {
 		return errors.New("bfd profiles section set")
 	}
-	if len(c.BGPAdvs) == 0 {
-		return nil
-	}
-	// we check for ipv6 addresses if we have at least one bgp advertisement, as it's
-	// not supported in native mode.
-	for _, p := range c.Pools {
-		for _, cidr := range p.Spec.Addresses {
-			nets, err := ParseCIDR(cidr)
-			if err != nil {
-				return fmt.Errorf("invalid CIDR %q in pool %q: %s", cidr, p.Name, err)
-			}
-			for _, n := range nets {
-				if n.IP.To4() == nil {
-					return fmt.Errorf("pool %q has ipv6 CIDR %s, native bgp mode does not support ipv6", p.Name, n)
-				}
-			}
-		}
-	}
 	return nil
 }
 
@@ -64,6 +55,17 @@ func DontValidate(c ClusterResources) error {
 // DiscardNativeOnly returns an error if the current configFile contains
 // any options that are available only in the native implementation.
 func DiscardNativeOnly(c ClusterResources) error {
+	for _, p := range c.Peers {
+		if p.Spec.SessionWatchdogTimeout != nil && p.Spec.SessionWatchdogTimeout.Duration != 0 {
+			return fmt.Errorf("peer %s has sessionWatchdogTimeout set on frr bgp mode", p.Spec.Address)
+		}
+		if p.Spec.InitialDelay != nil && p.Spec.InitialDelay.Duration != 0 {
+			return fmt.Errorf("peer %s has initialDelay set on frr bgp mode", p.Spec.Address)
+		}
+		if p.Spec.InitialJitter != nil && p.Spec.InitialJitter.Duration != 0 {
+			return fmt.Errorf("peer %s has initialJitter set on frr bgp mode", p.Spec.Address)
+		}
+	}
 	if len(c.Peers) > 1 {
 		peerAddr := make(map[string]bool)
 		myAsn := c.Peers[0].Spec.MyASN
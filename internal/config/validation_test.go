@@ -67,6 +67,48 @@ func TestValidate(t *testing.T) {
 					},
 				},
 			},
+			mustFail: false,
+		},
+		{
+			desc: "flow label ecmp",
+			config: ClusterResources{
+				Peers: []v1beta2.BGPPeer{
+					{
+						Spec: v1beta2.BGPPeerSpec{
+							Address:       "1.2.3.4",
+							FlowLabelECMP: true,
+						},
+					},
+				},
+			},
+			mustFail: true,
+		},
+		{
+			desc: "graceful restart",
+			config: ClusterResources{
+				Peers: []v1beta2.BGPPeer{
+					{
+						Spec: v1beta2.BGPPeerSpec{
+							Address:               "1.2.3.4",
+							EnableGracefulRestart: true,
+						},
+					},
+				},
+			},
+			mustFail: true,
+		},
+		{
+			desc: "vrf",
+			config: ClusterResources{
+				Peers: []v1beta2.BGPPeer{
+					{
+						Spec: v1beta2.BGPPeerSpec{
+							Address: "1.2.3.4",
+							VRFName: "red",
+						},
+					},
+				},
+			},
 			mustFail: true,
 		},
 		{
@@ -268,6 +310,48 @@ func TestValidateFRR(t *testing.T) {
 			},
 			mustFail: true,
 		},
+		{
+			desc: "session watchdog timeout set",
+			config: ClusterResources{
+				Peers: []v1beta2.BGPPeer{
+					{
+						Spec: v1beta2.BGPPeerSpec{
+							Address:                "1.2.3.4",
+							SessionWatchdogTimeout: &v1.Duration{Duration: 5 * time.Minute},
+						},
+					},
+				},
+			},
+			mustFail: true,
+		},
+		{
+			desc: "initial delay set",
+			config: ClusterResources{
+				Peers: []v1beta2.BGPPeer{
+					{
+						Spec: v1beta2.BGPPeerSpec{
+							Address:      "1.2.3.4",
+							InitialDelay: &v1.Duration{Duration: 10 * time.Second},
+						},
+					},
+				},
+			},
+			mustFail: true,
+		},
+		{
+			desc: "initial jitter set",
+			config: ClusterResources{
+				Peers: []v1beta2.BGPPeer{
+					{
+						Spec: v1beta2.BGPPeerSpec{
+							Address:       "1.2.3.4",
+							InitialJitter: &v1.Duration{Duration: 10 * time.Second},
+						},
+					},
+				},
+			},
+			mustFail: true,
+		},
 	}
 
 	for _, test := range tests {
@@ -83,3 +83,19 @@ func ForService(svc *v1.Service) (Family, error) {
 	addresses := []string{svc.Spec.ClusterIP}
 	return ForAddresses(addresses)
 }
+
+// ForNode returns the address family of the primary InternalIP of a
+// given node, or Unknown if the node has none.
+func ForNode(node *v1.Node) Family {
+	for _, a := range node.Status.Addresses {
+		if a.Type != v1.NodeInternalIP {
+			continue
+		}
+		ip := net.ParseIP(a.Address)
+		if ip == nil {
+			continue
+		}
+		return ForAddress(ip)
+	}
+	return Unknown
+}
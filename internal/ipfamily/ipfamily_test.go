@@ -5,6 +5,8 @@ package ipfamily
 import (
 	"net"
 	"testing"
+
+	v1 "k8s.io/api/core/v1"
 )
 
 func TestIPFamilyForAddresses(t *testing.T) {
@@ -179,6 +181,49 @@ func TestIPFamilyForAddress(t *testing.T) {
 	}
 }
 
+func TestIPFamilyForNode(t *testing.T) {
+	tests := []struct {
+		desc      string
+		addresses []v1.NodeAddress
+		family    Family
+	}{
+		{
+			desc: "ipv4 node",
+			addresses: []v1.NodeAddress{
+				{Type: v1.NodeHostName, Address: "node1"},
+				{Type: v1.NodeInternalIP, Address: "10.0.0.1"},
+			},
+			family: IPv4,
+		},
+		{
+			desc: "ipv6 primary on dual stack node",
+			addresses: []v1.NodeAddress{
+				{Type: v1.NodeExternalIP, Address: "1.2.3.4"},
+				{Type: v1.NodeInternalIP, Address: "fc00::1"},
+				{Type: v1.NodeInternalIP, Address: "10.0.0.1"},
+			},
+			family: IPv6,
+		},
+		{
+			desc: "no internal ip",
+			addresses: []v1.NodeAddress{
+				{Type: v1.NodeExternalIP, Address: "1.2.3.4"},
+			},
+			family: Unknown,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			node := &v1.Node{Status: v1.NodeStatus{Addresses: test.addresses}}
+			family := ForNode(node)
+			if family != test.family {
+				t.Fatalf("Expected family %s, got %s", test.family, family)
+			}
+		})
+	}
+}
+
 func ipnet(s string) *net.IPNet {
 	_, n, err := net.ParseCIDR(s)
 	if err != nil {
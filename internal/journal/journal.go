@@ -0,0 +1,259 @@
+// SPDX-License-Identifier:Apache-2.0
+
+package journal // import "go.universe.tf/metallb/internal/journal"
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Op is the kind of operation recorded by a journal entry.
+type Op string
+
+const (
+	// OpAssign records IPs being assigned to a service.
+	OpAssign Op = "assign"
+	// OpClear records a service releasing its IPs.
+	OpClear Op = "clear"
+)
+
+// DefaultMaxEntries is the number of entries after which the journal is
+// compacted.
+const DefaultMaxEntries = 1000
+
+// Entry is a single allocation operation.
+type Entry struct {
+	Op      Op        `json:"op"`
+	Service string    `json:"service"`
+	IPs     []string  `json:"ips,omitempty"`
+	Time    time.Time `json:"time"`
+}
+
+// Store persists the serialized journal.
+type Store interface {
+	// Load returns the persisted journal, or nil if there is none.
+	Load() ([]byte, error)
+	// Save replaces the persisted journal with data.
+	Save(data []byte) error
+}
+
+// Journal is an append-only log of the IP allocation operations, which
+// can be replayed to recover the IPs assigned to each service.
+//
+// A nil *Journal is valid and records nothing.
+type Journal struct {
+	sync.Mutex
+	store      Store
+	entries    []Entry
+	maxEntries int
+	now        func() time.Time
+}
+
+// New returns a Journal persisted to store, loaded with the entries
+// already in it.
+func New(store Store, maxEntries int) (*Journal, error) {
+	data, err := store.Load()
+	if err != nil {
+		return nil, fmt.Errorf("loading journal: %w", err)
+	}
+	entries, err := decode(data)
+	if err != nil {
+		return nil, fmt.Errorf("decoding journal: %w", err)
+	}
+	return &Journal{
+		store:      store,
+		entries:    entries,
+		maxEntries: maxEntries,
+		now:        time.Now,
+	}, nil
+}
+
+// Assign records the given IPs being assigned to svc.
+func (j *Journal) Assign(svc string, ips []net.IP) error {
+	if j == nil {
+		return nil
+	}
+	e := Entry{Op: OpAssign, Service: svc}
+	for _, ip := range ips {
+		e.IPs = append(e.IPs, ip.String())
+	}
+	return j.record(e)
+}
+
+// Clear records svc releasing its IPs.
+func (j *Journal) Clear(svc string) error {
+	if j == nil {
+		return nil
+	}
+	return j.record(Entry{Op: OpClear, Service: svc})
+}
+
+// Prune records the release of the IPs of the services for which
+// exists returns false, among the ones the journal assigned IPs to
+// before the given time. It returns the pruned services.
+func (j *Journal) Prune(exists func(svc string) bool, before time.Time) ([]string, error) {
+	if j == nil {
+		return nil, nil
+	}
+	j.Lock()
+	defer j.Unlock()
+	lastAssign := map[string]time.Time{}
+	for _, e := range j.entries {
+		if e.Op == OpAssign {
+			lastAssign[e.Service] = e.Time
+		}
+	}
+	var pruned []string
+	for svc := range replayJournal(j.entries) {
+		// A service assigned IPs in the meanwhile may be missing from
+		// the services listed before.
+		if !lastAssign[svc].Before(before) || exists(svc) {
+			continue
+		}
+		pruned = append(pruned, svc)
+	}
+	if len(pruned) == 0 {
+		return nil, nil
+	}
+	sort.Strings(pruned)
+
+	entries := make([]Entry, 0, len(pruned))
+	for _, svc := range pruned {
+		entries = append(entries, Entry{Op: OpClear, Service: svc})
+	}
+	if err := j.recordLocked(entries...); err != nil {
+		return nil, err
+	}
+	return pruned, nil
+}
+
+// IPs returns the IPs that the journal says are assigned to svc.
+func (j *Journal) IPs(svc string) []net.IP {
+	if j == nil {
+		return nil
+	}
+	j.Lock()
+	defer j.Unlock()
+	return replayJournal(j.entries)[svc]
+}
+
+// State returns the IPs assigned to each service, as reconstructed by
+// replaying the journal.
+func (j *Journal) State() map[string][]net.IP {
+	if j == nil {
+		return map[string][]net.IP{}
+	}
+	j.Lock()
+	defer j.Unlock()
+	return replayJournal(j.entries)
+}
+
+func (j *Journal) record(e Entry) error {
+	j.Lock()
+	defer j.Unlock()
+	return j.recordLocked(e)
+}
+
+// recordLocked appends the entries to the journal and saves it. The
+// journal must be locked.
+func (j *Journal) recordLocked(es ...Entry) error {
+	now := j.now()
+	entries := j.entries
+	for _, e := range es {
+		e.Time = now
+		entries = append(entries, e)
+	}
+	if j.maxEntries > 0 && len(entries) > j.maxEntries {
+		entries = compact(entries, now)
+	}
+	data, err := encode(entries)
+	if err != nil {
+		return err
+	}
+	if err := j.store.Save(data); err != nil {
+		return fmt.Errorf("saving journal: %w", err)
+	}
+	j.entries = entries
+	return nil
+}
+
+// replayJournal applies the entries in order and returns the IPs each
+// service ends up with.
+func replayJournal(entries []Entry) map[string][]net.IP {
+	res := map[string][]net.IP{}
+	for _, e := range entries {
+		switch e.Op {
+		case OpAssign:
+			ips := make([]net.IP, 0, len(e.IPs))
+			for _, s := range e.IPs {
+				if ip := net.ParseIP(s); ip != nil {
+					ips = append(ips, ip)
+				}
+			}
+			res[e.Service] = ips
+		case OpClear:
+			delete(res, e.Service)
+		}
+	}
+	return res
+}
+
+// compact replaces the entries with the minimal set of assignments
+// leading to the same state.
+func compact(entries []Entry, now time.Time) []Entry {
+	state := replayJournal(entries)
+	svcs := make([]string, 0, len(state))
+	for svc := range state {
+		svcs = append(svcs, svc)
+	}
+	sort.Strings(svcs)
+
+	res := make([]Entry, 0, len(svcs))
+	for _, svc := range svcs {
+		e := Entry{Op: OpAssign, Service: svc, Time: now}
+		for _, ip := range state[svc] {
+			e.IPs = append(e.IPs, ip.String())
+		}
+		res = append(res, e)
+	}
+	return res
+}
+
+// encode serializes the entries as JSON lines.
+func encode(entries []Entry) ([]byte, error) {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			return nil, err
+		}
+	}
+	return b.Bytes(), nil
+}
+
+func decode(data []byte) ([]Entry, error) {
+	var res []Entry
+	s := bufio.NewScanner(bytes.NewReader(data))
+	s.Buffer(make([]byte, 0, 64*1024), len(data)+1)
+	for s.Scan() {
+		line := bytes.TrimSpace(s.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(line, &e); err != nil {
+			return nil, err
+		}
+		res = append(res, e)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
@@ -0,0 +1,177 @@
+// SPDX-License-Identifier:Apache-2.0
+
+package journal
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+type memStore struct {
+	data []byte
+	err  error
+}
+
+func (s *memStore) Load() ([]byte, error) {
+	return s.data, nil
+}
+
+func (s *memStore) Save(data []byte) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.data = data
+	return nil
+}
+
+func ips(s ...string) []net.IP {
+	var res []net.IP
+	for _, ip := range s {
+		res = append(res, net.ParseIP(ip))
+	}
+	return res
+}
+
+func TestJournalReplay(t *testing.T) {
+	store := &memStore{}
+	j, err := New(store, DefaultMaxEntries)
+	if err != nil {
+		t.Fatalf("New: %s", err)
+	}
+
+	for _, step := range []func() error{
+		func() error { return j.Assign("ns/s1", ips("1.2.3.4")) },
+		func() error { return j.Assign("ns/s2", ips("1.2.3.5", "1000::5")) },
+		func() error { return j.Assign("ns/s3", ips("1.2.3.6")) },
+		func() error { return j.Clear("ns/s3") },
+		func() error { return j.Assign("ns/s1", ips("1.2.3.7")) },
+	} {
+		if err := step(); err != nil {
+			t.Fatalf("recording entry: %s", err)
+		}
+	}
+
+	want := map[string][]net.IP{
+		"ns/s1": ips("1.2.3.7"),
+		"ns/s2": ips("1.2.3.5", "1000::5"),
+	}
+	if diff := cmp.Diff(want, j.State()); diff != "" {
+		t.Errorf("wrong state (-want +got)\n%s", diff)
+	}
+
+	// A new journal on the same store recovers the same state.
+	reloaded, err := New(store, DefaultMaxEntries)
+	if err != nil {
+		t.Fatalf("New: %s", err)
+	}
+	if diff := cmp.Diff(want, reloaded.State()); diff != "" {
+		t.Errorf("wrong state after reload (-want +got)\n%s", diff)
+	}
+	if diff := cmp.Diff(ips("1.2.3.5", "1000::5"), reloaded.IPs("ns/s2")); diff != "" {
+		t.Errorf("wrong IPs for ns/s2 (-want +got)\n%s", diff)
+	}
+	if got := reloaded.IPs("ns/s3"); got != nil {
+		t.Errorf("cleared service ns/s3 has IPs %v", got)
+	}
+}
+
+func TestJournalCompaction(t *testing.T) {
+	store := &memStore{}
+	j, err := New(store, 3)
+	if err != nil {
+		t.Fatalf("New: %s", err)
+	}
+	for i := 0; i < 10; i++ {
+		if err := j.Assign("ns/s1", ips("1.2.3.4")); err != nil {
+			t.Fatalf("Assign: %s", err)
+		}
+		if err := j.Clear("ns/s1"); err != nil {
+			t.Fatalf("Clear: %s", err)
+		}
+	}
+	if err := j.Assign("ns/s2", ips("1.2.3.5")); err != nil {
+		t.Fatalf("Assign: %s", err)
+	}
+	if len(j.entries) > 3 {
+		t.Errorf("journal not compacted, %d entries", len(j.entries))
+	}
+	want := map[string][]net.IP{
+		"ns/s2": ips("1.2.3.5"),
+	}
+	if diff := cmp.Diff(want, j.State()); diff != "" {
+		t.Errorf("wrong state after compaction (-want +got)\n%s", diff)
+	}
+}
+
+func TestJournalPrune(t *testing.T) {
+	store := &memStore{}
+	j, err := New(store, DefaultMaxEntries)
+	if err != nil {
+		t.Fatalf("New: %s", err)
+	}
+	now := time.Now()
+	j.now = func() time.Time { return now }
+	for _, svc := range []string{"ns/s1", "ns/s2", "ns/s3"} {
+		if err := j.Assign(svc, ips("1.2.3.4")); err != nil {
+			t.Fatalf("Assign: %s", err)
+		}
+	}
+	listed := now.Add(time.Second)
+	// ns/s4 is assigned IPs after the services were listed.
+	now = now.Add(2 * time.Second)
+	if err := j.Assign("ns/s4", ips("1.2.3.5")); err != nil {
+		t.Fatalf("Assign: %s", err)
+	}
+
+	exists := map[string]bool{"ns/s2": true}
+	pruned, err := j.Prune(func(svc string) bool { return exists[svc] }, listed)
+	if err != nil {
+		t.Fatalf("Prune: %s", err)
+	}
+	if diff := cmp.Diff([]string{"ns/s1", "ns/s3"}, pruned); diff != "" {
+		t.Errorf("wrong pruned services (-want +got)\n%s", diff)
+	}
+	want := map[string][]net.IP{
+		"ns/s2": ips("1.2.3.4"),
+		"ns/s4": ips("1.2.3.5"),
+	}
+	reloaded, err := New(store, DefaultMaxEntries)
+	if err != nil {
+		t.Fatalf("New: %s", err)
+	}
+	if diff := cmp.Diff(want, reloaded.State()); diff != "" {
+		t.Errorf("wrong state after pruning (-want +got)\n%s", diff)
+	}
+}
+
+func TestJournalSaveFailure(t *testing.T) {
+	store := &memStore{}
+	j, err := New(store, DefaultMaxEntries)
+	if err != nil {
+		t.Fatalf("New: %s", err)
+	}
+	store.err = errors.New("boom")
+	if err := j.Assign("ns/s1", ips("1.2.3.4")); err == nil {
+		t.Fatalf("Assign did not fail")
+	}
+	if got := j.IPs("ns/s1"); got != nil {
+		t.Errorf("failed entry was recorded, ns/s1 has IPs %v", got)
+	}
+}
+
+func TestNilJournal(t *testing.T) {
+	var j *Journal
+	if err := j.Assign("ns/s1", ips("1.2.3.4")); err != nil {
+		t.Fatalf("Assign: %s", err)
+	}
+	if err := j.Clear("ns/s1"); err != nil {
+		t.Fatalf("Clear: %s", err)
+	}
+	if got := j.IPs("ns/s1"); got != nil {
+		t.Errorf("nil journal returned IPs %v", got)
+	}
+}
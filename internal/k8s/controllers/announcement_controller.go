@@ -0,0 +1,76 @@
+// SPDX-License-Identifier:Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"net"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// The reason of the events the speakers raise on the services they
+// announce.
+const reasonNodeAssigned = "nodeAssigned"
+
+// AnnouncementReconciler watches the events raised by the speakers when
+// they announce a service, and sends the IPs of the service to
+// Announced.
+type AnnouncementReconciler struct {
+	client.Client
+	Logger    log.Logger
+	Scheme    *runtime.Scheme
+	Announced chan<- net.IP
+}
+
+func (r *AnnouncementReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	level.Debug(r.Logger).Log("controller", "AnnouncementReconciler", "start reconcile", req.NamespacedName.String())
+	defer level.Debug(r.Logger).Log("controller", "AnnouncementReconciler", "end reconcile", req.NamespacedName.String())
+
+	var ev v1.Event
+	if err := r.Get(ctx, req.NamespacedName, &ev); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	var svc v1.Service
+	key := types.NamespacedName{Namespace: ev.InvolvedObject.Namespace, Name: ev.InvolvedObject.Name}
+	if err := r.Get(ctx, key, &svc); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	for _, ingress := range svc.Status.LoadBalancer.Ingress {
+		ip := net.ParseIP(ingress.IP)
+		if ip == nil {
+			continue
+		}
+		select {
+		case r.Announced <- ip:
+		case <-ctx.Done():
+			return ctrl.Result{}, ctx.Err()
+		}
+	}
+	return ctrl.Result{}, nil
+}
+
+func (r *AnnouncementReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	p := predicate.NewPredicateFuncs(
+		func(obj client.Object) bool {
+			ev, ok := obj.(*v1.Event)
+			if !ok {
+				level.Error(r.Logger).Log("controller", "AnnouncementReconciler", "error", "object is not event", "name", obj.GetName())
+				return false
+			}
+			return ev.Reason == reasonNodeAssigned && ev.InvolvedObject.Kind == "Service"
+		})
+
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&v1.Event{}).
+		WithEventFilter(p).
+		Complete(r)
+}
@@ -0,0 +1,86 @@
+// SPDX-License-Identifier:Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestAnnouncementController(t *testing.T) {
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "svc", Namespace: testNamespace},
+		Status: corev1.ServiceStatus{
+			LoadBalancer: corev1.LoadBalancerStatus{
+				Ingress: []corev1.LoadBalancerIngress{{IP: "1.2.3.4"}, {IP: "1000::1"}},
+			},
+		},
+	}
+	event := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{Name: "svc.1", Namespace: testNamespace},
+		InvolvedObject: corev1.ObjectReference{
+			Kind:      "Service",
+			Namespace: testNamespace,
+			Name:      "svc",
+		},
+		Reason: reasonNodeAssigned,
+	}
+	tests := []struct {
+		desc        string
+		initObjects []client.Object
+		want        []string
+	}{
+		{
+			desc:        "announced service",
+			initObjects: []client.Object{svc, event},
+			want:        []string{"1.2.3.4", "1000::1"},
+		},
+		{
+			desc:        "deleted service",
+			initObjects: []client.Object{event},
+		},
+		{
+			desc:        "deleted event",
+			initObjects: []client.Object{svc},
+		},
+	}
+	for _, test := range tests {
+		fakeClient, err := newFakeClient(test.initObjects)
+		if err != nil {
+			t.Fatalf("test %s failed to create fake client: %v", test.desc, err)
+		}
+		announced := make(chan net.IP, 10)
+		r := &AnnouncementReconciler{
+			Client:    fakeClient,
+			Logger:    log.NewNopLogger(),
+			Scheme:    scheme,
+			Announced: announced,
+		}
+		req := reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Namespace: testNamespace,
+				Name:      "svc.1",
+			},
+		}
+		if _, err := r.Reconcile(context.TODO(), req); err != nil {
+			t.Errorf("test %s failed: reconcile failed: %v", test.desc, err)
+		}
+		close(announced)
+		var got []string
+		for ip := range announced {
+			got = append(got, ip.String())
+		}
+		if diff := cmp.Diff(test.want, got); diff != "" {
+			t.Errorf("test %s failed: unexpected announced IPs (-want +got)\n%s", test.desc, diff)
+		}
+	}
+}
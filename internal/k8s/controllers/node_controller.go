@@ -23,6 +23,7 @@ import (
 	"github.com/go-kit/log/level"
 
 	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -36,6 +37,12 @@ type NodeReconciler struct {
 	NodeName  string
 	Namespace string
 	Handler   func(log.Logger, *v1.Node) SyncState
+	// DeleteHandler, if not nil, is called with the name of the nodes
+	// that are deleted.
+	DeleteHandler func(log.Logger, string) SyncState
+	// ForceReload, if not nil, reprocesses all the services when the
+	// handler asks for it.
+	ForceReload func()
 }
 
 func (r *NodeReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
@@ -43,18 +50,30 @@ func (r *NodeReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.
 	defer level.Info(r.Logger).Log("controller", "NodeReconciler", "end reconcile", req.NamespacedName.String())
 
 	var n v1.Node
+	var res SyncState
 	err := r.Get(ctx, req.NamespacedName, &n)
-	if err != nil {
-		return ctrl.Result{}, client.IgnoreNotFound(err)
+	switch {
+	case apierrors.IsNotFound(err):
+		if r.DeleteHandler == nil {
+			return ctrl.Result{}, nil
+		}
+		res = r.DeleteHandler(r.Logger, req.Name)
+	case err != nil:
+		return ctrl.Result{}, err
+	default:
+		res = r.Handler(r.Logger, &n)
 	}
 
-	res := r.Handler(r.Logger, &n)
 	switch res {
 	case SyncStateError:
 		return ctrl.Result{}, retryError
 	case SyncStateReprocessAll:
-		level.Error(r.Logger).Log("controller", "NodeReconciler", "error", "unexpected result reprocess all")
-		return ctrl.Result{}, nil
+		if r.ForceReload == nil {
+			level.Error(r.Logger).Log("controller", "NodeReconciler", "error", "unexpected result reprocess all")
+			return ctrl.Result{}, nil
+		}
+		level.Info(r.Logger).Log("controller", "NodeReconciler", "event", "force service reload")
+		r.ForceReload()
 	case SyncStateErrorNoRetry:
 		return ctrl.Result{}, nil
 	}
@@ -69,7 +88,8 @@ func (r *NodeReconciler) SetupWithManager(mgr ctrl.Manager) error {
 				level.Error(r.Logger).Log("controller", "NodeReconciler", "error", "object is not node", "name", obj.GetName())
 				return false
 			}
-			return node.Name == r.NodeName
+			// An empty NodeName means we are interested in all the nodes.
+			return r.NodeName == "" || node.Name == r.NodeName
 		})
 
 	return ctrl.NewControllerManagedBy(mgr).
@@ -43,6 +43,8 @@ func TestNodeController(t *testing.T) {
 		handlerRes           SyncState
 		expectReconcileFails bool
 		initObjects          []client.Object
+		forceReload          bool
+		expectDelete         bool
 	}{
 		{
 			desc:                 "handler returns SyncStateSuccess",
@@ -68,6 +70,25 @@ func TestNodeController(t *testing.T) {
 			initObjects:          []client.Object{testNode},
 			expectReconcileFails: false,
 		},
+		{
+			desc:                 "handler returns SyncStateReprocessAll with force reload",
+			handlerRes:           SyncStateReprocessAll,
+			initObjects:          []client.Object{testNode},
+			expectReconcileFails: false,
+			forceReload:          true,
+		},
+		{
+			desc:                 "node deleted, delete handler returns SyncStateSuccess",
+			handlerRes:           SyncStateSuccess,
+			expectReconcileFails: false,
+			expectDelete:         true,
+		},
+		{
+			desc:                 "node deleted, delete handler returns SyncStateError",
+			handlerRes:           SyncStateError,
+			expectReconcileFails: true,
+			expectDelete:         true,
+		},
 	}
 	for _, test := range tests {
 		fakeClient, err := newFakeClient(test.initObjects)
@@ -75,6 +96,15 @@ func TestNodeController(t *testing.T) {
 			t.Fatalf("test %s failed to create fake client: %v", test.desc, err)
 		}
 
+		calledDelete := false
+		mockDeleteHandler := func(l log.Logger, name string) SyncState {
+			calledDelete = true
+			if name != testNodeName {
+				t.Errorf("test %s failed, delete handler called with the wrong node %s", test.desc, name)
+			}
+			return test.handlerRes
+		}
+
 		mockHandler := func(l log.Logger, n *corev1.Node) SyncState {
 			if !reflect.DeepEqual(testNode.ObjectMeta, n.ObjectMeta) {
 				t.Errorf("test %s failed, handler called with the wrong node (-want +got)\n%s",
@@ -90,6 +120,12 @@ func TestNodeController(t *testing.T) {
 			NodeName:  testNodeName,
 			Namespace: testNamespace,
 			Handler:   mockHandler,
+
+			DeleteHandler: mockDeleteHandler,
+		}
+		calledForceReload := false
+		if test.forceReload {
+			r.ForceReload = func() { calledForceReload = true }
 		}
 		req := reconcile.Request{
 			NamespacedName: types.NamespacedName{
@@ -105,5 +141,11 @@ func TestNodeController(t *testing.T) {
 			t.Errorf("test %s failed: fail reconcile expected: %v, got: %v. err: %v",
 				test.desc, test.expectReconcileFails, failedReconcile, err)
 		}
+		if test.expectDelete != calledDelete {
+			t.Errorf("test %s failed: delete handler call expected: %v, got: %v", test.desc, test.expectDelete, calledDelete)
+		}
+		if test.forceReload != calledForceReload {
+			t.Errorf("test %s failed: force reload expected: %v, got: %v", test.desc, test.forceReload, calledForceReload)
+		}
 	}
 }
@@ -24,6 +24,7 @@ import (
 	"github.com/go-kit/log/level"
 	metallbv1beta1 "go.universe.tf/metallb/api/v1beta1"
 	"go.universe.tf/metallb/internal/config"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -39,6 +40,9 @@ type PoolReconciler struct {
 	Handler        func(log.Logger, map[string]*config.Pool) SyncState
 	ValidateConfig config.Validate
 	ForceReload    func()
+	// InvalidConfigHandler, if not nil, is called when the
+	// configuration fails to be parsed.
+	InvalidConfigHandler func(log.Logger, error)
 }
 
 func (r *PoolReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
@@ -63,10 +67,24 @@ func (r *PoolReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.
 		return ctrl.Result{}, err
 	}
 
+	var quotas metallbv1beta1.NamespaceIPQuotaList
+	if err := r.List(ctx, &quotas, client.InNamespace(r.Namespace)); err != nil {
+		level.Error(r.Logger).Log("controller", "PoolReconciler", "message", "failed to get namespaceipquotas", "error", err)
+		return ctrl.Result{}, err
+	}
+
+	var namespaces corev1.NamespaceList
+	if err := r.List(ctx, &namespaces); err != nil {
+		level.Error(r.Logger).Log("controller", "PoolReconciler", "message", "failed to get namespaces", "error", err)
+		return ctrl.Result{}, err
+	}
+
 	resources := config.ClusterResources{
 		Pools:              ipAddressPools.Items,
 		LegacyAddressPools: addressPools.Items,
 		Communities:        communities.Items,
+		Quotas:             quotas.Items,
+		Namespaces:         namespaces.Items,
 	}
 
 	level.Debug(r.Logger).Log("controller", "PoolReconciler", "metallb CRs", spew.Sdump(resources))
@@ -74,6 +92,9 @@ func (r *PoolReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.
 	cfg, err := config.For(resources, r.ValidateConfig)
 	if err != nil {
 		level.Error(r.Logger).Log("controller", "PoolReconciler", "error", "failed to parse the configuration", "error", err)
+		if r.InvalidConfigHandler != nil {
+			r.InvalidConfigHandler(r.Logger, err)
+		}
 		return ctrl.Result{}, nil
 	}
 
@@ -101,5 +122,7 @@ func (r *PoolReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		For(&metallbv1beta1.IPAddressPool{}).
 		Watches(&source.Kind{Type: &metallbv1beta1.AddressPool{}}, &handler.EnqueueRequestForObject{}).
 		Watches(&source.Kind{Type: &metallbv1beta1.Community{}}, &handler.EnqueueRequestForObject{}).
+		Watches(&source.Kind{Type: &metallbv1beta1.NamespaceIPQuota{}}, &handler.EnqueueRequestForObject{}).
+		Watches(&source.Kind{Type: &corev1.Namespace{}}, &handler.EnqueueRequestForObject{}).
 		Complete(r)
 }
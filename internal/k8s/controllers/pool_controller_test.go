@@ -39,6 +39,7 @@ func TestPoolController(t *testing.T) {
 		validResources          bool
 		expectReconcileFails    bool
 		expectForceReloadCalled bool
+		expectInvalidConfig     bool
 	}{
 		{
 			desc:                    "handler returns SyncStateSuccess, valid resources",
@@ -74,6 +75,7 @@ func TestPoolController(t *testing.T) {
 			validResources:          false,
 			expectReconcileFails:    false,
 			expectForceReloadCalled: false,
+			expectInvalidConfig:     true,
 		},
 	}
 	for _, test := range tests {
@@ -107,6 +109,9 @@ func TestPoolController(t *testing.T) {
 		calledForceReload := false
 		mockForceReload := func() { calledForceReload = true }
 
+		calledInvalidConfig := false
+		mockInvalidConfig := func(l log.Logger, err error) { calledInvalidConfig = true }
+
 		r := &PoolReconciler{
 			Client:         fakeClient,
 			Logger:         log.NewNopLogger(),
@@ -115,6 +120,8 @@ func TestPoolController(t *testing.T) {
 			ValidateConfig: config.DontValidate,
 			Handler:        mockHandler,
 			ForceReload:    mockForceReload,
+
+			InvalidConfigHandler: mockInvalidConfig,
 		}
 		req := reconcile.Request{
 			NamespacedName: types.NamespacedName{
@@ -132,6 +139,10 @@ func TestPoolController(t *testing.T) {
 		if test.expectForceReloadCalled != calledForceReload {
 			t.Errorf("test %s failed: call force reload expected: %v, got: %v", test.desc, test.expectForceReloadCalled, calledForceReload)
 		}
+
+		if test.expectInvalidConfig != calledInvalidConfig {
+			t.Errorf("test %s failed: call invalid config handler expected: %v, got: %v", test.desc, test.expectInvalidConfig, calledInvalidConfig)
+		}
 	}
 }
 
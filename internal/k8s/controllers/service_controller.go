@@ -32,8 +32,10 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/ratelimiter"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	"sigs.k8s.io/controller-runtime/pkg/source"
 )
@@ -46,7 +48,13 @@ type ServiceReconciler struct {
 	Handler           func(log.Logger, string, *v1.Service, epslices.EpsOrSlices) SyncState
 	Endpoints         NeedEndPoints
 	LoadBalancerClass string
-	Reload            chan event.GenericEvent
+	// Whether the services without a class are handled too when
+	// LoadBalancerClass is set, MetalLB being the default implementation.
+	DefaultLoadBalancer bool
+	Reload              chan event.GenericEvent
+	// The rate limiter of the retries of the services, the default one
+	// of controller-runtime if nil.
+	RateLimiter ratelimiter.RateLimiter
 }
 
 func (r *ServiceReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
@@ -68,7 +76,7 @@ func (r *ServiceReconciler) reconcileService(ctx context.Context, req ctrl.Reque
 		return ctrl.Result{}, err
 	}
 
-	if filterByLoadBalancerClass(service, r.LoadBalancerClass) {
+	if filterByLoadBalancerClass(service, r.LoadBalancerClass, r.DefaultLoadBalancer) {
 		level.Debug(r.Logger).Log("controller", "ServiceReconciler", "filtered service", req.NamespacedName)
 		return ctrl.Result{}, nil
 	}
@@ -93,6 +101,9 @@ func (r *ServiceReconciler) reconcileService(ctx context.Context, req ctrl.Reque
 		level.Info(r.Logger).Log("controller", "ServiceReconciler", "event", "force service reload")
 		r.forceReload()
 		return ctrl.Result{}, nil
+	case SyncStateRetry:
+		level.Info(r.Logger).Log("controller", "ServiceReconciler", "name", req.NamespacedName.String(), "event", "service not converged, retrying later")
+		return ctrl.Result{Requeue: true}, nil
 	case SyncStateErrorNoRetry:
 		level.Error(r.Logger).Log("controller", "ServiceReconciler", "name", req.NamespacedName.String(), "service", dumpResource(service), "endpoints", dumpResource(epSlices), "event", "failed to handle service")
 		return ctrl.Result{}, nil
@@ -120,6 +131,7 @@ func (r *ServiceReconciler) SetupWithManager(mgr ctrl.Manager) error {
 					return []reconcile.Request{{NamespacedName: serviceName}}
 				})).
 			Watches(&source.Channel{Source: r.Reload}, &handler.EnqueueRequestForObject{}).
+			WithOptions(controller.Options{RateLimiter: r.RateLimiter}).
 			Complete(r)
 	}
 	if r.Endpoints == Endpoints {
@@ -137,12 +149,14 @@ func (r *ServiceReconciler) SetupWithManager(mgr ctrl.Manager) error {
 					return []reconcile.Request{{NamespacedName: name}}
 				})).
 			Watches(&source.Channel{Source: r.Reload}, &handler.EnqueueRequestForObject{}).
+			WithOptions(controller.Options{RateLimiter: r.RateLimiter}).
 			Complete(r)
 	}
 
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&v1.Service{}).
 		Watches(&source.Channel{Source: r.Reload}, &handler.EnqueueRequestForObject{}).
+		WithOptions(controller.Options{RateLimiter: r.RateLimiter}).
 		Complete(r)
 }
 
@@ -158,7 +172,7 @@ func (r *ServiceReconciler) serviceFor(ctx context.Context, name types.Namespace
 	return &res, nil
 }
 
-func filterByLoadBalancerClass(service *v1.Service, loadBalancerClass string) bool {
+func filterByLoadBalancerClass(service *v1.Service, loadBalancerClass string, isDefault bool) bool {
 	// When receiving a delete, we can't make logic on the service so we
 	// rely on the application logic that will receive a delete on a service it
 	// did not handle and discard it.
@@ -166,7 +180,7 @@ func filterByLoadBalancerClass(service *v1.Service, loadBalancerClass string) bo
 		return false
 	}
 	if service.Spec.LoadBalancerClass == nil && loadBalancerClass != "" {
-		return true
+		return !isDefault
 	}
 	if service.Spec.LoadBalancerClass == nil && loadBalancerClass == "" {
 		return false
@@ -69,7 +69,7 @@ func (r *ServiceReconciler) reprocessAll(ctx context.Context, req ctrl.Request)
 
 	retry := false
 	for _, service := range services.Items {
-		if filterByLoadBalancerClass(&service, r.LoadBalancerClass) {
+		if filterByLoadBalancerClass(&service, r.LoadBalancerClass, r.DefaultLoadBalancer) {
 			level.Debug(r.Logger).Log("controller", "ServiceReconciler", "filtered service", req.NamespacedName)
 			continue
 		}
@@ -90,6 +90,10 @@ func (r *ServiceReconciler) reprocessAll(ctx context.Context, req ctrl.Request)
 			retry = true
 		case SyncStateReprocessAll:
 			retry = true
+		case SyncStateRetry:
+			// Retried on its own, to back off independently of the
+			// other services.
+			r.requeue(&service)
 		case SyncStateErrorNoRetry:
 			level.Error(r.Logger).Log("controller", "ServiceReconciler - reprocessAll", "name", serviceName, "service", dumpResource(service), "endpoints", dumpResource(eps), "event", "failed to handle service, no retry")
 		}
@@ -106,3 +110,8 @@ func (r *ServiceReconciler) reprocessAll(ctx context.Context, req ctrl.Request)
 func (r *ServiceReconciler) forceReload() {
 	r.Reload <- NewReloadEvent()
 }
+
+// requeue makes the reconciler process the given service again.
+func (r *ServiceReconciler) requeue(svc *v1.Service) {
+	r.Reload <- event.GenericEvent{Object: svc.DeepCopy()}
+}
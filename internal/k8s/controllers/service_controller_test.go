@@ -67,6 +67,7 @@ func TestServiceController(t *testing.T) {
 		shouldReprocessAll      bool
 		expectReconcileFails    bool
 		expectForceReloadCalled bool
+		expectRequeue           bool
 	}{
 		{
 			desc:                    "call reconcileService, handler returns SyncStateSuccess",
@@ -122,6 +123,16 @@ func TestServiceController(t *testing.T) {
 			expectReconcileFails:    false,
 			expectForceReloadCalled: true,
 		},
+		{
+			desc:                    "call reconcileService, handler returns SyncStateRetry",
+			handlerRes:              SyncStateRetry,
+			needEndPoints:           NoNeed,
+			initObjects:             []client.Object{testService},
+			shouldReprocessAll:      false,
+			expectReconcileFails:    false,
+			expectForceReloadCalled: false,
+			expectRequeue:           true,
+		},
 		{
 			desc:                    "call reprocessAll, handler returns SyncStateSuccess",
 			handlerRes:              SyncStateSuccess,
@@ -176,6 +187,15 @@ func TestServiceController(t *testing.T) {
 			expectReconcileFails:    true,
 			expectForceReloadCalled: false,
 		},
+		{
+			desc:                    "call reprocessAll, handler returns SyncStateRetry",
+			handlerRes:              SyncStateRetry,
+			needEndPoints:           NoNeed,
+			initObjects:             []client.Object{testService},
+			shouldReprocessAll:      true,
+			expectReconcileFails:    false,
+			expectForceReloadCalled: true,
+		},
 	}
 	for _, test := range tests {
 		fakeClient, err := newFakeClient(test.initObjects)
@@ -233,7 +253,7 @@ func TestServiceController(t *testing.T) {
 		ctx, cancel := context.WithTimeout(context.Background(), contextTimeOutDuration)
 		defer cancel()
 
-		_, err = r.Reconcile(ctx, req)
+		res, err := r.Reconcile(ctx, req)
 		failedReconcile := err != nil
 
 		if test.expectReconcileFails != failedReconcile {
@@ -241,6 +261,11 @@ func TestServiceController(t *testing.T) {
 				test.desc, test.expectReconcileFails, failedReconcile, err)
 		}
 
+		if test.expectRequeue != res.Requeue {
+			t.Errorf("test %s failed: requeue expected: %v, got: %v",
+				test.desc, test.expectRequeue, res.Requeue)
+		}
+
 		select {
 		case <-ctx.Done():
 			calledForceReload = false
@@ -260,6 +285,7 @@ func TestLBClass(t *testing.T) {
 		desc           string
 		serviceLBClass *string
 		metallLBClass  string
+		metallbDefault bool
 		shouldFilter   bool
 	}{
 		{
@@ -292,6 +318,27 @@ func TestLBClass(t *testing.T) {
 			metallLBClass:  "foo",
 			shouldFilter:   false,
 		},
+		{
+			desc:           "Empty serviceclass, metallb specific and default",
+			serviceLBClass: nil,
+			metallLBClass:  "foo",
+			metallbDefault: true,
+			shouldFilter:   false,
+		},
+		{
+			desc:           "Set serviceclass, metallb specific and default",
+			serviceLBClass: pointer.StrPtr("bar"),
+			metallLBClass:  "foo",
+			metallbDefault: true,
+			shouldFilter:   true,
+		},
+		{
+			desc:           "Set serviceclass, metallb same and default",
+			serviceLBClass: pointer.StrPtr("foo"),
+			metallLBClass:  "foo",
+			metallbDefault: true,
+			shouldFilter:   false,
+		},
 	}
 	for _, test := range tests {
 		svc := &corev1.Service{
@@ -299,7 +346,7 @@ func TestLBClass(t *testing.T) {
 				LoadBalancerClass: test.serviceLBClass,
 			},
 		}
-		filters := filterByLoadBalancerClass(svc, test.metallLBClass)
+		filters := filterByLoadBalancerClass(svc, test.metallLBClass, test.metallbDefault)
 		if filters != test.shouldFilter {
 			t.Errorf("test %s failed: expected filter: %v, got: %v",
 				test.desc, test.shouldFilter, filters)
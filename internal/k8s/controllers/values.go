@@ -19,6 +19,10 @@ const (
 	// The update caused a non transient error, the k8s client should
 	// just report and giveup.
 	SyncStateErrorNoRetry
+	// The update can't be completed until something outside of the
+	// watched objects changes, e.g. IPs are released. The k8s client
+	// should process it again later, with an exponential backoff.
+	SyncStateRetry
 )
 
 type NeedEndPoints int
@@ -0,0 +1,107 @@
+// SPDX-License-Identifier:Apache-2.0
+
+package k8s
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+)
+
+// dedupRecorder is an event recorder emitting an event identical to
+// the last one about the same object and reason at most once per
+// interval. The repeats it drops in the meantime are counted in the
+// message of the next one it emits.
+type dedupRecorder struct {
+	record.EventRecorder
+	interval time.Duration
+	now      func() time.Time
+
+	sync.Mutex
+	events    map[string]*recordedEvent
+	lastPrune time.Time
+}
+
+// recordedEvent is the last event emitted about an object and reason.
+type recordedEvent struct {
+	message  string
+	emitted  time.Time
+	repeated int
+}
+
+func newDedupRecorder(r record.EventRecorder, interval time.Duration) *dedupRecorder {
+	return &dedupRecorder{
+		EventRecorder: r,
+		interval:      interval,
+		now:           time.Now,
+		events:        map[string]*recordedEvent{},
+	}
+}
+
+// Event emits the event unless it repeats the last one about the object
+// and reason.
+func (r *dedupRecorder) Event(object runtime.Object, eventtype, reason, message string) {
+	if message, ok := r.admit(object, eventtype, reason, message); ok {
+		r.EventRecorder.Event(object, eventtype, reason, message)
+	}
+}
+
+// Eventf is like Event, with a formatted message.
+func (r *dedupRecorder) Eventf(object runtime.Object, eventtype, reason, messageFmt string, args ...interface{}) {
+	r.Event(object, eventtype, reason, fmt.Sprintf(messageFmt, args...))
+}
+
+// AnnotatedEventf is like Eventf, with annotations added to the event.
+func (r *dedupRecorder) AnnotatedEventf(object runtime.Object, annotations map[string]string, eventtype, reason, messageFmt string, args ...interface{}) {
+	message := fmt.Sprintf(messageFmt, args...)
+	if message, ok := r.admit(object, eventtype, reason, message); ok {
+		r.EventRecorder.AnnotatedEventf(object, annotations, eventtype, reason, "%s", message)
+	}
+}
+
+// admit returns whether the event must be emitted, and its message
+// with the number of repeats dropped since the last one.
+func (r *dedupRecorder) admit(object runtime.Object, eventtype, reason, message string) (string, bool) {
+	key := eventtype + "/" + reason
+	if obj, err := meta.Accessor(object); err == nil {
+		key = obj.GetNamespace() + "/" + obj.GetName() + "/" + key
+	}
+
+	r.Lock()
+	defer r.Unlock()
+	now := r.now()
+	r.prune(now)
+
+	last := r.events[key]
+	if last != nil && last.message == message {
+		if now.Sub(last.emitted) < r.interval {
+			last.repeated++
+			return "", false
+		}
+		r.events[key] = &recordedEvent{message: message, emitted: now}
+		if last.repeated > 0 {
+			message = fmt.Sprintf("%s (repeated %d times in the last %s)", message, last.repeated, now.Sub(last.emitted).Round(time.Second))
+		}
+		return message, true
+	}
+	r.events[key] = &recordedEvent{message: message, emitted: now}
+	return message, true
+}
+
+// prune forgets the events not repeated for a while, typically the
+// ones about deleted objects.
+func (r *dedupRecorder) prune(now time.Time) {
+	if now.Sub(r.lastPrune) < r.interval {
+		return
+	}
+	for key, e := range r.events {
+		if now.Sub(e.emitted) >= 2*r.interval {
+			delete(r.events, key)
+		}
+	}
+	r.lastPrune = now
+}
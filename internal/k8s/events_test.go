@@ -0,0 +1,111 @@
+// SPDX-License-Identifier:Apache-2.0
+
+package k8s
+
+import (
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestDedupRecorder(t *testing.T) {
+	fake := record.NewFakeRecorder(100)
+	r := newDedupRecorder(fake, time.Minute)
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	r.now = func() time.Time { return now }
+
+	svc1 := &v1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "svc1"}}
+	svc2 := &v1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "svc2"}}
+
+	steps := []struct {
+		desc    string
+		elapsed time.Duration
+		emit    func()
+		want    string
+	}{
+		{
+			desc: "first event",
+			emit: func() { r.Eventf(svc1, v1.EventTypeWarning, "AllocationFailed", "no %s", "IP") },
+			want: "Warning AllocationFailed no IP",
+		},
+		{
+			desc:    "repeat within the interval",
+			elapsed: 10 * time.Second,
+			emit:    func() { r.Eventf(svc1, v1.EventTypeWarning, "AllocationFailed", "no %s", "IP") },
+		},
+		{
+			desc:    "other repeat within the interval",
+			elapsed: 10 * time.Second,
+			emit:    func() { r.Eventf(svc1, v1.EventTypeWarning, "AllocationFailed", "no %s", "IP") },
+		},
+		{
+			desc: "same event about another service",
+			emit: func() { r.Eventf(svc2, v1.EventTypeWarning, "AllocationFailed", "no %s", "IP") },
+			want: "Warning AllocationFailed no IP",
+		},
+		{
+			desc: "other reason",
+			emit: func() { r.Event(svc1, v1.EventTypeNormal, "IPAllocated", "assigned IP") },
+			want: "Normal IPAllocated assigned IP",
+		},
+		{
+			desc: "other message",
+			emit: func() { r.Event(svc1, v1.EventTypeWarning, "AllocationFailed", "no IPv6") },
+			want: "Warning AllocationFailed no IPv6",
+		},
+		{
+			desc:    "repeat after the interval",
+			elapsed: time.Minute,
+			emit:    func() { r.Event(svc1, v1.EventTypeWarning, "AllocationFailed", "no IPv6") },
+			want:    "Warning AllocationFailed no IPv6",
+		},
+		{
+			desc:    "repeat within the interval, again",
+			elapsed: 30 * time.Second,
+			emit:    func() { r.Event(svc1, v1.EventTypeWarning, "AllocationFailed", "no IPv6") },
+		},
+		{
+			desc:    "repeat after the interval, counting the dropped ones",
+			elapsed: 30 * time.Second,
+			emit:    func() { r.Event(svc1, v1.EventTypeWarning, "AllocationFailed", "no IPv6") },
+			want:    "Warning AllocationFailed no IPv6 (repeated 1 times in the last 1m0s)",
+		},
+	}
+
+	for _, s := range steps {
+		now = now.Add(s.elapsed)
+		s.emit()
+		select {
+		case got := <-fake.Events:
+			if got != s.want {
+				t.Errorf("%s: expected event %q, got %q", s.desc, s.want, got)
+			}
+		default:
+			if s.want != "" {
+				t.Errorf("%s: expected event %q, got none", s.desc, s.want)
+			}
+		}
+	}
+}
+
+func TestDedupRecorderPrune(t *testing.T) {
+	r := newDedupRecorder(record.NewFakeRecorder(100), time.Minute)
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	r.now = func() time.Time { return now }
+
+	svc1 := &v1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "svc1"}}
+	svc2 := &v1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "svc2"}}
+	r.Event(svc1, v1.EventTypeWarning, "AllocationFailed", "no IP")
+	now = now.Add(2 * time.Minute)
+	r.Event(svc2, v1.EventTypeWarning, "AllocationFailed", "no IP")
+
+	if len(r.events) != 1 {
+		t.Fatalf("expected the events about svc1 to be forgotten, got %d events", len(r.events))
+	}
+	if _, ok := r.events["default/svc2/Warning/AllocationFailed"]; !ok {
+		t.Fatalf("expected the events about svc2 to be kept, got %v", r.events)
+	}
+}
@@ -0,0 +1,85 @@
+// SPDX-License-Identifier:Apache-2.0
+
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	metallbv1beta1 "go.universe.tf/metallb/api/v1beta1"
+	v1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// HealthzPath is the path the liveness of the process is served
+	// on.
+	HealthzPath = "/healthz"
+	// ReadyzPath is the path the readiness of the process is served
+	// on.
+	ReadyzPath = "/readyz"
+)
+
+// How long a readiness check waits for the caches to sync. Probes
+// time out after a second by default.
+const cacheSyncTimeout = 500 * time.Millisecond
+
+// readyCheck returns an error if the process is not ready.
+type readyCheck func(ctx context.Context) error
+
+// healthzHandler reports the process alive as long as it serves HTTP.
+func healthzHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+}
+
+// readyzHandler reports the process ready once all the checks pass.
+func readyzHandler(checks ...readyCheck) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, check := range checks {
+			if err := check(r.Context()); err != nil {
+				http.Error(w, "not ready: "+err.Error(), http.StatusServiceUnavailable)
+				return
+			}
+		}
+		fmt.Fprintln(w, "ok")
+	})
+}
+
+// readyObjects are the resources whose caches must be synced for the
+// process to be ready: the services and the configuration.
+var readyObjects = []client.Object{&v1.Service{}, &metallbv1beta1.IPAddressPool{}}
+
+// cacheSynced checks that the caches of readyObjects are synced.
+func (c *Client) cacheSynced(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, cacheSyncTimeout)
+	defer cancel()
+	for _, obj := range readyObjects {
+		informer, err := c.mgr.GetCache().GetInformer(ctx, obj)
+		if err != nil {
+			return err
+		}
+		if !informer.HasSynced() {
+			return fmt.Errorf("%T cache not synced", obj)
+		}
+	}
+	return nil
+}
+
+// leaderReady returns the check of ready, which applies only to the
+// leader when the replicas elect one: the others don't reconcile
+// anything to be ready for.
+func (c *Client) leaderReady(ready func() error) readyCheck {
+	return func(ctx context.Context) error {
+		if ready == nil {
+			return nil
+		}
+		if c.leaderElection != nil && !c.leaderElection.isLeader() {
+			return nil
+		}
+		return ready()
+	}
+}
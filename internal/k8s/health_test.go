@@ -0,0 +1,72 @@
+// SPDX-License-Identifier:Apache-2.0
+
+package k8s
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestReadyzHandler(t *testing.T) {
+	ok := func(context.Context) error { return nil }
+	notSynced := func(context.Context) error { return errors.New("caches not synced") }
+
+	tests := []struct {
+		desc     string
+		checks   []readyCheck
+		wantCode int
+		wantBody string
+	}{
+		{
+			desc:     "no check",
+			wantCode: http.StatusOK,
+			wantBody: "ok",
+		},
+		{
+			desc:     "all checks pass",
+			checks:   []readyCheck{ok, ok},
+			wantCode: http.StatusOK,
+			wantBody: "ok",
+		},
+		{
+			desc:     "one check fails",
+			checks:   []readyCheck{ok, notSynced},
+			wantCode: http.StatusServiceUnavailable,
+			wantBody: "not ready: caches not synced",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			readyzHandler(test.checks...).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, ReadyzPath, nil))
+			if rec.Code != test.wantCode {
+				t.Fatalf("expected status %d, got %d", test.wantCode, rec.Code)
+			}
+			if got := strings.TrimSpace(rec.Body.String()); got != test.wantBody {
+				t.Fatalf("expected body %q, got %q", test.wantBody, got)
+			}
+		})
+	}
+}
+
+func TestLeaderReady(t *testing.T) {
+	notConfigured := func() error { return errors.New("no configuration applied yet") }
+	elected := make(chan struct{})
+	c := &Client{leaderElection: &LeaderElection{elected: elected}}
+
+	if err := c.leaderReady(notConfigured)(context.Background()); err != nil {
+		t.Fatalf("expected a replica not elected to be ready, got %s", err)
+	}
+	close(elected)
+	if err := c.leaderReady(notConfigured)(context.Background()); err == nil {
+		t.Fatalf("expected the leader not to be ready before the configuration")
+	}
+	if err := c.leaderReady(nil)(context.Background()); err != nil {
+		t.Fatalf("expected no check to be ready, got %s", err)
+	}
+}
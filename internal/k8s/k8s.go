@@ -11,11 +11,14 @@ import (
 	"net/http"
 	"net/http/pprof"
 	"os"
+	"strings"
+	"time"
 
 	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/ratelimiter"
 
 	metallbv1alpha1 "go.universe.tf/metallb/api/v1alpha1"
 	metallbv1beta1 "go.universe.tf/metallb/api/v1beta1"
@@ -33,12 +36,15 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	v1 "k8s.io/api/core/v1"
 	discovery "k8s.io/api/discovery/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
 	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
 	policyv1beta1 "k8s.io/kubernetes/pkg/apis/policy/v1beta1"
 
 	appsv1 "k8s.io/api/apps/v1"
@@ -91,6 +97,9 @@ type Client struct {
 	events         record.EventRecorder
 	mgr            manager.Manager
 	validateConfig config.Validate
+	namespace      string
+	leaderElection *LeaderElection
+	reload         chan event.GenericEvent
 	ForceSync      func()
 }
 
@@ -113,6 +122,32 @@ type Config struct {
 	CertDir             string
 	CertServiceName     string
 	LoadBalancerClass   string
+	// Whether the services without a class are handled too when
+	// LoadBalancerClass is set.
+	DefaultLoadBalancer bool
+	// Additional handlers served on the metrics port, by path.
+	Handlers map[string]http.Handler
+	// Whether the replicas elect a leader, the only one reconciling,
+	// with the Lease named LeaderElectionID in Namespace. The state of
+	// the election is then served on LeaderHandlerPath.
+	LeaderElection   bool
+	LeaderElectionID string
+	// If not nil, receives the IPs of the services every time a
+	// speaker announces them.
+	AnnouncedIPs chan<- net.IP
+	// If not 0, an event identical to the last one about the same
+	// object and reason is emitted at most once per EventsInterval,
+	// along with the number of repeats dropped meanwhile.
+	EventsInterval time.Duration
+	// If not 0, the services failing to be processed are retried after
+	// RetryBaseDelay, the delay doubling at each failure up to
+	// RetryMaxDelay. The controller-runtime defaults apply otherwise.
+	RetryBaseDelay time.Duration
+	RetryMaxDelay  time.Duration
+	// If not nil, returns an error while the process is not ready,
+	// as served on ReadyzPath along with the sync of the caches. With
+	// LeaderElection, only the leader checks it.
+	Ready func() error
 	Listener
 }
 
@@ -140,8 +175,13 @@ func New(cfg *Config) (*Client, error) {
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme:             scheme,
 		Port:               9443, // TODO port only with controller, for webhooks
-		LeaderElection:     false,
-		MetricsBindAddress: "0", // Disable metrics endpoint of controller manager
+		MetricsBindAddress: "0",  // Disable metrics endpoint of controller manager
+
+		LeaderElection:                cfg.LeaderElection,
+		LeaderElectionID:              cfg.LeaderElectionID,
+		LeaderElectionNamespace:       cfg.Namespace,
+		LeaderElectionResourceLock:    resourcelock.LeasesResourceLock,
+		LeaderElectionReleaseOnCancel: true,
 		NewCache: cache.BuilderWithOptions(cache.Options{
 			SelectorsByObject: map[client.Object]cache.ObjectSelector{
 				&metallbv1beta1.AddressPool{}:      namespaceSelector,
@@ -152,9 +192,11 @@ func New(cfg *Config) (*Client, error) {
 				&metallbv1beta1.L2Advertisement{}:  namespaceSelector,
 				&metallbv1beta2.BGPPeer{}:          namespaceSelector,
 				&metallbv1beta1.Community{}:        namespaceSelector,
+				&metallbv1beta1.NamespaceIPQuota{}: namespaceSelector,
 				&corev1.Secret{}:                   namespaceSelector,
 				&corev1.Service{}:                  svcNamespaceSelector,
 				&corev1.Endpoints{}:                svcNamespaceSelector,
+				&corev1.Event{}:                    svcNamespaceSelector,
 				&discovery.EndpointSlice{}:         svcNamespaceSelector,
 			},
 		}),
@@ -168,7 +210,10 @@ func New(cfg *Config) (*Client, error) {
 		return nil, fmt.Errorf("creating Kubernetes client: %s", err)
 	}
 
-	recorder := mgr.GetEventRecorderFor(cfg.ProcessName)
+	var recorder record.EventRecorder = mgr.GetEventRecorderFor(cfg.ProcessName)
+	if cfg.EventsInterval > 0 {
+		recorder = newDedupRecorder(recorder, cfg.EventsInterval)
+	}
 
 	reloadChan := make(chan event.GenericEvent)
 	reload := func() {
@@ -181,9 +226,21 @@ func New(cfg *Config) (*Client, error) {
 		events:         recorder,
 		mgr:            mgr,
 		validateConfig: cfg.ValidateConfig,
+		namespace:      cfg.Namespace,
+		reload:         reloadChan,
 		ForceSync:      reload,
 	}
 
+	if cfg.LeaderElection {
+		c.leaderElection = &LeaderElection{
+			client:    clientset,
+			namespace: cfg.Namespace,
+			name:      cfg.LeaderElectionID,
+			elected:   mgr.Elected(),
+		}
+		go c.leaderElection.logLeadership(c.logger)
+	}
+
 	if cfg.ConfigChanged != nil {
 		if err = (&controllers.ConfigReconciler{
 			Client:         mgr.GetClient(),
@@ -208,6 +265,8 @@ func New(cfg *Config) (*Client, error) {
 			ValidateConfig: cfg.ValidateConfig,
 			Handler:        cfg.PoolHandler,
 			ForceReload:    reload,
+
+			InvalidConfigHandler: cfg.PoolConfigInvalidHandler,
 		}).SetupWithManager(mgr); err != nil {
 			level.Error(c.logger).Log("error", err, "unable to create controller", "config")
 			return nil, errors.Wrap(err, "failed to create config reconciler")
@@ -216,17 +275,32 @@ func New(cfg *Config) (*Client, error) {
 
 	if cfg.NodeChanged != nil {
 		if err = (&controllers.NodeReconciler{
-			Client:   mgr.GetClient(),
-			Logger:   cfg.Logger,
-			Scheme:   mgr.GetScheme(),
-			Handler:  cfg.NodeHandler,
-			NodeName: cfg.NodeName,
+			Client:        mgr.GetClient(),
+			Logger:        cfg.Logger,
+			Scheme:        mgr.GetScheme(),
+			Handler:       cfg.NodeHandler,
+			DeleteHandler: cfg.NodeDeleteHandler,
+			NodeName:      cfg.NodeName,
+
+			ForceReload: reload,
 		}).SetupWithManager(mgr); err != nil {
 			level.Error(c.logger).Log("error", err, "unable to create controller", "node")
 			return nil, errors.Wrap(err, "failed to create node reconciler")
 		}
 	}
 
+	if cfg.AnnouncedIPs != nil {
+		if err = (&controllers.AnnouncementReconciler{
+			Client:    mgr.GetClient(),
+			Logger:    cfg.Logger,
+			Scheme:    mgr.GetScheme(),
+			Announced: cfg.AnnouncedIPs,
+		}).SetupWithManager(mgr); err != nil {
+			level.Error(c.logger).Log("error", err, "unable to create controller", "announcement")
+			return nil, errors.Wrap(err, "failed to create announcement reconciler")
+		}
+	}
+
 	// use DisableEpSlices to skip the autodiscovery mechanism. Useful if EndpointSlices are enabled in the cluster but disabled in kube-proxy
 	useSlices := UseEndpointSlices(c.client) && !cfg.DisableEpSlices
 
@@ -264,13 +338,15 @@ func New(cfg *Config) (*Client, error) {
 
 	if cfg.ServiceChanged != nil {
 		if err = (&controllers.ServiceReconciler{
-			Client:            mgr.GetClient(),
-			Logger:            cfg.Logger,
-			Scheme:            mgr.GetScheme(),
-			Handler:           cfg.ServiceHandler,
-			Endpoints:         needEndpoints,
-			Reload:            reloadChan,
-			LoadBalancerClass: cfg.LoadBalancerClass,
+			Client:              mgr.GetClient(),
+			Logger:              cfg.Logger,
+			Scheme:              mgr.GetScheme(),
+			Handler:             cfg.ServiceHandler,
+			Endpoints:           needEndpoints,
+			Reload:              reloadChan,
+			LoadBalancerClass:   cfg.LoadBalancerClass,
+			DefaultLoadBalancer: cfg.DefaultLoadBalancer,
+			RateLimiter:         retryRateLimiter(cfg.RetryBaseDelay, cfg.RetryMaxDelay),
 		}).SetupWithManager(mgr); err != nil {
 			level.Error(c.logger).Log("error", err, "unable to create controller", "service")
 			return nil, errors.Wrap(err, "failed to create service reconciler")
@@ -328,6 +404,14 @@ func New(cfg *Config) (*Client, error) {
 
 	mux := http.NewServeMux()
 	mux.Handle("/metrics", promhttp.Handler())
+	mux.Handle(HealthzPath, healthzHandler())
+	mux.Handle(ReadyzPath, readyzHandler(c.cacheSynced, c.leaderReady(cfg.Ready)))
+	for path, h := range cfg.Handlers {
+		mux.Handle(path, h)
+	}
+	if c.leaderElection != nil {
+		mux.Handle(LeaderHandlerPath, c.leaderElection.Handler())
+	}
 
 	if cfg.EnablePprof {
 		mux.HandleFunc("/debug/pprof/", pprof.Index)
@@ -448,6 +532,76 @@ func (c *Client) CreateMlSecret(namespace, controllerDeploymentName, secretName
 	return err
 }
 
+// ConfigMapStore persists data in a ConfigMap.
+type ConfigMapStore struct {
+	client    kubernetes.Interface
+	namespace string
+	name      string
+}
+
+const configMapStoreKey = "data"
+
+// ConfigMapStore returns a store persisting data in the ConfigMap with
+// the given name, which is created if needed.
+func (c *Client) ConfigMapStore(namespace, name string) *ConfigMapStore {
+	return &ConfigMapStore{
+		client:    c.client,
+		namespace: namespace,
+		name:      name,
+	}
+}
+
+// Load returns the data stored in the ConfigMap, or nil if the
+// ConfigMap doesn't exist.
+func (s *ConfigMapStore) Load() ([]byte, error) {
+	cm, err := s.client.CoreV1().ConfigMaps(s.namespace).Get(context.TODO(), s.name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []byte(cm.Data[configMapStoreKey]), nil
+}
+
+// Save replaces the data stored in the ConfigMap.
+func (s *ConfigMapStore) Save(data []byte) error {
+	cms := s.client.CoreV1().ConfigMaps(s.namespace)
+	cm, err := cms.Get(context.TODO(), s.name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = cms.Create(context.TODO(), &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      s.name,
+				Namespace: s.namespace,
+			},
+			Data: map[string]string{configMapStoreKey: string(data)},
+		}, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	if cm.Data == nil {
+		cm.Data = map[string]string{}
+	}
+	cm.Data[configMapStoreKey] = string(data)
+	_, err = cms.Update(context.TODO(), cm, metav1.UpdateOptions{})
+	return err
+}
+
+// ServiceKeys returns the namespace/name keys of all the services.
+func (c *Client) ServiceKeys() (map[string]bool, error) {
+	sl, err := c.client.CoreV1().Services("").List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	res := map[string]bool{}
+	for _, svc := range sl.Items {
+		res[svc.Namespace+"/"+svc.Name] = true
+	}
+	return res, nil
+}
+
 // PodIPs returns the IPs of all the pods matched by the labels string.
 func (c *Client) PodIPs(namespace, labels string) ([]string, error) {
 	pl, err := c.client.CoreV1().Pods(namespace).List(context.TODO(), metav1.ListOptions{LabelSelector: labels})
@@ -468,12 +622,27 @@ func (c *Client) Run(stopCh <-chan struct{}) error {
 
 	level.Info(c.logger).Log("op", "Run", "msg", "Starting Manager")
 	if err := c.mgr.Start(ctx); err != nil {
+		if c.leaderElection != nil && c.leaderElection.isLeader() {
+			level.Info(c.logger).Log("op", "leaderElection", "lease", c.leaderElection.name, "error", err, "msg", "stopped being the leader")
+		}
 		return err
 	}
 
 	return nil
 }
 
+// ReprocessServiceAfter makes the service with the given namespace/name
+// key processed again once the given delay has elapsed.
+func (c *Client) ReprocessServiceAfter(name string, after time.Duration) {
+	namespace, svcName := "", name
+	if parts := strings.SplitN(name, "/", 2); len(parts) == 2 {
+		namespace, svcName = parts[0], parts[1]
+	}
+	time.AfterFunc(after, func() {
+		c.reload <- event.GenericEvent{Object: &v1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: svcName}}}
+	})
+}
+
 // UpdateStatus writes the protected "status" field of svc back into
 // the Kubernetes cluster.
 func (c *Client) UpdateStatus(svc *v1.Service) error {
@@ -481,6 +650,21 @@ func (c *Client) UpdateStatus(svc *v1.Service) error {
 	return err
 }
 
+// Update writes the metadata and spec of svc back to the cluster, and
+// returns the updated service.
+func (c *Client) Update(svc *v1.Service) (*v1.Service, error) {
+	return c.client.CoreV1().Services(svc.Namespace).Update(context.TODO(), svc, metav1.UpdateOptions{})
+}
+
+// retryRateLimiter returns the rate limiter of the retries, nil to use
+// the default one if the delays are not set.
+func retryRateLimiter(base, max time.Duration) ratelimiter.RateLimiter {
+	if base == 0 || max == 0 {
+		return nil
+	}
+	return workqueue.NewItemExponentialFailureRateLimiter(base, max)
+}
+
 // Infof logs an informational event about svc to the Kubernetes cluster.
 func (c *Client) Infof(svc *v1.Service, kind, msg string, args ...interface{}) {
 	c.events.Eventf(svc, v1.EventTypeNormal, kind, msg, args...)
@@ -491,6 +675,66 @@ func (c *Client) Errorf(svc *v1.Service, kind, msg string, args ...interface{})
 	c.events.Eventf(svc, v1.EventTypeWarning, kind, msg, args...)
 }
 
+// QuotaErrorf logs an error event about the NamespaceIPQuota with the
+// given name to the Kubernetes cluster.
+func (c *Client) QuotaErrorf(name, kind, msg string, args ...interface{}) {
+	quota := &metallbv1beta1.NamespaceIPQuota{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: c.namespace,
+		},
+	}
+	c.events.Eventf(quota, v1.EventTypeWarning, kind, msg, args...)
+}
+
+// PoolInfof logs an informational event about the IPAddressPool with
+// the given name to the Kubernetes cluster.
+func (c *Client) PoolInfof(name, kind, msg string, args ...interface{}) {
+	pool := &metallbv1beta1.IPAddressPool{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: c.namespace,
+		},
+	}
+	c.events.Eventf(pool, v1.EventTypeNormal, kind, msg, args...)
+}
+
+// PoolErrorf logs an error event about the IPAddressPool with the
+// given name to the Kubernetes cluster.
+func (c *Client) PoolErrorf(name, kind, msg string, args ...interface{}) {
+	pool := &metallbv1beta1.IPAddressPool{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: c.namespace,
+		},
+	}
+	c.events.Eventf(pool, v1.EventTypeWarning, kind, msg, args...)
+}
+
+// PeerErrorf logs an error event about the BGPPeer with the given
+// name to the Kubernetes cluster.
+func (c *Client) PeerErrorf(name, kind, msg string, args ...interface{}) {
+	peer := &metallbv1beta2.BGPPeer{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: c.namespace,
+		},
+	}
+	c.events.Eventf(peer, v1.EventTypeWarning, kind, msg, args...)
+}
+
+// PodErrorf logs an error event about the pod with the given name in
+// the namespace of the client to the Kubernetes cluster.
+func (c *Client) PodErrorf(name, kind, msg string, args ...interface{}) {
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: c.namespace,
+		},
+	}
+	c.events.Eventf(pod, v1.EventTypeWarning, kind, msg, args...)
+}
+
 // UseEndpointSlices detect if Endpoints Slices are enabled in the cluster.
 func UseEndpointSlices(kubeClient kubernetes.Interface) bool {
 	if _, err := kubeClient.Discovery().ServerResourcesForGroupVersion(discovery.SchemeGroupVersion.String()); err != nil {
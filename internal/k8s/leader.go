@@ -0,0 +1,102 @@
+// SPDX-License-Identifier:Apache-2.0
+
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// LeaderHandlerPath is the path the status of the leader election is
+// served on, when enabled.
+const LeaderHandlerPath = "/api/v1/leader"
+
+// LeaderStatus is the state of the election of the replica reconciling
+// the cluster.
+type LeaderStatus struct {
+	// Name of the pod holding the lease, empty if none.
+	Leader   string `json:"leader"`
+	IsLeader bool   `json:"isLeader"`
+	// When the lease expires if the leader doesn't renew it.
+	LeaseExpiry time.Time `json:"leaseExpiry"`
+}
+
+// LeaderElection reads the Lease the replicas elect their leader with.
+type LeaderElection struct {
+	client    kubernetes.Interface
+	namespace string
+	name      string
+	elected   <-chan struct{}
+}
+
+// Status returns the current state of the election.
+func (e *LeaderElection) Status(ctx context.Context) (LeaderStatus, error) {
+	lease, err := e.client.CoordinationV1().Leases(e.namespace).Get(ctx, e.name, metav1.GetOptions{})
+	if err != nil {
+		return LeaderStatus{}, err
+	}
+	return leaderStatus(lease, e.isLeader()), nil
+}
+
+func (e *LeaderElection) isLeader() bool {
+	select {
+	case <-e.elected:
+		return true
+	default:
+		return false
+	}
+}
+
+// leaderStatus returns the state of the election held in lease.
+func leaderStatus(lease *coordinationv1.Lease, isLeader bool) LeaderStatus {
+	res := LeaderStatus{IsLeader: isLeader}
+	if lease.Spec.HolderIdentity != nil {
+		// The identity of a replica is the name of its pod, followed by
+		// a unique suffix.
+		res.Leader = strings.SplitN(*lease.Spec.HolderIdentity, "_", 2)[0]
+	}
+	if lease.Spec.RenewTime != nil && lease.Spec.LeaseDurationSeconds != nil {
+		res.LeaseExpiry = lease.Spec.RenewTime.Add(time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second).UTC()
+	}
+	return res
+}
+
+// Handler serves the state of the election.
+func (e *LeaderElection) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		s, err := e.Status(r.Context())
+		if err != nil {
+			http.Error(w, "reading the leader election lease: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(s)
+	})
+}
+
+// logLeadership logs when the replica becomes the leader. Losing the
+// leadership stops the manager, which is logged by Run.
+func (e *LeaderElection) logLeadership(l log.Logger) {
+	level.Info(l).Log("op", "leaderElection", "lease", e.name, "msg", "waiting to become the leader")
+	<-e.elected
+	level.Info(l).Log("op", "leaderElection", "lease", e.name, "msg", "became the leader")
+}
+
+// Elected returns a channel closed when the replica becomes the leader,
+// or right away without leader election.
+func (c *Client) Elected() <-chan struct{} {
+	return c.mgr.Elected()
+}
@@ -0,0 +1,78 @@
+// SPDX-License-Identifier:Apache-2.0
+
+package k8s
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.universe.tf/metallb/internal/pointer"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestLeaderElection(t *testing.T) {
+	renew := metav1.NewMicroTime(time.Date(2022, 6, 1, 10, 0, 0, 0, time.UTC))
+	lease := &coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "metallb-controller",
+			Namespace: "metallb-system",
+		},
+		Spec: coordinationv1.LeaseSpec{
+			HolderIdentity:       pointer.StrPtr("controller-a_0e5d3c2a-8c1f-4b3a-9a1d-3f2e1c0b9a87"),
+			LeaseDurationSeconds: pointer.Int32Ptr(15),
+			RenewTime:            &renew,
+		},
+	}
+	wantExpiry := time.Date(2022, 6, 1, 10, 0, 15, 0, time.UTC)
+
+	elected := make(chan struct{})
+	e := &LeaderElection{
+		client:    fake.NewSimpleClientset(lease),
+		namespace: "metallb-system",
+		name:      "metallb-controller",
+		elected:   elected,
+	}
+
+	get := func() LeaderStatus {
+		rec := httptest.NewRecorder()
+		e.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, LeaderHandlerPath, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, rec.Code)
+		}
+		var s LeaderStatus
+		if err := json.Unmarshal(rec.Body.Bytes(), &s); err != nil {
+			t.Fatalf("failed to decode the response: %s", err)
+		}
+		return s
+	}
+
+	check := func(isLeader bool) {
+		t.Helper()
+		got := get()
+		if got.Leader != "controller-a" || got.IsLeader != isLeader || !got.LeaseExpiry.Equal(wantExpiry) {
+			t.Fatalf("expected controller-a as the leader until %s, isLeader %v, got %+v", wantExpiry, isLeader, got)
+		}
+	}
+	check(false)
+	close(elected)
+	check(true)
+
+	rec := httptest.NewRecorder()
+	e.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, LeaderHandlerPath, nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected status %d, got %d", http.StatusMethodNotAllowed, rec.Code)
+	}
+
+	// The lease is not created until a replica is elected.
+	e.name = "other"
+	rec = httptest.NewRecorder()
+	e.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, LeaderHandlerPath, nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("expected status %d without lease, got %d", http.StatusInternalServerError, rec.Code)
+	}
+}
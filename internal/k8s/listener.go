@@ -18,6 +18,12 @@ type Listener struct {
 	ConfigChanged  func(log.Logger, *config.Config) controllers.SyncState
 	PoolChanged    func(log.Logger, map[string]*config.Pool) controllers.SyncState
 	NodeChanged    func(log.Logger, *v1.Node) controllers.SyncState
+	// NodeDeleted, if not nil, is called with the name of the nodes
+	// that are deleted.
+	NodeDeleted func(log.Logger, string) controllers.SyncState
+	// PoolConfigInvalid, if not nil, is called when the configuration
+	// of the pools fails to be parsed.
+	PoolConfigInvalid func(log.Logger, error)
 }
 
 func (l *Listener) ServiceHandler(logger log.Logger, serviceName string, svc *v1.Service, endpointsOrSlices epslices.EpsOrSlices) controllers.SyncState {
@@ -38,8 +44,25 @@ func (l *Listener) NodeHandler(logger log.Logger, node *v1.Node) controllers.Syn
 	return l.NodeChanged(logger, node)
 }
 
+func (l *Listener) NodeDeleteHandler(logger log.Logger, name string) controllers.SyncState {
+	l.Lock()
+	defer l.Unlock()
+	if l.NodeDeleted == nil {
+		return controllers.SyncStateSuccess
+	}
+	return l.NodeDeleted(logger, name)
+}
+
 func (l *Listener) PoolHandler(logger log.Logger, pools map[string]*config.Pool) controllers.SyncState {
 	l.Lock()
 	defer l.Unlock()
 	return l.PoolChanged(logger, pools)
 }
+
+func (l *Listener) PoolConfigInvalidHandler(logger log.Logger, err error) {
+	l.Lock()
+	defer l.Unlock()
+	if l.PoolConfigInvalid != nil {
+		l.PoolConfigInvalid(logger, err)
+	}
+}
@@ -0,0 +1,168 @@
+// SPDX-License-Identifier:Apache-2.0
+
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+
+	metallbv1beta1 "go.universe.tf/metallb/api/v1beta1"
+	"go.universe.tf/metallb/internal/config"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// LabelServiceName is the label of the service status resources
+	// holding the name of the service.
+	LabelServiceName = "metallb.io/service-name"
+	// LabelServiceNamespace is the label of the service status resources
+	// holding the namespace of the service.
+	LabelServiceNamespace = "metallb.io/service-namespace"
+)
+
+// ServiceStatusStore records in ServiceL2Status and ServiceBGPStatus
+// resources the services announced by a node. The resources are owned
+// by the speaker pod, so they are garbage collected with it.
+type ServiceStatusStore struct {
+	client    client.Client
+	reader    client.Reader
+	namespace string
+	node      string
+	owner     []metav1.OwnerReference
+	// The last status written to each resource, to update it only
+	// when it changes.
+	written map[string]string
+}
+
+// ServiceStatusStore returns a store writing the statuses of the given
+// node in the given namespace, owned by the given speaker pod.
+func (c *Client) ServiceStatusStore(namespace, node, pod string) (*ServiceStatusStore, error) {
+	s := &ServiceStatusStore{
+		client:    c.mgr.GetClient(),
+		reader:    c.mgr.GetAPIReader(),
+		namespace: namespace,
+		node:      node,
+		written:   map[string]string{},
+	}
+	if pod == "" {
+		return s, nil
+	}
+	p, err := c.client.CoreV1().Pods(namespace).Get(context.TODO(), pod, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	s.owner = []metav1.OwnerReference{{
+		// p.APIVersion is empty.
+		APIVersion: "v1",
+		// p.Kind is empty.
+		Kind: "Pod",
+		Name: p.Name,
+		UID:  p.UID,
+	}}
+	return s, nil
+}
+
+// Set records that the node announces the service with the given
+// namespace/name key with the protocol, through the given interfaces
+// (layer 2) or peers (BGP).
+func (s *ServiceStatusStore) Set(protocol config.Proto, key string, via []string) error {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return err
+	}
+	switch protocol {
+	case config.Layer2:
+		obj := &metallbv1beta1.ServiceL2Status{ObjectMeta: s.objectMeta(protocol, namespace, name)}
+		status := metallbv1beta1.MetalLBServiceL2Status{
+			Node:             s.node,
+			ServiceName:      name,
+			ServiceNamespace: namespace,
+		}
+		for _, intf := range via {
+			status.Interfaces = append(status.Interfaces, metallbv1beta1.InterfaceInfo{Name: intf})
+		}
+		return s.set(obj, fmt.Sprint(status), func() { obj.Status = status })
+	case config.BGP:
+		obj := &metallbv1beta1.ServiceBGPStatus{ObjectMeta: s.objectMeta(protocol, namespace, name)}
+		status := metallbv1beta1.MetalLBServiceBGPStatus{
+			Node:             s.node,
+			ServiceName:      name,
+			ServiceNamespace: namespace,
+			Peers:            via,
+		}
+		return s.set(obj, fmt.Sprint(status), func() { obj.Status = status })
+	}
+	return fmt.Errorf("unknown protocol %q", protocol)
+}
+
+// Delete removes the record of the announcement of the service with
+// the given namespace/name key with the protocol.
+func (s *ServiceStatusStore) Delete(protocol config.Proto, key string) error {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return err
+	}
+	var obj client.Object
+	switch protocol {
+	case config.Layer2:
+		obj = &metallbv1beta1.ServiceL2Status{ObjectMeta: s.objectMeta(protocol, namespace, name)}
+	case config.BGP:
+		obj = &metallbv1beta1.ServiceBGPStatus{ObjectMeta: s.objectMeta(protocol, namespace, name)}
+	default:
+		return fmt.Errorf("unknown protocol %q", protocol)
+	}
+	delete(s.written, obj.GetName())
+	err = s.client.Delete(context.TODO(), obj)
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// set creates obj if needed, and writes its status with setStatus if it
+// changed since the last write.
+func (s *ServiceStatusStore) set(obj client.Object, status string, setStatus func()) error {
+	name := obj.GetName()
+	if s.written[name] == status {
+		return nil
+	}
+	err := s.reader.Get(context.TODO(), client.ObjectKeyFromObject(obj), obj)
+	if apierrors.IsNotFound(err) {
+		err = s.client.Create(context.TODO(), obj)
+	}
+	if err != nil {
+		return err
+	}
+	setStatus()
+	if err := s.client.Status().Update(context.TODO(), obj); err != nil {
+		return err
+	}
+	s.written[name] = status
+	return nil
+}
+
+// objectMeta returns the metadata of the status resource of the service
+// announced by the node with the protocol. Its name is derived from
+// them, as they don't always fit in a resource name.
+func (s *ServiceStatusStore) objectMeta(protocol config.Proto, namespace, name string) metav1.ObjectMeta {
+	h := fnv.New64a()
+	h.Write([]byte(s.node + "/" + namespace + "/" + name))
+	prefix := "l2"
+	if protocol == config.BGP {
+		prefix = "bgp"
+	}
+	return metav1.ObjectMeta{
+		Name:      fmt.Sprintf("%s-%x", prefix, h.Sum64()),
+		Namespace: s.namespace,
+		Labels: map[string]string{
+			LabelServiceName:      name,
+			LabelServiceNamespace: namespace,
+		},
+		OwnerReferences: s.owner,
+	}
+}
@@ -0,0 +1,163 @@
+// SPDX-License-Identifier:Apache-2.0
+
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+// Speaker describes a speaker registered in the SpeakerRegistry.
+type Speaker struct {
+	Node         string    `json:"node"`
+	Pod          string    `json:"pod"`
+	IP           string    `json:"ip,omitempty"`
+	Capabilities []string  `json:"capabilities,omitempty"`
+	Registered   time.Time `json:"registered"`
+}
+
+// SpeakerRegistry keeps track of the speakers in a ConfigMap, with one
+// entry per node. Speakers register themselves when they start, and
+// the controller removes the ones whose pod doesn't exist anymore.
+//
+// The registry only lists the speakers for the users and tools
+// inspecting the cluster. The layer 2 leader election and the BGP
+// announcements don't depend on it: they are still decided by each
+// speaker, from the memberlist and the node selectors of the
+// configuration.
+type SpeakerRegistry struct {
+	client    kubernetes.Interface
+	namespace string
+	name      string
+}
+
+// SpeakerRegistry returns the speaker registry stored in the ConfigMap
+// with the given name, which is created if needed.
+func (c *Client) SpeakerRegistry(namespace, name string) *SpeakerRegistry {
+	return &SpeakerRegistry{
+		client:    c.client,
+		namespace: namespace,
+		name:      name,
+	}
+}
+
+// Register adds the speaker to the registry, replacing any previous
+// speaker of the same node.
+func (r *SpeakerRegistry) Register(s Speaker) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return r.update(func(entries map[string]string) bool {
+		if entries[s.Node] == string(data) {
+			return false
+		}
+		entries[s.Node] = string(data)
+		return true
+	})
+}
+
+// Speakers returns the registered speakers, by node name.
+func (r *SpeakerRegistry) Speakers() (map[string]Speaker, error) {
+	cm, err := r.client.CoreV1().ConfigMaps(r.namespace).Get(context.TODO(), r.name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return map[string]Speaker{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeSpeakers(cm.Data)
+}
+
+// Prune removes the speakers whose pod, matched by the labels
+// selector, doesn't exist anymore. It returns the nodes of the
+// removed speakers.
+func (r *SpeakerRegistry) Prune(labels string) ([]string, error) {
+	pods, err := r.client.CoreV1().Pods(r.namespace).List(context.TODO(), metav1.ListOptions{LabelSelector: labels})
+	if err != nil {
+		return nil, err
+	}
+	alive := map[string]bool{}
+	for _, p := range pods.Items {
+		if p.DeletionTimestamp == nil {
+			alive[p.Name] = true
+		}
+	}
+
+	var removed []string
+	err = r.update(func(entries map[string]string) bool {
+		removed = nil
+		for node, data := range entries {
+			// Entries we can't parse are removed as well, the speakers
+			// register again when they restart.
+			var s Speaker
+			if err := json.Unmarshal([]byte(data), &s); err == nil && alive[s.Pod] {
+				continue
+			}
+			delete(entries, node)
+			removed = append(removed, node)
+		}
+		return len(removed) > 0
+	})
+	sort.Strings(removed)
+	return removed, err
+}
+
+// update applies change to the entries of the ConfigMap, and saves
+// them if change returns true. Conflicting updates are retried.
+func (r *SpeakerRegistry) update(change func(entries map[string]string) bool) error {
+	cms := r.client.CoreV1().ConfigMaps(r.namespace)
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cm, err := cms.Get(context.TODO(), r.name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			entries := map[string]string{}
+			if !change(entries) {
+				return nil
+			}
+			_, err = cms.Create(context.TODO(), &v1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      r.name,
+					Namespace: r.namespace,
+				},
+				Data: entries,
+			}, metav1.CreateOptions{})
+			if apierrors.IsAlreadyExists(err) {
+				// Another speaker created it in the meanwhile, try again.
+				return apierrors.NewConflict(v1.Resource("configmaps"), r.name, err)
+			}
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		if cm.Data == nil {
+			cm.Data = map[string]string{}
+		}
+		if !change(cm.Data) {
+			return nil
+		}
+		_, err = cms.Update(context.TODO(), cm, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+func decodeSpeakers(entries map[string]string) (map[string]Speaker, error) {
+	res := map[string]Speaker{}
+	for node, data := range entries {
+		var s Speaker
+		if err := json.Unmarshal([]byte(data), &s); err != nil {
+			return nil, fmt.Errorf("invalid entry for node %s: %w", node, err)
+		}
+		res[node] = s
+	}
+	return res, nil
+}
@@ -0,0 +1,74 @@
+// SPDX-License-Identifier:Apache-2.0
+
+package k8s
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func speakerPod(name string) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "metallb-system",
+			Labels:    map[string]string{"component": "speaker"},
+		},
+	}
+}
+
+func TestSpeakerRegistry(t *testing.T) {
+	client := fake.NewSimpleClientset(speakerPod("speaker-a"), speakerPod("speaker-b"))
+	r := &SpeakerRegistry{client: client, namespace: "metallb-system", name: "speakers"}
+
+	speakers := []Speaker{
+		{Node: "node-a", Pod: "speaker-a", IP: "10.0.0.1", Capabilities: []string{"frr", "layer2"}},
+		{Node: "node-b", Pod: "speaker-b", IP: "10.0.0.2", Capabilities: []string{"frr", "layer2"}},
+		{Node: "node-c", Pod: "speaker-c", IP: "10.0.0.3", Capabilities: []string{"frr"}},
+	}
+	for _, s := range speakers {
+		if err := r.Register(s); err != nil {
+			t.Fatalf("registering %s failed: %s", s.Node, err)
+		}
+	}
+
+	got, err := r.Speakers()
+	if err != nil {
+		t.Fatalf("listing the speakers failed: %s", err)
+	}
+	if len(got) != 3 || !reflect.DeepEqual(got["node-c"].Capabilities, []string{"frr"}) {
+		t.Fatalf("unexpected speakers %v", got)
+	}
+
+	// The speaker of node-a restarted.
+	if err := client.CoreV1().Pods("metallb-system").Delete(context.TODO(), "speaker-a", metav1.DeleteOptions{}); err != nil {
+		t.Fatalf("deleting speaker-a failed: %s", err)
+	}
+	if _, err := client.CoreV1().Pods("metallb-system").Create(context.TODO(), speakerPod("speaker-a2"), metav1.CreateOptions{}); err != nil {
+		t.Fatalf("creating speaker-a2 failed: %s", err)
+	}
+	if err := r.Register(Speaker{Node: "node-a", Pod: "speaker-a2", IP: "10.0.0.1"}); err != nil {
+		t.Fatalf("registering node-a again failed: %s", err)
+	}
+
+	removed, err := r.Prune("component=speaker")
+	if err != nil {
+		t.Fatalf("pruning failed: %s", err)
+	}
+	if !reflect.DeepEqual(removed, []string{"node-c"}) {
+		t.Fatalf("unexpected pruned speakers %v", removed)
+	}
+
+	got, err = r.Speakers()
+	if err != nil {
+		t.Fatalf("listing the speakers failed: %s", err)
+	}
+	if len(got) != 2 || got["node-a"].Pod != "speaker-a2" || got["node-b"].Pod != "speaker-b" {
+		t.Fatalf("unexpected speakers after pruning %v", got)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"io/ioutil"
 	"net"
 	"os"
+	"sort"
 	"strconv"
 	"sync"
 	"time"
@@ -284,6 +285,31 @@ func (a *Announce) AnnounceName(name string) bool {
 	return ok
 }
 
+// Interfaces returns the sorted names of the interfaces answering the
+// ARP and NDP requests for the IPs announced under name.
+func (a *Announce) Interfaces(name string) []string {
+	a.RLock()
+	defer a.RUnlock()
+	seen := map[string]bool{}
+	for _, ip := range a.ips[name] {
+		if ip.To4() != nil {
+			for _, client := range a.arps {
+				seen[client.Interface()] = true
+			}
+			continue
+		}
+		for _, client := range a.ndps {
+			seen[client.Interface()] = true
+		}
+	}
+	res := []string{}
+	for intf := range seen {
+		res = append(res, intf)
+	}
+	sort.Strings(res)
+	return res
+}
+
 // dropReason is the reason why a layer2 protocol packet was not
 // responded to.
 type dropReason int
@@ -4,6 +4,7 @@ package layer2
 
 import (
 	"net"
+	"reflect"
 	"testing"
 )
 
@@ -42,3 +43,32 @@ func Test_SetBalancer_AddsToAnnouncedServices(t *testing.T) {
 		}
 	}
 }
+
+func TestInterfaces(t *testing.T) {
+	announce := &Announce{
+		arps: map[int]*arpResponder{
+			1: {intf: "eth1"},
+			0: {intf: "eth0"},
+		},
+		ndps: map[int]*ndpResponder{
+			2: {intf: "eth2"},
+		},
+		ips: map[string][]net.IP{
+			"v4":   {net.IPv4(192, 168, 1, 20)},
+			"v6":   {net.ParseIP("1000::1")},
+			"dual": {net.IPv4(192, 168, 1, 21), net.ParseIP("1000::2")},
+		},
+	}
+
+	tests := map[string][]string{
+		"v4":      {"eth0", "eth1"},
+		"v6":      {"eth2"},
+		"dual":    {"eth0", "eth1", "eth2"},
+		"unknown": {},
+	}
+	for name, want := range tests {
+		if got := announce.Interfaces(name); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: expected interfaces %v, got %v", name, want, got)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+// SPDX-License-Identifier:Apache-2.0
+
+// Package remotewrite pushes metrics to a Prometheus remote_write
+// endpoint.
+package remotewrite // import "go.universe.tf/metallb/internal/remotewrite"
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/prometheus/prompb"
+)
+
+// Label is a label of a time series.
+type Label struct {
+	Name  string
+	Value string
+}
+
+// TimeSeries is a set of labels, including the metric __name__, with a
+// single sample.
+type TimeSeries struct {
+	Labels    []Label
+	Value     float64
+	Timestamp time.Time
+}
+
+// Client writes time series to a remote_write endpoint.
+type Client struct {
+	url    string
+	client *http.Client
+}
+
+// New returns a client writing to the given remote_write URL.
+func New(url string, timeout time.Duration) *Client {
+	return &Client{
+		url:    url,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+// Write sends the time series to the remote_write endpoint.
+func (c *Client) Write(ctx context.Context, series []TimeSeries) error {
+	data, err := writeRequest(series).Marshal()
+	if err != nil {
+		return err
+	}
+	body := snappy.Encode(nil, data)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("remote write to %s failed with status %s: %s", c.url, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// FromGatherer returns the current value of the gauges and counters
+// gathered by g whose name starts with prefix, timestamped at now.
+func FromGatherer(g prometheus.Gatherer, prefix string, now time.Time) ([]TimeSeries, error) {
+	families, err := g.Gather()
+	if err != nil {
+		return nil, err
+	}
+	res := []TimeSeries{}
+	for _, f := range families {
+		if !strings.HasPrefix(f.GetName(), prefix) {
+			continue
+		}
+		for _, m := range f.GetMetric() {
+			var value float64
+			switch f.GetType() {
+			case dto.MetricType_GAUGE:
+				value = m.GetGauge().GetValue()
+			case dto.MetricType_COUNTER:
+				value = m.GetCounter().GetValue()
+			default:
+				continue
+			}
+			labels := []Label{{Name: "__name__", Value: f.GetName()}}
+			for _, l := range m.GetLabel() {
+				labels = append(labels, Label{Name: l.GetName(), Value: l.GetValue()})
+			}
+			// remote_write requires the labels to be sorted by name.
+			sort.Slice(labels, func(i, j int) bool { return labels[i].Name < labels[j].Name })
+			res = append(res, TimeSeries{Labels: labels, Value: value, Timestamp: now})
+		}
+	}
+	return res, nil
+}
+
+// writeRequest returns the remote_write request carrying the series.
+func writeRequest(series []TimeSeries) *prompb.WriteRequest {
+	req := &prompb.WriteRequest{Timeseries: make([]prompb.TimeSeries, 0, len(series))}
+	for _, s := range series {
+		labels := make([]prompb.Label, 0, len(s.Labels))
+		for _, l := range s.Labels {
+			labels = append(labels, prompb.Label{Name: l.Name, Value: l.Value})
+		}
+		req.Timeseries = append(req.Timeseries, prompb.TimeSeries{
+			Labels:  labels,
+			Samples: []prompb.Sample{{Value: s.Value, Timestamp: s.Timestamp.UnixMilli()}},
+		})
+	}
+	return req
+}
@@ -0,0 +1,106 @@
+// SPDX-License-Identifier:Apache-2.0
+
+package remotewrite
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/prompb"
+)
+
+func TestWriteRequest(t *testing.T) {
+	series := []TimeSeries{{
+		Labels:    []Label{{Name: "a", Value: "b"}},
+		Value:     1,
+		Timestamp: time.UnixMilli(2),
+	}}
+	want := &prompb.WriteRequest{
+		Timeseries: []prompb.TimeSeries{{
+			Labels:  []prompb.Label{{Name: "a", Value: "b"}},
+			Samples: []prompb.Sample{{Value: 1, Timestamp: 2}},
+		}},
+	}
+	got := writeRequest(series)
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	series := []TimeSeries{{
+		Labels:    []Label{{Name: "__name__", Value: "metallb_allocator_addresses_in_use_total"}, {Name: "pool", Value: "default"}},
+		Value:     3,
+		Timestamp: time.UnixMilli(1000),
+	}}
+
+	var gotBody []byte
+	status := http.StatusNoContent
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Encoding") != "snappy" ||
+			r.Header.Get("Content-Type") != "application/x-protobuf" ||
+			r.Header.Get("X-Prometheus-Remote-Write-Version") != "0.1.0" {
+			http.Error(w, "invalid headers", http.StatusBadRequest)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		gotBody = body
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL, time.Second)
+	if err := c.Write(context.Background(), series); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	data, err := snappy.Decode(nil, gotBody)
+	if err != nil {
+		t.Fatalf("failed to decode the body: %s", err)
+	}
+	var got prompb.WriteRequest
+	if err := got.Unmarshal(data); err != nil {
+		t.Fatalf("failed to unmarshal the body: %s", err)
+	}
+	if !reflect.DeepEqual(&got, writeRequest(series)) {
+		t.Fatalf("unexpected body received %v", got)
+	}
+
+	status = http.StatusInternalServerError
+	if err := c.Write(context.Background(), series); err == nil {
+		t.Fatalf("expected an error for a failed write")
+	}
+}
+
+func TestFromGatherer(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	inUse := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "metallb",
+		Subsystem: "allocator",
+		Name:      "addresses_in_use_total",
+	}, []string{"pool"})
+	other := prometheus.NewGauge(prometheus.GaugeOpts{Name: "other"})
+	reg.MustRegister(inUse, other)
+	inUse.WithLabelValues("default").Set(3)
+	other.Set(1)
+
+	now := time.UnixMilli(1000)
+	got, err := FromGatherer(reg, "metallb_allocator_", now)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := []TimeSeries{{
+		Labels:    []Label{{Name: "__name__", Value: "metallb_allocator_addresses_in_use_total"}, {Name: "pool", Value: "default"}},
+		Value:     3,
+		Timestamp: now,
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
@@ -40,8 +40,35 @@ type SpeakerList struct {
 
 	mlMux        sync.Mutex // Mutex for mlSpeakerIPs.
 	mlSpeakerIPs []string   // Speaker pod IPs.
+
+	meta *nodeMeta
+}
+
+// unusableMeta is the metadata of the speakers whose node must not
+// announce the services.
+const unusableMeta = "unusable"
+
+// nodeMeta is the memberlist delegate sharing whether the node of the
+// speaker is usable with the other speakers.
+type nodeMeta struct {
+	sync.Mutex
+	unusable bool
 }
 
+func (m *nodeMeta) NodeMeta(limit int) []byte {
+	m.Lock()
+	defer m.Unlock()
+	if m.unusable {
+		return []byte(unusableMeta)
+	}
+	return nil
+}
+
+func (m *nodeMeta) NotifyMsg([]byte)                           {}
+func (m *nodeMeta) GetBroadcasts(overhead, limit int) [][]byte { return nil }
+func (m *nodeMeta) LocalState(join bool) []byte                { return nil }
+func (m *nodeMeta) MergeRemoteState(buf []byte, join bool)     {}
+
 // New creates a new SpeakerList and returns a pointer to it.
 func New(logger log.Logger, nodeName, bindAddr, bindPort, secret, namespace, labels string, stopCh chan struct{}) (*SpeakerList, error) {
 	sl := SpeakerList{
@@ -89,6 +116,8 @@ func New(logger log.Logger, nodeName, bindAddr, bindPort, secret, namespace, lab
 	// TODO: See https://github.com/metallb/metallb/issues/716
 	sl.mlEventCh = make(chan memberlist.NodeEvent, 1024)
 	mconfig.Events = &memberlist.ChannelEventDelegate{Ch: sl.mlEventCh}
+	sl.meta = &nodeMeta{}
+	mconfig.Delegate = sl.meta
 
 	ml, err := memberlist.Create(mconfig)
 	if err != nil {
@@ -281,11 +310,29 @@ func (sl *SpeakerList) UsableSpeakers() map[string]bool {
 	}
 	activeNodes := map[string]bool{}
 	for _, n := range sl.ml.Members() {
+		if string(n.Meta) == unusableMeta {
+			continue
+		}
 		activeNodes[n.Name] = true
 	}
 	return activeNodes
 }
 
+// SetUsable tells the other speakers whether the node of this speaker
+// can announce the services, for them to take over its layer 2
+// announcements while it can't.
+func (sl *SpeakerList) SetUsable(usable bool) {
+	if sl.ml == nil {
+		return
+	}
+	sl.meta.Lock()
+	sl.meta.unusable = !usable
+	sl.meta.Unlock()
+	if err := sl.ml.UpdateNode(time.Second); err != nil {
+		level.Error(sl.l).Log("op", "setUsable", "error", err, "msg", "failed to update the memberlist node")
+	}
+}
+
 // Stop stops the SpeakerList.
 func (sl *SpeakerList) Stop() {
 	if sl.ml == nil {
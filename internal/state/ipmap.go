@@ -0,0 +1,84 @@
+// SPDX-License-Identifier:Apache-2.0
+
+// Package state holds the allocation state of the controller.
+package state // import "go.universe.tf/metallb/internal/state"
+
+import (
+	"sort"
+	"sync"
+)
+
+// SafeIPMap maps the IPs to the services using them, several services
+// being able to share an IP. It is safe for concurrent use.
+//
+// The hooks must be set before the map is used. They are called
+// without the lock held, so they can read the map.
+type SafeIPMap struct {
+	mu       sync.RWMutex
+	services map[string]map[string]bool // ip -> svc -> true
+
+	// OnSet, if not nil, is called when a service starts using an IP.
+	OnSet func(ip, svc string)
+	// OnDelete, if not nil, is called when an IP is not used by any
+	// service anymore.
+	OnDelete func(ip string)
+}
+
+// NewSafeIPMap returns an empty SafeIPMap.
+func NewSafeIPMap() *SafeIPMap {
+	return &SafeIPMap{services: map[string]map[string]bool{}}
+}
+
+// Set records that svc uses ip.
+func (m *SafeIPMap) Set(ip, svc string) {
+	m.mu.Lock()
+	added := !m.services[ip][svc]
+	if added {
+		if m.services[ip] == nil {
+			m.services[ip] = map[string]bool{}
+		}
+		m.services[ip][svc] = true
+	}
+	m.mu.Unlock()
+
+	if added && m.OnSet != nil {
+		m.OnSet(ip, svc)
+	}
+}
+
+// Delete records that svc doesn't use ip anymore.
+func (m *SafeIPMap) Delete(ip, svc string) {
+	m.mu.Lock()
+	released := false
+	if m.services[ip][svc] {
+		delete(m.services[ip], svc)
+		if len(m.services[ip]) == 0 {
+			delete(m.services, ip)
+			released = true
+		}
+	}
+	m.mu.Unlock()
+
+	if released && m.OnDelete != nil {
+		m.OnDelete(ip)
+	}
+}
+
+// Services returns the services using ip, sorted by name.
+func (m *SafeIPMap) Services(ip string) []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	res := make([]string, 0, len(m.services[ip]))
+	for svc := range m.services[ip] {
+		res = append(res, svc)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// Len returns the number of IPs in use.
+func (m *SafeIPMap) Len() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.services)
+}
@@ -0,0 +1,71 @@
+// SPDX-License-Identifier:Apache-2.0
+
+package state
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSafeIPMap(t *testing.T) {
+	var events []string
+	m := NewSafeIPMap()
+	m.OnSet = func(ip, svc string) { events = append(events, "set "+ip+" "+svc) }
+	m.OnDelete = func(ip string) { events = append(events, "delete "+ip) }
+
+	m.Set("1.2.3.4", "svc1")
+	m.Set("1.2.3.4", "svc2")
+	m.Set("1.2.3.4", "svc1") // Already set, no hook.
+	m.Set("1.2.3.5", "svc3")
+	if got := m.Services("1.2.3.4"); !cmp.Equal(got, []string{"svc1", "svc2"}) {
+		t.Fatalf("unexpected services on 1.2.3.4: %v", got)
+	}
+	if m.Len() != 2 {
+		t.Fatalf("expected 2 IPs in use, got %d", m.Len())
+	}
+
+	m.Delete("1.2.3.4", "svc1") // Still used by svc2.
+	m.Delete("1.2.3.4", "svc3") // Not using the IP, no hook.
+	m.Delete("1.2.3.4", "svc2")
+	if got := m.Services("1.2.3.4"); len(got) != 0 {
+		t.Fatalf("expected no services on 1.2.3.4, got %v", got)
+	}
+	if m.Len() != 1 {
+		t.Fatalf("expected 1 IP in use, got %d", m.Len())
+	}
+
+	want := []string{
+		"set 1.2.3.4 svc1",
+		"set 1.2.3.4 svc2",
+		"set 1.2.3.5 svc3",
+		"delete 1.2.3.4",
+	}
+	if diff := cmp.Diff(want, events); diff != "" {
+		t.Fatalf("unexpected hook calls (-want +got):\n%s", diff)
+	}
+}
+
+func TestSafeIPMapConcurrent(t *testing.T) {
+	m := NewSafeIPMap()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			svc := fmt.Sprintf("svc%d", i)
+			for j := 0; j < 100; j++ {
+				ip := fmt.Sprintf("1.2.3.%d", j)
+				m.Set(ip, svc)
+				m.Services(ip)
+				m.Delete(ip, svc)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if m.Len() != 0 {
+		t.Fatalf("expected no IP in use, got %d", m.Len())
+	}
+}
@@ -0,0 +1,72 @@
+// SPDX-License-Identifier:Apache-2.0
+
+package stats
+
+import "time"
+
+// Bucket holds the activity of a pool over a fixed period of time.
+type Bucket struct {
+	// Start of the period covered by the bucket.
+	Start time.Time
+	// Number of IPs allocated and released during the period.
+	Allocated int
+	Released  int
+	// Highest utilization of the pool during the period, between 0
+	// and 1.
+	PeakUtilization float64
+	// Number of IPs allocated during the period, by namespace of the
+	// services.
+	Namespaces map[string]int
+}
+
+// RingBuffer is a circular buffer of buckets of the same width. The
+// oldest bucket is reused when a new period starts, so that the buffer
+// covers size*width of history.
+type RingBuffer struct {
+	buckets []Bucket
+	width   time.Duration
+}
+
+// NewRingBuffer returns a buffer of size buckets of the given width.
+func NewRingBuffer(size int, width time.Duration) *RingBuffer {
+	return &RingBuffer{
+		buckets: make([]Bucket, size),
+		width:   width,
+	}
+}
+
+// Bucket returns the bucket covering t, emptying it first if it held
+// an older period.
+func (r *RingBuffer) Bucket(t time.Time) *Bucket {
+	start := t.Truncate(r.width)
+	b := &r.buckets[r.index(start)]
+	if !b.Start.Equal(start) {
+		*b = Bucket{Start: start}
+	}
+	return b
+}
+
+// Each calls f on the buckets covering the window ending at now, from
+// the oldest to the most recent. The periods without activity are
+// skipped.
+func (r *RingBuffer) Each(now time.Time, window time.Duration, f func(b *Bucket)) {
+	n := int(window / r.width)
+	if n > len(r.buckets) {
+		n = len(r.buckets)
+	}
+	if n < 1 {
+		n = 1
+	}
+	last := now.Truncate(r.width)
+	for i := n - 1; i >= 0; i-- {
+		start := last.Add(-time.Duration(i) * r.width)
+		b := &r.buckets[r.index(start)]
+		if b.Start.Equal(start) {
+			f(b)
+		}
+	}
+}
+
+func (r *RingBuffer) index(start time.Time) int {
+	return int((start.Unix() / int64(r.width/time.Second)) % int64(len(r.buckets)))
+}
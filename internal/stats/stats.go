@@ -0,0 +1,225 @@
+// SPDX-License-Identifier:Apache-2.0
+
+// Package stats keeps the allocation statistics of the address pools
+// over the last 24 hours, in buckets of one minute, and serves them
+// over HTTP.
+package stats // import "go.universe.tf/metallb/internal/stats"
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	bucketWidth = time.Minute
+	// History is how long the statistics are kept.
+	History = 24 * time.Hour
+	// DefaultWindow is the window of the statistics when none is
+	// requested.
+	DefaultWindow = time.Hour
+)
+
+// Stats are the statistics of a pool over a window of time.
+type Stats struct {
+	Pool   string `json:"pool"`
+	Window string `json:"window"`
+	// IPs allocated and released per hour.
+	AllocationRate   float64 `json:"allocationRate"`
+	DeallocationRate float64 `json:"deallocationRate"`
+	// Current and highest utilization of the pool, between 0 and 1.
+	Utilization     float64 `json:"utilization"`
+	PeakUtilization float64 `json:"peakUtilization"`
+	// Namespace of the services the most IPs were allocated to.
+	TopNamespace string `json:"topNamespace,omitempty"`
+}
+
+type poolStats struct {
+	buckets     *RingBuffer
+	utilization float64
+}
+
+// Pools records the allocation statistics of the pools. A nil Pools
+// records nothing.
+type Pools struct {
+	sync.Mutex
+	pools map[string]*poolStats
+	now   func() time.Time
+}
+
+// New returns an empty Pools.
+func New() *Pools {
+	return &Pools{
+		pools: map[string]*poolStats{},
+		now:   time.Now,
+	}
+}
+
+// Allocated records the allocation of ips IPs of the pool to a service
+// of the given namespace.
+func (p *Pools) Allocated(pool, namespace string, ips int) {
+	if p == nil {
+		return
+	}
+	p.Lock()
+	defer p.Unlock()
+	b := p.bucket(pool)
+	b.Allocated += ips
+	if b.Namespaces == nil {
+		b.Namespaces = map[string]int{}
+	}
+	b.Namespaces[namespace] += ips
+}
+
+// Released records the release of ips IPs of the pool.
+func (p *Pools) Released(pool string, ips int) {
+	if p == nil {
+		return
+	}
+	p.Lock()
+	defer p.Unlock()
+	p.bucket(pool).Released += ips
+}
+
+// SetUtilization records the number of IPs of the pool in use, out of
+// its capacity.
+func (p *Pools) SetUtilization(pool string, inUse int, capacity int64) {
+	if p == nil {
+		return
+	}
+	p.Lock()
+	defer p.Unlock()
+	var u float64
+	if capacity > 0 {
+		u = float64(inUse) / float64(capacity)
+	}
+	b := p.bucket(pool)
+	if u > b.PeakUtilization {
+		b.PeakUtilization = u
+	}
+	p.pools[pool].utilization = u
+}
+
+// Remove drops the statistics of the pool.
+func (p *Pools) Remove(pool string) {
+	if p == nil {
+		return
+	}
+	p.Lock()
+	defer p.Unlock()
+	delete(p.pools, pool)
+}
+
+// Stats returns the statistics of the pool over the window ending now,
+// and false if nothing was recorded for the pool. The window is capped
+// to the history kept.
+func (p *Pools) Stats(pool string, window time.Duration) (Stats, bool) {
+	if p == nil {
+		return Stats{}, false
+	}
+	p.Lock()
+	defer p.Unlock()
+	s := p.pools[pool]
+	if s == nil {
+		return Stats{}, false
+	}
+	if window > History {
+		window = History
+	}
+	if window < bucketWidth {
+		window = bucketWidth
+	}
+
+	res := Stats{
+		Pool:            pool,
+		Window:          window.String(),
+		Utilization:     s.utilization,
+		PeakUtilization: s.utilization,
+	}
+	var allocated, released int
+	namespaces := map[string]int{}
+	s.buckets.Each(p.now(), window, func(b *Bucket) {
+		allocated += b.Allocated
+		released += b.Released
+		if b.PeakUtilization > res.PeakUtilization {
+			res.PeakUtilization = b.PeakUtilization
+		}
+		for ns, n := range b.Namespaces {
+			namespaces[ns] += n
+		}
+	})
+	res.AllocationRate = float64(allocated) / window.Hours()
+	res.DeallocationRate = float64(released) / window.Hours()
+	res.TopNamespace = topNamespace(namespaces)
+	return res, true
+}
+
+// bucket returns the current bucket of the pool. It must be called
+// with the lock held.
+func (p *Pools) bucket(pool string) *Bucket {
+	s := p.pools[pool]
+	if s == nil {
+		s = &poolStats{buckets: NewRingBuffer(int(History/bucketWidth), bucketWidth)}
+		p.pools[pool] = s
+	}
+	return s.buckets.Bucket(p.now())
+}
+
+// topNamespace returns the namespace with the most allocations, the
+// first in alphabetical order in case of a tie.
+func topNamespace(namespaces map[string]int) string {
+	names := make([]string, 0, len(namespaces))
+	for ns := range namespaces {
+		names = append(names, ns)
+	}
+	sort.Strings(names)
+	top := ""
+	for _, ns := range names {
+		if top == "" || namespaces[ns] > namespaces[top] {
+			top = ns
+		}
+	}
+	return top
+}
+
+// HandlerPath is the path the handler returned by Handler must be
+// registered on.
+const HandlerPath = "/api/v1/pools/"
+
+// Handler serves the statistics of a pool on
+// /api/v1/pools/{name}/stats, over the window given by the window
+// query parameter (1h by default).
+func (p *Pools) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, HandlerPath), "/")
+		if len(parts) != 2 || parts[0] == "" || parts[1] != "stats" {
+			http.NotFound(w, r)
+			return
+		}
+
+		window := DefaultWindow
+		if v := r.URL.Query().Get("window"); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d <= 0 {
+				http.Error(w, "invalid window "+v, http.StatusBadRequest)
+				return
+			}
+			window = d
+		}
+
+		s, ok := p.Stats(parts[0], window)
+		if !ok {
+			http.Error(w, "unknown pool "+parts[0], http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(s)
+	})
+}
@@ -0,0 +1,191 @@
+// SPDX-License-Identifier:Apache-2.0
+
+package stats
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRingBuffer(t *testing.T) {
+	start := time.Date(2022, 6, 1, 10, 0, 0, 0, time.UTC)
+	r := NewRingBuffer(3, time.Minute)
+	r.Bucket(start).Allocated = 1
+	r.Bucket(start.Add(30*time.Second)).Allocated++
+	r.Bucket(start.Add(time.Minute)).Allocated = 3
+
+	count := func(now time.Time, window time.Duration) int {
+		total := 0
+		r.Each(now, window, func(b *Bucket) { total += b.Allocated })
+		return total
+	}
+	if got := count(start.Add(time.Minute), 2*time.Minute); got != 5 {
+		t.Fatalf("expected 5 allocations over the last 2 minutes, got %d", got)
+	}
+	if got := count(start.Add(time.Minute), time.Minute); got != 3 {
+		t.Fatalf("expected 3 allocations over the last minute, got %d", got)
+	}
+	// The periods without activity don't count the stale buckets.
+	if got := count(start.Add(4*time.Minute), time.Hour); got != 0 {
+		t.Fatalf("expected no allocations after 4 minutes, got %d", got)
+	}
+
+	// The first bucket is reused after 3 minutes.
+	b := r.Bucket(start.Add(3 * time.Minute))
+	if b.Allocated != 0 {
+		t.Fatalf("expected a reused bucket to be empty, got %d allocations", b.Allocated)
+	}
+	if got := count(start.Add(3*time.Minute), time.Hour); got != 3 {
+		t.Fatalf("expected 3 allocations in the buffer, got %d", got)
+	}
+}
+
+func TestPoolsStats(t *testing.T) {
+	now := time.Date(2022, 6, 1, 10, 0, 0, 0, time.UTC)
+	p := New()
+	p.now = func() time.Time { return now }
+
+	p.Allocated("pool1", "ns1", 2)
+	p.SetUtilization("pool1", 2, 10)
+	now = now.Add(10 * time.Minute)
+	p.Allocated("pool1", "ns2", 1)
+	p.Allocated("pool1", "ns2", 2)
+	p.SetUtilization("pool1", 5, 10)
+	now = now.Add(20 * time.Minute)
+	p.Released("pool1", 4)
+	p.SetUtilization("pool1", 1, 10)
+
+	got, ok := p.Stats("pool1", time.Hour)
+	if !ok {
+		t.Fatalf("no statistics for pool1")
+	}
+	want := Stats{
+		Pool:             "pool1",
+		Window:           "1h0m0s",
+		AllocationRate:   5,
+		DeallocationRate: 4,
+		Utilization:      0.1,
+		PeakUtilization:  0.5,
+		TopNamespace:     "ns2",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected stats (-want +got):\n%s", diff)
+	}
+
+	// Over the last 15 minutes, only the release is in the window.
+	got, _ = p.Stats("pool1", 15*time.Minute)
+	want = Stats{
+		Pool:             "pool1",
+		Window:           "15m0s",
+		DeallocationRate: 16,
+		Utilization:      0.1,
+		PeakUtilization:  0.1,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected stats over 15m (-want +got):\n%s", diff)
+	}
+
+	// The window is capped to the history.
+	got, _ = p.Stats("pool1", 48*time.Hour)
+	if got.Window != "24h0m0s" {
+		t.Fatalf("expected the window to be capped to 24h, got %s", got.Window)
+	}
+
+	p.Remove("pool1")
+	if _, ok := p.Stats("pool1", time.Hour); ok {
+		t.Fatalf("expected no statistics for the removed pool")
+	}
+}
+
+func TestPoolsHandler(t *testing.T) {
+	now := time.Date(2022, 6, 1, 10, 0, 0, 0, time.UTC)
+	p := New()
+	p.now = func() time.Time { return now }
+	p.Allocated("pool1", "ns1", 3)
+	p.SetUtilization("pool1", 3, 4)
+
+	tests := []struct {
+		desc       string
+		method     string
+		url        string
+		wantStatus int
+		want       *Stats
+	}{
+		{
+			desc:       "default window",
+			url:        "/api/v1/pools/pool1/stats",
+			wantStatus: http.StatusOK,
+			want: &Stats{
+				Pool:            "pool1",
+				Window:          "1h0m0s",
+				AllocationRate:  3,
+				Utilization:     0.75,
+				PeakUtilization: 0.75,
+				TopNamespace:    "ns1",
+			},
+		},
+		{
+			desc:       "custom window",
+			url:        "/api/v1/pools/pool1/stats?window=30m",
+			wantStatus: http.StatusOK,
+			want: &Stats{
+				Pool:            "pool1",
+				Window:          "30m0s",
+				AllocationRate:  6,
+				Utilization:     0.75,
+				PeakUtilization: 0.75,
+				TopNamespace:    "ns1",
+			},
+		},
+		{
+			desc:       "invalid window",
+			url:        "/api/v1/pools/pool1/stats?window=forever",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			desc:       "unknown pool",
+			url:        "/api/v1/pools/pool2/stats",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			desc:       "unknown path",
+			url:        "/api/v1/pools/pool1",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			desc:       "wrong method",
+			method:     http.MethodPost,
+			url:        "/api/v1/pools/pool1/stats",
+			wantStatus: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			method := test.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			rec := httptest.NewRecorder()
+			p.Handler().ServeHTTP(rec, httptest.NewRequest(method, test.url, nil))
+			if rec.Code != test.wantStatus {
+				t.Fatalf("expected status %d, got %d", test.wantStatus, rec.Code)
+			}
+			if test.want == nil {
+				return
+			}
+			got := &Stats{}
+			if err := json.Unmarshal(rec.Body.Bytes(), got); err != nil {
+				t.Fatalf("failed to decode the response: %s", err)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Fatalf("unexpected stats (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
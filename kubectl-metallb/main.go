@@ -0,0 +1,131 @@
+// SPDX-License-Identifier:Apache-2.0
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"go.universe.tf/metallb/api/v1beta1"
+	"go.universe.tf/metallb/api/v1beta2"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const usage = `Inspect the state of MetalLB.
+
+Usage:
+  kubectl metallb [flags] <command>
+
+Commands:
+  pools        show the address pools and how many of their IPs are in use
+  allocations  show the IPs of the LoadBalancer services, their pool and the nodes announcing them
+  peers        show the BGP peers and the nodes they are configured on
+
+Flags:
+`
+
+func main() {
+	kubeconfig := flag.String("kubeconfig", os.Getenv(clientcmd.RecommendedConfigPathEnvVar), "path to the kubeconfig file, the default kubectl loading rules apply if empty")
+	namespace := flag.String("namespace", "metallb-system", "namespace MetalLB is deployed in")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = *kubeconfig
+	cfg, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{}).ClientConfig()
+	if err != nil {
+		log.Fatalf("failed to load kubeconfig: %s", err)
+	}
+	cs, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		log.Fatalf("failed to create the kubernetes client: %s", err)
+	}
+	scheme := runtime.NewScheme()
+	if err := v1beta1.AddToScheme(scheme); err != nil {
+		log.Fatalf("failed to register the metallb types: %s", err)
+	}
+	if err := v1beta2.AddToScheme(scheme); err != nil {
+		log.Fatalf("failed to register the metallb types: %s", err)
+	}
+	cl, err := client.New(cfg, client.Options{Scheme: scheme})
+	if err != nil {
+		log.Fatalf("failed to create the metallb client: %s", err)
+	}
+
+	ctx := context.Background()
+	switch cmd := flag.Arg(0); cmd {
+	case "pools":
+		pools := listPools(ctx, cl, *namespace)
+		services := listServices(ctx, cs)
+		rows, err := poolUsage(pools, services)
+		if err != nil {
+			log.Fatalf("failed to compute the usage of the pools: %s", err)
+		}
+		printPools(os.Stdout, rows)
+	case "allocations":
+		pools := listPools(ctx, cl, *namespace)
+		services := listServices(ctx, cs)
+		events, err := cs.CoreV1().Events(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+			FieldSelector: fields.OneTermEqualSelector("reason", reasonNodeAssigned).String(),
+		})
+		if err != nil {
+			log.Fatalf("failed to list the events: %s", err)
+		}
+		rows, err := allocations(pools, services, events.Items)
+		if err != nil {
+			log.Fatalf("failed to compute the allocations: %s", err)
+		}
+		printAllocations(os.Stdout, rows)
+	case "peers":
+		var peers v1beta2.BGPPeerList
+		if err := cl.List(ctx, &peers, client.InNamespace(*namespace)); err != nil {
+			log.Fatalf("failed to list the BGP peers: %s", err)
+		}
+		nodes, err := cs.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+		if err != nil {
+			log.Fatalf("failed to list the nodes: %s", err)
+		}
+		rows, err := peerNodes(peers.Items, nodes.Items)
+		if err != nil {
+			log.Fatalf("failed to select the nodes of the peers: %s", err)
+		}
+		printPeers(os.Stdout, rows)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", cmd)
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+func listPools(ctx context.Context, cl client.Client, namespace string) []v1beta1.IPAddressPool {
+	var pools v1beta1.IPAddressPoolList
+	if err := cl.List(ctx, &pools, client.InNamespace(namespace)); err != nil {
+		log.Fatalf("failed to list the address pools: %s", err)
+	}
+	return pools.Items
+}
+
+func listServices(ctx context.Context, cs kubernetes.Interface) []corev1.Service {
+	services, err := cs.CoreV1().Services(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		log.Fatalf("failed to list the services: %s", err)
+	}
+	return services.Items
+}
@@ -0,0 +1,281 @@
+// SPDX-License-Identifier:Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"go.universe.tf/metallb/api/v1beta1"
+	"go.universe.tf/metallb/api/v1beta2"
+	"go.universe.tf/metallb/internal/config"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// reasonNodeAssigned is the reason of the events the speakers raise on
+// a service when they start announcing it.
+const reasonNodeAssigned = "nodeAssigned"
+
+// poolRow is the usage of an address pool.
+type poolRow struct {
+	name       string
+	autoAssign bool
+	addresses  []string
+	used       int
+	total      *big.Int
+}
+
+// allocationRow is the IPs of a LoadBalancer service.
+type allocationRow struct {
+	namespace string
+	name      string
+	ips       []string
+	pools     []string
+	nodes     []string
+}
+
+// peerRow is a BGP peer and the nodes it is configured on.
+type peerRow struct {
+	name    string
+	address string
+	asn     uint32
+	myASN   uint32
+	vrf     string
+	nodes   []string
+}
+
+// poolCIDRs returns the CIDRs of each pool.
+func poolCIDRs(pools []v1beta1.IPAddressPool) (map[string][]*net.IPNet, error) {
+	ret := map[string][]*net.IPNet{}
+	for _, p := range pools {
+		for _, addr := range p.Spec.Addresses {
+			cidrs, err := config.ParseCIDR(addr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid address %q in pool %q: %s", addr, p.Name, err)
+			}
+			ret[p.Name] = append(ret[p.Name], cidrs...)
+		}
+	}
+	return ret, nil
+}
+
+// poolFor returns the pool the IP belongs to, "" if none.
+func poolFor(pools map[string][]*net.IPNet, ip net.IP) string {
+	for name, cidrs := range pools {
+		for _, cidr := range cidrs {
+			if cidr.Contains(ip) {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// serviceIPs returns the valid IPs of the status of the service.
+func serviceIPs(svc *corev1.Service) []net.IP {
+	var ret []net.IP
+	for _, ingress := range svc.Status.LoadBalancer.Ingress {
+		if ip := net.ParseIP(ingress.IP); ip != nil {
+			ret = append(ret, ip)
+		}
+	}
+	return ret
+}
+
+// poolUsage returns the number of IPs of each pool assigned to the
+// LoadBalancer services, an IP shared by several services counting
+// once, sorted by pool name.
+func poolUsage(pools []v1beta1.IPAddressPool, services []corev1.Service) ([]poolRow, error) {
+	cidrs, err := poolCIDRs(pools)
+	if err != nil {
+		return nil, err
+	}
+	used := map[string]map[string]bool{}
+	for i := range services {
+		if services[i].Spec.Type != corev1.ServiceTypeLoadBalancer {
+			continue
+		}
+		for _, ip := range serviceIPs(&services[i]) {
+			pool := poolFor(cidrs, ip)
+			if pool == "" {
+				continue
+			}
+			if used[pool] == nil {
+				used[pool] = map[string]bool{}
+			}
+			used[pool][ip.String()] = true
+		}
+	}
+
+	ret := []poolRow{}
+	for _, p := range pools {
+		total := big.NewInt(0)
+		for _, cidr := range cidrs[p.Name] {
+			ones, bits := cidr.Mask.Size()
+			total.Add(total, new(big.Int).Lsh(big.NewInt(1), uint(bits-ones)))
+		}
+		ret = append(ret, poolRow{
+			name:       p.Name,
+			autoAssign: p.Spec.AutoAssign == nil || *p.Spec.AutoAssign,
+			addresses:  p.Spec.Addresses,
+			used:       len(used[p.Name]),
+			total:      total,
+		})
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].name < ret[j].name })
+	return ret, nil
+}
+
+// allocations returns the IPs of the LoadBalancer services, the pools
+// they belong to and the nodes announcing them according to the
+// nodeAssigned events, sorted by namespace and name.
+func allocations(pools []v1beta1.IPAddressPool, services []corev1.Service, events []corev1.Event) ([]allocationRow, error) {
+	cidrs, err := poolCIDRs(pools)
+	if err != nil {
+		return nil, err
+	}
+	nodes := announcingNodes(events)
+
+	ret := []allocationRow{}
+	for i := range services {
+		svc := &services[i]
+		if svc.Spec.Type != corev1.ServiceTypeLoadBalancer {
+			continue
+		}
+		row := allocationRow{
+			namespace: svc.Namespace,
+			name:      svc.Name,
+			nodes:     nodes[svc.Namespace+"/"+svc.Name],
+		}
+		for _, ip := range serviceIPs(svc) {
+			row.ips = append(row.ips, ip.String())
+			pool := poolFor(cidrs, ip)
+			if pool == "" {
+				pool = "<none>"
+			}
+			row.pools = append(row.pools, pool)
+		}
+		ret = append(ret, row)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].namespace != ret[j].namespace {
+			return ret[i].namespace < ret[j].namespace
+		}
+		return ret[i].name < ret[j].name
+	})
+	return ret, nil
+}
+
+// announcingNodes returns the sorted nodes announcing each service,
+// indexed by namespace/name, out of the nodeAssigned events.
+func announcingNodes(events []corev1.Event) map[string][]string {
+	seen := map[string]map[string]bool{}
+	for _, e := range events {
+		if e.Reason != reasonNodeAssigned || e.InvolvedObject.Kind != "Service" {
+			continue
+		}
+		var node, protocol string
+		if _, err := fmt.Sscanf(e.Message, "announcing from node %q with protocol %q", &node, &protocol); err != nil {
+			continue
+		}
+		key := e.InvolvedObject.Namespace + "/" + e.InvolvedObject.Name
+		if seen[key] == nil {
+			seen[key] = map[string]bool{}
+		}
+		seen[key][fmt.Sprintf("%s (%s)", node, protocol)] = true
+	}
+	ret := map[string][]string{}
+	for key, nodes := range seen {
+		for n := range nodes {
+			ret[key] = append(ret[key], n)
+		}
+		sort.Strings(ret[key])
+	}
+	return ret
+}
+
+// peerNodes returns the BGP peers and the nodes matching their node
+// selectors, all the nodes if they have none, sorted by peer name.
+func peerNodes(peers []v1beta2.BGPPeer, nodes []corev1.Node) ([]peerRow, error) {
+	ret := []peerRow{}
+	for _, p := range peers {
+		selectors := []labels.Selector{}
+		for _, s := range p.Spec.NodeSelectors {
+			s := s
+			l, err := metav1.LabelSelectorAsSelector(&s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid node selector %v in peer %q: %s", s, p.Name, err)
+			}
+			selectors = append(selectors, l)
+		}
+		if len(selectors) == 0 {
+			selectors = append(selectors, labels.Everything())
+		}
+		row := peerRow{
+			name:    p.Name,
+			address: p.Spec.Address,
+			asn:     p.Spec.ASN,
+			myASN:   p.Spec.MyASN,
+			vrf:     p.Spec.VRFName,
+		}
+		for _, n := range nodes {
+			for _, s := range selectors {
+				if s.Matches(labels.Set(n.Labels)) {
+					row.nodes = append(row.nodes, n.Name)
+					break
+				}
+			}
+		}
+		sort.Strings(row.nodes)
+		ret = append(ret, row)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].name < ret[j].name })
+	return ret, nil
+}
+
+// orNone returns the joined values, "<none>" if there is none.
+func orNone(values []string) string {
+	if len(values) == 0 {
+		return "<none>"
+	}
+	return strings.Join(values, ",")
+}
+
+func printPools(out io.Writer, rows []poolRow) {
+	w := tabwriter.NewWriter(out, 0, 8, 3, ' ', 0)
+	fmt.Fprintln(w, "NAME\tAUTO ASSIGN\tADDRESSES\tIN USE\tTOTAL")
+	for _, r := range rows {
+		fmt.Fprintf(w, "%s\t%t\t%s\t%d\t%s\n", r.name, r.autoAssign, orNone(r.addresses), r.used, r.total)
+	}
+	w.Flush()
+}
+
+func printAllocations(out io.Writer, rows []allocationRow) {
+	w := tabwriter.NewWriter(out, 0, 8, 3, ' ', 0)
+	fmt.Fprintln(w, "NAMESPACE\tNAME\tIPS\tPOOLS\tANNOUNCED FROM")
+	for _, r := range rows {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", r.namespace, r.name, orNone(r.ips), orNone(r.pools), orNone(r.nodes))
+	}
+	w.Flush()
+}
+
+func printPeers(out io.Writer, rows []peerRow) {
+	w := tabwriter.NewWriter(out, 0, 8, 3, ' ', 0)
+	fmt.Fprintln(w, "NAME\tADDRESS\tASN\tMY ASN\tVRF\tNODES")
+	for _, r := range rows {
+		vrf := r.vrf
+		if vrf == "" {
+			vrf = "<none>"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\t%s\n", r.name, r.address, r.asn, r.myASN, vrf, orNone(r.nodes))
+	}
+	w.Flush()
+}
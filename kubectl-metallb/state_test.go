@@ -0,0 +1,167 @@
+// SPDX-License-Identifier:Apache-2.0
+
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"go.universe.tf/metallb/api/v1beta1"
+	"go.universe.tf/metallb/api/v1beta2"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func loadBalancer(namespace, name string, ips ...string) corev1.Service {
+	svc := corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+		Spec:       corev1.ServiceSpec{Type: corev1.ServiceTypeLoadBalancer},
+	}
+	for _, ip := range ips {
+		svc.Status.LoadBalancer.Ingress = append(svc.Status.LoadBalancer.Ingress, corev1.LoadBalancerIngress{IP: ip})
+	}
+	return svc
+}
+
+func testPools() []v1beta1.IPAddressPool {
+	manual := false
+	return []v1beta1.IPAddressPool{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "pool2"},
+			Spec: v1beta1.IPAddressPoolSpec{
+				Addresses:  []string{"1.2.4.0/30"},
+				AutoAssign: &manual,
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "pool1"},
+			Spec:       v1beta1.IPAddressPoolSpec{Addresses: []string{"1.2.3.0/24", "1000::/120"}},
+		},
+	}
+}
+
+func TestPoolUsage(t *testing.T) {
+	clusterIP := loadBalancer("default", "clusterip", "1.2.3.9")
+	clusterIP.Spec.Type = corev1.ServiceTypeClusterIP
+	services := []corev1.Service{
+		loadBalancer("default", "s1", "1.2.3.1", "1000::1"),
+		loadBalancer("default", "s2", "1.2.3.1"),
+		loadBalancer("other", "s3", "1.2.4.2"),
+		loadBalancer("other", "s4", "5.6.7.8"),
+		clusterIP,
+	}
+
+	rows, err := poolUsage(testPools(), services)
+	if err != nil {
+		t.Fatalf("poolUsage failed: %s", err)
+	}
+	want := []struct {
+		name       string
+		autoAssign bool
+		used       int
+		total      string
+	}{
+		{"pool1", true, 2, "512"},
+		{"pool2", false, 1, "4"},
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("expected %d rows, got %d", len(want), len(rows))
+	}
+	for i, w := range want {
+		r := rows[i]
+		if r.name != w.name || r.autoAssign != w.autoAssign || r.used != w.used || r.total.String() != w.total {
+			t.Errorf("row %d: expected %v, got %s %t %d %s", i, w, r.name, r.autoAssign, r.used, r.total)
+		}
+	}
+}
+
+func TestAllocations(t *testing.T) {
+	services := []corev1.Service{
+		loadBalancer("other", "s3", "5.6.7.8"),
+		loadBalancer("default", "s1", "1.2.3.1", "1000::1"),
+		loadBalancer("default", "pending"),
+	}
+	event := func(name, message string) corev1.Event {
+		return corev1.Event{
+			InvolvedObject: corev1.ObjectReference{Kind: "Service", Namespace: "default", Name: name},
+			Reason:         reasonNodeAssigned,
+			Message:        message,
+		}
+	}
+	events := []corev1.Event{
+		event("s1", `announcing from node "node2" with protocol "bgp"`),
+		event("s1", `announcing from node "node1" with protocol "bgp"`),
+		event("s1", `announcing from node "node1" with protocol "bgp"`),
+		event("s1", "unparsable"),
+	}
+
+	rows, err := allocations(testPools(), services, events)
+	if err != nil {
+		t.Fatalf("allocations failed: %s", err)
+	}
+	want := []allocationRow{
+		{namespace: "default", name: "pending"},
+		{
+			namespace: "default",
+			name:      "s1",
+			ips:       []string{"1.2.3.1", "1000::1"},
+			pools:     []string{"pool1", "pool1"},
+			nodes:     []string{"node1 (bgp)", "node2 (bgp)"},
+		},
+		{
+			namespace: "other",
+			name:      "s3",
+			ips:       []string{"5.6.7.8"},
+			pools:     []string{"<none>"},
+		},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Fatalf("expected %+v, got %+v", want, rows)
+	}
+}
+
+func TestPeerNodes(t *testing.T) {
+	node := func(name string, labels map[string]string) corev1.Node {
+		return corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+	}
+	nodes := []corev1.Node{
+		node("node2", map[string]string{"rack": "a"}),
+		node("node1", map[string]string{"rack": "a"}),
+		node("node3", map[string]string{"rack": "b"}),
+	}
+	peers := []v1beta2.BGPPeer{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "tor-a"},
+			Spec: v1beta2.BGPPeerSpec{
+				Address: "10.0.0.1",
+				ASN:     64500,
+				MyASN:   64501,
+				NodeSelectors: []metav1.LabelSelector{
+					{MatchLabels: map[string]string{"rack": "a"}},
+				},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "core"},
+			Spec: v1beta2.BGPPeerSpec{
+				Address: "10.0.1.1",
+				ASN:     64502,
+				MyASN:   64501,
+				VRFName: "red",
+			},
+		},
+	}
+
+	rows, err := peerNodes(peers, nodes)
+	if err != nil {
+		t.Fatalf("peerNodes failed: %s", err)
+	}
+	want := []peerRow{
+		{name: "core", address: "10.0.1.1", asn: 64502, myASN: 64501, vrf: "red", nodes: []string{"node1", "node2", "node3"}},
+		{name: "tor-a", address: "10.0.0.1", asn: 64500, myASN: 64501, nodes: []string{"node1", "node2"}},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Fatalf("expected %+v, got %+v", want, rows)
+	}
+}
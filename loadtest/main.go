@@ -0,0 +1,236 @@
+// SPDX-License-Identifier:Apache-2.0
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const (
+	annotationAddressPool = "metallb.universe.tf/address-pool"
+	pollInterval          = 100 * time.Millisecond
+)
+
+// histogramBuckets are the upper bounds of the latency histogram.
+var histogramBuckets = []time.Duration{
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2 * time.Second,
+	5 * time.Second,
+	10 * time.Second,
+	30 * time.Second,
+	time.Minute,
+}
+
+type result struct {
+	latency time.Duration
+	err     error
+}
+
+func main() {
+	kubeconfig := flag.String("kubeconfig", os.Getenv(clientcmd.RecommendedConfigPathEnvVar), "path to the kubeconfig file")
+	namespace := flag.String("namespace", "default", "namespace to create the services in")
+	services := flag.Int("services", 100, "number of LoadBalancer services to create")
+	concurrency := flag.Int("concurrency", 10, "number of services created or deleted at the same time")
+	pool := flag.String("pool", "", "address pool to request the IPs from, any pool if empty")
+	timeout := flag.Duration("timeout", 5*time.Minute, "maximum time to wait for a service to be assigned an IP or deleted")
+	flag.Parse()
+
+	if *services <= 0 {
+		log.Fatalf("invalid number of services %d", *services)
+	}
+	if *concurrency <= 0 {
+		log.Fatalf("invalid concurrency %d", *concurrency)
+	}
+
+	cfg, err := clientcmd.BuildConfigFromFlags("", *kubeconfig)
+	if err != nil {
+		log.Fatalf("failed to load kubeconfig: %s", err)
+	}
+	// The default client side rate limit would be the bottleneck.
+	cfg.QPS = float32(10 * *concurrency)
+	cfg.Burst = 20 * *concurrency
+	cs, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		log.Fatalf("failed to create the kubernetes client: %s", err)
+	}
+	client := cs.CoreV1().Services(*namespace)
+
+	prefix := fmt.Sprintf("metallb-loadtest-%d", time.Now().Unix())
+	names := make([]string, *services)
+	for i := range names {
+		names[i] = fmt.Sprintf("%s-%d", prefix, i)
+	}
+
+	log.Printf("Creating %d services in namespace %s, %d at a time", *services, *namespace, *concurrency)
+	start := time.Now()
+	assigned := run(names, *concurrency, func(name string) (time.Duration, error) {
+		return createAndWait(client, name, *pool, *timeout)
+	})
+	log.Printf("IP assignment of %d services took %s", *services, time.Since(start))
+	report("IP assignment latency", assigned)
+
+	log.Printf("Deleting %d services, %d at a time", *services, *concurrency)
+	start = time.Now()
+	deleted := run(names, *concurrency, func(name string) (time.Duration, error) {
+		return deleteAndWait(client, name, *timeout)
+	})
+	log.Printf("Cleanup of %d services took %s", *services, time.Since(start))
+	report("Deletion latency", deleted)
+}
+
+// run calls f on each of the given services, with at most concurrency
+// calls in flight, and returns the results in the order of names.
+func run(names []string, concurrency int, f func(string) (time.Duration, error)) []result {
+	res := make([]result, len(names))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				latency, err := f(names[i])
+				if err != nil {
+					log.Printf("%s: %s", names[i], err)
+				}
+				res[i] = result{latency: latency, err: err}
+			}
+		}()
+	}
+	for i := range names {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	return res
+}
+
+// createAndWait creates a LoadBalancer service and returns the time it
+// took for it to be assigned an IP.
+func createAndWait(client typedcorev1.ServiceInterface, name, pool string, timeout time.Duration) (time.Duration, error) {
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+			Labels: map[string]string{
+				"app": "metallb-loadtest",
+			},
+		},
+		Spec: corev1.ServiceSpec{
+			Type: corev1.ServiceTypeLoadBalancer,
+			Selector: map[string]string{
+				"app": "metallb-loadtest",
+			},
+			Ports: []corev1.ServicePort{
+				{
+					Protocol:   corev1.ProtocolTCP,
+					Port:       80,
+					TargetPort: intstr.FromInt(80),
+				},
+			},
+		},
+	}
+	if pool != "" {
+		svc.Annotations = map[string]string{
+			annotationAddressPool: pool,
+		}
+	}
+
+	start := time.Now()
+	if _, err := client.Create(context.Background(), svc, metav1.CreateOptions{}); err != nil {
+		return 0, fmt.Errorf("failed to create service: %w", err)
+	}
+	err := wait.PollImmediate(pollInterval, timeout, func() (bool, error) {
+		s, err := client.Get(context.Background(), name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		return len(s.Status.LoadBalancer.Ingress) > 0, nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("service was not assigned an IP: %w", err)
+	}
+	return time.Since(start), nil
+}
+
+// deleteAndWait deletes a service and returns the time it took for it
+// to be gone.
+func deleteAndWait(client typedcorev1.ServiceInterface, name string, timeout time.Duration) (time.Duration, error) {
+	start := time.Now()
+	err := client.Delete(context.Background(), name, metav1.DeleteOptions{})
+	if apierrors.IsNotFound(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete service: %w", err)
+	}
+	err = wait.PollImmediate(pollInterval, timeout, func() (bool, error) {
+		_, err := client.Get(context.Background(), name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("service was not deleted: %w", err)
+	}
+	return time.Since(start), nil
+}
+
+// report prints the percentiles and the histogram of the successful
+// results.
+func report(title string, results []result) {
+	var latencies []time.Duration
+	failed := 0
+	for _, r := range results {
+		if r.err != nil {
+			failed++
+			continue
+		}
+		latencies = append(latencies, r.latency)
+	}
+
+	fmt.Printf("\n%s (%d succeeded, %d failed)\n", title, len(latencies), failed)
+	if len(latencies) == 0 {
+		return
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	percentile := func(p int) time.Duration {
+		return latencies[(len(latencies)-1)*p/100]
+	}
+	fmt.Printf("  min %s, p50 %s, p90 %s, p99 %s, max %s\n",
+		latencies[0], percentile(50), percentile(90), percentile(99), latencies[len(latencies)-1])
+
+	counts := make([]int, len(histogramBuckets)+1)
+	for _, l := range latencies {
+		i := sort.Search(len(histogramBuckets), func(i int) bool { return l <= histogramBuckets[i] })
+		counts[i]++
+	}
+	for i, c := range counts {
+		bound := "+Inf"
+		if i < len(histogramBuckets) {
+			bound = histogramBuckets[i].String()
+		}
+		bar := strings.Repeat("#", c*50/len(latencies))
+		fmt.Printf("  <= %-6s %6d %s\n", bound, c, bar)
+	}
+}
@@ -16,14 +16,18 @@ package main
 
 import (
 	"fmt"
+	"hash/fnv"
+	"math/rand"
 	"net"
 	"reflect"
 	"sort"
 	"strconv"
+	"time"
 
 	"go.universe.tf/metallb/internal/bgp"
 	bgpfrr "go.universe.tf/metallb/internal/bgp/frr"
 	bgpnative "go.universe.tf/metallb/internal/bgp/native"
+	"go.universe.tf/metallb/internal/bgp/policy"
 	"go.universe.tf/metallb/internal/config"
 	"go.universe.tf/metallb/internal/k8s/epslices"
 	"go.universe.tf/metallb/internal/logging"
@@ -42,22 +46,43 @@ const (
 	bgpFrr    bgpImplementation = "frr"
 )
 
+// annotationRouterID sets the router ID of the node's sessions with
+// the peers that don't set one.
+const annotationRouterID = "metallb.universe.tf/bgp-router-id"
+
 type peer struct {
 	cfg     *config.Peer
 	session bgp.Session
+	// The routes announced to the peer, all if nil.
+	policy *policy.Policy
 }
 
 type bgpController struct {
 	logger         log.Logger
 	myNode         string
 	nodeLabels     labels.Set
+	nodeRouterID   net.IP
 	peers          []*peer
 	svcAds         map[string][]*bgp.Advertisement
+	svcPools       map[string]string // service name -> pool name
+	pools          map[string]*config.Pool
 	bgpType        bgpImplementation
 	sessionManager bgp.SessionManager
 }
 
 func (c *bgpController) SetConfig(l log.Logger, cfg *config.Config) error {
+	policies := map[*config.Peer]*policy.Policy{}
+	for _, p := range cfg.Peers {
+		if p.RoutePolicy == "" {
+			continue
+		}
+		pol, err := policy.Parse(p.RoutePolicy)
+		if err != nil {
+			return errors.Wrapf(err, "invalid route policy for peer %s", p.Name)
+		}
+		policies[p] = pol
+	}
+
 	newPeers := make([]*peer, 0, len(cfg.Peers))
 newPeers:
 	for _, p := range cfg.Peers {
@@ -73,9 +98,11 @@ newPeers:
 		}
 		// No existing peers match, create a new one.
 		newPeers = append(newPeers, &peer{
-			cfg: p,
+			cfg:    p,
+			policy: policies[p],
 		})
 	}
+	c.pools = cfg.Pools
 
 	oldPeers := c.peers
 	c.peers = newPeers
@@ -212,11 +239,29 @@ func (c *bgpController) syncPeers(l log.Logger) error {
 			// Session doesn't exist, but should be running. Create
 			// it.
 			level.Info(l).Log("event", "peerAdded", "peer", p.cfg.Addr, "msg", "peer configured, starting BGP session")
-			var routerID net.IP
+			routerID := c.nodeRouterID
 			if p.cfg.RouterID != nil {
 				routerID = p.cfg.RouterID
 			}
-			s, err := c.sessionManager.NewSession(c.logger, net.JoinHostPort(p.cfg.Addr.String(), strconv.Itoa(int(p.cfg.Port))), p.cfg.SrcAddr, p.cfg.MyASN, routerID, p.cfg.ASN, p.cfg.HoldTime, p.cfg.KeepaliveTime, p.cfg.Password, c.myNode, p.cfg.BFDProfile, p.cfg.EBGPMultiHop, p.cfg.Name)
+			s, err := c.sessionManager.NewSession(c.logger,
+				bgp.SessionParameters{
+					PeerAddress:     net.JoinHostPort(p.cfg.Addr.String(), strconv.Itoa(int(p.cfg.Port))),
+					SourceAddress:   p.cfg.SrcAddr,
+					MyASN:           p.cfg.MyASN,
+					RouterID:        routerID,
+					PeerASN:         p.cfg.ASN,
+					HoldTime:        p.cfg.HoldTime,
+					KeepAliveTime:   p.cfg.KeepaliveTime,
+					WatchdogTimeout: p.cfg.SessionWatchdogTimeout,
+					InitialDelay:    initialDelay(p.cfg),
+					Password:        p.cfg.Password,
+					CurrentNode:     c.myNode,
+					BFDProfile:      p.cfg.BFDProfile,
+					VRFName:         p.cfg.VRF,
+					EBGPMultiHop:    p.cfg.EBGPMultiHop,
+					GracefulRestart: p.cfg.EnableGracefulRestart,
+					SessionName:     p.cfg.Name,
+				})
 			if err != nil {
 				level.Error(l).Log("op", "syncPeers", "error", err, "peer", p.cfg.Addr, "msg", "failed to create BGP session")
 				errs++
@@ -249,6 +294,12 @@ func (c *bgpController) syncBFDProfiles(profiles map[string]*config.BFDProfile)
 
 func (c *bgpController) SetBalancer(l log.Logger, name string, lbIPs []net.IP, pool *config.Pool) error {
 	c.svcAds[name] = nil
+	c.svcPools[name] = ""
+	for poolName, p := range c.pools {
+		if p == pool {
+			c.svcPools[name] = poolName
+		}
+	}
 	for _, lbIP := range lbIPs {
 		for _, adCfg := range pool.BGPAdvertisements {
 			// skipping if this node is not enabled for this advertisement
@@ -274,6 +325,9 @@ func (c *bgpController) SetBalancer(l log.Logger, name string, lbIPs []net.IP, p
 				ad.Communities = append(ad.Communities, comm)
 			}
 			sort.Slice(ad.Communities, func(i, j int) bool { return ad.Communities[i] < ad.Communities[j] })
+			if ones, bits := m.Size(); bits == 128 && ones == 128 {
+				ad.FlowLabel = flowLabelFor(name)
+			}
 			c.svcAds[name] = append(c.svcAds[name], ad)
 		}
 	}
@@ -301,41 +355,194 @@ func (c *bgpController) updateAds() error {
 		if peer.session == nil {
 			continue
 		}
-		if err := peer.session.Set(allAds...); err != nil {
+		ads := allAds
+		if peer.policy != nil {
+			ads = c.adsMatching(peer.policy)
+		}
+		if !peer.cfg.FlowLabelECMPEnabled {
+			ads = withoutFlowLabel(ads)
+		}
+		if err := peer.session.Set(ads...); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+// adsMatching returns the advertisements of all the services matching
+// the route policy.
+func (c *bgpController) adsMatching(pol *policy.Policy) []*bgp.Advertisement {
+	var res []*bgp.Advertisement
+	for svc, ads := range c.svcAds {
+		for _, ad := range ads {
+			if pol.Match(c.routeFor(svc, ad)) {
+				res = append(res, ad)
+			}
+		}
+	}
+	return res
+}
+
+// routeFor returns the route the route policies see for the given
+// advertisement of the service.
+func (c *bgpController) routeFor(svc string, ad *bgp.Advertisement) policy.Route {
+	route := policy.Route{
+		Pool:      c.svcPools[svc],
+		Prefix:    ad.Prefix.String(),
+		LocalPref: ad.LocalPref,
+	}
+	for _, comm := range ad.Communities {
+		route.Communities = append(route.Communities, config.CommunityToString(comm))
+	}
+	return route
+}
+
+// AnnouncedVia returns the sorted names of the peers with a session
+// the IPs of the service are advertised to.
+func (c *bgpController) AnnouncedVia(name string) []string {
+	res := []string{}
+	for _, p := range c.peers {
+		if p.session == nil {
+			continue
+		}
+		for _, ad := range c.svcAds[name] {
+			if !ad.MatchesPeer(p.cfg.Name) {
+				continue
+			}
+			if p.policy != nil && !p.policy.Match(c.routeFor(name, ad)) {
+				continue
+			}
+			res = append(res, p.cfg.Name)
+			break
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// flowLabelFor returns a stable, non zero, 20 bits IPv6 flow label
+// derived from the given service name.
+func flowLabelFor(svc string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(svc))
+	label := h.Sum32() & 0xfffff
+	if label == 0 {
+		// Zero means the flow is not labeled, per RFC 6437.
+		label = 1
+	}
+	return label
+}
+
+// withoutFlowLabel returns the given advertisements with their flow
+// label stripped, for peers that didn't ask for it.
+func withoutFlowLabel(ads []*bgp.Advertisement) []*bgp.Advertisement {
+	labeled := false
+	for _, ad := range ads {
+		if ad.FlowLabel != 0 {
+			labeled = true
+			break
+		}
+	}
+	if !labeled {
+		return ads
+	}
+	res := make([]*bgp.Advertisement, 0, len(ads))
+	for _, ad := range ads {
+		if ad.FlowLabel != 0 {
+			stripped := *ad
+			stripped.FlowLabel = 0
+			ad = &stripped
+		}
+		res = append(res, ad)
+	}
+	return res
+}
+
 func (c *bgpController) DeleteBalancer(l log.Logger, name, reason string) error {
 	if _, ok := c.svcAds[name]; !ok {
 		return nil
 	}
 	delete(c.svcAds, name)
+	delete(c.svcPools, name)
 	return c.updateAds()
 }
 
 func (c *bgpController) SetNode(l log.Logger, node *v1.Node) error {
+	routerID, err := nodeRouterID(node)
+	if err != nil {
+		level.Error(l).Log("op", "setNode", "error", err, "msg", "ignoring the router ID of the node")
+	}
 	nodeLabels := node.Labels
 	if nodeLabels == nil {
 		nodeLabels = map[string]string{}
 	}
 	ns := labels.Set(nodeLabels)
-	if c.nodeLabels != nil && labels.Equals(c.nodeLabels, ns) {
-		// Node labels unchanged, no action required.
+	routerIDChanged := !routerID.Equal(c.nodeRouterID)
+	if c.nodeLabels != nil && labels.Equals(c.nodeLabels, ns) && !routerIDChanged {
+		// Node labels and router ID unchanged, no action required.
 		return nil
 	}
+	if routerIDChanged {
+		c.nodeRouterID = routerID
+		level.Info(l).Log("event", "nodeRouterIDChanged", "routerID", routerID, "msg", "Node router ID changed, restarting BGP sessions")
+		// syncPeers recreates the sessions closed here with the new
+		// router ID.
+		for _, p := range c.peers {
+			if p.session == nil || p.cfg.RouterID != nil {
+				continue
+			}
+			if err := p.session.Close(); err != nil {
+				level.Error(l).Log("op", "setNode", "error", err, "peer", p.cfg.Addr, "msg", "failed to shut down BGP session")
+			}
+			p.session = nil
+		}
+	}
 	c.nodeLabels = ns
 	level.Info(l).Log("event", "nodeLabelsChanged", "msg", "Node labels changed, resyncing BGP peers")
 	return c.syncPeers(l)
 }
 
+// nodeRouterID returns the router ID set by the annotation of the
+// node, nil if there is none.
+func nodeRouterID(node *v1.Node) (net.IP, error) {
+	s, ok := node.Annotations[annotationRouterID]
+	if !ok {
+		return nil, nil
+	}
+	ip := net.ParseIP(s)
+	if ip == nil || ip.To4() == nil {
+		return nil, fmt.Errorf("invalid router ID %q in annotation %s: must be an IPv4 address", s, annotationRouterID)
+	}
+	return ip.To4(), nil
+}
+
+// sessionFlapping reports that the BGP session with the given peer
+// keeps going down.
+func (c *controller) sessionFlapping(name, addr string) {
+	if c.client == nil || name == "" {
+		return
+	}
+	c.client.PeerErrorf(name, "BGPSessionFlapping", "BGP session with %s from node %s went down more than %d times in %s",
+		addr, c.myNode, bgpnative.FlapThreshold, bgpnative.FlapWindow)
+}
+
+// sessionAlarm reports on the speaker pod that the BGP session with
+// the given peer breached a threshold of the alarm policy.
+func (c *controller) sessionAlarm(name, addr, reason, message string) {
+	if c.client == nil || c.myPod == "" {
+		return
+	}
+	c.client.PodErrorf(c.myPod, reason, "%s (peer %s, node %s)", message, name, c.myNode)
+}
+
 // Create a new 'bgp.SessionManager' of type 'bgpType'.
-var newBGP = func(bgpType bgpImplementation, l log.Logger, logLevel logging.Level) bgp.SessionManager {
+// flapping is called when a session is flapping, and the sessions are
+// checked against alarms. Both are only supported by the native
+// implementation.
+var newBGP = func(bgpType bgpImplementation, l log.Logger, logLevel logging.Level, flapping func(name, addr string), alarms bgpnative.SessionAlarmPolicy) bgp.SessionManager {
 	switch bgpType {
 	case bgpNative:
-		return bgpnative.NewSessionManager(l)
+		return bgpnative.NewSessionManager(l, flapping, alarms)
 	case bgpFrr:
 		return bgpfrr.NewSessionManager(l, logLevel)
 	default:
@@ -351,3 +558,14 @@ func poolMatchesNodeBGP(pool *config.Pool, node string) bool {
 	}
 	return false
 }
+
+// initialDelay returns how long the session to the peer waits before
+// connecting, so the speakers restarting together don't all connect
+// at once.
+func initialDelay(p *config.Peer) time.Duration {
+	delay := p.InitialDelay
+	if p.InitialJitter > 0 {
+		delay += time.Duration(rand.Int63n(int64(p.InitialJitter)))
+	}
+	return delay
+}
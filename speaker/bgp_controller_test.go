@@ -12,6 +12,8 @@ import (
 	"time"
 
 	"go.universe.tf/metallb/internal/bgp"
+	bgpnative "go.universe.tf/metallb/internal/bgp/native"
+	"go.universe.tf/metallb/internal/bgp/policy"
 	"go.universe.tf/metallb/internal/config"
 	"go.universe.tf/metallb/internal/k8s/controllers"
 	"go.universe.tf/metallb/internal/k8s/epslices"
@@ -91,9 +93,10 @@ type fakeBGP struct {
 	sessionManager fakeBGPSessionManager
 }
 
-func (f *fakeBGP) NewSessionManager(_ bgpImplementation, _ log.Logger, _ logging.Level) bgp.SessionManager {
+func (f *fakeBGP) NewSessionManager(_ bgpImplementation, _ log.Logger, _ logging.Level, _ func(string, string), _ bgpnative.SessionAlarmPolicy) bgp.SessionManager {
 	f.sessionManager.t = f.t
 	f.sessionManager.gotAds = make(map[string][]*bgp.Advertisement)
+	f.sessionManager.routerIDs = make(map[string]net.IP)
 
 	return &f.sessionManager
 }
@@ -104,9 +107,12 @@ type fakeBGPSessionManager struct {
 	sync.Mutex
 	// peer IP -> advertisements
 	gotAds map[string][]*bgp.Advertisement
+	// peer IP -> router ID of the session
+	routerIDs map[string]net.IP
 }
 
-func (f *fakeBGPSessionManager) NewSession(_ log.Logger, addr string, _ net.IP, _ uint32, _ net.IP, _ uint32, _ time.Duration, _ time.Duration, _, _, _ string, _ bool, name string) (bgp.Session, error) {
+func (f *fakeBGPSessionManager) NewSession(_ log.Logger, args bgp.SessionParameters) (bgp.Session, error) {
+	addr := args.PeerAddress
 	f.Lock()
 	defer f.Unlock()
 
@@ -117,6 +123,7 @@ func (f *fakeBGPSessionManager) NewSession(_ log.Logger, addr string, _ net.IP,
 	// Nil because we haven't programmed any routes for it yet, but
 	// the key now exists in the map.
 	f.gotAds[addr] = nil
+	f.routerIDs[addr] = args.RouterID
 	return &fakeSession{
 		f:    f,
 		addr: addr,
@@ -186,6 +193,7 @@ func (f *fakeSession) Set(ads ...*bgp.Advertisement) error {
 // to do to k8s.
 type testK8S struct {
 	loggedWarning bool
+	reprocessed   map[string]time.Duration
 	t             *testing.T
 }
 
@@ -202,6 +210,23 @@ func (s *testK8S) Errorf(_ *v1.Service, evtType string, msg string, args ...inte
 	s.loggedWarning = true
 }
 
+func (s *testK8S) PeerErrorf(_ string, evtType string, msg string, args ...interface{}) {
+	s.t.Logf("k8s Warning event %q: %s", evtType, fmt.Sprintf(msg, args...))
+	s.loggedWarning = true
+}
+
+func (s *testK8S) PodErrorf(_ string, evtType string, msg string, args ...interface{}) {
+	s.t.Logf("k8s Warning event %q: %s", evtType, fmt.Sprintf(msg, args...))
+	s.loggedWarning = true
+}
+
+func (s *testK8S) ReprocessServiceAfter(name string, after time.Duration) {
+	if s.reprocessed == nil {
+		s.reprocessed = map[string]time.Duration{}
+	}
+	s.reprocessed[name] = after
+}
+
 func TestBGPSpeaker(t *testing.T) {
 	b := &fakeBGP{
 		t: t,
@@ -2056,3 +2081,263 @@ func TestNodeSelectors(t *testing.T) {
 		}
 	}
 }
+
+func TestBGPAnnouncedVia(t *testing.T) {
+	prodOnly, err := policy.Parse("pool == 'prod'")
+	if err != nil {
+		t.Fatalf("parsing the policy: %s", err)
+	}
+	c := &bgpController{
+		peers: []*peer{
+			{cfg: &config.Peer{Name: "all"}, session: &fakeSession{}},
+			{cfg: &config.Peer{Name: "down"}},
+			{cfg: &config.Peer{Name: "prod"}, session: &fakeSession{}, policy: prodOnly},
+			{cfg: &config.Peer{Name: "selected"}, session: &fakeSession{}},
+		},
+		svcPools: map[string]string{
+			"svc1": "prod",
+			"svc2": "dev",
+		},
+		svcAds: map[string][]*bgp.Advertisement{
+			"svc1": {{Prefix: ipnet("10.20.30.1/32")}},
+			"svc2": {{Prefix: ipnet("10.20.30.2/32"), Peers: []string{"selected", "prod"}}},
+		},
+	}
+
+	tests := map[string][]string{
+		"svc1": {"all", "prod", "selected"},
+		"svc2": {"selected"},
+		"svc3": {},
+	}
+	for svc, want := range tests {
+		if diff := cmp.Diff(want, c.AnnouncedVia(svc)); diff != "" {
+			t.Errorf("%s: unexpected peers (-want +got)\n%s", svc, diff)
+		}
+	}
+}
+
+func TestNodeRouterID(t *testing.T) {
+	b := &fakeBGP{
+		t: t,
+	}
+	newBGP = b.NewSessionManager
+	c, err := newController(controllerConfig{
+		MyNode:        "pandora",
+		DisableLayer2: true,
+		bgpType:       bgpNative,
+	})
+	if err != nil {
+		t.Fatalf("creating controller: %s", err)
+	}
+	c.client = &testK8S{t: t}
+
+	l := log.NewNopLogger()
+	cfg := &config.Config{
+		Peers: []*config.Peer{
+			{
+				Addr:          net.ParseIP("1.2.3.4"),
+				NodeSelectors: []labels.Selector{labels.Everything()},
+			},
+			{
+				Addr:          net.ParseIP("2.3.4.5"),
+				RouterID:      net.ParseIP("10.0.0.1"),
+				NodeSelectors: []labels.Selector{labels.Everything()},
+			},
+		},
+	}
+	if c.SetConfig(l, cfg) == controllers.SyncStateError {
+		t.Fatalf("SetConfig failed")
+	}
+
+	tests := []struct {
+		desc          string
+		annotations   map[string]string
+		wantRouterIDs map[string]net.IP
+	}{
+		{
+			desc: "No annotation",
+			wantRouterIDs: map[string]net.IP{
+				"1.2.3.4:0": nil,
+				"2.3.4.5:0": net.ParseIP("10.0.0.1"),
+			},
+		},
+		{
+			desc:        "Annotation set",
+			annotations: map[string]string{annotationRouterID: "10.0.0.2"},
+			wantRouterIDs: map[string]net.IP{
+				"1.2.3.4:0": net.ParseIP("10.0.0.2").To4(),
+				"2.3.4.5:0": net.ParseIP("10.0.0.1"),
+			},
+		},
+		{
+			desc:        "Annotation changed",
+			annotations: map[string]string{annotationRouterID: "10.0.0.3"},
+			wantRouterIDs: map[string]net.IP{
+				"1.2.3.4:0": net.ParseIP("10.0.0.3").To4(),
+				"2.3.4.5:0": net.ParseIP("10.0.0.1"),
+			},
+		},
+		{
+			desc:        "Invalid annotation",
+			annotations: map[string]string{annotationRouterID: "2001:db8::1"},
+			wantRouterIDs: map[string]net.IP{
+				"1.2.3.4:0": nil,
+				"2.3.4.5:0": net.ParseIP("10.0.0.1"),
+			},
+		},
+	}
+
+	for _, test := range tests {
+		node := &v1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Annotations: test.annotations,
+			},
+		}
+		if c.SetNode(l, node) == controllers.SyncStateError {
+			t.Errorf("%q: SetNode failed", test.desc)
+		}
+		b.sessionManager.Lock()
+		got := b.sessionManager.routerIDs
+		b.sessionManager.Unlock()
+		if diff := cmp.Diff(test.wantRouterIDs, got); diff != "" {
+			t.Errorf("%q: unexpected router IDs (-want +got)\n%s", test.desc, diff)
+		}
+	}
+}
+
+func TestFlowLabel(t *testing.T) {
+	l1 := flowLabelFor("ns1/svc1")
+	if l1 == 0 || l1 > 0xfffff {
+		t.Fatalf("invalid flow label %d", l1)
+	}
+	if l := flowLabelFor("ns1/svc1"); l != l1 {
+		t.Fatalf("flow label not stable, got %d and %d", l1, l)
+	}
+	if l := flowLabelFor("ns2/svc1"); l == l1 {
+		t.Fatalf("flow labels of different services collide on %d", l)
+	}
+
+	ads := []*bgp.Advertisement{
+		{
+			Prefix:    ipnet("1000::1/128"),
+			FlowLabel: l1,
+		},
+		{
+			Prefix: ipnet("10.20.30.1/32"),
+		},
+	}
+	stripped := withoutFlowLabel(ads)
+	for _, ad := range stripped {
+		if ad.FlowLabel != 0 {
+			t.Fatalf("flow label not stripped from %s", ad.Prefix)
+		}
+	}
+	if ads[0].FlowLabel != l1 {
+		t.Fatalf("stripping the flow label modified the original advertisement")
+	}
+}
+
+func TestInitialDelay(t *testing.T) {
+	p := &config.Peer{InitialDelay: 2 * time.Second}
+	if got := initialDelay(p); got != 2*time.Second {
+		t.Fatalf("expected a delay of 2s without jitter, got %s", got)
+	}
+
+	p.InitialJitter = 5 * time.Second
+	for i := 0; i < 100; i++ {
+		got := initialDelay(p)
+		if got < 2*time.Second || got >= 7*time.Second {
+			t.Fatalf("delay %s is out of [2s, 7s)", got)
+		}
+	}
+}
+
+func TestRoutePolicy(t *testing.T) {
+	b := &fakeBGP{
+		t: t,
+	}
+	newBGP = b.NewSessionManager
+	c, err := newController(controllerConfig{
+		MyNode:        "pandora",
+		DisableLayer2: true,
+		bgpType:       bgpNative,
+	})
+	if err != nil {
+		t.Fatalf("creating controller: %s", err)
+	}
+	c.client = &testK8S{t: t}
+
+	cfg := &config.Config{
+		Peers: []*config.Peer{
+			{
+				Addr:          net.ParseIP("1.2.3.4"),
+				NodeSelectors: []labels.Selector{labels.Everything()},
+			},
+			{
+				Addr:          net.ParseIP("2.3.4.5"),
+				NodeSelectors: []labels.Selector{labels.Everything()},
+				RoutePolicy:   "pool == 'prod' && community contains '64512:100'",
+			},
+		},
+		Pools: map[string]*config.Pool{
+			"prod": {
+				CIDR: []*net.IPNet{ipnet("10.20.30.0/24")},
+				BGPAdvertisements: []*config.BGPAdvertisement{
+					{
+						AggregationLength: 32,
+						Communities:       map[uint32]bool{0xfc000064: true},
+						Nodes:             map[string]bool{"pandora": true},
+					},
+					{
+						AggregationLength: 24,
+						Nodes:             map[string]bool{"pandora": true},
+					},
+				},
+			},
+			"dev": {
+				CIDR: []*net.IPNet{ipnet("10.20.40.0/24")},
+				BGPAdvertisements: []*config.BGPAdvertisement{
+					{
+						AggregationLength: 32,
+						Communities:       map[uint32]bool{0xfc000064: true},
+						Nodes:             map[string]bool{"pandora": true},
+					},
+				},
+			},
+		},
+	}
+
+	l := log.NewNopLogger()
+	if c.SetConfig(l, cfg) == controllers.SyncStateError {
+		t.Fatalf("SetConfig failed")
+	}
+	handler := c.protocolHandlers[config.BGP]
+	if err := handler.SetBalancer(l, "prod-svc", []net.IP{net.ParseIP("10.20.30.1")}, cfg.Pools["prod"]); err != nil {
+		t.Fatalf("SetBalancer(prod-svc) failed: %s", err)
+	}
+	if err := handler.SetBalancer(l, "dev-svc", []net.IP{net.ParseIP("10.20.40.1")}, cfg.Pools["dev"]); err != nil {
+		t.Fatalf("SetBalancer(dev-svc) failed: %s", err)
+	}
+
+	prodHost := &bgp.Advertisement{
+		Prefix:      ipnet("10.20.30.1/32"),
+		Communities: []uint32{0xfc000064},
+	}
+	prodAggregate := &bgp.Advertisement{
+		Prefix: ipnet("10.20.30.0/24"),
+	}
+	devHost := &bgp.Advertisement{
+		Prefix:      ipnet("10.20.40.1/32"),
+		Communities: []uint32{0xfc000064},
+	}
+	wantAds := map[string][]*bgp.Advertisement{
+		"1.2.3.4:0": {prodHost, prodAggregate, devHost},
+		"2.3.4.5:0": {prodHost},
+	}
+	gotAds := b.sessionManager.Ads()
+	sortAds(wantAds)
+	sortAds(gotAds)
+	if diff := cmp.Diff(wantAds, gotAds); diff != "" {
+		t.Errorf("unexpected advertisement state (-want +got)\n%s", diff)
+	}
+}
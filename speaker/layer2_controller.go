@@ -19,6 +19,7 @@ import (
 	"crypto/sha256"
 	"net"
 	"sort"
+	"strings"
 
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
@@ -28,6 +29,10 @@ import (
 	v1 "k8s.io/api/core/v1"
 )
 
+// annotationSoftNodeAffinity makes the node hosting the only ready
+// endpoint of the service announce it, when it is eligible.
+const annotationSoftNodeAffinity = "metallb.universe.tf/soft-node-affinity"
+
 type layer2Controller struct {
 	announcer *layer2.Announce
 	myNode    string
@@ -112,6 +117,33 @@ func (c *layer2Controller) ShouldAnnounce(l log.Logger, name string, toAnnounce
 	} else {
 		nodes = nodesWithActiveSpeakers(forPool)
 	}
+	// With multi-path L2, all the eligible nodes announce the IP and
+	// the switches pick the MAC(s) to send the traffic to.
+	if pool.MultiPathL2 {
+		for _, n := range nodes {
+			if n == c.myNode {
+				return ""
+			}
+		}
+		return "notOwner"
+	}
+
+	// Prefer the node of the only endpoint, saving a hop, as long as it
+	// has a healthy speaker. Otherwise, fall back to the election.
+	if svc.Annotations[annotationSoftNodeAffinity] == "true" {
+		if preferred, ok := singleEndpointNode(eps); ok {
+			for _, n := range nodes {
+				if n != preferred {
+					continue
+				}
+				if preferred == c.myNode {
+					return ""
+				}
+				return "notOwner"
+			}
+		}
+	}
+
 	// Using the first IP should work for both single and dual stack.
 	ipString := toAnnounce[0].String()
 	// Sort the slice by the hash of node + load balancer ips. This
@@ -148,6 +180,12 @@ func (c *layer2Controller) DeleteBalancer(l log.Logger, name, reason string) err
 	return nil
 }
 
+// AnnouncedVia returns the interfaces answering for the IPs of the
+// service.
+func (c *layer2Controller) AnnouncedVia(name string) []string {
+	return c.announcer.Interfaces(name)
+}
+
 func (c *layer2Controller) SetNode(log.Logger, *v1.Node) error {
 	c.sList.Rejoin()
 	return nil
@@ -162,6 +200,48 @@ func nodesWithActiveSpeakers(speakers map[string]bool) []string {
 	return ret
 }
 
+// singleEndpointNode returns the node of the endpoint, if there is
+// exactly one ready endpoint. The addresses of the same pod, e.g. of
+// both families for a dual-stack pod, count as one endpoint.
+func singleEndpointNode(eps epslices.EpsOrSlices) (string, bool) {
+	nodes := map[string]*string{} // endpoint -> node
+	switch eps.Type {
+	case epslices.Eps:
+		for _, subset := range eps.EpVal.Subsets {
+			for _, ep := range subset.Addresses {
+				nodes[endpointKey(ep.TargetRef, ep.IP)] = ep.NodeName
+			}
+		}
+	case epslices.Slices:
+		for _, slice := range eps.SlicesVal {
+			for _, ep := range slice.Endpoints {
+				if !epslices.IsConditionReady(ep.Conditions) {
+					continue
+				}
+				nodes[endpointKey(ep.TargetRef, strings.Join(ep.Addresses, ","))] = ep.NodeName
+			}
+		}
+	}
+	if len(nodes) != 1 {
+		return "", false
+	}
+	for _, node := range nodes {
+		if node != nil {
+			return *node, true
+		}
+	}
+	return "", false
+}
+
+// endpointKey identifies an endpoint by the object it targets, or by
+// its addresses when it targets none.
+func endpointKey(ref *v1.ObjectReference, addresses string) string {
+	if ref == nil {
+		return addresses
+	}
+	return ref.Kind + "/" + ref.Namespace + "/" + ref.Name
+}
+
 // activeEndpointExists returns true if at least one endpoint is active.
 func activeEndpointExists(eps epslices.EpsOrSlices) bool {
 	switch eps.Type {
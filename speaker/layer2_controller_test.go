@@ -31,6 +31,8 @@ func (sl *fakeSpeakerList) UsableSpeakers() map[string]bool {
 
 func (sl *fakeSpeakerList) Rejoin() {}
 
+func (sl *fakeSpeakerList) SetUsable(bool) {}
+
 func compareUseableNodesReturnedValue(a, b []string) bool {
 	if &a == &b {
 		return true
@@ -2498,3 +2500,212 @@ func TestClusterPolicy(t *testing.T) {
 		t.Fatalf("All services assigned to speaker1")
 	}
 }
+
+func TestShouldAnnounceMultiPath(t *testing.T) {
+	fakeSL := &fakeSpeakerList{
+		speakers: map[string]bool{
+			"iris1": true,
+			"iris2": true,
+			"iris3": true,
+		},
+	}
+	speakers := map[string]*controller{}
+	for _, node := range []string{"iris1", "iris2", "iris3"} {
+		c, err := newController(controllerConfig{
+			MyNode: node,
+			Logger: log.NewLogfmtLogger(log.NewSyncWriter(os.Stderr)),
+			SList:  fakeSL,
+		})
+		if err != nil {
+			t.Fatalf("creating controller: %s", err)
+		}
+		c.client = &testK8S{t: t}
+		speakers[node] = c
+	}
+
+	pool := &config.Pool{
+		CIDR:        []*net.IPNet{ipnet("10.20.30.0/24")},
+		MultiPathL2: true,
+		L2Advertisements: []*config.L2Advertisement{
+			{
+				Nodes: map[string]bool{
+					"iris1": true,
+					"iris2": true,
+				},
+			},
+		},
+	}
+	eps := epslices.EpsOrSlices{
+		SlicesVal: []discovery.EndpointSlice{
+			{
+				Endpoints: []discovery.Endpoint{
+					{
+						Addresses: []string{
+							"2.3.4.5",
+						},
+						NodeName: stringPtr("iris1"),
+						Conditions: discovery.EndpointConditions{
+							Ready: pointer.BoolPtr(true),
+						},
+					},
+				},
+			},
+		},
+		Type: epslices.Slices,
+	}
+
+	tests := []struct {
+		desc   string
+		policy v1.ServiceExternalTrafficPolicyType
+		want   map[string]string
+	}{
+		{
+			desc:   "cluster policy, all the nodes matching the advertisement announce",
+			policy: v1.ServiceExternalTrafficPolicyTypeCluster,
+			want: map[string]string{
+				"iris1": "",
+				"iris2": "",
+				"iris3": "notOwner",
+			},
+		},
+		{
+			desc:   "local policy, only the nodes with endpoints announce",
+			policy: v1.ServiceExternalTrafficPolicyTypeLocal,
+			want: map[string]string{
+				"iris1": "",
+				"iris2": "notOwner",
+				"iris3": "notOwner",
+			},
+		},
+	}
+
+	l := log.NewNopLogger()
+	lbIP := net.ParseIP("10.20.30.1")
+	for _, test := range tests {
+		svc := &v1.Service{
+			Spec: v1.ServiceSpec{
+				Type:                  "LoadBalancer",
+				ExternalTrafficPolicy: test.policy,
+			},
+			Status: statusAssigned("10.20.30.1"),
+		}
+		for node, c := range speakers {
+			got := c.protocolHandlers[config.Layer2].ShouldAnnounce(l, "test1", []net.IP{lbIP}, pool, svc, eps)
+			if got != test.want[node] {
+				t.Errorf("%s: node %s got %q, want %q", test.desc, node, got, test.want[node])
+			}
+		}
+	}
+}
+
+func TestShouldAnnounceSoftNodeAffinity(t *testing.T) {
+	fakeSL := &fakeSpeakerList{
+		speakers: map[string]bool{
+			"iris1": true,
+			"iris2": true,
+			"iris3": true,
+		},
+	}
+	speakers := map[string]*controller{}
+	for _, node := range []string{"iris1", "iris2", "iris3"} {
+		c, err := newController(controllerConfig{
+			MyNode: node,
+			Logger: log.NewLogfmtLogger(log.NewSyncWriter(os.Stderr)),
+			SList:  fakeSL,
+		})
+		if err != nil {
+			t.Fatalf("creating controller: %s", err)
+		}
+		c.client = &testK8S{t: t}
+		speakers[node] = c
+	}
+
+	pool := &config.Pool{
+		CIDR: []*net.IPNet{ipnet("10.20.30.0/24")},
+		L2Advertisements: []*config.L2Advertisement{
+			{
+				Nodes: map[string]bool{
+					"iris1": true,
+					"iris2": true,
+					"iris3": true,
+				},
+			},
+		},
+	}
+	endpoint := func(node, pod, address string) discovery.Endpoint {
+		return discovery.Endpoint{
+			Addresses: []string{address},
+			NodeName:  stringPtr(node),
+			Conditions: discovery.EndpointConditions{
+				Ready: pointer.BoolPtr(true),
+			},
+			TargetRef: &v1.ObjectReference{Kind: "Pod", Namespace: "default", Name: pod},
+		}
+	}
+	oneEndpoint := epslices.EpsOrSlices{
+		SlicesVal: []discovery.EndpointSlice{{Endpoints: []discovery.Endpoint{endpoint("iris2", "pod1", "2.3.4.5")}}},
+		Type:      epslices.Slices,
+	}
+	// A dual-stack pod has an endpoint in the slices of both families.
+	dualStackEndpoint := epslices.EpsOrSlices{
+		SlicesVal: []discovery.EndpointSlice{
+			{AddressType: discovery.AddressTypeIPv4, Endpoints: []discovery.Endpoint{endpoint("iris2", "pod1", "2.3.4.5")}},
+			{AddressType: discovery.AddressTypeIPv6, Endpoints: []discovery.Endpoint{endpoint("iris2", "pod1", "2000::5")}},
+		},
+		Type: epslices.Slices,
+	}
+	twoEndpoints := epslices.EpsOrSlices{
+		SlicesVal: []discovery.EndpointSlice{{Endpoints: []discovery.Endpoint{endpoint("iris2", "pod1", "2.3.4.5"), endpoint("iris3", "pod2", "2.3.4.6")}}},
+		Type:      epslices.Slices,
+	}
+
+	l := log.NewNopLogger()
+	announcers := func(ip string, eps epslices.EpsOrSlices) []string {
+		svc := &v1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Annotations: map[string]string{annotationSoftNodeAffinity: "true"},
+			},
+			Spec: v1.ServiceSpec{
+				Type:                  "LoadBalancer",
+				ExternalTrafficPolicy: v1.ServiceExternalTrafficPolicyTypeCluster,
+			},
+			Status: statusAssigned(ip),
+		}
+		res := []string{}
+		for node, c := range speakers {
+			if c.protocolHandlers[config.Layer2].ShouldAnnounce(l, "test1", []net.IP{net.ParseIP(ip)}, pool, svc, eps) == "" {
+				res = append(res, node)
+			}
+		}
+		return res
+	}
+
+	elected := map[string]bool{}
+	for i := 1; i < 256; i++ {
+		ip := fmt.Sprintf("10.20.30.%d", i)
+		if got := announcers(ip, oneEndpoint); len(got) != 1 || got[0] != "iris2" {
+			t.Fatalf("ip %s: expected only the node of the endpoint to announce, got %v", ip, got)
+		}
+		if got := announcers(ip, dualStackEndpoint); len(got) != 1 || got[0] != "iris2" {
+			t.Fatalf("ip %s: expected only the node of the dual-stack endpoint to announce, got %v", ip, got)
+		}
+		got := announcers(ip, twoEndpoints)
+		if len(got) != 1 {
+			t.Fatalf("ip %s: expected one node to announce with two endpoints, got %v", ip, got)
+		}
+		elected[got[0]] = true
+	}
+	if len(elected) == 1 {
+		t.Fatalf("with two endpoints, all the IPs were announced by %v", elected)
+	}
+
+	// The speaker of the node of the endpoint is not healthy, the others
+	// fall back to the election.
+	delete(fakeSL.speakers, "iris2")
+	for i := 1; i < 256; i++ {
+		ip := fmt.Sprintf("10.20.30.%d", i)
+		if got := announcers(ip, oneEndpoint); len(got) != 1 || got[0] == "iris2" {
+			t.Fatalf("ip %s: expected one healthy node to announce, got %v", ip, got)
+		}
+	}
+}
@@ -15,6 +15,7 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"io/ioutil"
@@ -22,11 +23,13 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
 	"github.com/prometheus/client_golang/prometheus"
 	"go.universe.tf/metallb/internal/bgp"
+	bgpnative "go.universe.tf/metallb/internal/bgp/native"
 	"go.universe.tf/metallb/internal/config"
 	metallbcfg "go.universe.tf/metallb/internal/config"
 	"go.universe.tf/metallb/internal/k8s"
@@ -39,6 +42,10 @@ import (
 	v1 "k8s.io/api/core/v1"
 )
 
+// annotationIgnore excludes a service from MetalLB, as the controller
+// does.
+const annotationIgnore = "metallb.universe.tf/ignore"
+
 var announcing = prometheus.NewGaugeVec(prometheus.GaugeOpts{
 	Namespace: "metallb",
 	Subsystem: "speaker",
@@ -56,6 +63,15 @@ type service interface {
 	UpdateStatus(svc *v1.Service) error
 	Infof(svc *v1.Service, desc, msg string, args ...interface{})
 	Errorf(svc *v1.Service, desc, msg string, args ...interface{})
+	PeerErrorf(name, desc, msg string, args ...interface{})
+	PodErrorf(name, desc, msg string, args ...interface{})
+	ReprocessServiceAfter(name string, after time.Duration)
+}
+
+// serviceStatus records the services announced by the node.
+type serviceStatus interface {
+	Set(protocol config.Proto, name string, via []string) error
+	Delete(protocol config.Proto, name string) error
 }
 
 func main() {
@@ -69,11 +85,21 @@ func main() {
 		mlLabels          = flag.String("ml-labels", os.Getenv("METALLB_ML_LABELS"), "Labels to match the speakers (for MemberList / fast dead node detection)")
 		mlSecret          = flag.String("ml-secret-key", os.Getenv("METALLB_ML_SECRET_KEY"), "Secret key for MemberList (fast dead node detection)")
 		myNode            = flag.String("node-name", os.Getenv("METALLB_NODE_NAME"), "name of this Kubernetes node (spec.nodeName)")
+		podName           = flag.String("pod-name", os.Getenv("METALLB_POD_NAME"), "name of this speaker pod (metadata.name)")
+		speakerRegistry   = flag.String("speaker-registry", os.Getenv("METALLB_SPEAKER_REGISTRY"), "name of the ConfigMap the speaker registers itself in, disabled if empty")
 		port              = flag.Int("port", 7472, "HTTP listening port")
 		logLevel          = flag.String("log-level", "info", fmt.Sprintf("log level. must be one of: [%s]", logging.Levels.String()))
 		disableEpSlices   = flag.Bool("disable-epslices", false, "Disable the usage of EndpointSlices and default to Endpoints instead of relying on the autodiscovery mechanism")
 		enablePprof       = flag.Bool("enable-pprof", false, "Enable pprof profiling")
 		loadBalancerClass = flag.String("lb-class", "", "load balancer class. When enabled, metallb will handle only services whose spec.loadBalancerClass matches the given lb class")
+		lbClassDefault    = flag.Bool("lb-class-default", false, "when --lb-class is set, also handle the services without a spec.loadBalancerClass, metallb being the default load balancer of the cluster")
+		alarmMinUptime    = flag.Int("bgp-alarm-min-uptime", 0, "raise an alarm when a BGP session goes down after being up for less than this many seconds, disabled if 0")
+		alarmMaxFlaps     = flag.Int("bgp-alarm-max-flaps", 0, "raise an alarm when a BGP session goes down more than this many times in an hour, disabled if 0")
+		alarmMaxLatency   = flag.Duration("bgp-alarm-max-announcement-latency", 0, "raise an alarm when the BGP announcements take longer than this to be sent to a peer, disabled if 0")
+		withdrawUnusable  = flag.Bool("withdraw-from-unusable-node", false, "stop announcing the services while the node is NotReady, cordoned or being deleted")
+		shutdownDelay     = flag.Duration("shutdown-delay", 0, "on shutdown, withdraw all the announcements and wait this long for the withdrawals to propagate before exiting, disabled if 0")
+		eventsInterval    = flag.Duration("events-interval", 0, "emit an event identical to the last one about a service at most once per interval, counting the repeats dropped meanwhile, disabled if 0")
+		serviceStatus     = flag.Bool("enable-service-status", false, "record the services announced by the node in ServiceL2Status and ServiceBGPStatus resources")
 	)
 	flag.Parse()
 
@@ -127,8 +153,16 @@ func main() {
 		MyNode:   *myNode,
 		Logger:   logger,
 		LogLevel: logging.Level(*logLevel),
+		MyPod:    *podName,
 		SList:    sList,
 		bgpType:  bgpImplementation(bgpType),
+
+		WithdrawFromUnusableNode: *withdrawUnusable,
+		SessionAlarms: bgpnative.SessionAlarmPolicy{
+			MinUptimeSeconds:       *alarmMinUptime,
+			MaxFlapCount:           *alarmMaxFlaps,
+			MaxAnnouncementLatency: *alarmMaxLatency,
+		},
 	})
 	if err != nil {
 		level.Error(logger).Log("op", "startup", "error", err, "msg", "failed to create MetalLB controller")
@@ -159,8 +193,11 @@ func main() {
 			ConfigChanged:  ctrl.SetConfig,
 			NodeChanged:    ctrl.SetNode,
 		},
-		ValidateConfig:    validateConfig,
-		LoadBalancerClass: *loadBalancerClass,
+		ValidateConfig:      validateConfig,
+		LoadBalancerClass:   *loadBalancerClass,
+		DefaultLoadBalancer: *lbClassDefault,
+		Ready:               ctrl.ready,
+		EventsInterval:      *eventsInterval,
 	})
 	if err != nil {
 		level.Error(logger).Log("op", "startup", "error", err, "msg", "failed to create k8s client")
@@ -168,36 +205,91 @@ func main() {
 	}
 	ctrl.client = client
 
+	if *serviceStatus {
+		store, err := client.ServiceStatusStore(*namespace, *myNode, *podName)
+		if err != nil {
+			level.Error(logger).Log("op", "startup", "error", err, "msg", "failed to create the service status store")
+			os.Exit(1)
+		}
+		ctrl.status = store
+	}
+
+	if *speakerRegistry != "" {
+		capabilities := []string{"bgp-" + bgpType, string(config.Layer2)}
+		err := client.SpeakerRegistry(*namespace, *speakerRegistry).Register(k8s.Speaker{
+			Node:         *myNode,
+			Pod:          *podName,
+			IP:           *host,
+			Capabilities: capabilities,
+			Registered:   time.Now(),
+		})
+		if err != nil {
+			level.Error(logger).Log("op", "startup", "error", err, "msg", "failed to register in the speaker registry")
+		}
+	}
+
 	sList.Start(client)
-	defer sList.Stop()
 
 	if err := client.Run(stopCh); err != nil {
 		level.Error(logger).Log("op", "startup", "error", err, "msg", "failed to run k8s client")
 		os.Exit(1)
 	}
+
+	if *shutdownDelay > 0 {
+		ctrl.withdrawAll(logger)
+	}
+	// Leaving the memberlist cluster lets the other speakers take over
+	// the layer 2 announcements.
+	sList.Stop()
+	if *shutdownDelay > 0 {
+		level.Info(logger).Log("op", "shutdown", "delay", *shutdownDelay, "msg", "waiting for the withdrawals to propagate")
+		time.Sleep(*shutdownDelay)
+	}
 }
 
 type controller struct {
 	myNode  string
+	myPod   string
 	bgpType bgpImplementation
 
 	config *config.Config
 	client service
+	// Records the services announced by the node, nil if disabled.
+	status serviceStatus
 
 	protocolHandlers map[config.Proto]Protocol
 	announced        map[config.Proto]map[string]bool // for each protocol, says if we are advertising the given service
 	svcIPs           map[string][]net.IP              // service name -> assigned IPs
+	// When the services waiting for the first announcement to settle
+	// can be announced with the other protocols.
+	settling map[string]time.Time
 
 	protocols []config.Proto
+
+	// configured is closed once the first configuration is applied.
+	configured chan struct{}
+
+	sList SpeakerList
+	// If true, the services are withdrawn while the node is unusable.
+	withdrawUnusable bool
+	// Why the node is unusable, empty if it is usable.
+	unusableReason string
 }
 
 type controllerConfig struct {
 	MyNode   string
 	Logger   log.Logger
 	LogLevel logging.Level
+	MyPod    string
 	SList    SpeakerList
 
 	bgpType bgpImplementation
+	// SessionAlarms are the thresholds the BGP sessions are checked
+	// against. Alarms are reported on the MyPod pod.
+	SessionAlarms bgpnative.SessionAlarmPolicy
+	// WithdrawFromUnusableNode stops the announcements while the node
+	// is NotReady, cordoned or being deleted.
+	WithdrawFromUnusableNode bool
 
 	// For testing only, and will be removed in a future release.
 	// See: https://github.com/metallb/metallb/issues/152.
@@ -206,14 +298,15 @@ type controllerConfig struct {
 }
 
 func newController(cfg controllerConfig) (*controller, error) {
+	bgpCtrl := &bgpController{
+		logger:   cfg.Logger,
+		myNode:   cfg.MyNode,
+		svcAds:   make(map[string][]*bgp.Advertisement),
+		svcPools: make(map[string]string),
+		bgpType:  cfg.bgpType,
+	}
 	handlers := map[config.Proto]Protocol{
-		config.BGP: &bgpController{
-			logger:         cfg.Logger,
-			myNode:         cfg.MyNode,
-			svcAds:         make(map[string][]*bgp.Advertisement),
-			bgpType:        cfg.bgpType,
-			sessionManager: newBGP(cfg.bgpType, cfg.Logger, cfg.LogLevel),
-		},
+		config.BGP: bgpCtrl,
 	}
 	protocols := []config.Proto{config.BGP}
 
@@ -232,14 +325,22 @@ func newController(cfg controllerConfig) (*controller, error) {
 
 	ret := &controller{
 		myNode:           cfg.MyNode,
+		myPod:            cfg.MyPod,
 		bgpType:          cfg.bgpType,
 		protocolHandlers: handlers,
 		announced:        map[config.Proto]map[string]bool{},
 		svcIPs:           map[string][]net.IP{},
+		settling:         map[string]time.Time{},
 		protocols:        protocols,
+		configured:       make(chan struct{}),
+		sList:            cfg.SList,
+		withdrawUnusable: cfg.WithdrawFromUnusableNode,
 	}
 	ret.announced[config.BGP] = map[string]bool{}
 	ret.announced[config.Layer2] = map[string]bool{}
+	alarms := cfg.SessionAlarms
+	alarms.Alarm = ret.sessionAlarm
+	bgpCtrl.sessionManager = newBGP(cfg.bgpType, cfg.Logger, cfg.LogLevel, ret.sessionFlapping, alarms)
 
 	return ret, nil
 }
@@ -253,6 +354,10 @@ func (c *controller) SetBalancer(l log.Logger, name string, svc *v1.Service, eps
 		return c.deleteBalancer(l, name, "notLoadBalancer")
 	}
 
+	if svc.Annotations[annotationIgnore] == "true" {
+		return c.deleteBalancer(l, name, "ignored")
+	}
+
 	level.Debug(l).Log("event", "startUpdate", "msg", "start of service update")
 	defer level.Debug(l).Log("event", "endUpdate", "msg", "end of service update")
 
@@ -265,6 +370,10 @@ func (c *controller) SetBalancer(l log.Logger, name string, svc *v1.Service, eps
 		return c.deleteBalancer(l, name, "noIPAllocated")
 	}
 
+	if c.unusableReason != "" {
+		return c.deleteBalancer(l, name, c.unusableReason)
+	}
+
 	lbIPs := []net.IP{}
 	for i := range svc.Status.LoadBalancer.Ingress {
 		lbIP := net.ParseIP(svc.Status.LoadBalancer.Ingress[i].IP)
@@ -296,15 +405,57 @@ func (c *controller) SetBalancer(l log.Logger, name string, svc *v1.Service, eps
 		}
 	}
 
-	for _, protocol := range c.protocols {
+	protocols := c.announcementOrder(pool)
+	for i, protocol := range protocols {
+		if i > 0 {
+			if settled, ok := c.settling[name]; ok {
+				if time.Now().Before(settled) {
+					break
+				}
+				delete(c.settling, name)
+			}
+		}
+		announced := c.announced[protocol][name]
 		if st := c.handleService(l, name, lbIPs, svc, pool, eps, protocol); st == controllers.SyncStateError {
 			return st
 		}
+		// Give the first announcement the time to propagate before making
+		// the second one, only when the service is newly announced. The
+		// service is processed again once the settle time has elapsed.
+		if i == 0 && len(protocols) > 1 && pool.BGPSettleTime > 0 && !announced && c.announced[protocol][name] {
+			level.Debug(l).Log("event", "settling", "protocol", protocol, "settleTime", pool.BGPSettleTime, "msg", "delaying the next announcement")
+			c.settling[name] = time.Now().Add(pool.BGPSettleTime)
+			c.client.ReprocessServiceAfter(name, pool.BGPSettleTime)
+			break
+		}
 	}
 
 	return controllers.SyncStateSuccess
 }
 
+// announcementOrder returns the protocols in the order the IPs of the
+// given pool must be announced.
+func (c *controller) announcementOrder(pool *config.Pool) []config.Proto {
+	var first config.Proto
+	switch pool.AnnouncementOrder {
+	case config.AnnounceBGPFirst:
+		first = config.BGP
+	case config.AnnounceL2First:
+		first = config.Layer2
+	default:
+		return c.protocols
+	}
+	res := []config.Proto{}
+	for _, p := range c.protocols {
+		if p == first {
+			res = append([]config.Proto{p}, res...)
+			continue
+		}
+		res = append(res, p)
+	}
+	return res
+}
+
 func (c *controller) handleService(l log.Logger,
 	name string,
 	lbIPs []net.IP,
@@ -323,6 +474,17 @@ func (c *controller) handleService(l log.Logger,
 		return c.deleteBalancerProtocol(l, protocol, name, deleteReason)
 	}
 
+	// In hybrid mode the service is announced via BGP only from the node
+	// announcing it via L2, so that the next hop the routers learn is the
+	// L2 owner. Both are re-evaluated together when the owner changes.
+	if protocol == config.BGP && pool.Hybrid {
+		if l2Handler := c.protocolHandlers[config.Layer2]; l2Handler != nil {
+			if deleteReason := l2Handler.ShouldAnnounce(l, name, lbIPs, pool, svc, eps); deleteReason != "" {
+				return c.deleteBalancerProtocol(l, protocol, name, deleteReason)
+			}
+		}
+	}
+
 	if err := handler.SetBalancer(l, name, lbIPs, pool); err != nil {
 		level.Error(l).Log("op", "setBalancer", "error", err, "msg", "failed to announce service")
 		return controllers.SyncStateError
@@ -332,6 +494,11 @@ func (c *controller) handleService(l log.Logger,
 		c.announced[protocol][name] = true
 		c.svcIPs[name] = lbIPs
 	}
+	if c.status != nil {
+		if err := c.status.Set(protocol, name, handler.AnnouncedVia(name)); err != nil {
+			level.Error(l).Log("op", "setServiceStatus", "error", err, "msg", "failed to record the announcement of the service")
+		}
+	}
 
 	for _, ip := range lbIPs {
 		announcing.With(prometheus.Labels{
@@ -346,7 +513,19 @@ func (c *controller) handleService(l log.Logger,
 	return controllers.SyncStateSuccess
 }
 
+// withdrawAll stops announcing all the services, for the traffic to
+// move to the other nodes before the speaker exits. It must be called
+// once the k8s client is stopped.
+func (c *controller) withdrawAll(l log.Logger) {
+	for name := range c.svcIPs {
+		if st := c.deleteBalancer(l, name, "shutdown"); st == controllers.SyncStateError {
+			level.Error(l).Log("op", "shutdown", "service", name, "msg", "failed to withdraw the service")
+		}
+	}
+}
+
 func (c *controller) deleteBalancer(l log.Logger, name, reason string) controllers.SyncState {
+	delete(c.settling, name)
 	for _, protocol := range c.protocols {
 		if st := c.deleteBalancerProtocol(l, protocol, name, reason); st == controllers.SyncStateError {
 			return st
@@ -365,6 +544,11 @@ func (c *controller) deleteBalancerProtocol(l log.Logger, protocol config.Proto,
 		level.Error(l).Log("op", "deleteBalancer", "error", err, "msg", "failed to clear balancer state", "protocol", protocol)
 		return controllers.SyncStateError
 	}
+	if c.status != nil {
+		if err := c.status.Delete(protocol, name); err != nil {
+			level.Error(l).Log("op", "deleteServiceStatus", "error", err, "msg", "failed to remove the record of the announcement of the service", "protocol", protocol)
+		}
+	}
 
 	for _, ip := range c.svcIPs[name] {
 		ok := announcing.Delete(prometheus.Labels{
@@ -453,11 +637,25 @@ func (c *controller) SetConfig(l log.Logger, cfg *config.Config) controllers.Syn
 		}
 	}
 
+	if c.config == nil && c.configured != nil {
+		close(c.configured)
+	}
 	c.config = cfg
 
 	return controllers.SyncStateReprocessAll
 }
 
+// ready returns an error until the first configuration is applied,
+// which starts the BGP sessions it configures.
+func (c *controller) ready() error {
+	select {
+	case <-c.configured:
+		return nil
+	default:
+		return errors.New("no configuration applied yet")
+	}
+}
+
 func (c *controller) SetNode(l log.Logger, node *v1.Node) controllers.SyncState {
 	for proto, handler := range c.protocolHandlers {
 		if err := handler.SetNode(l, node); err != nil {
@@ -465,7 +663,40 @@ func (c *controller) SetNode(l log.Logger, node *v1.Node) controllers.SyncState
 			return controllers.SyncStateError
 		}
 	}
-	return controllers.SyncStateSuccess
+	if !c.withdrawUnusable {
+		return controllers.SyncStateSuccess
+	}
+	reason := nodeUnusableReason(node)
+	if reason == c.unusableReason {
+		return controllers.SyncStateSuccess
+	}
+	c.unusableReason = reason
+	if c.sList != nil {
+		c.sList.SetUsable(reason == "")
+	}
+	if reason != "" {
+		level.Info(l).Log("event", "nodeUnusable", "reason", reason, "msg", "node unusable, withdrawing all the services")
+	} else {
+		level.Info(l).Log("event", "nodeUsable", "msg", "node usable again, announcing the services")
+	}
+	return controllers.SyncStateReprocessAll
+}
+
+// nodeUnusableReason returns why the services must not be announced
+// from the node, empty if they can.
+func nodeUnusableReason(node *v1.Node) string {
+	if node.DeletionTimestamp != nil {
+		return "nodeDeleting"
+	}
+	if node.Spec.Unschedulable {
+		return "nodeCordoned"
+	}
+	for _, c := range node.Status.Conditions {
+		if c.Type == v1.NodeReady && c.Status != v1.ConditionTrue {
+			return "nodeNotReady"
+		}
+	}
+	return ""
 }
 
 // A Protocol can advertise an IP address.
@@ -475,10 +706,14 @@ type Protocol interface {
 	SetBalancer(log.Logger, string, []net.IP, *config.Pool) error
 	DeleteBalancer(log.Logger, string, string) error
 	SetNode(log.Logger, *v1.Node) error
+	// AnnouncedVia returns the interfaces or the peers the service with
+	// the given name is announced through.
+	AnnouncedVia(string) []string
 }
 
 // Speakerlist represents a list of healthy speakers.
 type SpeakerList interface {
 	UsableSpeakers() map[string]bool
 	Rejoin()
+	SetUsable(bool)
 }
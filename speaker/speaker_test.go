@@ -4,7 +4,9 @@ package main
 
 import (
 	"net"
+	"reflect"
 	"testing"
+	"time"
 
 	"github.com/go-kit/log"
 	"go.universe.tf/metallb/internal/config"
@@ -26,14 +28,42 @@ func NewController(l2Handler *MockProtocol, bgpHandler *MockProtocol, t *testing
 		},
 		announced: map[config.Proto]map[string]bool{},
 		svcIPs:    map[string][]net.IP{},
+		settling:  map[string]time.Time{},
 		protocols: config.Protocols,
 		client:    &testK8S{t: t},
+
+		configured: make(chan struct{}),
 	}
 	ret.announced[config.BGP] = map[string]bool{}
 	ret.announced[config.Layer2] = map[string]bool{}
 	return ret
 }
 
+func TestReady(t *testing.T) {
+	c := NewController(&MockProtocol{protocol: config.Layer2}, &MockProtocol{protocol: config.BGP}, t)
+	if err := c.ready(); err == nil {
+		t.Fatalf("expected the speaker not to be ready before the configuration")
+	}
+
+	if state := c.SetConfig(logger, nil); state != controllers.SyncStateErrorNoRetry {
+		t.Fatalf("expected the missing configuration to be rejected, got %d", state)
+	}
+	if err := c.ready(); err == nil {
+		t.Fatalf("expected the speaker not to be ready without a configuration")
+	}
+
+	if state := c.SetConfig(logger, &config.Config{}); state != controllers.SyncStateReprocessAll {
+		t.Fatalf("Set config failed")
+	}
+	if err := c.ready(); err != nil {
+		t.Fatalf("expected the speaker to be ready, got %s", err)
+	}
+	// Applying a configuration again doesn't close the channel twice.
+	if state := c.SetConfig(logger, &config.Config{}); state != controllers.SyncStateReprocessAll {
+		t.Fatalf("Set config failed")
+	}
+}
+
 func TestLoadBalancerCreation(t *testing.T) {
 	var l2MockHandler = &MockProtocol{
 		protocol:       config.Layer2,
@@ -159,12 +189,451 @@ func TestLoadBalancerCreation(t *testing.T) {
 	}
 }
 
+func TestWithdrawAll(t *testing.T) {
+	l2MockHandler := &MockProtocol{protocol: config.Layer2, shouldAnnounce: true}
+	bgpMockHandler := &MockProtocol{protocol: config.BGP, shouldAnnounce: true}
+	c := NewController(l2MockHandler, bgpMockHandler, t)
+
+	cfg := &config.Config{
+		Pools: map[string]*config.Pool{
+			"default": {
+				CIDR: []*net.IPNet{ipnet("10.20.30.0/24")},
+			},
+		},
+	}
+	if state := c.SetConfig(logger, cfg); state != controllers.SyncStateReprocessAll {
+		t.Fatalf("Set config failed")
+	}
+	for _, name := range []string{"testsvc1", "testsvc2"} {
+		svc := &v1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: name,
+			},
+			Spec: v1.ServiceSpec{
+				Type:                  "LoadBalancer",
+				ExternalTrafficPolicy: "Cluster",
+			},
+			Status: statusAssigned("10.20.30.1"),
+		}
+		if state := c.SetBalancer(logger, name, svc, epslices.EpsOrSlices{}); state != controllers.SyncStateSuccess {
+			t.Fatalf("Set balancer failed")
+		}
+	}
+
+	c.withdrawAll(logger)
+	if !l2MockHandler.deleteBalancerCalled || !bgpMockHandler.deleteBalancerCalled {
+		t.Fatal("services not withdrawn from both protocols")
+	}
+	if len(c.svcIPs) != 0 {
+		t.Fatalf("expected no service left, got %v", c.svcIPs)
+	}
+	for _, proto := range config.Protocols {
+		if len(c.announced[proto]) != 0 {
+			t.Fatalf("expected no service announced in %s, got %v", proto, c.announced[proto])
+		}
+	}
+}
+
+// fakeServiceStatus records the announcements, indexed by protocol
+// and service.
+type fakeServiceStatus map[string][]string
+
+func (f fakeServiceStatus) Set(protocol config.Proto, name string, via []string) error {
+	f[string(protocol)+" "+name] = via
+	return nil
+}
+
+func (f fakeServiceStatus) Delete(protocol config.Proto, name string) error {
+	delete(f, string(protocol)+" "+name)
+	return nil
+}
+
+func TestServiceStatus(t *testing.T) {
+	l2MockHandler := &MockProtocol{protocol: config.Layer2, shouldAnnounce: true, announcedVia: []string{"eth0"}}
+	bgpMockHandler := &MockProtocol{protocol: config.BGP, shouldAnnounce: true, announcedVia: []string{"peer1", "peer2"}}
+	c := NewController(l2MockHandler, bgpMockHandler, t)
+	status := fakeServiceStatus{}
+	c.status = status
+
+	cfg := &config.Config{
+		Pools: map[string]*config.Pool{
+			"default": {
+				CIDR: []*net.IPNet{ipnet("10.20.30.0/24")},
+			},
+		},
+	}
+	if state := c.SetConfig(logger, cfg); state != controllers.SyncStateReprocessAll {
+		t.Fatalf("Set config failed")
+	}
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "testsvc",
+		},
+		Spec: v1.ServiceSpec{
+			Type:                  "LoadBalancer",
+			ExternalTrafficPolicy: "Cluster",
+		},
+		Status: statusAssigned("10.20.30.1"),
+	}
+	if state := c.SetBalancer(logger, "default/testsvc", svc, epslices.EpsOrSlices{}); state != controllers.SyncStateSuccess {
+		t.Fatalf("Set balancer failed")
+	}
+	want := fakeServiceStatus{
+		"layer2 default/testsvc": {"eth0"},
+		"bgp default/testsvc":    {"peer1", "peer2"},
+	}
+	if !reflect.DeepEqual(status, want) {
+		t.Fatalf("expected status %v, got %v", want, status)
+	}
+
+	if state := c.SetBalancer(logger, "default/testsvc", nil, epslices.EpsOrSlices{}); state != controllers.SyncStateSuccess {
+		t.Fatalf("Delete balancer failed")
+	}
+	if len(status) != 0 {
+		t.Fatalf("expected the status to be removed, got %v", status)
+	}
+}
+
+func TestIgnoredService(t *testing.T) {
+	l2MockHandler := &MockProtocol{protocol: config.Layer2, shouldAnnounce: true}
+	bgpMockHandler := &MockProtocol{protocol: config.BGP, shouldAnnounce: true}
+	c := NewController(l2MockHandler, bgpMockHandler, t)
+
+	cfg := &config.Config{
+		Pools: map[string]*config.Pool{
+			"default": {
+				CIDR: []*net.IPNet{ipnet("10.20.30.0/24")},
+			},
+		},
+	}
+	if state := c.SetConfig(logger, cfg); state != controllers.SyncStateReprocessAll {
+		t.Fatalf("Set config failed")
+	}
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "testsvc",
+		},
+		Spec: v1.ServiceSpec{
+			Type:                  "LoadBalancer",
+			ExternalTrafficPolicy: "Cluster",
+		},
+		Status: statusAssigned("10.20.30.1"),
+	}
+	if state := c.SetBalancer(logger, "testsvc", svc, epslices.EpsOrSlices{}); state != controllers.SyncStateSuccess {
+		t.Fatalf("Set balancer failed")
+	}
+
+	svc.Annotations = map[string]string{annotationIgnore: "true"}
+	if state := c.SetBalancer(logger, "testsvc", svc, epslices.EpsOrSlices{}); state != controllers.SyncStateSuccess {
+		t.Fatalf("Set balancer of the ignored service failed")
+	}
+	for _, proto := range config.Protocols {
+		if c.announced[proto]["testsvc"] {
+			t.Fatalf("the ignored service is still announced in %s", proto)
+		}
+	}
+	if !l2MockHandler.deleteBalancerCalled || !bgpMockHandler.deleteBalancerCalled {
+		t.Fatal("the announcements of the ignored service were not withdrawn")
+	}
+}
+
+func TestWithdrawFromUnusableNode(t *testing.T) {
+	l2MockHandler := &MockProtocol{protocol: config.Layer2, shouldAnnounce: true}
+	bgpMockHandler := &MockProtocol{protocol: config.BGP, shouldAnnounce: true}
+	c := NewController(l2MockHandler, bgpMockHandler, t)
+	c.withdrawUnusable = true
+
+	cfg := &config.Config{
+		Pools: map[string]*config.Pool{
+			"default": {
+				CIDR: []*net.IPNet{ipnet("10.20.30.0/24")},
+			},
+		},
+	}
+	if state := c.SetConfig(logger, cfg); state != controllers.SyncStateReprocessAll {
+		t.Fatalf("Set config failed")
+	}
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "testsvc",
+		},
+		Spec: v1.ServiceSpec{
+			Type:                  "LoadBalancer",
+			ExternalTrafficPolicy: "Cluster",
+		},
+		Status: statusAssigned("10.20.30.1"),
+	}
+	ready := func(status v1.ConditionStatus) []v1.NodeCondition {
+		return []v1.NodeCondition{{Type: v1.NodeReady, Status: status}}
+	}
+
+	tests := []struct {
+		desc         string
+		node         *v1.Node
+		wantState    controllers.SyncState
+		wantAnnounce bool
+	}{
+		{
+			desc:         "ready node",
+			node:         &v1.Node{Status: v1.NodeStatus{Conditions: ready(v1.ConditionTrue)}},
+			wantState:    controllers.SyncStateSuccess,
+			wantAnnounce: true,
+		},
+		{
+			desc:         "not ready node",
+			node:         &v1.Node{Status: v1.NodeStatus{Conditions: ready(v1.ConditionUnknown)}},
+			wantState:    controllers.SyncStateReprocessAll,
+			wantAnnounce: false,
+		},
+		{
+			desc:         "ready again",
+			node:         &v1.Node{Status: v1.NodeStatus{Conditions: ready(v1.ConditionTrue)}},
+			wantState:    controllers.SyncStateReprocessAll,
+			wantAnnounce: true,
+		},
+		{
+			desc: "cordoned node",
+			node: &v1.Node{
+				Spec:   v1.NodeSpec{Unschedulable: true},
+				Status: v1.NodeStatus{Conditions: ready(v1.ConditionTrue)},
+			},
+			wantState:    controllers.SyncStateReprocessAll,
+			wantAnnounce: false,
+		},
+		{
+			desc: "deleted node",
+			node: &v1.Node{
+				ObjectMeta: metav1.ObjectMeta{DeletionTimestamp: &metav1.Time{Time: time.Now()}},
+				Status:     v1.NodeStatus{Conditions: ready(v1.ConditionTrue)},
+			},
+			wantState:    controllers.SyncStateReprocessAll,
+			wantAnnounce: false,
+		},
+	}
+
+	for _, test := range tests {
+		if state := c.SetNode(logger, test.node); state != test.wantState {
+			t.Fatalf("%s: expected state %d, got %d", test.desc, test.wantState, state)
+		}
+		if state := c.SetBalancer(logger, "testsvc", svc, epslices.EpsOrSlices{}); state != controllers.SyncStateSuccess {
+			t.Fatalf("%s: Set balancer failed", test.desc)
+		}
+		for _, proto := range config.Protocols {
+			if c.announced[proto]["testsvc"] != test.wantAnnounce {
+				t.Fatalf("%s: expected announced %v in %s, got %v", test.desc, test.wantAnnounce, proto, c.announced[proto]["testsvc"])
+			}
+		}
+	}
+}
+
+func TestHybridPool(t *testing.T) {
+	var l2MockHandler = &MockProtocol{
+		protocol:       config.Layer2,
+		shouldAnnounce: false,
+	}
+
+	var bgpMockHandler = &MockProtocol{
+		protocol:       config.BGP,
+		shouldAnnounce: true,
+	}
+	c := NewController(l2MockHandler, bgpMockHandler, t)
+
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "testsvc",
+		},
+		Spec: v1.ServiceSpec{
+			Type:                  "LoadBalancer",
+			ExternalTrafficPolicy: "Cluster",
+		},
+		Status: statusAssigned("10.20.30.1"),
+	}
+
+	cfg := &config.Config{
+		Pools: map[string]*config.Pool{
+			"default": {
+				CIDR:   []*net.IPNet{ipnet("10.20.30.0/24")},
+				Hybrid: true,
+			},
+		},
+	}
+
+	state := c.SetConfig(logger, cfg)
+	if state != controllers.SyncStateReprocessAll {
+		t.Fatalf("Set config failed")
+	}
+
+	// another node owns the ip via l2, bgp must not announce it
+	state = c.SetBalancer(logger,
+		"testsvc",
+		svc,
+		epslices.EpsOrSlices{})
+	if state != controllers.SyncStateSuccess {
+		t.Fatalf("Set balancer failed")
+	}
+	if bgpMockHandler.setBalancerCalled {
+		t.Fatal("not l2 owner, bgp handler was called")
+	}
+	if c.announced[config.BGP]["testsvc"] {
+		t.Fatal("not l2 owner, ip is announced in bgp")
+	}
+
+	l2MockHandler.reset()
+	bgpMockHandler.reset()
+	l2MockHandler.shouldAnnounce = true
+
+	// this node became the l2 owner, both protocols announce the ip
+	state = c.SetBalancer(logger,
+		"testsvc",
+		svc,
+		epslices.EpsOrSlices{})
+	if state != controllers.SyncStateSuccess {
+		t.Fatalf("Set balancer failed")
+	}
+	if !l2MockHandler.setBalancerCalled {
+		t.Fatal("l2 owner, l2 handler was not called")
+	}
+	if !bgpMockHandler.setBalancerCalled {
+		t.Fatal("l2 owner, bgp handler was not called")
+	}
+
+	l2MockHandler.reset()
+	bgpMockHandler.reset()
+	l2MockHandler.shouldAnnounce = false
+
+	// the l2 owner moved to another node, bgp withdraws the ip too
+	state = c.SetBalancer(logger,
+		"testsvc",
+		svc,
+		epslices.EpsOrSlices{})
+	if state != controllers.SyncStateSuccess {
+		t.Fatalf("Set balancer failed")
+	}
+	if !bgpMockHandler.deleteBalancerCalled {
+		t.Fatal("l2 owner moved, bgp delete handler was not called")
+	}
+	if c.announced[config.BGP]["testsvc"] || c.announced[config.Layer2]["testsvc"] {
+		t.Fatal("l2 owner moved, ip is still announced")
+	}
+}
+
+func TestAnnouncementOrder(t *testing.T) {
+	settle := 50 * time.Millisecond
+	tests := []struct {
+		desc   string
+		order  string
+		first  config.Proto
+		second config.Proto
+	}{
+		{
+			desc:   "bgp first",
+			order:  config.AnnounceBGPFirst,
+			first:  config.BGP,
+			second: config.Layer2,
+		},
+		{
+			desc:   "l2 first",
+			order:  config.AnnounceL2First,
+			first:  config.Layer2,
+			second: config.BGP,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			handlers := map[config.Proto]*MockProtocol{
+				config.Layer2: {protocol: config.Layer2, shouldAnnounce: true},
+				config.BGP:    {protocol: config.BGP, shouldAnnounce: true},
+			}
+			c := NewController(handlers[config.Layer2], handlers[config.BGP], t)
+
+			svc := &v1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "testsvc",
+				},
+				Spec: v1.ServiceSpec{
+					Type:                  "LoadBalancer",
+					ExternalTrafficPolicy: "Cluster",
+				},
+				Status: statusAssigned("10.20.30.1"),
+			}
+
+			cfg := &config.Config{
+				Pools: map[string]*config.Pool{
+					"default": {
+						CIDR:              []*net.IPNet{ipnet("10.20.30.0/24")},
+						Hybrid:            true,
+						AnnouncementOrder: test.order,
+						BGPSettleTime:     settle,
+					},
+				},
+			}
+			if state := c.SetConfig(logger, cfg); state != controllers.SyncStateReprocessAll {
+				t.Fatalf("Set config failed")
+			}
+
+			k8s := c.client.(*testK8S)
+			start := time.Now()
+			if state := c.SetBalancer(logger, "testsvc", svc, epslices.EpsOrSlices{}); state != controllers.SyncStateSuccess {
+				t.Fatalf("Set balancer failed")
+			}
+			if elapsed := time.Since(start); elapsed >= settle {
+				t.Fatalf("announcing the service blocked for %s", elapsed)
+			}
+			first, second := handlers[test.first], handlers[test.second]
+			if !first.setBalancerCalled {
+				t.Fatalf("the service was not announced with %s", test.first)
+			}
+			if second.setBalancerCalled {
+				t.Fatalf("the service was announced with %s before the settle time", test.second)
+			}
+			if after := k8s.reprocessed["testsvc"]; after != settle {
+				t.Fatalf("the service is reprocessed after %s, expected %s", after, settle)
+			}
+
+			// Processing the service again before the settle time doesn't
+			// make the second announcement.
+			if state := c.SetBalancer(logger, "testsvc", svc, epslices.EpsOrSlices{}); state != controllers.SyncStateSuccess {
+				t.Fatalf("Set balancer failed")
+			}
+			if second.setBalancerCalled {
+				t.Fatalf("the service was announced with %s before the settle time", test.second)
+			}
+
+			time.Sleep(settle)
+			if state := c.SetBalancer(logger, "testsvc", svc, epslices.EpsOrSlices{}); state != controllers.SyncStateSuccess {
+				t.Fatalf("Set balancer failed")
+			}
+			if !second.setBalancerCalled {
+				t.Fatalf("the service was not announced with %s after the settle time", test.second)
+			}
+
+			// An already announced service is refreshed with both protocols
+			// at once.
+			first.reset()
+			second.reset()
+			delete(k8s.reprocessed, "testsvc")
+			if state := c.SetBalancer(logger, "testsvc", svc, epslices.EpsOrSlices{}); state != controllers.SyncStateSuccess {
+				t.Fatalf("Set balancer failed")
+			}
+			if !first.setBalancerCalled || !second.setBalancerCalled {
+				t.Fatal("the service was not refreshed with both protocols")
+			}
+			if _, ok := k8s.reprocessed["testsvc"]; ok {
+				t.Fatal("the refreshed service was reprocessed")
+			}
+		})
+	}
+}
+
 type MockProtocol struct {
 	config               *config.Config
 	protocol             config.Proto
 	shouldAnnounce       bool
 	setBalancerCalled    bool
 	deleteBalancerCalled bool
+	announcedVia         []string
 }
 
 func (m *MockProtocol) SetConfig(l log.Logger, c *config.Config) error {
@@ -190,7 +659,11 @@ func (m *MockProtocol) DeleteBalancer(_ log.Logger, _ string, _ string) error {
 }
 
 func (m *MockProtocol) SetNode(_ log.Logger, _ *v1.Node) error {
-	panic("not implemented") // TODO: Implement
+	return nil
+}
+
+func (m *MockProtocol) AnnouncedVia(_ string) []string {
+	return m.announcedVia
 }
 
 func (m *MockProtocol) reset() {
@@ -18,7 +18,8 @@ from invoke.exceptions import Exit, UnexpectedExit
 all_binaries = set(["controller",
                     "speaker",
                     "mirror-server",
-                    "configmaptocrs"])
+                    "configmaptocrs",
+                    "consistency-check"])
 all_architectures = set(["amd64",
                          "arm",
                          "arm64",